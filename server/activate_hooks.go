@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"io"
+
 	"github.com/pkg/errors"
 )
 
@@ -9,13 +12,90 @@ import (
 // This demo implementation logs a message to the demo channel whenever the plugin is activated.
 // It also creates a demo bot account
 func (p *Plugin) OnActivate() error {
+	p.providerCtx, p.cancelProviders = context.WithCancel(context.Background())
+
+	if err := p.openStore(); err != nil {
+		return errors.Wrap(err, "failed to open store")
+	}
+
 	if err := p.IsValid(); err != nil {
-		return err
+		// Stay active so the configuration gate can guide users and admins instead of
+		// leaving the slash commands unregistered.
+		p.API.LogWarn("Autotranslate plugin is not configured", "err", err.Error())
 	}
 
 	if err := p.registerCommands(); err != nil {
 		return errors.Wrap(err, "failed to register commands")
 	}
 
+	if err := p.ensureBot(); err != nil {
+		return err
+	}
+
+	p.providerScorer = newProviderScorer()
+
+	p.usageTracker = newUsageTracker(p)
+	p.usageTracker.start()
+
+	p.wsBatcher = newWSBatcher(p)
+	p.wsBatcher.start()
+
+	p.queue = newTranslationQueue(p)
+	p.queue.start()
+
+	p.dataCleaner = newDataCleaner(p)
+	p.dataCleaner.start()
+
+	p.channelClassifier = newChannelClassifier(p)
+	p.channelClassifier.start()
+
+	p.transcriptJobs = newTranscriptJobPoller(p)
+	p.transcriptJobs.start()
+
+	go p.safely("self-check", p.logSelfCheck)
+
+	return nil
+}
+
+// OnDeactivate is invoked when the plugin is deactivated. Running provider calls are aborted,
+// queued translations are reported as failed to the users waiting for them, and pending
+// WebSocket events and usage counts are flushed before the store is closed.
+func (p *Plugin) OnDeactivate() error {
+	if p.cancelProviders != nil {
+		p.cancelProviders()
+	}
+
+	if p.dataCleaner != nil {
+		p.dataCleaner.close()
+	}
+
+	if p.channelClassifier != nil {
+		p.channelClassifier.close()
+	}
+
+	if p.transcriptJobs != nil {
+		p.transcriptJobs.close()
+	}
+
+	if p.queue != nil {
+		p.queue.close()
+	}
+
+	if p.wsBatcher != nil {
+		p.wsBatcher.close()
+	}
+
+	if p.usageTracker != nil {
+		p.usageTracker.close()
+	}
+
+	p.removeAppendedTranslations()
+
+	if closer, ok := p.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			p.API.LogWarn("Failed to close store", "err", err.Error())
+		}
+	}
+
 	return nil
 }
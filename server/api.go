@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mattermost/mattermost-server/v5/plugin"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/translate"
 	"github.com/mattermost/mattermost-server/v5/model"
 )
 
@@ -20,6 +18,9 @@ type APIErrorResponse struct {
 	ID         string `json:"id"`
 	Message    string `json:"message"`
 	StatusCode int    `json:"status_code"`
+
+	// RetryAfter is the number of seconds to wait before retrying a throttled request.
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 func writeAPIError(w http.ResponseWriter, err *APIErrorResponse) {
@@ -29,8 +30,13 @@ func writeAPIError(w http.ResponseWriter, err *APIErrorResponse) {
 }
 
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	defer p.recoverPanic("ServeHTTP "+r.URL.Path, func(interface{}) {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	})
+
 	if err := p.IsValid(); err != nil {
 		http.Error(w, "This plugin is not configured.", http.StatusNotImplemented)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -38,38 +44,159 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 	switch path := r.URL.Path; path {
 	case "/api/go":
 		p.getGo(w, r)
+	case "/api/detect":
+		p.detectPost(w, r)
+	case "/api/history":
+		p.handleTranslationHistory(w, r)
 	case "/api/get_info":
 		p.getInfo(w, r)
 	case "/api/set_info":
 		p.setInfo(w, r)
+	case "/api/dm_translation":
+		p.dmTranslation(w, r)
+	case "/api/search":
+		p.searchAndTranslate(w, r)
+	case "/api/saved_digest":
+		p.savedDigest(w, r)
+	case "/api/reaction":
+		p.reactionTranslate(w, r)
+	case "/api/playbooks/status_updates":
+		p.translatePlaybookStatusUpdates(w, r)
+	case "/api/boards/card":
+		p.translateBoardCard(w, r)
+	case "/api/review":
+		p.handleReview(w, r)
+	case "/api/review/correct":
+		p.handleReviewCorrection(w, r)
+	case "/api/onboarding":
+		p.handleOnboarding(w, r)
+	case "/api/glossary":
+		p.handleGlossary(w, r)
+	case "/api/official_language":
+		p.translateIntoOfficialLanguage(w, r)
+	case "/api/usage/me":
+		p.getMyUsage(w, r)
+	case "/api/privacy":
+		p.getPrivacy(w, r)
+	case "/api/feedback":
+		p.postFeedback(w, r)
+	case "/api/admin/providers":
+		p.getProviderReports(w, r)
+	case "/api/admin/resume":
+		p.resumeAutoTranslation(w, r)
+	case "/api/admin/watchdog_resume":
+		p.resumeAfterWatchdog(w, r)
+	case "/api/admin/benchmark":
+		p.postBenchmark(w, r)
+	case "/api/admin/bulk":
+		p.handleBulkJob(w, r)
+	case "/api/admin/kv":
+		p.handleKVMigration(w, r)
+	case "/api/admin/audit":
+		p.getSettingsAuditLog(w, r)
+	case "/api/admin/usage.csv":
+		p.exportUsageCSV(w, r)
+	case "/api/admin/audit.csv":
+		p.exportAuditCSV(w, r)
+	case "/api/admin/zero_retention.csv":
+		p.exportZeroRetentionCSV(w, r)
+	case "/api/admin/glossary_conflicts":
+		p.getGlossaryConflicts(w, r)
+	case "/api/admin/term_suggestion":
+		p.handleTermSuggestion(w, r)
+	case "/api/admin/term_suggestion/submit":
+		p.handleTermSuggestionSubmission(w, r)
+	case "/api/admin/reaction_languages":
+		p.handleReactionLanguages(w, r)
+	case "/api/admin/simulate":
+		p.handleSimulation(w, r)
+	case "/api/admin/pair_stats":
+		p.getPairStats(w, r)
+	case "/api/admin/rollout":
+		p.getRolloutStats(w, r)
+	case "/api/admin/channel_classes":
+		p.handleChannelClassifications(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func (p *Plugin) translateText(text, sourceLang, targetLang string) (string, *model.AppError) {
-	configuration := p.getConfiguration()
-	sess := session.Must(session.NewSession())
-	creds := credentials.NewStaticCredentials(configuration.AWSAccessKeyID, configuration.AWSSecretAccessKey, "")
-	_, awsErr := creds.Get()
-	if awsErr != nil {
-		return "", model.NewAppError("translateText", "BadCredentials", nil, "Invalid AWS credentials", http.StatusForbidden)
+// translateWithProviders translates text with the best ranked provider for the language pair,
+// falling back to the next provider when one fails. The preferred provider, if any, is tried
+// first unless the language pair is pinned to another provider. The conversation, if any, is
+// given to the providers able to use it.
+func (p *Plugin) translateWithProviders(requestID, preferredProvider, text, sourceLang, targetLang string, conversation []string) (string, string, *model.AppError) {
+	if !p.getConfiguration().getAllowedPairs().allows(sourceLang, targetLang) {
+		return "", "", pairNotAllowedAppError(requestID, sourceLang, targetLang)
 	}
 
-	svc := translate.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(configuration.AWSRegion))
+	if language := p.blockedLanguage(text, sourceLang); language != "" {
+		return "", "", languageBlockedAppError(requestID, language)
+	}
 
-	input := translate.TextInput{
-		SourceLanguageCode: &sourceLang,
-		TargetLanguageCode: &targetLang,
-		Text:               &text,
+	providers := p.rankProviders(requestID, preferredProvider, sourceLang, targetLang)
+	if len(providers) == 0 {
+		return "", "", model.NewAppError("translateText", "NoProvider", nil, "No translation provider configured, request_id="+requestID, http.StatusNotImplemented)
 	}
 
-	output, awsErr := svc.Text(&input)
-	if awsErr != nil {
-		return "", model.NewAppError("translateText", "TranslationFailed", nil, "Translation API error", http.StatusInternalServerError)
+	pipeline := p.getConfiguration().getProcessingPipeline()
+	state := newProcessingState(sourceLang, targetLang)
+	state.glossary = p.getRequestGlossary(requestID, sourceLang, targetLang)
+	processedText := pipeline.before(text, state)
+
+	partial := p.getPartialListener(requestID, text)
+	domain := p.getRequestDomain(requestID)
+
+	// The error of the best ranked provider that failed for a known reason is reported.
+	failure := appErrorTranslationFailed
+	pair := languagePair(sourceLang, targetLang)
+	for _, provider := range providers {
+		// Providers that throttled are left alone for as long as they asked.
+		if p.providerThrottledFor(provider.Name()) > 0 {
+			if failure == appErrorTranslationFailed {
+				failure = appErrorThrottled
+			}
+			continue
+		}
+
+		if specialized, ok := provider.(domainProvider); ok && domain != "" {
+			specialized.SetDomain(domain)
+		}
+
+		start := time.Now()
+		var translated string
+		var err error
+		if streaming, ok := provider.(streamingProvider); ok && partial != nil {
+			translated, err = streaming.TranslateStream(requestID, processedText, sourceLang, targetLang, conversation, func(text string) {
+				partial(pipeline.after(text, state))
+			})
+		} else if conversational, ok := provider.(conversationalProvider); ok && len(conversation) > 0 {
+			translated, err = conversational.TranslateInConversation(requestID, processedText, sourceLang, targetLang, conversation)
+		} else {
+			translated, err = provider.Translate(requestID, processedText, sourceLang, targetLang)
+		}
+		latency := time.Since(start)
+		p.providerScorer.record(provider.Name(), pair, latency, err != nil)
+		p.pairStats.recordCall(pair, latency, err != nil)
+		if err == nil {
+			if p.usageTracker != nil {
+				p.usageTracker.add(utf8.RuneCountInString(text))
+			}
+			p.logZeroRetention(requestID, provider, "translation")
+			return pipeline.after(translated, state), provider.Name(), nil
+		}
+
+		p.API.LogError("Translation API error", "request_id", requestID, "provider", provider.Name(), "source", sourceLang, "target", targetLang, "err", err.Error())
+		id := providerErrorID(err)
+		if id == appErrorThrottled {
+			p.throttleProvider(provider.Name(), throttleDelay(err))
+		}
+		if failure == appErrorTranslationFailed {
+			failure = id
+		}
 	}
 
-	return *output.TranslatedText, nil
+	return "", "", model.NewAppError("translateText", failure, nil, "Translation API error, request_id="+requestID, translationErrorStatus(failure))
 }
 
 func (p *Plugin) getGo(w http.ResponseWriter, r *http.Request) {
@@ -79,44 +206,196 @@ func (p *Plugin) getGo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
 	postID := r.URL.Query().Get("post_id")
 	source := r.URL.Query().Get("source")
 	target := r.URL.Query().Get("target")
 
 	post, err := p.API.GetPost(postID)
 	if err != nil {
-		http.Error(w, "No post to translate", http.StatusBadRequest)
+		httpErrorWithRequestID(w, requestID, "No post to translate", http.StatusBadRequest)
 		return
 	}
 
-	// 🔹 言語が "auto" の場合は自動検出
-	if source == "auto" {
-		detected, err := p.detectLanguage(post.Message)
+	userInfo, _ := p.getUserInfo(userID)
+	if r.URL.Query().Get("async") == "true" {
+		// The job translates from the resolved language, so that its idempotency key is the one
+		// of the same translation requested synchronously.
+		source, _, apiErr := p.resolvePostSource(requestID, post, source)
+		if apiErr != nil {
+			writeAPIErrorWithRequestID(w, requestID, apiErr)
+			return
+		}
+
+		job, err := p.queue.submit(&translationJob{
+			RequestID:      requestID,
+			UserID:         userID,
+			PostID:         postID,
+			SourceLanguage: source,
+			TargetLanguage: target,
+			Provider:       p.preferredProvider(userInfo),
+			Priority:       jobPriorityInteractive,
+			IdempotencyKey: translationIdempotencyKey(postID, languagePair(source, target), post.UpdateAt),
+		})
+		if err == errQueueFull {
+			writeAPIErrorWithRequestID(w, requestID, &APIErrorResponse{ID: apiErrorQueueFull, Message: "Too many translations are waiting, try again later", StatusCode: http.StatusServiceUnavailable, RetryAfter: queueFullRetryAfter})
+			return
+		}
 		if err != nil {
-			http.Error(w, "Language detection failed", http.StatusBadRequest)
+			p.API.LogError("Failed to queue translation", "request_id", requestID, "err", err.Error())
+			httpErrorWithRequestID(w, requestID, "Failed to queue translation", http.StatusInternalServerError)
 			return
 		}
-		source = detected
+
+		// A repeated request is answered with the ID of the queued one, whose events it waits for.
+		w.WriteHeader(http.StatusAccepted)
+		resp, _ := json.Marshal(map[string]string{"request_id": job.RequestID, "post_id": postID})
+		w.Write(resp)
+		return
 	}
 
-	translatedText, err := p.translateText(post.Message, source, target)
-	if err != nil {
-		http.Error(w, "Translation failed", http.StatusBadRequest)
+	defer p.streamTranslation(requestID, userID, postID, target)()
+
+	translated, apiErr := p.translatePost(requestID, userID, p.preferredProvider(userInfo), post, source, target)
+	if apiErr != nil {
+		writeAPIErrorWithRequestID(w, requestID, apiErr)
 		return
 	}
 
-	translated := TranslatedMessage{
-		ID:             postID + source + target + strconv.FormatInt(post.UpdateAt, 10),
-		PostID:         postID,
+	// An explicit source language is a hint about how this sender writes.
+	p.rememberSenderLanguage(requestID, userID, post, source)
+
+	p.personalizeTranslation(requestID, userInfo, post, translated)
+	p.translatePermalinkPreviews(requestID, userID, p.preferredProvider(userInfo), post, translated)
+	p.addThreadContext(requestID, userID, p.preferredProvider(userInfo), post, translated)
+
+	resp, _ := json.Marshal(translated)
+	w.Write(resp)
+}
+
+// resolvePostSource returns the source language to translate the post from, detecting it when it
+// is "auto", along with the confidence of the detection.
+func (p *Plugin) resolvePostSource(requestID string, post *model.Post, source string) (string, float64, *APIErrorResponse) {
+	if source != autoLanguage {
+		return source, 0, nil
+	}
+
+	detected, err := p.getPostLanguage(requestID, post)
+	if err != nil {
+		return "", 0, &APIErrorResponse{ID: "detection_failed", Message: "Language detection failed", StatusCode: http.StatusBadRequest}
+	}
+
+	return detected.Language, detected.Confidence, nil
+}
+
+// translatePost translates the message of a post, detecting the source language first when it
+// is set to "auto".
+func (p *Plugin) translatePost(requestID, userID, preferredProvider string, post *model.Post, source, target string) (*TranslatedMessage, *APIErrorResponse) {
+	if p.isOverUserQuota(userID) {
+		return nil, quotaExceededError()
+	}
+
+	if p.isPrivateMessageExcluded(post.ChannelId) {
+		return nil, privateMessageError()
+	}
+
+	// 🔹 言語が "auto" の場合は自動検出
+	source, confidence, apiErr := p.resolvePostSource(requestID, post, source)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	// Do not pay for an identity translation.
+	if source == target {
+		return nil, &APIErrorResponse{ID: apiErrorAlreadyInLanguage, Message: "This message is already in your language", StatusCode: http.StatusBadRequest}
+	}
+
+	if !p.getConfiguration().getAllowedPairs().allows(source, target) {
+		return nil, pairNotAllowedError(source, target)
+	}
+
+	if language := p.blockedLanguage(post.Message, source); language != "" {
+		return nil, languageBlockedError(language)
+	}
+
+	characters := utf8.RuneCountInString(post.Message)
+	// A translation by another provider than the one the user chose is not reused, unless a
+	// user corrected it.
+	translation := p.getCachedTranslation(post, source, target)
+	if translation != nil && translation.CorrectedBy == "" && preferredProvider != "" && translation.Provider != preferredProvider {
+		translation = nil
+	}
+	cached := translation != nil
+
+	// A request translating the same version of the post, on this or another server, is waited
+	// for rather than paid for again.
+	key := translationIdempotencyKey(post.Id, languagePair(source, target), post.UpdateAt)
+	claimed := false
+	if !cached {
+		claimed = p.claimIdempotencyKey(idempotentTranslation, key, translationClaimTTL)
+		if !claimed {
+			translation = p.awaitCachedTranslation(post, source, target)
+			cached = translation != nil
+		}
+	}
+	p.pairStats.recordCacheLookup(languagePair(source, target), cached)
+
+	if !cached {
+		stopGlossary := p.useGlossary(requestID, post.ChannelId)
+		translatedText, provider, err := p.translateTextWithProvider(requestID, preferredProvider, post.Message, source, target, nil)
+		stopGlossary()
+		if err != nil {
+			if claimed {
+				p.releaseIdempotencyKey(idempotentTranslation, key)
+			}
+			p.API.LogDebug("Translation failed", "request_id", requestID, "idempotency_key", key, "err", err.Error())
+			return nil, p.translationError(userID, err)
+		}
+		if !isRecalledTranslation(provider) {
+			p.recordUserUsage(userID, source, target, characters)
+			p.recordChannelUsage(post.ChannelId, characters)
+		}
+
+		translation = &cachedTranslation{TranslatedText: translatedText, Provider: provider, UpdateAt: post.UpdateAt}
+		p.cacheTranslation(requestID, post, source, target, translation)
+		if claimed {
+			p.releaseIdempotencyKey(idempotentTranslation, key)
+		}
+	}
+
+	return &TranslatedMessage{
+		ID:             post.Id + source + target + strconv.FormatInt(post.UpdateAt, 10),
+		PostID:         post.Id,
 		SourceLanguage: source,
 		SourceText:     post.Message,
 		TargetLanguage: target,
-		TranslatedText: translatedText,
+		TranslatedText: translation.TranslatedText,
 		UpdateAt:       post.UpdateAt,
+		Confidence:     confidence,
+		Provider:       translation.Provider,
+		Characters:     characters,
+		Cached:         cached,
+		CorrectedBy:    translation.CorrectedBy,
+		IdempotencyKey: key,
+	}, nil
+}
+
+// personalizeTranslation adds what the reader asked for to a translation: the romanized
+// original and the conversion of amounts of money into their currency.
+func (p *Plugin) personalizeTranslation(requestID string, userInfo *UserInfo, post *model.Post, translated *TranslatedMessage) {
+	if userInfo == nil {
+		return
 	}
 
-	resp, _ := json.Marshal(translated)
-	w.Write(resp)
+	if userInfo.Romanize && hasRomanizableScript(post.Message) {
+		translated.RomanizedText = p.romanizeText(requestID, post.Message)
+	}
+
+	if userInfo.Currency != "" {
+		translated.TranslatedText = p.annotateCurrencies(requestID, translated.TranslatedText, userInfo.Currency)
+	}
 }
 
 func (p *Plugin) getInfo(w http.ResponseWriter, r *http.Request) {
@@ -132,10 +411,30 @@ func (p *Plugin) getInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Let clients polling the settings skip unchanged ones.
+	w.Header().Set("Cache-Control", "no-cache")
+	if etag := userInfoETag(info); etag != "" {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	resp, _ := json.Marshal(info)
 	w.Write(resp)
 }
 
+// userInfoETag identifies a version of the user info by the time it was last saved. Info saved
+// before the field existed has none and is never reported unchanged.
+func userInfoETag(info *UserInfo) string {
+	if info.UpdateAt == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(`"%s-%d"`, info.UserID, info.UpdateAt)
+}
+
 func (p *Plugin) setInfo(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("Mattermost-User-ID")
 	if userID == "" {
@@ -160,7 +459,19 @@ func (p *Plugin) setInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := p.setUserInfo(info)
+	if p.violatesTeamLock(info) {
+		http.Error(w, teamLockedMessage, http.StatusForbidden)
+		return
+	}
+
+	if info.Activated {
+		if pairErr := p.getConfiguration().checkSettingsPair(info.SourceLanguage, info.TargetLanguage); pairErr != nil {
+			http.Error(w, pairErr.Message, pairErr.StatusCode)
+			return
+		}
+	}
+
+	err := p.setUserInfo(newRequestID(), info)
 	if err != nil {
 		http.Error(w, "Failed to set info", http.StatusBadRequest)
 		return
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	appendedPostsKey = "appended_posts"
+	maxAppendedPosts = 1000
+)
+
+// trackAppendedTranslation remembers the latest posts whose message includes their translation,
+// so that the translations can be removed if the plugin is disabled.
+func (p *Plugin) trackAppendedTranslation(post *model.Post) {
+	if !p.getConfiguration().RemoveTranslationsOnDisable || post.GetProp(propOriginalLength) == nil {
+		return
+	}
+
+	for {
+		var old []string
+		ok, err := p.Helpers.KVGetJSON(appendedPostsKey, &old)
+		if err != nil {
+			p.API.LogWarn("Failed to get posts with appended translations", "err", err.Error())
+			return
+		}
+
+		updated := append(append([]string{}, old...), post.Id)
+		if len(updated) > maxAppendedPosts {
+			updated = updated[len(updated)-maxAppendedPosts:]
+		}
+
+		var oldValue interface{}
+		if ok {
+			oldValue = old
+		}
+
+		saved, err := p.Helpers.KVCompareAndSetJSON(appendedPostsKey, oldValue, updated)
+		if err != nil {
+			p.API.LogWarn("Failed to save posts with appended translations", "err", err.Error())
+			return
+		}
+
+		if saved {
+			return
+		}
+	}
+}
+
+// isPluginDisabled reports whether the plugin is being deactivated because it was disabled, as
+// opposed to the server shutting down or the plugin being upgraded.
+func (p *Plugin) isPluginDisabled() bool {
+	state, ok := p.API.GetConfig().PluginSettings.PluginStates[manifest.Id]
+	return ok && !state.Enable
+}
+
+// removeAppendedTranslations restores the messages of the tracked posts as their authors wrote
+// them, when System Admins asked for it and the plugin is disabled.
+func (p *Plugin) removeAppendedTranslations() {
+	if !p.getConfiguration().RemoveTranslationsOnDisable || !p.isPluginDisabled() {
+		return
+	}
+
+	var postIDs []string
+	if _, err := p.Helpers.KVGetJSON(appendedPostsKey, &postIDs); err != nil {
+		p.API.LogWarn("Failed to get posts with appended translations", "err", err.Error())
+		return
+	}
+
+	removed := 0
+	for _, postID := range postIDs {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			continue
+		}
+
+		length, ok := originalLength(post)
+		if !ok {
+			continue
+		}
+
+		restored := post.Clone()
+		restored.Message = post.Message[:length]
+		restored.DelProp(propTranslated)
+		restored.DelProp(propOriginalLength)
+		if _, appErr := p.API.UpdatePost(restored); appErr != nil {
+			p.API.LogWarn("Failed to remove appended translation", "post_id", postID, "err", appErr.Error())
+			continue
+		}
+		removed++
+	}
+
+	if appErr := p.API.KVDelete(appendedPostsKey); appErr != nil {
+		p.API.LogWarn("Failed to delete posts with appended translations", "err", appErr.Error())
+	}
+
+	p.API.LogInfo("Removed appended translations", "posts", removed)
+}
+
+// originalLength returns the length of the message of the post before its translation was
+// appended, unless the message no longer ends with the translation, such as after an edit.
+func originalLength(post *model.Post) (int, bool) {
+	var length int
+	switch value := post.GetProp(propOriginalLength).(type) {
+	case float64:
+		length = int(value)
+	case int:
+		length = value
+	default:
+		return 0, false
+	}
+
+	if length < 0 || length > len(post.Message) || !strings.HasPrefix(post.Message[length:], "\n\n") {
+		return 0, false
+	}
+
+	return length, true
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// atRestDataKeyKey holds the data key generated by AWS KMS, encrypted by KMS.
+const atRestDataKeyKey = "at_rest_data_key"
+
+// atRestPrefix starts the values encrypted at rest, which plain JSON never does.
+var atRestPrefix = []byte("enc1:")
+
+// errAtRestKeyUnavailable is returned when encrypting or decrypting without the key, because it
+// could not be loaded from AWS KMS or was removed.
+var errAtRestKeyUnavailable = errors.New("the key encrypting data at rest is unavailable")
+
+// atRestCipher encrypts the cached translations and the settings audit kept in the KV store or
+// the database, which end up in backups readable by more people than the messages themselves.
+// Values written before encryption was turned on stay readable.
+type atRestCipher struct {
+	lock sync.RWMutex
+	// source identifies the settings the key was loaded for, so that it is only loaded again
+	// when they change.
+	source string
+	aead   cipher.AEAD
+	err    error
+}
+
+func (c *atRestCipher) set(source string, aead cipher.AEAD, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.source = source
+	c.aead = aead
+	c.err = err
+}
+
+func (c *atRestCipher) get() (string, cipher.AEAD, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.source, c.aead, c.err
+}
+
+// enabled reports whether new values are encrypted.
+func (c *atRestCipher) enabled() bool {
+	source, _, _ := c.get()
+	return source != ""
+}
+
+// seal encrypts the value, or returns it unchanged when encryption is off. It fails rather than
+// writing in the clear when encryption is on but the key is unavailable.
+func (c *atRestCipher) seal(value []byte) ([]byte, error) {
+	source, aead, err := c.get()
+	if source == "" {
+		return value, nil
+	}
+	if aead == nil {
+		if err == nil {
+			err = errAtRestKeyUnavailable
+		}
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append([]byte{}, atRestPrefix...), nonce...)
+	return aead.Seal(sealed, nonce, value, nil), nil
+}
+
+// open decrypts the value, or returns it unchanged when it was written in the clear.
+func (c *atRestCipher) open(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, atRestPrefix) {
+		return value, nil
+	}
+
+	_, aead, _ := c.get()
+	if aead == nil {
+		return nil, errAtRestKeyUnavailable
+	}
+
+	sealed := value[len(atRestPrefix):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is truncated")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func (c *atRestCipher) sealJSON(v interface{}) ([]byte, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.seal(value)
+}
+
+func (c *atRestCipher) openJSON(value []byte, v interface{}) error {
+	opened, err := c.open(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(opened, v)
+}
+
+// loadAtRestKey loads the key encrypting data at rest when its settings changed: a data key of
+// AWS KMS when a KMS key is set, otherwise the key set by the System Admin.
+func (p *Plugin) loadAtRestKey(configuration *configuration) {
+	key := strings.TrimSpace(configuration.AtRestEncryptionKey)
+	kmsKeyID := strings.TrimSpace(configuration.AtRestKMSKeyID)
+
+	source := ""
+	if kmsKeyID != "" {
+		source = "kms|" + kmsKeyID
+	} else if key != "" {
+		source = "key|" + key
+	}
+
+	if loaded, _, _ := p.atRest.get(); loaded == source {
+		return
+	}
+	if source == "" {
+		p.atRest.set("", nil, nil)
+		return
+	}
+
+	var dataKey []byte
+	var err error
+	if kmsKeyID != "" {
+		dataKey, err = p.getKMSDataKey(configuration, kmsKeyID)
+	} else {
+		sum := sha256.Sum256([]byte(key))
+		dataKey = sum[:]
+	}
+
+	var aead cipher.AEAD
+	if err == nil {
+		var block cipher.Block
+		if block, err = aes.NewCipher(dataKey); err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		// Without the key, cached translations and the audit are neither read nor written
+		// until the settings are fixed.
+		p.API.LogError("Failed to load the key encrypting data at rest", "err", err.Error())
+	}
+
+	p.atRest.set(source, aead, err)
+}
+
+// getKMSDataKey returns the data key shared by the servers of the cluster, generated by AWS KMS
+// on first use and kept in the KV store encrypted by the KMS key.
+func (p *Plugin) getKMSDataKey(configuration *configuration, kmsKeyID string) ([]byte, error) {
+	sess := session.Must(session.NewSession())
+	creds := credentials.NewStaticCredentials(configuration.AWSAccessKeyID, configuration.AWSSecretAccessKey, "")
+	if _, err := creds.Get(); err != nil {
+		return nil, err
+	}
+	svc := kms.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(configuration.AWSRegion))
+
+	for {
+		wrapped, appErr := p.API.KVGet(atRestDataKeyKey)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if wrapped != nil {
+			output, err := svc.Decrypt(&kms.DecryptInput{CiphertextBlob: wrapped})
+			if err != nil {
+				return nil, err
+			}
+			return output.Plaintext, nil
+		}
+
+		output, err := svc.GenerateDataKey(&kms.GenerateDataKeyInput{
+			KeyId:   aws.String(kmsKeyID),
+			KeySpec: aws.String(kms.DataKeySpecAes256),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		saved, appErr := p.API.KVSetWithOptions(atRestDataKeyKey, output.CiphertextBlob, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: nil,
+		})
+		if appErr != nil {
+			return nil, appErr
+		}
+		if saved {
+			return output.Plaintext, nil
+		}
+		// Another server generated the data key first, theirs is used.
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	settingsAuditKeyPrefix = "audit_"
+	maxSettingsAuditSize   = 100
+
+	settingsKindUser            = "user"
+	settingsKindChannelLearning = "channel_learning"
+	settingsKindTeam            = "team"
+)
+
+// settingsChange records who changed the settings of a user, channel or team, the request ID of
+// the command or request that changed them, as found in the logs, and the values before and
+// after the change. Before is null when the settings did not exist yet.
+type settingsChange struct {
+	Kind      string          `json:"kind"`
+	SubjectID string          `json:"subject_id"`
+	ActorID   string          `json:"actor_id"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreateAt  int64           `json:"create_at"`
+}
+
+// getSettingsAudit returns the recorded changes of the settings of a user, channel or team,
+// oldest first.
+func (p *Plugin) getSettingsAudit(subjectID string) ([]settingsChange, error) {
+	return p.store.GetSettingsAudit(subjectID)
+}
+
+// recordSettingsChange appends a change to the audit of the subject, keeping the latest
+// maxSettingsAuditSize changes. Failures are logged only, the change itself is already saved.
+func (p *Plugin) recordSettingsChange(requestID, actorID, kind, subjectID string, before, after interface{}) {
+	change := settingsChange{
+		Kind:      kind,
+		SubjectID: subjectID,
+		ActorID:   actorID,
+		RequestID: requestID,
+		CreateAt:  model.GetMillis(),
+	}
+
+	var err error
+	if change.Before, err = json.Marshal(before); err != nil {
+		p.API.LogWarn("Failed to marshal settings for audit", "request_id", requestID, "subject_id", subjectID, "err", err.Error())
+		return
+	}
+	if change.After, err = json.Marshal(after); err != nil {
+		p.API.LogWarn("Failed to marshal settings for audit", "request_id", requestID, "subject_id", subjectID, "err", err.Error())
+		return
+	}
+
+	if err := p.store.AppendSettingsChange(change, maxSettingsAuditSize); err != nil {
+		p.API.LogWarn("Failed to save settings audit", "request_id", requestID, "subject_id", subjectID, "err", err.Error())
+	}
+}
+
+// getSettingsAuditLog returns to System Admins the recorded settings changes of the user,
+// channel or team given by subject_id.
+func (p *Plugin) getSettingsAuditLog(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to read the settings audit", http.StatusForbidden)
+		return
+	}
+
+	subjectID := r.URL.Query().Get("subject_id")
+	if !model.IsValidId(subjectID) {
+		http.Error(w, "Invalid parameter: subject_id", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := p.getSettingsAudit(subjectID)
+	if err != nil {
+		p.API.LogError("Failed to get settings audit", "subject_id", subjectID, "err", err.Error())
+		http.Error(w, "Failed to get settings audit", http.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []settingsChange{}
+	}
+
+	resp, _ := json.Marshal(changes)
+	w.Write(resp)
+}
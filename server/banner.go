@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultBannerTemplate is the line introducing an appended translation.
+const defaultBannerTemplate = "(Translated: {source} → {target})"
+
+var providerDisplayNames = map[string]string{
+	providerAWS:   "Amazon Translate",
+	providerDeepL: "DeepL",
+	providerLLM:   "LLM",
+}
+
+// bannerDetails describes how a translation was produced, for the banner placeholders.
+type bannerDetails struct {
+	SourceLanguage string
+	TargetLanguage string
+	Provider       string
+
+	// Confidence of the source language detection, only meaningful when Detected is true.
+	Confidence float64
+	Detected   bool
+}
+
+// renderBanner fills the placeholders of the configured banner template: {source}, {target},
+// {provider} and {confidence}. The confidence is "-" when the source language was not
+// detected.
+func (c *configuration) renderBanner(details bannerDetails) string {
+	template := c.BannerTemplate
+	if strings.TrimSpace(template) == "" {
+		template = defaultBannerTemplate
+	}
+
+	confidence := "-"
+	if details.Detected {
+		confidence = fmt.Sprintf("%.0f%%", details.Confidence*100)
+	}
+
+	provider := providerDisplayNames[details.Provider]
+	if provider == "" {
+		provider = details.Provider
+	}
+
+	return strings.NewReplacer(
+		"{source}", languageName(details.SourceLanguage),
+		"{target}", languageName(details.TargetLanguage),
+		"{provider}", provider,
+		"{confidence}", confidence,
+	).Replace(template)
+}
+
+// bannerPlaceholderRegexp matches the placeholders of a banner template once escaped by
+// regexp.QuoteMeta.
+var bannerPlaceholderRegexp = regexp.MustCompile(`\\\{(source|target|provider|confidence)\\\}`)
+
+// containsBanner reports whether a line of the message is a banner of the configured template,
+// quoted or not, as in a translated message copied into a new one.
+func (c *configuration) containsBanner(message string) bool {
+	// The banner is always on a line of its own, after the original message.
+	if !strings.Contains(message, "\n") {
+		return false
+	}
+
+	template := c.BannerTemplate
+	if strings.TrimSpace(template) == "" {
+		template = defaultBannerTemplate
+	}
+
+	pattern := bannerPlaceholderRegexp.ReplaceAllString(regexp.QuoteMeta(strings.TrimSpace(template)), ".+?")
+	banner, err := regexp.Compile(`(?m)^[>\s]*` + pattern + `\s*$`)
+	if err != nil {
+		return false
+	}
+
+	return banner.MatchString(message)
+}
+
+// languageName returns the name of a language code, or the code itself when it is unknown.
+func languageName(code string) string {
+	if name, ok := languageCodes[code]; ok {
+		return name
+	}
+
+	return code
+}
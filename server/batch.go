@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// batchTranslationConcurrency bounds the provider calls a single batch makes in parallel.
+const batchTranslationConcurrency = 4
+
+// batchTranslation is the outcome of translating one post of a batch. TranslatedText is empty
+// when the post is already written in the target language.
+type batchTranslation struct {
+	Post           *model.Post
+	SourceLanguage string
+	TranslatedText string
+	Err            error
+}
+
+// translateBatch detects the language of every post and translates the ones that are not in
+// the target language. Results are returned in the order of the posts.
+func (p *Plugin) translateBatch(requestID, preferredProvider string, posts []*model.Post, targetLang string) []*batchTranslation {
+	sourceLangs, errs := p.resolveSourceLanguages(requestID, posts)
+
+	results := make([]*batchTranslation, len(posts))
+	semaphore := make(chan struct{}, batchTranslationConcurrency)
+
+	var wg sync.WaitGroup
+	for i, post := range posts {
+		wg.Add(1)
+		go func(i int, post *model.Post) {
+			defer wg.Done()
+			defer p.recoverPanic("batch translation", func(recovered interface{}) {
+				results[i] = &batchTranslation{Post: post, Err: fmt.Errorf("translation crashed: %v", recovered)}
+			})
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i] = p.translateBatchItem(requestID, preferredProvider, post, sourceLangs[i], errs[i], targetLang)
+		}(i, post)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (p *Plugin) translateBatchItem(requestID, preferredProvider string, post *model.Post, sourceLang string, err error, targetLang string) *batchTranslation {
+	result := &batchTranslation{Post: post}
+
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.SourceLanguage = sourceLang
+
+	if sourceLang == targetLang {
+		return result
+	}
+
+	translatedText, appErr := p.translateText(requestID, preferredProvider, post.Message, sourceLang, targetLang)
+	if appErr != nil {
+		result.Err = appErr
+		return result
+	}
+	result.TranslatedText = translatedText
+
+	return result
+}
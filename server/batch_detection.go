@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/comprehend"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxDetectionBatchSize is the number of texts Comprehend detects in a single batch request.
+const maxDetectionBatchSize = 25
+
+// detectLanguages returns the dominant language of each text with a single request. The
+// language of a text that could not be detected is empty.
+func (p *Plugin) detectLanguages(requestID string, texts []string) ([]string, error) {
+	languages := make([]string, len(texts))
+
+	// Texts that may be in a blocked language are not sent to Comprehend, nor texts confidently
+	// detected locally.
+	var sent []int
+	for i, text := range texts {
+		if language := p.blockedLanguage(text, ""); language != "" {
+			languages[i] = language
+			continue
+		}
+		if language, _, ok := p.detectLanguageLocallyIfConfident(text); ok {
+			languages[i] = language
+			continue
+		}
+		sent = append(sent, i)
+	}
+	if len(sent) == 0 {
+		return languages, nil
+	}
+
+	sentTexts := make([]string, len(sent))
+	for i, index := range sent {
+		sentTexts[i] = texts[index]
+	}
+
+	svc, err := p.newComprehendClient(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &comprehend.BatchDetectDominantLanguageInput{
+		TextList: aws.StringSlice(sentTexts),
+	}
+
+	result, err := svc.BatchDetectDominantLanguageWithContext(p.providerContext(), input, withRequestID(requestID))
+	if err != nil {
+		p.API.LogError("Batch language detection API error", "request_id", requestID, "err", err.Error())
+		return nil, fmt.Errorf("Failed to detect languages")
+	}
+
+	for _, item := range result.ResultList {
+		index := int(aws.Int64Value(item.Index))
+		if index < 0 || index >= len(sent) || len(item.Languages) == 0 {
+			continue
+		}
+		languages[sent[index]] = aws.StringValue(item.Languages[0].LanguageCode)
+	}
+
+	return languages, nil
+}
+
+// resolveSourceLanguages is resolveSourceLanguage for many posts at once. Posts of senders
+// without a remembered language are detected in batches, falling back to one detection per
+// post when a batch fails. The languages and errors are returned in the order of the posts.
+func (p *Plugin) resolveSourceLanguages(requestID string, posts []*model.Post) ([]string, []error) {
+	languages := make([]string, len(posts))
+	errs := make([]error, len(posts))
+
+	senderLanguages := map[string]string{}
+	var pending []int
+	for i, post := range posts {
+		// Direct and group messages excluded from translation are not detected either.
+		if p.isPrivateMessageExcluded(post.ChannelId) {
+			errs[i] = errPrivateMessage
+			continue
+		}
+
+		language, ok := senderLanguages[post.UserId]
+		if !ok {
+			language = p.getSenderLanguage(post.UserId)
+			senderLanguages[post.UserId] = language
+		}
+
+		if language != "" {
+			languages[i] = language
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += maxDetectionBatchSize {
+		end := start + maxDetectionBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		chunk := pending[start:end]
+
+		texts := make([]string, len(chunk))
+		for j, i := range chunk {
+			texts[j] = posts[i].Message
+		}
+
+		detected, err := p.detectLanguages(requestID, texts)
+		if err != nil {
+			for _, i := range chunk {
+				languages[i], errs[i] = p.detectLanguage(requestID, posts[i].Message)
+			}
+			continue
+		}
+
+		for j, i := range chunk {
+			if detected[j] == "" {
+				errs[i] = fmt.Errorf("Failed to detect language")
+				continue
+			}
+			languages[i] = detected[j]
+		}
+	}
+
+	return languages, errs
+}
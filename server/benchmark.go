@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBenchmarkTranslations = 100
+	maxBenchmarkTranslations     = 2000
+
+	// maxRealBenchmarkTranslations caps benchmarks against real providers, which are billed.
+	maxRealBenchmarkTranslations = 50
+
+	benchmarkConcurrency = 8
+	benchmarkTarget      = "ja"
+)
+
+// benchmarkTexts are the synthetic messages translated by the benchmark, of the usual length
+// of chat messages.
+var benchmarkTexts = []string{
+	"Can you take a look at the latest build when you have a minute?",
+	"The deployment is scheduled for tomorrow morning, please review the checklist before then.",
+	"Thanks!",
+	"I pushed a fix for the login issue, the tests are green now.",
+	"Let's move the meeting to Thursday afternoon so that everyone can join.",
+	"Customers in Europe reported slow page loads since the last release, we are investigating.",
+}
+
+// benchmarkReport summarizes a benchmark run.
+type benchmarkReport struct {
+	Provider     string  `json:"provider"`
+	Translations int     `json:"translations"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	DurationMs   int64   `json:"duration_ms"`
+	Throughput   float64 `json:"throughput_per_second"`
+	LatencyP50Ms int64   `json:"latency_p50_ms"`
+	LatencyP95Ms int64   `json:"latency_p95_ms"`
+	LatencyP99Ms int64   `json:"latency_p99_ms"`
+	LatencyMaxMs int64   `json:"latency_max_ms"`
+}
+
+// getBenchmarkProvider returns the provider a benchmark runs against and the maximum number of
+// translations allowed with it.
+func (p *Plugin) getBenchmarkProvider(name string) (translationProvider, int, error) {
+	if name == "" || name == providerMock {
+		return &mockProvider{ctx: p.providerContext()}, maxBenchmarkTranslations, nil
+	}
+
+	for _, provider := range p.getProviders() {
+		if provider.Name() == name {
+			return provider, maxRealBenchmarkTranslations, nil
+		}
+	}
+
+	return nil, 0, errors.Errorf("provider %q is not configured", name)
+}
+
+// runBenchmark translates count synthetic messages with the provider, benchmarkConcurrency at
+// a time, and measures throughput, latencies and errors.
+func (p *Plugin) runBenchmark(provider translationProvider, count int) *benchmarkReport {
+	requestID := newRequestID()
+	latencies := make([]time.Duration, count)
+	failed := make([]bool, count)
+
+	indexes := make(chan int)
+	var workers sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < benchmarkConcurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer p.recoverPanic("benchmark", nil)
+			for i := range indexes {
+				text := benchmarkTexts[i%len(benchmarkTexts)]
+				callStart := time.Now()
+				_, err := provider.Translate(requestID, text, enLanguage, benchmarkTarget)
+				latencies[i] = time.Since(callStart)
+				failed[i] = err != nil
+
+				if err == nil && provider.Name() != providerMock && p.usageTracker != nil {
+					p.usageTracker.add(utf8.RuneCountInString(text))
+				}
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	workers.Wait()
+	duration := time.Since(start)
+
+	report := &benchmarkReport{
+		Provider:     provider.Name(),
+		Translations: count,
+		DurationMs:   duration.Milliseconds(),
+	}
+	for _, f := range failed {
+		if f {
+			report.Errors++
+		}
+	}
+	if count > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(count)
+		report.Throughput = float64(count) / duration.Seconds()
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		percentile := func(pct int) int64 {
+			return latencies[(count-1)*pct/100].Milliseconds()
+		}
+		report.LatencyP50Ms = percentile(50)
+		report.LatencyP95Ms = percentile(95)
+		report.LatencyP99Ms = percentile(99)
+		report.LatencyMaxMs = latencies[count-1].Milliseconds()
+	}
+
+	p.API.LogInfo("Benchmark done", "request_id", requestID, "provider", report.Provider, "translations", count, "errors", report.Errors, "duration_ms", report.DurationMs)
+	return report
+}
+
+// parseBenchmarkCount returns the number of translations asked for, within the maximum of the
+// provider.
+func parseBenchmarkCount(value string, max int) (int, error) {
+	if value == "" {
+		if defaultBenchmarkTranslations > max {
+			return max, nil
+		}
+		return defaultBenchmarkTranslations, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return 0, errors.New("the number of translations must be a positive number")
+	}
+	if count > max {
+		return 0, errors.Errorf("at most %d translations can be run with this provider", max)
+	}
+
+	return count, nil
+}
+
+// renderBenchmarkReport formats the report for a direct message.
+func renderBenchmarkReport(report *benchmarkReport) string {
+	return fmt.Sprintf(
+		"#### Autotranslate benchmark\n"+
+			"| Provider | Translations | Errors | Duration | Throughput | p50 | p95 | p99 | Max |\n"+
+			"|:--|--:|--:|--:|--:|--:|--:|--:|--:|\n"+
+			"| %s | %d | %d (%.1f%%) | %d ms | %.1f/s | %d ms | %d ms | %d ms | %d ms |",
+		report.Provider, report.Translations, report.Errors, report.ErrorRate*100, report.DurationMs, report.Throughput,
+		report.LatencyP50Ms, report.LatencyP95Ms, report.LatencyP99Ms, report.LatencyMaxMs,
+	)
+}
+
+// startBenchmark runs a benchmark in the background and reports it to the user by direct
+// message.
+func (p *Plugin) startBenchmark(userID, providerName, countValue string) error {
+	provider, max, err := p.getBenchmarkProvider(providerName)
+	if err != nil {
+		return err
+	}
+
+	count, err := parseBenchmarkCount(countValue, max)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer p.recoverPanic("benchmark", nil)
+
+		report := p.runBenchmark(provider, count)
+		if err := p.sendDirectMessage(userID, renderBenchmarkReport(report)); err != nil {
+			p.API.LogWarn("Failed to report benchmark", "user_id", userID, "err", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// postBenchmark runs a benchmark for System Admins and answers with its report.
+func (p *Plugin) postBenchmark(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to run benchmarks", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, max, err := p.getBenchmarkProvider(r.URL.Query().Get("provider"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := parseBenchmarkCount(r.URL.Query().Get("count"), max)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, _ := json.Marshal(p.runBenchmark(provider, count))
+	w.Write(resp)
+}
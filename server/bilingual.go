@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// minBilingualShare is the share of the characters of a message, in percent, that must be
+// written in each of the source and target languages for the message to be bilingual.
+const minBilingualShare = 25
+
+// isBilingual reports whether the author already wrote the text in both the source and the
+// target language, as some do to address everyone, by detecting the language of each line.
+func (p *Plugin) isBilingual(requestID, text, sourceLang, targetLang string) bool {
+	var segments []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			segments = append(segments, line)
+		}
+	}
+	if len(segments) < 2 {
+		return false
+	}
+
+	languages, err := p.detectLanguages(requestID, segments)
+	if err != nil {
+		return false
+	}
+
+	total, sourceChars, targetChars := 0, 0, 0
+	for i, segment := range segments {
+		length := utf8.RuneCountInString(segment)
+		total += length
+		switch languages[i] {
+		case sourceLang:
+			sourceChars += length
+		case targetLang:
+			targetChars += length
+		}
+	}
+
+	return sourceChars*100 >= total*minBilingualShare && targetChars*100 >= total*minBilingualShare
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	apiErrorLanguageBlocked = "language_blocked"
+	appErrorLanguageBlocked = "LanguageBlocked"
+
+	// minStopwordHits is the number of common words of a language a text written in the Latin
+	// script must contain to be considered in that language.
+	minStopwordHits = 2
+)
+
+// scriptLanguages lists the languages written in each script told apart by textScript, except
+// the Latin script whose languages are guessed from their common words.
+var scriptLanguages = map[string][]string{
+	"Kana":       {"ja"},
+	"Hangul":     {"ko"},
+	"Han":        {"zh", "zh-TW", "ja"},
+	"Thai":       {"th"},
+	"Hebrew":     {"he"},
+	"Greek":      {"el"},
+	"Devanagari": {"hi"},
+	"Cyrillic":   {"ru", "uk", "bg", "sr", "mk", "kk", "mn"},
+	"Arabic":     {"ar", "fa", "fa-AF", "ur", "ps"},
+}
+
+// latinStopwords are common words of languages written in the Latin script.
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "you", "this", "for", "with", "have", "not"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "sie", "es", "ein", "eine", "mit", "auf", "zu", "auch"},
+	"fr": {"le", "la", "les", "et", "est", "une", "un", "des", "pas", "je", "vous", "que", "pour", "avec", "sur"},
+	"es": {"el", "los", "las", "y", "es", "una", "que", "por", "para", "con", "no", "del", "como", "pero", "está"},
+	"it": {"il", "lo", "gli", "e", "è", "che", "non", "una", "per", "con", "sono", "della", "anche", "ma", "come"},
+	"pt": {"o", "os", "as", "e", "é", "que", "não", "uma", "para", "com", "por", "do", "da", "mas", "você"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "ik", "je", "dat", "van", "met", "op", "voor", "zijn", "ook"},
+	"pl": {"i", "w", "nie", "jest", "się", "na", "że", "to", "z", "do", "jak", "ale", "tak", "co", "czy"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "ne", "değil", "var", "ben", "sen", "mi", "gibi"},
+	"sv": {"och", "att", "det", "är", "som", "en", "på", "inte", "jag", "med", "för", "har", "du", "av", "till"},
+	"id": {"dan", "yang", "di", "ini", "itu", "tidak", "dengan", "untuk", "ada", "saya", "kami", "akan", "dari", "ke", "juga"},
+}
+
+// localLanguageCandidates returns the languages the text may be written in, guessed on this
+// server from its script and, for the Latin script, its common words. It is a heuristic which
+// returns nothing for texts it cannot tell.
+func localLanguageCandidates(text string) []string {
+	script := textScript(text)
+	if script != "Latin" {
+		return scriptLanguages[script]
+	}
+
+	words := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		words[word]++
+	}
+
+	var candidates []string
+	for language, stopwords := range latinStopwords {
+		hits := 0
+		for _, stopword := range stopwords {
+			hits += words[stopword]
+		}
+		if hits >= minStopwordHits {
+			candidates = append(candidates, language)
+		}
+	}
+	sort.Strings(candidates)
+
+	return candidates
+}
+
+// getBlockedLanguages returns the languages whose content must never be sent to external
+// services. Invalid codes are reported by IsValid.
+func (c *configuration) getBlockedLanguages() map[string]bool {
+	blocked := map[string]bool{}
+	for _, language := range strings.Split(c.BlockedLanguages, ",") {
+		if language = strings.TrimSpace(language); language != "" {
+			blocked[language] = true
+		}
+	}
+
+	return blocked
+}
+
+// validateBlockedLanguages checks that the blocked languages are supported language codes.
+func validateBlockedLanguages(value string) error {
+	for _, language := range strings.Split(value, ",") {
+		language = strings.TrimSpace(language)
+		if language != "" && (language == autoLanguage || languageCodes[language] == "") {
+			return fmt.Errorf("Invalid blocked language %q", language)
+		}
+	}
+
+	return nil
+}
+
+// blockedLanguage returns the blocked language the text is or may be written in, or an empty
+// string when the text can be sent to external services. A known source language is trusted,
+// otherwise the language is guessed locally.
+func (p *Plugin) blockedLanguage(text, sourceLang string) string {
+	blocked := p.getConfiguration().getBlockedLanguages()
+	if len(blocked) == 0 {
+		return ""
+	}
+
+	if blocked[sourceLang] {
+		return sourceLang
+	}
+
+	for _, language := range localLanguageCandidates(text) {
+		if blocked[language] {
+			return language
+		}
+	}
+
+	return ""
+}
+
+// languageBlockedMessage explains why a text in a blocked language is not translated.
+func languageBlockedMessage(language string) string {
+	return fmt.Sprintf("This message looks like %s, which your System Admin does not allow to be sent to translation services. It was not translated.", languageName(language))
+}
+
+// languageBlockedError is returned when translating a text in a blocked language is requested.
+func languageBlockedError(language string) *APIErrorResponse {
+	return &APIErrorResponse{ID: apiErrorLanguageBlocked, Message: languageBlockedMessage(language), StatusCode: http.StatusForbidden}
+}
+
+// languageBlockedAppError is languageBlockedError for the translation functions returning
+// application errors.
+func languageBlockedAppError(requestID, language string) *model.AppError {
+	return model.NewAppError("translateText", appErrorLanguageBlocked, nil, fmt.Sprintf("Text in blocked language %s, request_id=%s", language, requestID), http.StatusForbidden)
+}
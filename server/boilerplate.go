@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	boilerplateKeyPrefix = "bp_"
+
+	// boilerplateTTL is how long, in seconds, the translation of a boilerplate line is reused.
+	boilerplateTTL = 30 * 24 * 60 * 60
+
+	// boilerplateMinRepeats is the number of posts of a channel a line must appear in, with
+	// any variable parts, to be boilerplate.
+	boilerplateMinRepeats = 3
+
+	// maxBoilerplateTemplates caps the lines tracked per channel.
+	maxBoilerplateTemplates = 200
+
+	// boilerplateTemplateTTL is how long a line not seen again is tracked.
+	boilerplateTemplateTTL = 7 * 24 * time.Hour
+
+	// providerBoilerplate is reported as the provider of a message made of boilerplate only.
+	providerBoilerplate = "boilerplate"
+)
+
+// boilerplateVariableRegexp finds the parts of lines that change from a post to the next in
+// templates and notifications: links, mentions, UUIDs, hashes, and numbers such as IDs, dates
+// and times.
+var boilerplateVariableRegexp = regexp.MustCompile(`https?://\S+|@[\w.\-]+|\b[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\b|\b[0-9a-fA-F]*\d[0-9a-fA-F]*\b(?:[.,:/\-]\d+)*`)
+
+// boilerplateTemplate returns the line with its variable parts replaced with placeholders, and
+// those parts, in order.
+func boilerplateTemplate(line string) (string, []string) {
+	var variables []string
+	template := boilerplateVariableRegexp.ReplaceAllStringFunc(line, func(match string) string {
+		return boilerplateVariablePlaceholders.protect(&variables, match)
+	})
+
+	return strings.TrimSpace(template), variables
+}
+
+// hasWords reports whether the text has words worth translating besides its placeholders.
+func hasWords(text string) bool {
+	text = boilerplateVariablePlaceholders.strip(text)
+	text = boilerplateLinePlaceholders.strip(text)
+
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+
+	return letters >= 3
+}
+
+func boilerplateHash(template string) string {
+	sum := sha256.Sum256([]byte(template))
+	return hex.EncodeToString(sum[:16])
+}
+
+type boilerplateSighting struct {
+	posts    int
+	lastSeen time.Time
+}
+
+// boilerplateTracker counts, per channel, the posts each line template appeared in, so that
+// the lines of templates and automated notifications are recognized. Counts are kept in memory
+// and per server.
+type boilerplateTracker struct {
+	lock     sync.Mutex
+	channels map[string]map[string]*boilerplateSighting
+}
+
+// observe counts the templates of the lines of a new post of the channel.
+func (t *boilerplateTracker) observe(channelID, message string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.channels == nil {
+		t.channels = map[string]map[string]*boilerplateSighting{}
+	}
+	sightings, ok := t.channels[channelID]
+	if !ok {
+		sightings = map[string]*boilerplateSighting{}
+		t.channels[channelID] = sightings
+	}
+
+	now := time.Now()
+	seen := map[string]bool{}
+	for _, line := range strings.Split(message, "\n") {
+		template, _ := boilerplateTemplate(line)
+		if !hasWords(template) {
+			continue
+		}
+
+		hash := boilerplateHash(template)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		sighting, ok := sightings[hash]
+		if !ok {
+			if len(sightings) >= maxBoilerplateTemplates {
+				t.prune(sightings, now)
+			}
+			if len(sightings) >= maxBoilerplateTemplates {
+				continue
+			}
+			sighting = &boilerplateSighting{}
+			sightings[hash] = sighting
+		}
+		sighting.posts++
+		sighting.lastSeen = now
+	}
+}
+
+// prune forgets the templates not seen for a while, then those seen in a single post.
+func (t *boilerplateTracker) prune(sightings map[string]*boilerplateSighting, now time.Time) {
+	for hash, sighting := range sightings {
+		if now.Sub(sighting.lastSeen) > boilerplateTemplateTTL {
+			delete(sightings, hash)
+		}
+	}
+	if len(sightings) < maxBoilerplateTemplates {
+		return
+	}
+
+	for hash, sighting := range sightings {
+		if sighting.posts < 2 {
+			delete(sightings, hash)
+		}
+	}
+}
+
+// isBoilerplate reports whether the template appeared in enough posts of the channel.
+func (t *boilerplateTracker) isBoilerplate(channelID, hash string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sighting, ok := t.channels[channelID][hash]
+	return ok && sighting.posts >= boilerplateMinRepeats
+}
+
+// observeBoilerplate counts the lines of a new post when boilerplate filtering is on.
+func (p *Plugin) observeBoilerplate(post *model.Post) {
+	if !p.getConfiguration().FilterBoilerplate || post.IsSystemMessage() || post.UserId == p.botUserID || isTranslatedPost(post) {
+		return
+	}
+
+	p.boilerplate.observe(post.ChannelId, post.Message)
+}
+
+func boilerplateKey(hash, sourceLang, targetLang string) string {
+	return boilerplateKeyPrefix + hash + "_" + sourceLang + "_" + targetLang
+}
+
+// getBoilerplateTranslation returns the translation of the template in the channel, translating
+// it and caching it the first time. The translation keeps the placeholders of the template. It
+// is cached per channel, as the glossaries of channels differ.
+func (p *Plugin) getBoilerplateTranslation(requestID, preferredProvider, channelID, template, sourceLang, targetLang string) (string, bool) {
+	key := boilerplateKey(boilerplateHash(channelID+"\n"+template), sourceLang, targetLang)
+	if value, appErr := p.API.KVGet(key); appErr == nil && value != nil {
+		if opened, err := p.atRest.open(value); err == nil {
+			return string(opened), true
+		}
+	}
+
+	translated, _, appErr := p.translateWithProviders(requestID, preferredProvider, template, sourceLang, targetLang, nil)
+	if appErr != nil {
+		return "", false
+	}
+
+	// A template whose placeholders the provider did not keep cannot be filled.
+	translated = boilerplateVariablePlaceholders.normalize(translated)
+	for _, placeholder := range boilerplateVariablePlaceholders.regexp.FindAllString(template, -1) {
+		if strings.Count(translated, placeholder) != strings.Count(template, placeholder) {
+			return "", false
+		}
+	}
+
+	value, err := p.atRest.seal([]byte(translated))
+	if err != nil {
+		return translated, true
+	}
+	if _, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{ExpireInSeconds: boilerplateTTL}); appErr != nil {
+		p.API.LogWarn("Failed to cache boilerplate translation", "request_id", requestID, "err", appErr.Error())
+	}
+
+	return translated, true
+}
+
+// translateBoilerplate translates a text containing boilerplate lines of its channel: the
+// translations of the boilerplate are reused with their variable parts filled in, and only the
+// other lines are sent to the providers. It reports false when the text has no boilerplate.
+func (p *Plugin) translateBoilerplate(requestID, preferredProvider, text, sourceLang, targetLang string, conversation []string) (string, string, bool) {
+	if !p.getConfiguration().FilterBoilerplate || sourceLang == autoLanguage {
+		return "", "", false
+	}
+
+	channelID, ok := p.requestGlossaries.Load(requestID)
+	if !ok {
+		return "", "", false
+	}
+
+	lines := strings.Split(text, "\n")
+	var boilerplate []string
+	var remainder []string
+	for _, line := range lines {
+		template, variables := boilerplateTemplate(line)
+		if !hasWords(template) || !p.boilerplate.isBoilerplate(channelID.(string), boilerplateHash(template)) {
+			remainder = append(remainder, line)
+			continue
+		}
+
+		translated, ok := p.getBoilerplateTranslation(requestID, preferredProvider, channelID.(string), template, sourceLang, targetLang)
+		if !ok {
+			remainder = append(remainder, line)
+			continue
+		}
+
+		translated, _ = boilerplateVariablePlaceholders.restore(translated, variables)
+		remainder = append(remainder, boilerplateLinePlaceholders.protect(&boilerplate, translated))
+	}
+	if len(boilerplate) == 0 {
+		return "", "", false
+	}
+
+	translated := strings.Join(remainder, "\n")
+	provider := providerBoilerplate
+	if hasWords(translated) {
+		var appErr *model.AppError
+		translated, provider, appErr = p.translateWithProviders(requestID, preferredProvider, translated, sourceLang, targetLang, conversation)
+		if appErr != nil {
+			return "", "", false
+		}
+	}
+
+	// Lines the provider dropped would be missing from the translation.
+	translated, filled := boilerplateLinePlaceholders.restore(translated, boilerplate)
+	for _, ok := range filled {
+		if !ok {
+			return "", "", false
+		}
+	}
+
+	return translated, provider, true
+}
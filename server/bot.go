@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	botUsername    = "autotranslate"
+	botDisplayName = "Autotranslate"
+	botDescription = "Created by the Autotranslate plugin."
+)
+
+// ensureBot creates the plugin bot account if needed and remembers its user ID.
+func (p *Plugin) ensureBot() error {
+	botUserID, err := p.Helpers.EnsureBot(&model.Bot{
+		Username:    botUsername,
+		DisplayName: botDisplayName,
+		Description: botDescription,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure bot account")
+	}
+
+	p.botUserID = botUserID
+	return nil
+}
+
+// sendDirectMessage posts a message from the plugin bot in its direct channel with the user.
+func (p *Plugin) sendDirectMessage(userID, message string) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get direct channel")
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create direct message")
+	}
+
+	return nil
+}
+
+// mentionUser returns the @mention of the user, or "someone" when the user cannot be found.
+func (p *Plugin) mentionUser(userID string) string {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return "someone"
+	}
+
+	return "@" + user.Username
+}
+
+// postTeamID returns the ID of the team of the channel of the post, or an empty string for
+// direct and group messages.
+func (p *Plugin) postTeamID(post *model.Post) string {
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return ""
+	}
+
+	return channel.TeamId
+}
+
+// isPostGone reports whether the post was deleted or its channel archived, in which case work
+// done for it in the background is dropped rather than delivered.
+func (p *Plugin) isPostGone(postID string) bool {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return appErr.StatusCode == http.StatusNotFound
+	}
+	if post.DeleteAt != 0 {
+		return true
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	return appErr == nil && channel.DeleteAt != 0
+}
+
+// getPermalink returns a link to the post, or an empty string when it cannot be built such as
+// for posts in direct and group channels which do not belong to a team.
+func (p *Plugin) getPermalink(post *model.Post, channel *model.Channel) string {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" || channel.TeamId == "" {
+		return ""
+	}
+
+	team, appErr := p.API.GetTeam(channel.TeamId)
+	if appErr != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s/pl/%s", *siteURL, team.Name, post.Id)
+}
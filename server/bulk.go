@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	bulkJobKeyPrefix = "bulk_job_"
+
+	bulkScopeTeam    = "team"
+	bulkScopeChannel = "channel"
+
+	bulkMembersPerPage = 100
+)
+
+// bulkJob enables or disables auto-translation for all members of a team or channel in the
+// background. Its progress is stored so admins can follow it.
+type bulkJob struct {
+	ID          string `json:"id"`
+	RequestedBy string `json:"requested_by"`
+	Scope       string `json:"scope"`
+	TargetID    string `json:"target_id"`
+	Enable      bool   `json:"enable"`
+	Processed   int    `json:"processed"`
+	Changed     int    `json:"changed"`
+	Skipped     int    `json:"skipped"`
+	Done        bool   `json:"done"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (p *Plugin) saveBulkJob(job *bulkJob) {
+	if err := p.Helpers.KVSetJSON(bulkJobKeyPrefix+job.ID, job); err != nil {
+		p.API.LogWarn("Failed to save bulk job progress", "job_id", job.ID, "err", err.Error())
+	}
+}
+
+// startBulkJob validates and starts a bulk job, returning it as started.
+func (p *Plugin) startBulkJob(requestedBy, scope, targetID string, enable bool) (*bulkJob, error) {
+	if scope != bulkScopeTeam && scope != bulkScopeChannel {
+		return nil, fmt.Errorf("Invalid scope %q, should be %q or %q", scope, bulkScopeTeam, bulkScopeChannel)
+	}
+
+	job := &bulkJob{
+		ID:          newRequestID(),
+		RequestedBy: requestedBy,
+		Scope:       scope,
+		TargetID:    targetID,
+		Enable:      enable,
+	}
+	p.saveBulkJob(job)
+
+	go p.safely("bulk translation", func() { p.runBulkJob(job) })
+
+	return job, nil
+}
+
+// bulkJobMemberIDs returns a page of the user IDs of the members of the team or channel of the job.
+func (p *Plugin) bulkJobMemberIDs(job *bulkJob, page int) ([]string, *model.AppError) {
+	var userIDs []string
+	if job.Scope == bulkScopeTeam {
+		members, appErr := p.API.GetTeamMembers(job.TargetID, page, bulkMembersPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, member := range members {
+			if member.DeleteAt == 0 {
+				userIDs = append(userIDs, member.UserId)
+			}
+		}
+		return userIDs, nil
+	}
+
+	members, appErr := p.API.GetChannelMembers(job.TargetID, page, bulkMembersPerPage)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if members != nil {
+		for _, member := range *members {
+			userIDs = append(userIDs, member.UserId)
+		}
+	}
+	return userIDs, nil
+}
+
+func (p *Plugin) runBulkJob(job *bulkJob) {
+	respectOptOuts := p.getConfiguration().BulkRespectOptOuts
+	teamID := job.TargetID
+	if job.Scope == bulkScopeChannel {
+		if channel, appErr := p.API.GetChannel(job.TargetID); appErr == nil {
+			teamID = channel.TeamId
+		}
+	}
+
+	for page := 0; ; page++ {
+		userIDs, appErr := p.bulkJobMemberIDs(job, page)
+		if appErr != nil {
+			job.Error = appErr.Error()
+			break
+		}
+
+		var changed []string
+		for _, userID := range userIDs {
+			job.Processed++
+
+			if user, appErr := p.API.GetUser(userID); appErr != nil || user.IsBot || user.DeleteAt != 0 {
+				job.Skipped++
+				continue
+			}
+
+			userInfo, _ := p.getUserInfo(userID)
+			switch {
+			case userInfo == nil && !job.Enable:
+				job.Skipped++
+				continue
+			case userInfo == nil:
+				userInfo = p.NewUserInfo(userID)
+				if teamID != "" {
+					p.getTeamSettings(teamID).applyTeamDefaults(userInfo)
+				}
+			case userInfo.Activated == job.Enable:
+				job.Skipped++
+				continue
+			case job.Enable && respectOptOuts:
+				// The user turned auto-translation off themselves.
+				job.Skipped++
+				continue
+			}
+
+			userInfo.Activated = job.Enable
+			if apiErr := p.saveUserInfoAs(job.ID, job.RequestedBy, userInfo); apiErr != nil {
+				job.Skipped++
+				continue
+			}
+			changed = append(changed, userID)
+			job.Changed++
+		}
+
+		p.emitBulkInfoRefresh(job, changed)
+		p.saveBulkJob(job)
+		if len(userIDs) < bulkMembersPerPage {
+			break
+		}
+	}
+
+	job.Done = true
+	p.saveBulkJob(job)
+
+	action := "disabled"
+	if job.Enable {
+		action = "enabled"
+	}
+	message := fmt.Sprintf("Auto-translation %s for the members of the %s: %d changed, %d skipped out of %d.", action, job.Scope, job.Changed, job.Skipped, job.Processed)
+	if job.Error != "" {
+		message += fmt.Sprintf(" The job stopped early: %s", job.Error)
+	}
+	if err := p.sendDirectMessage(job.RequestedBy, message); err != nil {
+		p.API.LogWarn("Failed to report bulk job", "job_id", job.ID, "err", err.Error())
+	}
+}
+
+// handleBulkJob starts a bulk job with POST and reports the progress of one with GET.
+func (p *Plugin) handleBulkJob(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to run bulk changes", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var job bulkJob
+		if ok, err := p.Helpers.KVGetJSON(bulkJobKeyPrefix+r.URL.Query().Get("job_id"), &job); err != nil || !ok {
+			http.Error(w, "No bulk job found", http.StatusNotFound)
+			return
+		}
+
+		resp, _ := json.Marshal(job)
+		w.Write(resp)
+	case http.MethodPost:
+		var body struct {
+			Scope    string `json:"scope"`
+			TargetID string `json:"target_id"`
+			Enable   bool   `json:"enable"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TargetID == "" {
+			http.Error(w, "Invalid parameter: scope and target_id are required", http.StatusBadRequest)
+			return
+		}
+
+		job, err := p.startBulkJob(userID, body.Scope, body.TargetID, body.Enable)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		resp, _ := json.Marshal(job)
+		w.Write(resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// emitBulkInfoRefresh tells the members whose info the job changed to fetch it again, with a
+// single event for the team or channel of the job instead of one event per member.
+func (p *Plugin) emitBulkInfoRefresh(job *bulkJob, userIDs []string) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	// WebSocket payloads only carry plain values, so the IDs are sent comma separated.
+	payload := map[string]interface{}{
+		"request_id": job.ID,
+		"user_ids":   strings.Join(userIDs, ","),
+	}
+	if job.Scope == bulkScopeChannel {
+		p.publishToChannel(wsEventInfoRefresh, job.TargetID, payload)
+	} else {
+		p.publishToTeam(wsEventInfoRefresh, job.TargetID, payload)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	// postTypeCallsTranscription is the type of the post the Calls plugin adds to the thread of
+	// a call with its transcript attached as a WebVTT file.
+	postTypeCallsTranscription = "custom_calls_transcription"
+
+	// maxTranscriptPostCharacters keeps transcript replies below the post size limit.
+	maxTranscriptPostCharacters = 16000
+)
+
+// transcriptCue is what one speaker said without being interrupted.
+type transcriptCue struct {
+	speaker string
+	text    string
+}
+
+// getCallTranscriptLanguages returns the valid language codes of the configured list.
+func (c *configuration) getCallTranscriptLanguages() []string {
+	var languages []string
+	for _, language := range strings.Split(c.CallTranscriptLanguages, ",") {
+		language = strings.TrimSpace(language)
+		if language != "" && language != autoLanguage && languageCodes[language] != "" {
+			languages = append(languages, language)
+		}
+	}
+
+	return languages
+}
+
+// parseWebVTT returns the cues of a WebVTT transcript, merging the consecutive cues of a
+// speaker.
+func parseWebVTT(content string) []*transcriptCue {
+	var cues []*transcriptCue
+	for _, line := range strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "WEBVTT" || strings.Contains(line, "-->") || strings.Trim(line, "0123456789") == "" {
+			continue
+		}
+
+		speaker := ""
+		if strings.HasPrefix(line, "<v ") {
+			if end := strings.Index(line, ">"); end != -1 {
+				speaker = strings.TrimSpace(line[3:end])
+				line = line[end+1:]
+			}
+		}
+		line = strings.TrimSpace(strings.TrimSuffix(line, "</v>"))
+		if line == "" {
+			continue
+		}
+
+		if last := len(cues) - 1; last >= 0 && cues[last].speaker == speaker {
+			cues[last].text += " " + line
+			continue
+		}
+		cues = append(cues, &transcriptCue{speaker: speaker, text: line})
+	}
+
+	return cues
+}
+
+// transcriptSize returns the size in bytes of the text of the cues.
+func transcriptSize(cues []*transcriptCue) int {
+	size := 0
+	for _, cue := range cues {
+		size += len(cue.text)
+	}
+
+	return size
+}
+
+// translateCallTranscript replies to the thread of a call with its transcript translated into
+// each configured language. Transcripts larger than what Amazon Translate translates in a
+// request go through asynchronous translation jobs when a bucket is configured for them, the
+// translations being posted once they complete. Other transcripts, and the languages no job
+// was started for, are translated with the batch pipeline, one post per cue.
+func (p *Plugin) translateCallTranscript(post *model.Post) {
+	languages := p.getConfiguration().getCallTranscriptLanguages()
+	if post.Type != postTypeCallsTranscription || len(languages) == 0 {
+		return
+	}
+
+	// Transcripts of direct and group calls are kept from providers like their messages.
+	if p.isPrivateMessageExcluded(post.ChannelId) {
+		return
+	}
+
+	requestID := newRequestID()
+
+	var cues []*transcriptCue
+	for _, fileID := range post.FileIds {
+		content, appErr := p.API.GetFile(fileID)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get call transcript", "request_id", requestID, "file_id", fileID, "err", appErr.Error())
+			continue
+		}
+		cues = append(cues, parseWebVTT(string(content))...)
+	}
+
+	if len(cues) == 0 {
+		return
+	}
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+
+	if transcriptSize(cues) > transcriptJobMinBytes {
+		languages = p.startTranscriptJobs(requestID, post.ChannelId, rootID, cues, languages)
+	}
+
+	p.translateTranscriptCues(requestID, post.ChannelId, rootID, cues, languages)
+}
+
+// translateTranscriptCues translates the cues of a transcript one by one into each language,
+// posting the translations in the thread of the call.
+func (p *Plugin) translateTranscriptCues(requestID, channelID, rootID string, cues []*transcriptCue, languages []string) {
+	cuePosts := make([]*model.Post, len(cues))
+	for i, cue := range cues {
+		cuePosts[i] = &model.Post{ChannelId: channelID, Message: cue.text}
+	}
+
+	for _, language := range languages {
+		// Translations are not posted to the thread of a call deleted meanwhile.
+		if p.isPostGone(rootID) {
+			return
+		}
+
+		translations := make([]string, len(cues))
+		for i, result := range p.translateBatch(requestID, "", cuePosts, language) {
+			if result.Err == nil {
+				translations[i] = result.TranslatedText
+			}
+		}
+
+		p.postTranscriptTranslation(requestID, channelID, rootID, language, cues, translations)
+	}
+}
+
+// postTranscriptTranslation posts the translation of a transcript into the language in the
+// thread of the call, split in as many posts as needed. Cues without a translation keep their
+// original text.
+func (p *Plugin) postTranscriptTranslation(requestID, channelID, rootID, language string, cues []*transcriptCue, translations []string) {
+	var transcript strings.Builder
+	for i, cue := range cues {
+		text := translations[i]
+		if text == "" {
+			text = cue.text
+		}
+
+		if cue.speaker != "" {
+			fmt.Fprintf(&transcript, "**%s**: ", cue.speaker)
+		}
+		transcript.WriteString(text)
+		transcript.WriteString("\n\n")
+	}
+
+	for i, chunk := range splitText(strings.TrimSpace(transcript.String()), maxTranscriptPostCharacters) {
+		message := chunk.text
+		if i == 0 {
+			message = fmt.Sprintf("#### Transcript (%s)\n\n%s", languageCodes[language], message)
+		}
+
+		if _, appErr := p.API.CreatePost(&model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channelID,
+			RootId:    rootID,
+			Message:   message,
+		}); appErr != nil {
+			p.API.LogWarn("Failed to post translated transcript", "request_id", requestID, "language", language, "err", appErr.Error())
+			return
+		}
+	}
+}
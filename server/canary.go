@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const providerFeedbackKeyPrefix = "provider_feedback_"
+
+// providerFeedback counts the ratings users gave to translations of a provider.
+type providerFeedback struct {
+	Positive int `json:"positive"`
+	Negative int `json:"negative"`
+}
+
+// ProviderReport compares the providers for the admins deciding on a canary rollout.
+type ProviderReport struct {
+	Provider         string  `json:"provider"`
+	Canary           bool    `json:"canary"`
+	Calls            int     `json:"calls"`
+	Failures         int     `json:"failures"`
+	AverageLatencyMs float64 `json:"average_latency_ms"`
+	PositiveFeedback int     `json:"positive_feedback"`
+	NegativeFeedback int     `json:"negative_feedback"`
+}
+
+// getCanaryPercentage returns the share of traffic, between 0 and 100, sent to the canary.
+func (c *configuration) getCanaryPercentage() int {
+	percentage, err := strconv.Atoi(strings.TrimSpace(c.CanaryPercentage))
+	if err != nil || percentage < 0 {
+		return 0
+	}
+
+	if percentage > 100 {
+		return 100
+	}
+
+	return percentage
+}
+
+// isCanaryRequest decides whether a request goes to the canary provider. It hashes the request
+// ID so retries of the same request make the same choice.
+func isCanaryRequest(requestID string, percentage int) bool {
+	if percentage <= 0 {
+		return false
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(requestID))
+	return int(hash.Sum32()%100) < percentage
+}
+
+// applyCanary moves the canary provider to the front of the ranking for the requests selected
+// by the canary percentage.
+func (p *Plugin) applyCanary(requestID string, providers []translationProvider) []translationProvider {
+	configuration := p.getConfiguration()
+	if configuration.CanaryProvider == "" || !isCanaryRequest(requestID, configuration.getCanaryPercentage()) {
+		return providers
+	}
+
+	for i, provider := range providers {
+		if provider.Name() == configuration.CanaryProvider {
+			ranked := append([]translationProvider{provider}, providers[:i]...)
+			return append(ranked, providers[i+1:]...)
+		}
+	}
+
+	return providers
+}
+
+func (p *Plugin) getProviderFeedback(provider string) *providerFeedback {
+	feedback := &providerFeedback{}
+	if _, err := p.Helpers.KVGetJSON(providerFeedbackKeyPrefix+provider, feedback); err != nil {
+		p.API.LogWarn("Failed to get provider feedback", "provider", provider, "err", err.Error())
+	}
+
+	return feedback
+}
+
+// recordProviderFeedback atomically counts a rating for the provider.
+func (p *Plugin) recordProviderFeedback(provider string, positive bool) error {
+	for {
+		var old *providerFeedback
+		if ok, err := p.Helpers.KVGetJSON(providerFeedbackKeyPrefix+provider, &old); err != nil {
+			return err
+		} else if !ok {
+			old = nil
+		}
+
+		updated := &providerFeedback{}
+		if old != nil {
+			*updated = *old
+		}
+
+		if positive {
+			updated.Positive++
+		} else {
+			updated.Negative++
+		}
+
+		var oldValue interface{}
+		if old != nil {
+			oldValue = old
+		}
+
+		saved, err := p.Helpers.KVCompareAndSetJSON(providerFeedbackKeyPrefix+provider, oldValue, updated)
+		if err != nil {
+			return err
+		}
+
+		if saved {
+			return nil
+		}
+	}
+}
+
+// postFeedback records whether a user found a translation of a provider helpful.
+func (p *Plugin) postFeedback(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to send feedback", http.StatusUnauthorized)
+		return
+	}
+
+	var feedback struct {
+		Provider string `json:"provider"`
+		Positive bool   `json:"positive"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil || !isProviderName(feedback.Provider) {
+		http.Error(w, "Invalid parameter: feedback", http.StatusBadRequest)
+		return
+	}
+
+	if err := p.recordProviderFeedback(feedback.Provider, feedback.Positive); err != nil {
+		p.API.LogError("Failed to record provider feedback", "provider", feedback.Provider, "err", err.Error())
+		http.Error(w, "Failed to record feedback", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getProviderReports returns the latency and feedback of every configured provider.
+func (p *Plugin) getProviderReports(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to view provider reports", http.StatusForbidden)
+		return
+	}
+
+	canary := p.getConfiguration().CanaryProvider
+
+	reports := []*ProviderReport{}
+	for _, provider := range p.getProviders() {
+		calls, failures, averageLatencyMs := p.providerScorer.getTotals(provider.Name())
+		feedback := p.getProviderFeedback(provider.Name())
+
+		reports = append(reports, &ProviderReport{
+			Provider:         provider.Name(),
+			Canary:           provider.Name() == canary,
+			Calls:            calls,
+			Failures:         failures,
+			AverageLatencyMs: averageLatencyMs,
+			PositiveFeedback: feedback.Positive,
+			NegativeFeedback: feedback.Negative,
+		})
+	}
+
+	resp, _ := json.Marshal(reports)
+	w.Write(resp)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	channelCapKeyPrefix   = "channel_cap_"
+	channelUsageKeyPrefix = "channel_usage_"
+
+	settingsKindChannelCap = "channel_cap"
+
+	// channelUsageTTL is how long, in seconds, the usage of a channel is kept after the
+	// month it was counted in started.
+	channelUsageTTL = 62 * 24 * 60 * 60
+)
+
+// channelUsage counts the characters translated for the posts of a channel with a cap in a
+// month.
+type channelUsage struct {
+	Characters int64 `json:"characters"`
+	// Notified is whether System Admins were told the channel went over its cap this month.
+	Notified bool `json:"notified,omitempty"`
+}
+
+func channelUsageKey(channelID, month string) string {
+	return channelUsageKeyPrefix + month + "_" + channelID
+}
+
+// getChannelCap returns the monthly character cap of the channel, and false when it has none.
+func (p *Plugin) getChannelCap(channelID string) (int64, bool) {
+	value, appErr := p.API.KVGet(channelCapKeyPrefix + channelID)
+	if appErr != nil || value == nil {
+		return 0, false
+	}
+
+	characters, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return characters, true
+}
+
+// setChannelCap sets the monthly character cap of the channel, a negative cap removing it, and
+// records the change in the settings audit.
+func (p *Plugin) setChannelCap(requestID, actorID, channelID string, characters int64) *model.AppError {
+	var previous interface{}
+	if old, ok := p.getChannelCap(channelID); ok {
+		previous = old
+	}
+
+	var appErr *model.AppError
+	var current interface{}
+	if characters < 0 {
+		appErr = p.API.KVDelete(channelCapKeyPrefix + channelID)
+	} else {
+		appErr = p.API.KVSet(channelCapKeyPrefix+channelID, []byte(strconv.FormatInt(characters, 10)))
+		current = characters
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindChannelCap, channelID, previous, current)
+
+	return nil
+}
+
+func (p *Plugin) getChannelUsage(channelID, month string) *channelUsage {
+	usage := &channelUsage{}
+	if _, err := p.Helpers.KVGetJSON(channelUsageKey(channelID, month), usage); err != nil {
+		p.API.LogWarn("Failed to get channel usage", "channel_id", channelID, "err", err.Error())
+	}
+
+	return usage
+}
+
+// isOverChannelCap reports whether the posts of the channel used up its cap this month, the
+// channel being limited to detect-only mode for the rest of the month.
+func (p *Plugin) isOverChannelCap(channelID string) bool {
+	characters, ok := p.getChannelCap(channelID)
+	if !ok {
+		return false
+	}
+	if characters == 0 {
+		return true
+	}
+
+	return p.getChannelUsage(channelID, time.Now().UTC().Format(usageMonthFmt)).Characters >= characters
+}
+
+// recordChannelUsage atomically adds the characters translated for a post of the channel to its
+// usage of the month, when the channel has a cap, and tells System Admins the first time in the
+// month the cap is reached. Failures are logged only, the translation is already done.
+func (p *Plugin) recordChannelUsage(channelID string, characters int) {
+	capCharacters, ok := p.getChannelCap(channelID)
+	if !ok {
+		return
+	}
+
+	month := time.Now().UTC().Format(usageMonthFmt)
+	key := channelUsageKey(channelID, month)
+	for {
+		oldValue, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get channel usage", "channel_id", channelID, "err", appErr.Error())
+			return
+		}
+
+		updated := &channelUsage{}
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, updated); err != nil {
+				p.API.LogWarn("Failed to read channel usage", "channel_id", channelID, "err", err.Error())
+				return
+			}
+		}
+		updated.Characters += int64(characters)
+		notify := updated.Characters >= capCharacters && !updated.Notified
+		if notify {
+			updated.Notified = true
+		}
+
+		value, _ := json.Marshal(updated)
+		saved, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        oldValue,
+			ExpireInSeconds: channelUsageTTL,
+		})
+		if appErr != nil {
+			p.API.LogWarn("Failed to save channel usage", "channel_id", channelID, "err", appErr.Error())
+			return
+		}
+		if !saved {
+			continue
+		}
+
+		if notify {
+			p.API.LogWarn("Channel switched to detect-only after crossing its monthly cap", "channel_id", channelID, "characters", updated.Characters, "cap", capCharacters)
+			p.notifyAdminsOfChannelCap(channelID, updated.Characters, capCharacters)
+		}
+		return
+	}
+}
+
+func (p *Plugin) notifyAdminsOfChannelCap(channelID string, total, capCharacters int64) {
+	admins, appErr := p.API.GetUsers(&model.UserGetOptions{Role: model.SYSTEM_ADMIN_ROLE_ID, Page: 0, PerPage: 100})
+	if appErr != nil {
+		p.API.LogError("Failed to get system admins", "err", appErr.Error())
+		return
+	}
+
+	name := channelID
+	if channel, appErr := p.API.GetChannel(channelID); appErr == nil {
+		name = "~" + channel.Name
+		if team, appErr := p.API.GetTeam(channel.TeamId); appErr == nil {
+			name = fmt.Sprintf("~%s in %s", channel.Name, team.DisplayName)
+		}
+	}
+
+	message := fmt.Sprintf("Auto-translation of %s was switched to detect-only for the rest of the month: %d characters were translated for its messages this month, reaching its cap of %d. Run `/autotranslate cap` in the channel to raise or remove the cap.", name, total, capCharacters)
+
+	for _, admin := range admins {
+		channel, appErr := p.API.GetDirectChannel(admin.Id, p.botUserID)
+		if appErr != nil {
+			continue
+		}
+
+		if _, appErr := p.API.CreatePost(&model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channel.Id,
+			Message:   message,
+		}); appErr != nil {
+			p.API.LogWarn("Failed to notify system admin", "user_id", admin.Id, "err", appErr.Error())
+		}
+	}
+}
+
+// executeChannelCapCommand shows or sets the monthly character cap of the current channel.
+func (p *Plugin) executeChannelCapCommand(requestID string, args *model.CommandArgs, param string) string {
+	if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+		return "Only System Admins can cap the translations of channels."
+	}
+
+	if param == "" {
+		characters, ok := p.getChannelCap(args.ChannelId)
+		if !ok {
+			return "This channel has no monthly cap."
+		}
+
+		usage := p.getChannelUsage(args.ChannelId, time.Now().UTC().Format(usageMonthFmt))
+		text := fmt.Sprintf("This channel is capped at `%d` characters a month, `%d` were translated this month.", characters, usage.Characters)
+		if usage.Characters >= characters {
+			text += " Its messages are only labelled with their language until the end of the month."
+		}
+		return text
+	}
+
+	characters := int64(-1)
+	if param != "none" {
+		var err error
+		characters, err = strconv.ParseInt(strings.TrimSpace(param), 10, 64)
+		if err != nil || characters < 0 {
+			return "Invalid parameter. Should be a number of characters, or \"none\"."
+		}
+	}
+
+	if appErr := p.setChannelCap(requestID, args.UserId, args.ChannelId, characters); appErr != nil {
+		return "An error occurred while setting the cap of this channel."
+	}
+
+	switch {
+	case characters < 0:
+		return "This channel no longer has a monthly cap."
+	case characters == 0:
+		return "Messages of this channel are no longer auto-translated, only labelled with their language."
+	default:
+		return fmt.Sprintf("This channel is now capped at `%d` characters a month. Once reached, its messages are only labelled with their language until the end of the month.", characters)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	channelClassKeyPrefix = "channel_class_"
+
+	// classificationInterval is how often channels are classified from their recent posts.
+	classificationInterval = 24 * time.Hour
+	classificationDelay    = 30 * time.Minute
+
+	// classificationLockKey makes a single server of a cluster classify the channels each day.
+	classificationLockKey        = "classification_lock"
+	classificationLockTTLSeconds = 23 * 60 * 60
+
+	classificationSampleSize  = 50
+	classificationMinPosts    = 10
+	classificationMaxChannels = 1000
+	classificationPageSize    = 200
+
+	// classificationBotShare is the share of recent posts sent by bots and integrations above
+	// which a channel is bot-dominated.
+	classificationBotShare = 0.7
+
+	// classificationMonolingualShare is the share of the recent posts of people detected in one
+	// language above which a channel is monolingual.
+	classificationMonolingualShare = 0.9
+
+	channelClassBotDominated = "bot-dominated"
+	channelClassMonolingual  = "monolingual"
+	channelClassMultilingual = "multilingual"
+
+	channelClassificationOff       = "off"
+	channelClassificationRecommend = "recommend"
+	channelClassificationApply     = "apply"
+
+	recommendationPending   = "pending"
+	recommendationApplied   = "applied"
+	recommendationDismissed = "dismissed"
+
+	recommendationSettingCap              = "cap"
+	recommendationSettingOfficialLanguage = "official_language"
+)
+
+// channelRecommendation is a change of the settings of a channel suggested by its class. An
+// empty value removes the setting.
+type channelRecommendation struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	Reason  string `json:"reason"`
+}
+
+// channelClassification is the class of a channel, from its recent posts, and the settings it
+// calls for, which System Admins apply or dismiss unless they are applied automatically.
+type channelClassification struct {
+	ChannelID        string                 `json:"channel_id"`
+	TeamID           string                 `json:"team_id"`
+	Class            string                 `json:"class"`
+	Posts            int                    `json:"posts"`
+	BotShare         float64                `json:"bot_share"`
+	Languages        map[string]int         `json:"languages"`
+	DominantLanguage string                 `json:"dominant_language,omitempty"`
+	Recommendation   *channelRecommendation `json:"recommendation,omitempty"`
+	Status           string                 `json:"status,omitempty"`
+	DecidedBy        string                 `json:"decided_by,omitempty"`
+	ClassifiedAt     int64                  `json:"classified_at"`
+}
+
+// sameRecommendation reports whether two recommendations change the same setting the same way.
+func sameRecommendation(a, b *channelRecommendation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Setting == b.Setting && a.Value == b.Value
+}
+
+// channelClassifier periodically classifies the public channels from their recent posts.
+type channelClassifier struct {
+	plugin *Plugin
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newChannelClassifier(p *Plugin) *channelClassifier {
+	return &channelClassifier{
+		plugin: p,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *channelClassifier) start() {
+	go func() {
+		defer close(c.done)
+
+		timer := time.NewTimer(classificationDelay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-timer.C:
+				c.plugin.safely("channel classification", c.plugin.classifyChannels)
+				timer.Reset(classificationInterval)
+			}
+		}
+	}()
+}
+
+// close stops the classifier, waiting for a running classification to finish.
+func (c *channelClassifier) close() {
+	close(c.stop)
+	<-c.done
+}
+
+// classifyChannels classifies the public channels of every team, unless it is turned off or
+// another server of the cluster is doing it.
+func (p *Plugin) classifyChannels() {
+	mode := p.getConfiguration().ChannelClassification
+	if mode != channelClassificationRecommend && mode != channelClassificationApply {
+		return
+	}
+
+	locked, appErr := p.API.KVSetWithOptions(classificationLockKey, []byte("1"), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: classificationLockTTLSeconds,
+	})
+	if appErr != nil || !locked {
+		return
+	}
+
+	teams, appErr := p.API.GetTeams()
+	if appErr != nil {
+		p.API.LogWarn("Failed to get teams for channel classification", "err", appErr.Error())
+		return
+	}
+
+	bots := map[string]bool{}
+	classified := 0
+	for _, team := range teams {
+		for page := 0; classified < classificationMaxChannels; page++ {
+			channels, appErr := p.API.GetPublicChannelsForTeam(team.Id, page, classificationPageSize)
+			if appErr != nil {
+				break
+			}
+
+			for _, channel := range channels {
+				if channel.DeleteAt != 0 || classified >= classificationMaxChannels {
+					continue
+				}
+				if classification := p.classifyChannel(channel, bots); classification != nil {
+					p.saveChannelClassification(classification, mode == channelClassificationApply)
+					classified++
+				}
+			}
+
+			if len(channels) < classificationPageSize {
+				break
+			}
+		}
+	}
+
+	p.API.LogInfo("Classified channels", "channels", classified)
+}
+
+// isBotPost reports whether the post was sent by a bot account or an integration. bots caches
+// whether the authors are bots.
+func (p *Plugin) isBotPost(post *model.Post, bots map[string]bool) bool {
+	if post.GetProp("from_webhook") == "true" || post.GetProp("from_bot") == "true" {
+		return true
+	}
+
+	isBot, ok := bots[post.UserId]
+	if !ok {
+		user, appErr := p.API.GetUser(post.UserId)
+		isBot = appErr == nil && user.IsBot
+		bots[post.UserId] = isBot
+	}
+
+	return isBot
+}
+
+// classifyChannel classifies the channel from its recent posts, without calling providers, and
+// returns nil when it has too few posts to tell.
+func (p *Plugin) classifyChannel(channel *model.Channel, bots map[string]bool) *channelClassification {
+	postList, appErr := p.API.GetPostsForChannel(channel.Id, 0, classificationSampleSize)
+	if appErr != nil {
+		return nil
+	}
+
+	classification := &channelClassification{
+		ChannelID:    channel.Id,
+		TeamID:       channel.TeamId,
+		Languages:    map[string]int{},
+		ClassifiedAt: model.GetMillis(),
+	}
+
+	botPosts := 0
+	detected := 0
+	for _, post := range postList.ToSlice() {
+		// Translations are posts of the bot, but not what the channel is about.
+		if post.IsSystemMessage() || post.Message == "" || post.UserId == p.botUserID {
+			continue
+		}
+		classification.Posts++
+
+		if p.isBotPost(post, bots) {
+			botPosts++
+			continue
+		}
+
+		text := post.Message
+		if length, ok := originalLength(post); ok {
+			text = text[:length]
+		}
+		if language, confidence := detectLanguageLocally(p.getConfiguration().translatableText(text)); language != "" && confidence >= localDetectionMinConfidence {
+			classification.Languages[language]++
+			detected++
+		}
+	}
+	if classification.Posts < classificationMinPosts {
+		return nil
+	}
+
+	classification.BotShare = float64(botPosts) / float64(classification.Posts)
+	languages := make([]string, 0, len(classification.Languages))
+	for language := range classification.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		if classification.DominantLanguage == "" || classification.Languages[language] > classification.Languages[classification.DominantLanguage] {
+			classification.DominantLanguage = language
+		}
+	}
+
+	switch {
+	case classification.BotShare >= classificationBotShare:
+		classification.Class = channelClassBotDominated
+		if capCharacters, ok := p.getChannelCap(channel.Id); !ok || capCharacters != 0 {
+			classification.Recommendation = &channelRecommendation{
+				Setting: recommendationSettingCap,
+				Value:   "0",
+				Reason:  fmt.Sprintf("%.0f%% of the recent messages were sent by bots and integrations", classification.BotShare*100),
+			}
+		}
+	case detected == 0 || float64(classification.Languages[classification.DominantLanguage])/float64(detected) >= classificationMonolingualShare:
+		classification.Class = channelClassMonolingual
+		if classification.DominantLanguage != "" && p.getOfficialLanguage(channel.Id) == "" {
+			classification.Recommendation = &channelRecommendation{
+				Setting: recommendationSettingOfficialLanguage,
+				Value:   classification.DominantLanguage,
+				Reason:  fmt.Sprintf("the recent messages of people are written in %s", languageName(classification.DominantLanguage)),
+			}
+		}
+	default:
+		classification.Class = channelClassMultilingual
+		if capCharacters, ok := p.getChannelCap(channel.Id); ok && capCharacters == 0 {
+			classification.Recommendation = &channelRecommendation{
+				Setting: recommendationSettingCap,
+				Value:   "",
+				Reason:  fmt.Sprintf("people write the recent messages in %d languages, but the channel is never auto-translated", len(classification.Languages)),
+			}
+		}
+	}
+
+	return classification
+}
+
+func (p *Plugin) getChannelClassification(channelID string) *channelClassification {
+	var classification *channelClassification
+	if _, err := p.Helpers.KVGetJSON(channelClassKeyPrefix+channelID, &classification); err != nil {
+		p.API.LogWarn("Failed to get channel classification", "channel_id", channelID, "err", err.Error())
+		return nil
+	}
+
+	return classification
+}
+
+// saveChannelClassification saves the classification of a channel, applying its recommendation
+// when asked to. A recommendation System Admins already applied or dismissed keeps its status.
+func (p *Plugin) saveChannelClassification(classification *channelClassification, apply bool) {
+	if classification.Recommendation != nil {
+		classification.Status = recommendationPending
+		if previous := p.getChannelClassification(classification.ChannelID); previous != nil && previous.Status != recommendationPending && sameRecommendation(previous.Recommendation, classification.Recommendation) {
+			classification.Status = previous.Status
+			classification.DecidedBy = previous.DecidedBy
+		}
+
+		if apply && classification.Status == recommendationPending {
+			if appErr := p.applyChannelRecommendation(newRequestID(), p.botUserID, classification.ChannelID, classification.Recommendation); appErr != nil {
+				p.API.LogWarn("Failed to apply channel recommendation", "channel_id", classification.ChannelID, "err", appErr.Error())
+			} else {
+				classification.Status = recommendationApplied
+				classification.DecidedBy = p.botUserID
+			}
+		}
+	}
+
+	if err := p.Helpers.KVSetJSON(channelClassKeyPrefix+classification.ChannelID, classification); err != nil {
+		p.API.LogWarn("Failed to save channel classification", "channel_id", classification.ChannelID, "err", err.Error())
+	}
+}
+
+// applyChannelRecommendation changes the setting of the channel as recommended, recording the
+// change in the settings audit as made by the actor.
+func (p *Plugin) applyChannelRecommendation(requestID, actorID, channelID string, recommendation *channelRecommendation) *model.AppError {
+	switch recommendation.Setting {
+	case recommendationSettingCap:
+		characters := int64(-1)
+		if recommendation.Value != "" {
+			characters = 0
+		}
+		return p.setChannelCap(requestID, actorID, channelID, characters)
+	case recommendationSettingOfficialLanguage:
+		return p.setOfficialLanguage(requestID, actorID, channelID, recommendation.Value)
+	}
+
+	return model.NewAppError("applyChannelRecommendation", "Unknown setting", nil, recommendation.Setting, http.StatusBadRequest)
+}
+
+// listChannelClassifications returns the classifications of the channels, those with a pending
+// recommendation first.
+func (p *Plugin) listChannelClassifications() ([]*channelClassification, error) {
+	classifications := []*channelClassification{}
+	err := forEachKVKey(p.API, channelClassKeyPrefix, func(key string) error {
+		if classification := p.getChannelClassification(strings.TrimPrefix(key, channelClassKeyPrefix)); classification != nil {
+			classifications = append(classifications, classification)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(classifications, func(i, j int) bool {
+		pendingI := classifications[i].Status == recommendationPending
+		pendingJ := classifications[j].Status == recommendationPending
+		if pendingI != pendingJ {
+			return pendingI
+		}
+		return classifications[i].ChannelID < classifications[j].ChannelID
+	})
+
+	return classifications, nil
+}
+
+// handleChannelClassifications lets System Admins review the classes of channels, and apply or
+// dismiss the settings they call for.
+func (p *Plugin) handleChannelClassifications(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to review channel classifications", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		classifications, err := p.listChannelClassifications()
+		if err != nil {
+			http.Error(w, "Failed to list channel classifications", http.StatusInternalServerError)
+			return
+		}
+
+		if status := r.URL.Query().Get("status"); status != "" {
+			filtered := []*channelClassification{}
+			for _, classification := range classifications {
+				if classification.Status == status {
+					filtered = append(filtered, classification)
+				}
+			}
+			classifications = filtered
+		}
+
+		resp, _ := json.Marshal(classifications)
+		w.Write(resp)
+	case http.MethodPost:
+		var decision struct {
+			ChannelID string `json:"channel_id"`
+			Action    string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil || (decision.Action != "apply" && decision.Action != "dismiss") {
+			http.Error(w, "Invalid parameter: action", http.StatusBadRequest)
+			return
+		}
+
+		classification := p.getChannelClassification(decision.ChannelID)
+		if classification == nil || classification.Recommendation == nil || classification.Status != recommendationPending {
+			http.Error(w, "No pending recommendation for the channel", http.StatusNotFound)
+			return
+		}
+
+		classification.Status = recommendationDismissed
+		if decision.Action == "apply" {
+			if appErr := p.applyChannelRecommendation(newRequestID(), userID, classification.ChannelID, classification.Recommendation); appErr != nil {
+				http.Error(w, "Failed to apply the recommendation", http.StatusInternalServerError)
+				return
+			}
+			classification.Status = recommendationApplied
+		}
+		classification.DecidedBy = userID
+
+		if err := p.Helpers.KVSetJSON(channelClassKeyPrefix+classification.ChannelID, classification); err != nil {
+			http.Error(w, "Failed to save the decision", http.StatusInternalServerError)
+			return
+		}
+
+		resp, _ := json.Marshal(classification)
+		w.Write(resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	channelDomainKeyPrefix = "channel_domain_"
+
+	settingsKindChannelDomain = "channel_domain"
+
+	channelDomainLegal       = "legal"
+	channelDomainMedical     = "medical"
+	channelDomainEngineering = "engineering"
+)
+
+// channelDomainPrompts holds, by domain, what LLM providers are told about the messages of the
+// channels tagged with it.
+var channelDomainPrompts = map[string]string{
+	channelDomainLegal:       "The message comes from a conversation about legal matters: use the established legal terminology of the target language and keep terms of art precise rather than simplified.",
+	channelDomainMedical:     "The message comes from a conversation between healthcare professionals: use the established medical terminology of the target language and keep drug names, dosages and abbreviations exact.",
+	channelDomainEngineering: "The message comes from a conversation between engineers: keep technical terms, product names, identifiers and units as engineers of the target language would write them, leaving untranslated the ones they use in English.",
+}
+
+// channelDomainNames returns the supported domains, sorted.
+func channelDomainNames() []string {
+	names := make([]string, 0, len(channelDomainPrompts))
+	for name := range channelDomainPrompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// getChannelDomain returns the domain the channel is tagged with, or an empty string when it
+// has none.
+func (p *Plugin) getChannelDomain(channelID string) string {
+	value, appErr := p.API.KVGet(channelDomainKeyPrefix + channelID)
+	if appErr != nil || value == nil {
+		return ""
+	}
+
+	return string(value)
+}
+
+// setChannelDomain tags the channel with a domain, an empty domain removing the tag, and
+// records the change in the settings audit.
+func (p *Plugin) setChannelDomain(requestID, actorID, channelID, domain string) *model.AppError {
+	previous := p.getChannelDomain(channelID)
+
+	var appErr *model.AppError
+	if domain == "" {
+		appErr = p.API.KVDelete(channelDomainKeyPrefix + channelID)
+	} else {
+		appErr = p.API.KVSet(channelDomainKeyPrefix+channelID, []byte(domain))
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindChannelDomain, channelID, previous, domain)
+
+	return nil
+}
+
+// getRequestDomain returns the domain of the channel whose glossaries the translations of the
+// request apply, if any.
+func (p *Plugin) getRequestDomain(requestID string) string {
+	channelID, ok := p.requestGlossaries.Load(requestID)
+	if !ok {
+		return ""
+	}
+
+	return p.getChannelDomain(channelID.(string))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	channelLanguagesKeyPrefix = "channel_langs_"
+
+	// channelLanguagesTTL is how long, in seconds, the dominant languages of a channel are cached.
+	channelLanguagesTTL = 24 * 60 * 60
+
+	channelLanguagesSampleSize = 20
+	maxChannelLanguages        = 3
+)
+
+// getChannelLanguages returns the dominant languages of a channel, most used first, based on a
+// sample of its recent posts. The result is cached since it requires detecting every post.
+func (p *Plugin) getChannelLanguages(requestID, channelID string) []string {
+	var languages []string
+	if ok, err := p.Helpers.KVGetJSON(channelLanguagesKeyPrefix+channelID, &languages); err == nil && ok {
+		return languages
+	}
+
+	postList, appErr := p.API.GetPostsForChannel(channelID, 0, channelLanguagesSampleSize)
+	if appErr != nil {
+		return nil
+	}
+
+	var posts []*model.Post
+	for _, post := range postList.ToSlice() {
+		if !post.IsSystemMessage() && post.Message != "" {
+			posts = append(posts, post)
+		}
+	}
+
+	counts := map[string]int{}
+	detected, errs := p.resolveSourceLanguages(requestID, posts)
+	for i, language := range detected {
+		if errs[i] != nil {
+			continue
+		}
+		counts[language]++
+	}
+
+	for language := range counts {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if counts[languages[i]] == counts[languages[j]] {
+			return languages[i] < languages[j]
+		}
+		return counts[languages[i]] > counts[languages[j]]
+	})
+
+	if len(languages) > maxChannelLanguages {
+		languages = languages[:maxChannelLanguages]
+	}
+
+	if err := p.Helpers.KVSetWithExpiryJSON(channelLanguagesKeyPrefix+channelID, languages, channelLanguagesTTL); err != nil {
+		p.API.LogWarn("Failed to cache channel languages", "channel_id", channelID, "err", err.Error())
+	}
+
+	return languages
+}
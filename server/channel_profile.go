@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sync"
+	"unicode"
+)
+
+const (
+	// channelProfileSize is the number of recent detections kept per channel.
+	channelProfileSize = 20
+
+	// channelProfileMinShare is the share of the recent detections the dominant language of a
+	// channel must have for new posts to be assumed in that language.
+	channelProfileMinShare = 0.9
+
+	// channelProfileVerifyEvery makes every Nth post still detected, so that the profile follows
+	// channels whose language changes.
+	channelProfileVerifyEvery = 5
+)
+
+// channelProfile is the rolling record of the languages and scripts detected in the new posts
+// of a channel.
+type channelProfile struct {
+	lock      sync.Mutex
+	languages []string
+	scripts   []string
+	next      int
+	guessed   int
+}
+
+// record adds a detection to the profile, replacing the oldest one when it is full.
+func (c *channelProfile) record(language, script string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.languages) < channelProfileSize {
+		c.languages = append(c.languages, language)
+		c.scripts = append(c.scripts, script)
+		return
+	}
+
+	c.languages[c.next] = language
+	c.scripts[c.next] = script
+	c.next = (c.next + 1) % channelProfileSize
+}
+
+// guess returns the dominant language of the channel and its share of the recent detections,
+// when a text written in the script is safe to assume in that language without detecting it.
+func (c *channelProfile) guess(script string) (string, float64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if script == "" || len(c.languages) < channelProfileSize {
+		return "", 0, false
+	}
+
+	language, count := dominant(c.languages)
+	share := float64(count) / float64(len(c.languages))
+	if share < channelProfileMinShare {
+		return "", 0, false
+	}
+
+	// A text in another script than usual, such as Japanese in an English channel, is detected.
+	if dominantScript, _ := dominant(c.scripts); script != dominantScript {
+		return "", 0, false
+	}
+
+	c.guessed++
+	if c.guessed%channelProfileVerifyEvery == 0 {
+		return "", 0, false
+	}
+
+	return language, share, true
+}
+
+// dominant returns the most frequent value and its count.
+func dominant(values []string) (string, int) {
+	counts := map[string]int{}
+	best, bestCount := "", 0
+	for _, value := range values {
+		counts[value]++
+		if counts[value] > bestCount {
+			best, bestCount = value, counts[value]
+		}
+	}
+
+	return best, bestCount
+}
+
+// textScripts lists the scripts told apart by textScript.
+var textScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Hangul", unicode.Hangul},
+	{"Han", unicode.Han},
+}
+
+// textScript returns the script most letters of the text are written in, or an empty string
+// when the text has no letter. Texts with kana are Japanese whatever the share of kanji.
+func textScript(text string) string {
+	counts := map[string]int{}
+	for _, r := range text {
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			return "Kana"
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		name := "Other"
+		for _, script := range textScripts {
+			if unicode.Is(script.table, r) {
+				name = script.name
+				break
+			}
+		}
+		counts[name]++
+	}
+
+	best, bestCount := "", 0
+	for name, count := range counts {
+		if count > bestCount || (count == bestCount && name < best) {
+			best, bestCount = name, count
+		}
+	}
+
+	return best
+}
+
+// getChannelProfile returns the profile of the channel, creating it when needed.
+func (p *Plugin) getChannelProfile(channelID string) *channelProfile {
+	profile, _ := p.channelProfiles.LoadOrStore(channelID, &channelProfile{})
+	return profile.(*channelProfile)
+}
+
+// resolveNewPostLanguage is resolveSourceLanguageWithConfidence for a new post of the channel,
+// which assumes the dominant language of the channel instead of detecting texts that are
+// likely in it.
+func (p *Plugin) resolveNewPostLanguage(requestID, channelID, senderID, text string) (string, float64, error) {
+	if !p.getConfiguration().ChannelLanguagePrior {
+		return p.resolveSourceLanguageWithConfidence(requestID, senderID, text)
+	}
+
+	if language := p.getSenderLanguage(senderID); language != "" {
+		return language, 1, nil
+	}
+
+	profile := p.getChannelProfile(channelID)
+	script := textScript(text)
+	if language, share, ok := profile.guess(script); ok {
+		return language, share, nil
+	}
+
+	language, confidence, err := p.detectLanguageWithConfidence(requestID, text)
+	if err != nil {
+		return "", 0, err
+	}
+	profile.record(language, script)
+
+	return language, confidence, nil
+}
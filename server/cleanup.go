@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	// cleanupInterval is how often the data of deactivated and deleted users, and the data past
+	// its retention period, is removed. The plugin API this plugin is built against has no hook
+	// for user deactivation.
+	cleanupInterval = 24 * time.Hour
+	cleanupDelay    = 10 * time.Minute
+
+	// cleanupLockKey makes a single server of a cluster run the cleanup of each day.
+	cleanupLockKey        = "cleanup_lock"
+	cleanupLockTTLSeconds = 23 * 60 * 60
+)
+
+// userKeyPrefixes lists the prefixes of the keys holding the data of a single user, followed
+// by the user ID. The user info is stored under the user ID itself. Queued translations belong
+// to a user too, see ownerOfKey. Usage counters and the settings audit are kept for reporting,
+// and the translation histories of posts, which other users corrected, until their retention
+// period.
+var userKeyPrefixes = []string{profileIndexKeyPrefix, profileKeyPrefix, skipNextKeyPrefix, senderLanguageKeyPrefix}
+
+// userIDOfKey returns the ID of the user whose data is stored under the key, or an empty
+// string when the key does not belong to a single user.
+func userIDOfKey(key string) string {
+	if model.IsValidId(key) {
+		return key
+	}
+
+	for _, prefix := range userKeyPrefixes {
+		if rest := strings.TrimPrefix(key, prefix); rest != key && len(rest) >= 26 && model.IsValidId(rest[:26]) {
+			return rest[:26]
+		}
+	}
+
+	return ""
+}
+
+// ownerOfKey returns the ID of the user whose data is stored under the key, or an empty string
+// when the key does not belong to a single user. Queued translations belong to the user who
+// requested them.
+func (p *Plugin) ownerOfKey(key string) string {
+	if !strings.HasPrefix(key, queuedJobKeyPrefix) {
+		return userIDOfKey(key)
+	}
+
+	var job *translationJob
+	if _, err := p.Helpers.KVGetJSON(key, &job); err != nil || job == nil {
+		return ""
+	}
+	return job.UserID
+}
+
+// dataCleaner periodically removes the data of deactivated and deleted users, so that the KV
+// store does not grow with every user who ever used the plugin, and the data past its retention
+// period.
+type dataCleaner struct {
+	plugin *Plugin
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newDataCleaner(p *Plugin) *dataCleaner {
+	return &dataCleaner{
+		plugin: p,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (d *dataCleaner) start() {
+	go func() {
+		defer close(d.done)
+
+		timer := time.NewTimer(cleanupDelay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-timer.C:
+				d.plugin.safely("cleanup", d.plugin.cleanup)
+				timer.Reset(cleanupInterval)
+			}
+		}
+	}()
+}
+
+// close stops the cleaner, waiting for a running cleanup to finish.
+func (d *dataCleaner) close() {
+	close(d.stop)
+	<-d.done
+}
+
+// cleanup removes the data of inactive users and the data past its retention period, unless
+// another server of the cluster is doing it.
+func (p *Plugin) cleanup() {
+	locked, appErr := p.API.KVSetWithOptions(cleanupLockKey, []byte("1"), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: cleanupLockTTLSeconds,
+	})
+	if appErr != nil || !locked {
+		return
+	}
+
+	p.cleanupInactiveUsers()
+	p.enforceRetention()
+}
+
+// cleanupInactiveUsers removes the settings, profiles, caches and queued translations of
+// deactivated and deleted users.
+func (p *Plugin) cleanupInactiveUsers() {
+	inactive := map[string]bool{}
+	var keys []string
+	err := forEachKVKey(p.API, "", func(key string) error {
+		userID := p.ownerOfKey(key)
+		if userID == "" {
+			return nil
+		}
+
+		isInactive, ok := inactive[userID]
+		if !ok {
+			user, appErr := p.API.GetUser(userID)
+			isInactive = (appErr != nil && appErr.StatusCode == http.StatusNotFound) || (user != nil && user.DeleteAt != 0)
+			inactive[userID] = isInactive
+		}
+
+		if isInactive {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		p.API.LogError("Failed to list data for cleanup", "err", err.Error())
+		return
+	}
+
+	for _, key := range keys {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			p.API.LogWarn("Failed to delete data of inactive user", "key", key, "err", appErr.Error())
+		}
+	}
+
+	for userID, isInactive := range inactive {
+		if isInactive {
+			p.userInfoCache.Delete(userID)
+		}
+	}
+
+	if len(keys) > 0 {
+		p.API.LogInfo("Removed data of inactive users", "keys", len(keys))
+	}
+}
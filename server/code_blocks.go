@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// codeBlocksTranslate sends code to providers like the rest of the message.
+	codeBlocksTranslate = "translate"
+	// codeBlocksSkip keeps code from being translated.
+	codeBlocksSkip = "skip"
+	// codeBlocksComments translates only the comments of code blocks.
+	codeBlocksComments = "comments"
+)
+
+var (
+	// codeCommentRegexp matches the lines carrying the comments of code blocks to providers.
+	codeCommentRegexp = regexp.MustCompile(`(?m)^[ \t]*` + codeCommentPlaceholders.pattern + `[ \t]*(.*)$\n?`)
+
+	inlineCodeRegexp = regexp.MustCompile("`[^`\n]+`")
+)
+
+// commentSyntax is how comments are written in a programming language.
+type commentSyntax struct {
+	line       []string
+	blockStart string
+	blockEnd   string
+	// wholeLine only recognizes line comments starting a line, for code of unknown language.
+	wholeLine bool
+}
+
+var (
+	cComments    = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/"}
+	hashComments = commentSyntax{line: []string{"#"}}
+	dashComments = commentSyntax{line: []string{"--"}}
+	semiComments = commentSyntax{line: []string{";"}}
+	percComments = commentSyntax{line: []string{"%"}}
+	htmlComments = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+	cssComments  = commentSyntax{blockStart: "/*", blockEnd: "*/"}
+
+	unknownComments = commentSyntax{line: []string{"//", "#"}, wholeLine: true}
+)
+
+// commentLanguages lists, by syntax of comments, the languages of code blocks as written after
+// their fence.
+var commentLanguages = []struct {
+	syntax    commentSyntax
+	languages []string
+}{
+	{cComments, []string{"c", "h", "cpp", "c++", "cc", "java", "js", "javascript", "jsx", "ts", "typescript", "tsx", "go", "golang", "rust", "rs", "swift", "kotlin", "kt", "scala", "cs", "csharp", "php", "dart", "groovy", "scss", "less", "proto", "protobuf"}},
+	{cssComments, []string{"css"}},
+	{hashComments, []string{"python", "py", "ruby", "rb", "sh", "bash", "shell", "zsh", "yaml", "yml", "perl", "pl", "r", "toml", "dockerfile", "makefile", "make", "powershell", "ps1", "elixir", "ex", "nim"}},
+	{dashComments, []string{"sql", "lua", "haskell", "hs"}},
+	{semiComments, []string{"lisp", "clojure", "clj", "scheme", "asm", "ini"}},
+	{percComments, []string{"tex", "latex", "erlang", "matlab"}},
+	{htmlComments, []string{"html", "xml", "svg", "vue", "markdown", "md"}},
+}
+
+// getCommentSyntax returns the syntax of comments of the language of a code block.
+func getCommentSyntax(language string) commentSyntax {
+	language = strings.ToLower(language)
+	for _, entry := range commentLanguages {
+		for _, name := range entry.languages {
+			if name == language {
+				return entry.syntax
+			}
+		}
+	}
+
+	return unknownComments
+}
+
+// codeComment is a comment found in a line of code, between the prefix and the suffix.
+type codeComment struct {
+	prefix string
+	text   string
+	suffix string
+}
+
+// indexOutsideQuotes returns the index of the first occurrence of marker in the line outside
+// string literals, or -1.
+func indexOutsideQuotes(line, marker string) int {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != 0:
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case strings.HasPrefix(line[i:], marker):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// findComment returns the comment of a line of code, if any, and whether a block comment is
+// still open at its end. inBlock is whether a block comment was open at its start.
+func (s commentSyntax) findComment(line string, inBlock bool) (*codeComment, bool) {
+	if inBlock {
+		end := strings.Index(line, s.blockEnd)
+		text := line
+		suffix := ""
+		if end >= 0 {
+			text, suffix = line[:end], line[end:]
+		}
+
+		// Lines of block comments are often decorated with a leading "*".
+		trimmed := strings.TrimLeft(text, " \t")
+		if strings.HasPrefix(trimmed, "*") && !strings.HasPrefix(trimmed, s.blockEnd) {
+			trimmed = trimmed[1:]
+		}
+		prefix := text[:len(text)-len(trimmed)]
+
+		return &codeComment{prefix: prefix, text: trimmed, suffix: suffix}, end < 0
+	}
+
+	start, marker, block := -1, "", false
+	if s.blockStart != "" {
+		if index := indexOutsideQuotes(line, s.blockStart); index >= 0 {
+			start, marker, block = index, s.blockStart, true
+		}
+	}
+	for _, lineMarker := range s.line {
+		index := indexOutsideQuotes(line, lineMarker)
+		if index < 0 || (start >= 0 && index >= start) {
+			continue
+		}
+		if s.wholeLine && strings.TrimSpace(line[:index]) != "" {
+			continue
+		}
+		start, marker, block = index, lineMarker, false
+	}
+	if start < 0 {
+		return nil, false
+	}
+
+	prefix := line[:start+len(marker)]
+	text := line[start+len(marker):]
+	if !block {
+		return &codeComment{prefix: prefix, text: text}, false
+	}
+
+	end := strings.Index(text, s.blockEnd)
+	if end < 0 {
+		return &codeComment{prefix: prefix, text: text}, true
+	}
+
+	return &codeComment{prefix: prefix, text: text[:end], suffix: text[end:]}, false
+}
+
+// codeProcessor keeps code blocks and inline code from being translated, translating only the
+// comments of code blocks in comments mode. In translate mode, it leaves the text as it is.
+type codeProcessor struct {
+	mode string
+}
+
+func (codeProcessor) Name() string {
+	return "code"
+}
+
+// hasLetters reports whether a comment has words to translate.
+func hasLetters(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c codeProcessor) Before(text string, state *processingState) string {
+	if c.mode != codeBlocksSkip && c.mode != codeBlocksComments {
+		return text
+	}
+
+	var code, comments []string
+	protect := func(value string) string {
+		return codePlaceholders.protect(&code, value)
+	}
+
+	var out []string
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~") {
+			out = append(out, inlineCodeRegexp.ReplaceAllStringFunc(lines[i], protect))
+			continue
+		}
+
+		fence := trimmed[:3]
+		language := ""
+		if fields := strings.Fields(trimmed[3:]); len(fields) > 0 {
+			language = fields[0]
+		}
+		syntax := getCommentSyntax(language)
+
+		// The block runs to its closing fence, or to the end of the message.
+		block := []string{lines[i]}
+		var blockComments []string
+		inComment := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				block = append(block, line)
+				break
+			}
+
+			if c.mode == codeBlocksComments {
+				var comment *codeComment
+				comment, inComment = syntax.findComment(line, inComment)
+				if comment != nil && hasLetters(comment.text) {
+					blockComments = append(blockComments, codeCommentPlaceholders.placeholder(len(comments))+" "+strings.TrimSpace(comment.text))
+					comments = append(comments, comment.text)
+					line = fmt.Sprintf("%s\x00%d\x00%s", comment.prefix, len(comments)-1, comment.suffix)
+				}
+			}
+			block = append(block, line)
+		}
+
+		out = append(out, protect(strings.Join(block, "\n")))
+		out = append(out, blockComments...)
+	}
+
+	state.values[c.Name()] = code
+	state.values[c.Name()+"_comments"] = comments
+	return strings.Join(out, "\n")
+}
+
+var codeCommentSlotRegexp = regexp.MustCompile("\x00(\\d+)\x00")
+
+func (c codeProcessor) After(text string, state *processingState) string {
+	code := state.values[c.Name()]
+	comments := state.values[c.Name()+"_comments"]
+	if len(code) == 0 {
+		return text
+	}
+
+	// Comments keep the spacing of the original around their translation.
+	translatedComments := map[int]string{}
+	text = codeCommentRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		groups := codeCommentRegexp.FindStringSubmatch(match)
+		index, _ := strconv.Atoi(groups[1])
+		if index < len(comments) {
+			original := comments[index]
+			leading := original[:len(original)-len(strings.TrimLeft(original, " \t"))]
+			trailing := original[len(strings.TrimRight(original, " \t")):]
+			translatedComments[index] = leading + strings.TrimSpace(groups[2]) + trailing
+		}
+		return ""
+	})
+
+	return codePlaceholders.restoreFunc(text, len(code), func(index int) string {
+		return codeCommentSlotRegexp.ReplaceAllStringFunc(code[index], func(slot string) string {
+			comment, _ := strconv.Atoi(codeCommentSlotRegexp.FindStringSubmatch(slot)[1])
+			if translated, ok := translatedComments[comment]; ok {
+				return translated
+			}
+			return comments[comment]
+		})
+	})
+}
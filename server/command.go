@@ -27,6 +27,39 @@ This plugin is powered by Amazon Translate which is a text translation service t
   * |value| can be any of the [supported language codes](https://docs.aws.amazon.com/translate/latest/dg/what-is.html) or "auto" to automatically detect language used.
 * |/autotranslate target [value]| - Update your autotranslation target
   * |value| can be any of the [supported language codes](https://docs.aws.amazon.com/translate/latest/dg/what-is.html).
+* |/autotranslate provider [value]| - Choose the provider handling your translations, if allowed by your System Admin
+  * |value| can be "aws", "deepl", "llm" or "auto" to let the plugin pick the best one.
+* |/autotranslate display [value]| - Choose how the translations of your messages are shown
+  * |value| can be "append" to add them to your message, "ephemeral" to only show them to you, "thread-reply" to post them as a reply, "props-toggle" to let readers show them on demand, or "dm" to receive them by direct message.
+* |/autotranslate profile [name]| - Switch to the source, target and display mode saved as a profile
+  * |/autotranslate profile save [name]| saves your current settings as a profile, |/autotranslate profile delete [name]| deletes one and |/autotranslate profile list| lists them.
+* |/autotranslate team [setting] [value]| - For team admins, set the defaults of the members of the current team
+  * |setting| can be "target" with a language code, "display" with a display mode, or "lock" with "on" or "off" to prevent members from changing them. Use "none" as value to clear a default.
+* |/autotranslate bulk [action] [scope]| - For System Admins, turn auto-translation on or off for all members of the current team or channel
+  * |action| can be "enable" or "disable" and |scope| can be "team" or "channel".
+* |/autotranslate romanize [value]| - Show the romanized original, such as romaji or pinyin, with the translations you request
+  * |value| can be "on" or "off".
+* |!fr| at the start of a message - Translate this message into French, whatever your settings. Use |!ja>fr| to also set the source language, or |!ja>| to set only the source language.
+* |/autotranslate precorrect [value]| - Fix typos in your messages before they are translated, if enabled by your System Admin. Your message is posted as you wrote it.
+  * |value| can be "on" or "off".
+* |/autotranslate currency [value]| - Follow amounts of money in the translations you request with their approximate value in your currency
+  * |value| can be a currency code such as "USD", "EUR" or "JPY", or "off".
+* |/autotranslate learning [value]| - Set the learning mode of the current channel, if you can manage it
+  * |value| can be "on" to show each line of the original above its translation, "annotated" to also add romaji or pinyin, or "off".
+* |/autotranslate official [language code]| - Set the language the messages of the current channel are expected in, if you can manage it. Authors of messages in other languages are offered to translate them. Use "none" to remove it.
+* |/autotranslate domain [value]| - Tag the current channel with a domain, if you can manage it, so that its translations use the glossary of the domain and, with the LLM provider, its terminology
+  * |value| can be "legal", "medical", "engineering" or "none".
+* |/autotranslate cap [characters]| - For System Admins, cap the characters translated each month for the messages of the current channel. Once the cap is reached, messages are only labelled with their language until the end of the month. Use 0 to never auto-translate the channel, "none" to remove the cap, or no value to show the cap and this month's usage.
+* |/autotranslate glossary [action]| - Manage the glossary of the current channel, or of its team by adding "team" after the action, if you can manage it. System Admins manage the glossary of the domain of the channel by adding "domain". Channel terms take precedence over team terms, and team terms over domain terms.
+  * |action| can be "list", "add ja:en [term] = [translation]" or "remove ja:en [term]". Adding a term warns about the other glossaries translating it differently.
+* |/autotranslate correct [message link] [better translation]| - Replace the translation of a message with yours, if allowed by your System Admin. The translation shown in the message is corrected for everyone, otherwise the one readers of your language are shown. Your correction is reused for the same text from then on.
+* |/autotranslate skip| - Do not translate your next message. Starting a message with the skip marker, |!nt| by default, does the same.
+* |/autotranslate usage| - Show how many characters were translated for you this month, your remaining quota and your most used language pairs
+* |/autotranslate saved| - Receive a direct message with your saved messages translated into your target language
+* |/autotranslate diagnostics| - For System Admins, check the configuration, providers, storage, bot account and background jobs of the plugin
+* |/autotranslate benchmark [count] [provider]| - For System Admins, run synthetic translations and receive their throughput, latencies and error rate by direct message
+  * |count| defaults to 100. |provider| defaults to "mock", which simulates translations without cost. Benchmarks against a real provider are limited to 50 translations.
+* |/autotranslate preset [name]| - For System Admins, apply a bundle of settings: "cost-saver", "quality-first" or "privacy-strict". Without a name, the presets are described.
 * |Language codes|: See [AWS Translate supported languages](https://docs.aws.amazon.com/translate/latest/dg/what-is.html)
   `
 
@@ -40,9 +73,12 @@ const translateHelp = `
 	* |value| can be any of the [supported language codes](https://docs.aws.amazon.com/translate/latest/dg/what-is.html) or "auto" to automatically detect language used.
   * |/translate target [value]| - Update your translation target
 	* |value| can be any of the [supported language codes](https://docs.aws.amazon.com/translate/latest/dg/what-is.html).
+  * |/translate correct [message link] [better translation]| - Replace the translation of a message with yours, if allowed by your System Admin
   * |Language codes|: See [AWS Translate supported languages](https://docs.aws.amazon.com/translate/latest/dg/what-is.html)
 	`
 
+const teamLockedMessage = "Your team admin locked the target language and display mode of the members of your team."
+
 // See https://docs.aws.amazon.com/translate/latest/dg/what-is.html for updated supported languages.
 // Below is hard-coded but would be nice if AWS SDK supports getting the list programmatically
 // which is not the case currently.
@@ -130,7 +166,7 @@ func (p *Plugin) registerCommands() error {
 		DisplayName:      "Autotranslate",
 		Description:      "Mattermost Autotranslation Plugin",
 		AutoComplete:     true,
-		AutoCompleteDesc: "Available commands: info, on, off, source, target, help",
+		AutoCompleteDesc: "Available commands: info, on, off, source, target, provider, display, profile, team, bulk, romanize, precorrect, currency, learning, official, domain, cap, glossary, correct, skip, usage, saved, diagnostics, benchmark, preset, help",
 		AutoCompleteHint: "[command]",
 	}); err != nil {
 		return errors.Wrap(err, "failed to register autotranslate command")
@@ -142,7 +178,7 @@ func (p *Plugin) registerCommands() error {
 		DisplayName:      "Translate",
 		Description:      "Mattermost Translate Plugin",
 		AutoComplete:     true,
-		AutoCompleteDesc: "Available commands: on, off, help",
+		AutoCompleteDesc: "Available commands: on, off, correct, help",
 		AutoCompleteHint: "[command]",
 	}); err != nil {
 		return errors.Wrap(err, "failed to register translate command")
@@ -162,11 +198,17 @@ func getCommandResponse(responseType, text string) *model.CommandResponse {
 
 func setUserInfoCommandResponse(userInfo *UserInfo, err *APIErrorResponse, action string) (*model.CommandResponse, *model.AppError) {
 	var actionMapping = map[string]interface{}{
-		"source": "setting up language source of autotranslation plugin",
-		"target": "setting up language target of autotranslation plugin",
-		"on":     "turning on the autotranslation plugin",
-		"off":    "turning off the autotranslation plugin",
-		"info":   "getting user information",
+		"source":     "setting up language source of autotranslation plugin",
+		"target":     "setting up language target of autotranslation plugin",
+		"on":         "turning on the autotranslation plugin",
+		"off":        "turning off the autotranslation plugin",
+		"info":       "getting user information",
+		"provider":   "setting up the translation provider of autotranslation plugin",
+		"display":    "setting up the display mode of autotranslation plugin",
+		"profile":    "switching the profile of autotranslation plugin",
+		"romanize":   "setting up the romanization of autotranslation plugin",
+		"precorrect": "setting up the pre-correction of autotranslation plugin",
+		"currency":   "setting up the currency of autotranslation plugin",
 	}
 
 	if err != nil {
@@ -223,8 +265,11 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, text), nil
 	}
 
+	// requestID identifies the command in logs, error messages and the settings audit.
+	requestID := newRequestID()
+
 	userInfo, err := p.getUserInfo(args.UserId)
-	if userInfo == nil && action != "on" {
+	if userInfo == nil && action != "on" && action != "usage" && action != "diagnostics" && action != "benchmark" && action != "preset" && action != "cap" && action != "glossary" && action != "correct" {
 		text = "No record found. Try `/autotranslate on` to enable."
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, text), nil
 	}
@@ -235,15 +280,25 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 			"Your autotranslation plugin settings:\n * Active: `%s`\n * Language: `source: %s`, `target: %s`\n",
 			userInfo.getActivatedString(), languageCodes[userInfo.SourceLanguage], languageCodes[userInfo.TargetLanguage],
 		)
+		if userInfo.Activated && !p.isAutoTranslating(args.UserId, userInfo) {
+			text += "Auto-translation is being rolled out gradually and your messages are not translated yet.\n"
+		}
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, text), nil
 	case "on":
+		if configErr := p.IsValid(); configErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.unconfiguredMessage(args.UserId, configErr)), nil
+		}
+
 		if userInfo == nil {
 			userInfo = p.NewUserInfo(args.UserId)
+			if args.TeamId != "" {
+				p.getTeamSettings(args.TeamId).applyTeamDefaults(userInfo)
+			}
 		} else {
 			userInfo.Activated = true
 		}
 
-		err = p.setUserInfo(userInfo)
+		err = p.setUserInfo(requestID, userInfo)
 		return setUserInfoCommandResponse(userInfo, err, action)
 	case "off":
 		if userInfo == nil {
@@ -251,7 +306,7 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		}
 
 		userInfo.Activated = false
-		err = p.setUserInfo(userInfo)
+		err = p.setUserInfo(requestID, userInfo)
 		return setUserInfoCommandResponse(userInfo, err, action)
 	case "source":
 		if userInfo == nil {
@@ -267,7 +322,7 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		}
 
 		userInfo.SourceLanguage = param
-		err = p.setUserInfo(userInfo)
+		err = p.setUserInfo(requestID, userInfo)
 		return setUserInfoCommandResponse(userInfo, err, action)
 	case "target":
 		if userInfo == nil {
@@ -287,15 +342,273 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		}
 
 		userInfo.TargetLanguage = param
-		err = p.setUserInfo(userInfo)
+		if p.violatesTeamLock(userInfo) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, teamLockedMessage), nil
+		}
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "provider":
+		if !p.getConfiguration().AllowUserProvider {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Choosing a translation provider is not allowed by your System Admin."), nil
+		}
+
+		if param == autoLanguage {
+			param = ""
+		} else if !isProviderName(param) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Invalid \"%s\" provider. Should be one of %s or \"auto\".", param, strings.Join(providerNames, ", "))), nil
+		}
+
+		userInfo.Provider = param
+		err = p.setUserInfo(requestID, userInfo)
 		return setUserInfoCommandResponse(userInfo, err, action)
+	case "display":
+		if !isDisplayMode(param) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Invalid \"%s\" display mode. Should be one of %s.", param, strings.Join(displayModes, ", "))), nil
+		}
+
+		userInfo.DisplayMode = param
+		if p.violatesTeamLock(userInfo) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, teamLockedMessage), nil
+		}
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "profile":
+		name := ""
+		if len(split) > 3 {
+			name = split[3]
+		}
+
+		switch param {
+		case "", "list":
+			names, listErr := p.getProfileNames(args.UserId)
+			if listErr != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while listing your profiles."), nil
+			}
+			if len(names) == 0 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You have no profile yet. Save your current settings with `/autotranslate profile save [name]`."), nil
+			}
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Your profiles: `"+strings.Join(names, "`, `")+"`"), nil
+		case "save":
+			if saveErr := p.saveProfile(userInfo, name); saveErr != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Failed to save the profile: %s", saveErr.Error())), nil
+			}
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Your current settings are saved as the `%s` profile.", name)), nil
+		case "delete":
+			if deleteErr := p.deleteProfile(args.UserId, name); deleteErr != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while deleting the profile."), nil
+			}
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("The `%s` profile is deleted.", name)), nil
+		}
+
+		profile, profileErr := p.getProfile(args.UserId, param)
+		if profileErr != nil || profile == nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("No profile named `%s`. See your profiles with `/autotranslate profile list`.", param)), nil
+		}
+
+		userInfo.applyProfile(profile)
+		if p.violatesTeamLock(userInfo) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, teamLockedMessage), nil
+		}
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "team":
+		if args.TeamId == "" || !p.canManageTeam(args.UserId, args.TeamId) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only team admins can change the defaults of the team."), nil
+		}
+
+		value := ""
+		if len(split) > 3 {
+			value = split[3]
+		}
+
+		settings := p.getTeamSettings(args.TeamId)
+		switch {
+		case param == "target" && value == "none":
+			settings.TargetLanguage = ""
+		case param == "target" && value != autoLanguage && languageCodes[value] != "":
+			settings.TargetLanguage = value
+		case param == "display" && value == "none":
+			settings.DisplayMode = ""
+		case param == "display" && isDisplayMode(value):
+			settings.DisplayMode = value
+		case param == "lock" && (value == "on" || value == "off"):
+			settings.Locked = value == "on"
+		default:
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameters. Should be `target [language code|none]`, `display [display mode|none]` or `lock [on|off]`."), nil
+		}
+
+		if teamErr := p.setTeamSettings(requestID, args.UserId, args.TeamId, settings); teamErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while saving the team defaults."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Team defaults updated:\n * Target language: `%s`\n * Display mode: `%s`\n * Locked: `%t`", settings.TargetLanguage, settings.DisplayMode, settings.Locked)), nil
+	case "bulk":
+		if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only System Admins can turn auto-translation on or off for other users."), nil
+		}
+
+		scope := ""
+		if len(split) > 3 {
+			scope = split[3]
+		}
+
+		targetID := args.TeamId
+		if scope == bulkScopeChannel {
+			targetID = args.ChannelId
+		}
+
+		if (param != "enable" && param != "disable") || targetID == "" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameters. Should be `enable` or `disable` followed by `team` or `channel`."), nil
+		}
+
+		job, bulkErr := p.startBulkJob(args.UserId, scope, targetID, param == "enable")
+		if bulkErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, bulkErr.Error()), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Bulk change started (job ID: `%s`). You will receive a direct message when it is done.", job.ID)), nil
+	case "romanize":
+		if param != "on" && param != "off" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameter. Should be \"on\" or \"off\"."), nil
+		}
+
+		userInfo.Romanize = param == "on"
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "precorrect":
+		if p.getConfiguration().PreCorrection == "" || p.getConfiguration().PreCorrection == preCorrectionOff {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Pre-correction is not enabled by your System Admin."), nil
+		}
+
+		if param != "on" && param != "off" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameter. Should be \"on\" or \"off\"."), nil
+		}
+
+		userInfo.PreCorrect = param == "on"
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "currency":
+		if param == "off" {
+			param = ""
+		} else if param = strings.ToUpper(param); !isCurrencyCode(param) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameter. Should be a three letter currency code or \"off\"."), nil
+		}
+
+		userInfo.Currency = param
+		err = p.setUserInfo(requestID, userInfo)
+		return setUserInfoCommandResponse(userInfo, err, action)
+	case "learning":
+		if param != learningModeOn && param != learningModeAnnotated && param != learningModeOff {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameter. Should be \"on\", \"annotated\" or \"off\"."), nil
+		}
+
+		channel, appErr := p.API.GetChannel(args.ChannelId)
+		if appErr != nil || !p.canManageChannel(args.UserId, channel) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You do not have permission to change the learning mode of this channel."), nil
+		}
+
+		if appErr := p.setLearningMode(requestID, args.UserId, channel.Id, param); appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while setting the learning mode of this channel."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Learning mode of this channel set to `%s`.", param)), nil
+	case "official":
+		if param == "none" {
+			param = ""
+		} else if param == autoLanguage || languageCodes[param] == "" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Invalid parameter. Should be a language code or \"none\"."), nil
+		}
+
+		channel, appErr := p.API.GetChannel(args.ChannelId)
+		if appErr != nil || !p.canManageChannel(args.UserId, channel) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You do not have permission to change the official language of this channel."), nil
+		}
+
+		if appErr := p.setOfficialLanguage(requestID, args.UserId, channel.Id, param); appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while setting the official language of this channel."), nil
+		}
+
+		if param == "" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "This channel no longer has an official language."), nil
+		}
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Official language of this channel set to `%s`.", languageCodes[param])), nil
+	case "domain":
+		if param == "none" {
+			param = ""
+		} else if channelDomainPrompts[param] == "" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Invalid parameter. Should be one of %s, or \"none\".", strings.Join(channelDomainNames(), ", "))), nil
+		}
+
+		channel, appErr := p.API.GetChannel(args.ChannelId)
+		if appErr != nil || !p.canManageChannel(args.UserId, channel) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You do not have permission to change the domain of this channel."), nil
+		}
+
+		if appErr := p.setChannelDomain(requestID, args.UserId, channel.Id, param); appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while setting the domain of this channel."), nil
+		}
+
+		if param == "" {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "This channel no longer has a domain."), nil
+		}
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Domain of this channel set to `%s`. Its translations use the glossary of the domain and, with the LLM provider, its terminology.", param)), nil
+	case "cap":
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.executeChannelCapCommand(requestID, args, param)), nil
+	case "glossary":
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.executeGlossaryCommand(requestID, args, split[2:])), nil
+	case "correct":
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.executeCorrectCommand(args, split[2:])), nil
+	case "usage":
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, renderUsageReport(p.getUsageReport(args.UserId))), nil
+	case "diagnostics":
+		if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only System Admins can run the diagnostics."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, renderDiagnostics(requestID, p.runDiagnostics(requestID))), nil
+	case "benchmark":
+		if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only System Admins can run benchmarks."), nil
+		}
+
+		providerName := ""
+		if len(split) > 3 {
+			providerName = split[3]
+		}
+
+		if benchmarkErr := p.startBenchmark(args.UserId, providerName, param); benchmarkErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Invalid parameters: %s.", benchmarkErr.Error())), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Benchmark started. You will receive a direct message with the results when it is done."), nil
+	case "preset":
+		if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Only System Admins can apply configuration presets."), nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.executePresetCommand(requestID, args.UserId, split[2:])), nil
+	case "skip":
+		if err := p.skipNextMessage(args.UserId); err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "An error occurred while skipping the translation of your next message."), nil
+		}
+
+		marker := p.getConfiguration().getSkipMarker()
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Your next message will not be translated. You can also start a message with `%s`.", marker)), nil
+	case "saved":
+		// The web and desktop apps intercept this command and send the saved post IDs to
+		// /api/saved_digest, since the plugin API cannot list them.
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Translating saved messages is only available from the web and desktop apps."), nil
 	default:
 		if command == "/translate" && action != "" {
+			if configErr := p.IsValid(); configErr != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.unconfiguredMessage(args.UserId, configErr)), nil
+			}
+
 			sourceLang := userInfo.SourceLanguage
 			targetLang := userInfo.TargetLanguage
-			translatedText, err := p.translateText(action, sourceLang, targetLang)
+			translatedText, err := p.translateText(requestID, p.preferredProvider(userInfo), action, sourceLang, targetLang)
 			if err != nil {
-				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Failed to translate message."), nil
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Failed to translate message. (request ID: `%s`)", requestID)), nil
 			}
 
 			// 言語コードを言語名に変換
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
 )
 
@@ -24,6 +25,183 @@ type configuration struct {
 	// AWS region with "us-east-1" as default
 	AWSRegion string
 
+	// DeepL API key, enables DeepL as an additional provider
+	DeepLAPIKey string
+
+	// only translate with DeepL API Pro, which does not keep texts
+	DeepLNoTrace bool
+
+	// API key of an OpenAI compatible chat completions API, enables the LLM provider
+	LLMAPIKey string
+
+	// chat completions endpoint of the LLM provider
+	LLMAPIURL string
+
+	// model used by the LLM provider
+	LLMModel string
+
+	// number of preceding thread messages given as context to the LLM provider
+	LLMContextMessages string
+
+	// ask the LLM API not to store requests and replies
+	LLMNoTrace bool
+
+	// language pairs pinned to a provider, e.g. "ja:en=deepl"
+	ProviderPinning string
+
+	// language pairs translations are limited to, e.g. "*<>en", every pair if empty
+	AllowedLanguagePairs string
+
+	// comma separated languages whose content is never sent to external services
+	BlockedLanguages string
+
+	// never send direct and group messages to external services
+	ExcludeDirectMessages bool
+
+	// provider receiving a share of the traffic during a rollout
+	CanaryProvider string
+
+	// share of the traffic, in percent, sent to the canary provider
+	CanaryPercentage string
+
+	// share of activated users, in percent, whose messages are auto-translated, all when empty
+	RolloutPercentage string
+
+	// let users choose the provider handling their translations
+	AllowUserProvider bool
+
+	// number of characters above which OversizePolicy applies
+	MaxMessageCharacters string
+
+	// what to do with longer messages: "truncate", "split" or "skip"
+	OversizePolicy string
+
+	// monthly characters above which auto-translation is suspended, 0 for no limit
+	MonthlyCharacterThreshold string
+
+	// number of characters each user can have translated in a month, 0 for no quota
+	UserMonthlyCharacterQuota string
+
+	// "translate" to append translations or "detect_only" to only label posts with their language
+	TranslationMode string
+
+	// milliseconds new posts are held for their translation before being posted untranslated and updated later, 0 for no limit
+	HookLatencyBudget string
+
+	// line introducing appended translations, with {source}, {target}, {provider} and {confidence} placeholders
+	BannerTemplate string
+
+	// "off", "mask" or "hold" translations introducing offensive words
+	ProfanityGate string
+
+	// offensive words checked by the profanity gate, comma or newline separated
+	ProfanityWords string
+
+	// "team/channel" whose members review low-confidence and flagged translations, no review if empty
+	ReviewChannel string
+
+	// detection confidence, in percent, under which translations are reviewed
+	ReviewConfidenceThreshold string
+
+	// let users replace translations with their own through /translate correct
+	CrowdsourcedCorrections bool
+
+	// "off", "llm" or "languagetool" to correct the source text of users who opted in before translating it
+	PreCorrection string
+
+	// check endpoint of the LanguageTool server used for pre-correction
+	LanguageToolURL string
+
+	// convert dates, imperial units and decimal separators of translations to the target language conventions
+	LocalizeFormats bool
+
+	// API returning the exchange rates used to annotate amounts of money, fetched once a day
+	CurrencyRatesURL string
+
+	// comma separated text processors applied around each translation, in order
+	ProcessingPipeline string
+
+	// "translate", "skip" or "comments" to translate code blocks, leave them untranslated or translate only their comments
+	CodeBlocks string
+
+	// whether glossary terms are also found in their inflected forms
+	GlossaryInflections bool
+
+	// token that suppresses the translation of a message it starts, "!nt" by default
+	SkipMarker string
+
+	// whether quotes of earlier messages are translated with the new text, "new_text" or "all"
+	QuoteHandling string
+
+	// link the translation of a message to the translation of the recent message it quotes
+	LinkQuotedTranslations bool
+
+	// give translated replies a translated excerpt of the root of their thread
+	ThreadContextLine bool
+
+	// do not auto-translate messages written in both the source and the target language
+	SkipBilingualMessages bool
+
+	// translate lines repeated in the posts of a channel once, sending only the rest of messages to providers
+	FilterBoilerplate bool
+
+	// assume the dominant language of channels for new posts instead of detecting it
+	ChannelLanguagePrior bool
+
+	// "off", "recommend" or "apply" to classify channels daily and suggest or apply the settings their class calls for
+	ChannelClassification string
+
+	// "comprehend" or "local" to detect languages on the server, with Comprehend for uncertain results
+	LanguageDetection string
+
+	// translate direct messages into the recipient's target language for push notifications
+	TranslatePushNotifications bool
+
+	// show members of group messages the translation of new messages into their reading language
+	TranslateGroupMessages bool
+
+	// comma separated languages the transcripts of calls are translated into
+	CallTranscriptLanguages string
+
+	// S3 bucket, with an optional key prefix, large transcripts are translated through
+	TranscriptJobBucket string
+
+	// IAM role Amazon Translate assumes to access the transcript bucket
+	TranscriptJobRoleARN string
+
+	// direct message a translated copy of important and urgent posts to activated channel members
+	AlwaysTranslateUrgent bool
+
+	// direct message a translated copy of posts to @mentioned users who read another language
+	TranslateMentions bool
+
+	// leave users who turned auto-translation off themselves out of bulk enabling
+	BulkRespectOptOuts bool
+
+	// offer new team members reading another language than the team to turn auto-translation on
+	OnboardNewMembers bool
+
+	// PostgreSQL connection string of the store for usage, audit and detections, KV store if empty
+	StoreDataSource string
+
+	// days translations of messages are cached, 7 by default, 0 for not at all
+	TranslationRetentionDays string
+
+	// days changes of settings are kept in the audit, 0 for no limit
+	AuditRetentionDays string
+
+	// days usage counters are kept after their month ended, 0 for no limit
+	UsageRetentionDays string
+
+	// key encrypting cached translations and the settings audit in the KV store, not encrypted if empty
+	AtRestEncryptionKey string
+
+	// AWS KMS key generating the key encrypting data at rest, instead of AtRestEncryptionKey
+	AtRestKMSKeyID string
+
+	// remove the translations appended to recent messages when the plugin is disabled
+	RemoveTranslationsOnDisable bool
+
 	// disable plugin
 	disabled bool
 }
@@ -32,10 +210,69 @@ type configuration struct {
 // your configuration has no reference types.
 func (c *configuration) Clone() *configuration {
 	return &configuration{
-		AWSAccessKeyID:     c.AWSAccessKeyID,
-		AWSSecretAccessKey: c.AWSSecretAccessKey,
-		AWSRegion:          c.AWSRegion,
-		disabled:           c.disabled,
+		AWSAccessKeyID:              c.AWSAccessKeyID,
+		AWSSecretAccessKey:          c.AWSSecretAccessKey,
+		AWSRegion:                   c.AWSRegion,
+		DeepLAPIKey:                 c.DeepLAPIKey,
+		DeepLNoTrace:                c.DeepLNoTrace,
+		LLMAPIKey:                   c.LLMAPIKey,
+		LLMAPIURL:                   c.LLMAPIURL,
+		LLMModel:                    c.LLMModel,
+		LLMContextMessages:          c.LLMContextMessages,
+		LLMNoTrace:                  c.LLMNoTrace,
+		ProviderPinning:             c.ProviderPinning,
+		AllowedLanguagePairs:        c.AllowedLanguagePairs,
+		BlockedLanguages:            c.BlockedLanguages,
+		ExcludeDirectMessages:       c.ExcludeDirectMessages,
+		CanaryProvider:              c.CanaryProvider,
+		CanaryPercentage:            c.CanaryPercentage,
+		RolloutPercentage:           c.RolloutPercentage,
+		AllowUserProvider:           c.AllowUserProvider,
+		MaxMessageCharacters:        c.MaxMessageCharacters,
+		OversizePolicy:              c.OversizePolicy,
+		MonthlyCharacterThreshold:   c.MonthlyCharacterThreshold,
+		UserMonthlyCharacterQuota:   c.UserMonthlyCharacterQuota,
+		TranslationMode:             c.TranslationMode,
+		HookLatencyBudget:           c.HookLatencyBudget,
+		BannerTemplate:              c.BannerTemplate,
+		ProfanityGate:               c.ProfanityGate,
+		ReviewChannel:               c.ReviewChannel,
+		ReviewConfidenceThreshold:   c.ReviewConfidenceThreshold,
+		CrowdsourcedCorrections:     c.CrowdsourcedCorrections,
+		ProfanityWords:              c.ProfanityWords,
+		PreCorrection:               c.PreCorrection,
+		LanguageToolURL:             c.LanguageToolURL,
+		LocalizeFormats:             c.LocalizeFormats,
+		CurrencyRatesURL:            c.CurrencyRatesURL,
+		ProcessingPipeline:          c.ProcessingPipeline,
+		CodeBlocks:                  c.CodeBlocks,
+		GlossaryInflections:         c.GlossaryInflections,
+		SkipMarker:                  c.SkipMarker,
+		QuoteHandling:               c.QuoteHandling,
+		LinkQuotedTranslations:      c.LinkQuotedTranslations,
+		ThreadContextLine:           c.ThreadContextLine,
+		SkipBilingualMessages:       c.SkipBilingualMessages,
+		FilterBoilerplate:           c.FilterBoilerplate,
+		ChannelLanguagePrior:        c.ChannelLanguagePrior,
+		ChannelClassification:       c.ChannelClassification,
+		LanguageDetection:           c.LanguageDetection,
+		TranslatePushNotifications:  c.TranslatePushNotifications,
+		TranslateGroupMessages:      c.TranslateGroupMessages,
+		CallTranscriptLanguages:     c.CallTranscriptLanguages,
+		TranscriptJobBucket:         c.TranscriptJobBucket,
+		TranscriptJobRoleARN:        c.TranscriptJobRoleARN,
+		AlwaysTranslateUrgent:       c.AlwaysTranslateUrgent,
+		TranslateMentions:           c.TranslateMentions,
+		BulkRespectOptOuts:          c.BulkRespectOptOuts,
+		OnboardNewMembers:           c.OnboardNewMembers,
+		StoreDataSource:             c.StoreDataSource,
+		TranslationRetentionDays:    c.TranslationRetentionDays,
+		AuditRetentionDays:          c.AuditRetentionDays,
+		UsageRetentionDays:          c.UsageRetentionDays,
+		AtRestEncryptionKey:         c.AtRestEncryptionKey,
+		AtRestKMSKeyID:              c.AtRestKMSKeyID,
+		RemoveTranslationsOnDisable: c.RemoveTranslationsOnDisable,
+		disabled:                    c.disabled,
 	}
 }
 
@@ -83,6 +320,11 @@ func (p *Plugin) OnConfigurationChange() error {
 	}
 
 	p.setConfiguration(configuration)
+	p.loadAtRestKey(configuration)
+	p.unconfiguredHints.Range(func(key, _ interface{}) bool {
+		p.unconfiguredHints.Delete(key)
+		return true
+	})
 
 	return nil
 }
@@ -110,5 +352,31 @@ func (p *Plugin) IsValid() error {
 		configuration.AWSRegion = "us-east-1"
 	}
 
+	if _, err := parseProviderPinning(configuration.ProviderPinning); err != nil {
+		return err
+	}
+
+	if _, err := parseAllowedPairs(configuration.AllowedLanguagePairs); err != nil {
+		return err
+	}
+
+	if err := validateBlockedLanguages(configuration.BlockedLanguages); err != nil {
+		return err
+	}
+
+	if _, err := parseProcessingPipeline(configuration, configuration.ProcessingPipeline); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// unconfiguredMessage returns the hint shown when a translation is attempted while the plugin
+// is not configured. System admins are told what is missing, everyone else who to ask.
+func (p *Plugin) unconfiguredMessage(userID string, err error) string {
+	if p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		return fmt.Sprintf("Translation is unavailable: %s. Complete the setup in **System Console > Plugins > Autotranslate**.", err.Error())
+	}
+
+	return "Translation is unavailable because the Autotranslate plugin is not configured yet. Please contact your System Admin."
+}
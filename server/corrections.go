@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	correctUsage = "Usage: `/translate correct [message link] [better translation]`"
+
+	// correctionAttribution starts the line naming who corrected a translation shown in a post.
+	correctionAttribution = "\n_Corrected by "
+)
+
+// errTranslationRemoved is returned when correcting a post whose translation is no longer in it.
+var errTranslationRemoved = fmt.Errorf("the translation was removed from the message")
+
+// executeCorrectCommand replaces the translation of a message with the one written by the
+// user, with their name. The translation shown in the message itself is corrected for every
+// reader, otherwise the translation the user reads in their language is.
+func (p *Plugin) executeCorrectCommand(args *model.CommandArgs, words []string) string {
+	if !p.getConfiguration().CrowdsourcedCorrections {
+		return "Your System Admin did not allow corrections of translations."
+	}
+	if len(words) < 2 {
+		return correctUsage
+	}
+
+	link := words[0]
+	corrected := strings.TrimSpace(args.Command[strings.Index(args.Command, link)+len(link):])
+	if len([]rune(corrected)) > maxCorrectionLength {
+		return fmt.Sprintf("Corrections are limited to %d characters.", maxCorrectionLength)
+	}
+
+	postIDs := p.permalinkPostIDs(link)
+	if len(postIDs) == 0 {
+		return correctUsage
+	}
+
+	post, appErr := p.API.GetPost(postIDs[0])
+	if appErr != nil || post.DeleteAt != 0 || !p.API.HasPermissionToChannel(args.UserId, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		return "Message not found."
+	}
+
+	if post.GetProp(propTranslationLanguages) == nil {
+		return p.correctReaderTranslation(args.UserId, post, corrected)
+	}
+
+	if err := p.replacePostTranslation(args.UserId, post, corrected); err != nil {
+		p.API.LogWarn("Failed to correct translation", "post_id", post.Id, "err", err.Error())
+		return fmt.Sprintf("Failed to correct the translation: %s.", err.Error())
+	}
+
+	if item := p.getReviewItem(post.Id); item != nil {
+		p.closeReview(item, fmt.Sprintf(":pencil2: Corrected by %s with /translate correct:\n%s", p.mentionUser(args.UserId), quoteText(corrected)))
+	}
+
+	return "Thanks! The translation of the message was corrected."
+}
+
+// replacePostTranslation shows the corrected translation in the post in place of its own, with
+// the name of the user who corrected it, and saves it in the translation memory.
+func (p *Plugin) replacePostTranslation(userID string, post *model.Post, corrected string) error {
+	pair, _ := post.GetProp(propTranslationLanguages).(string)
+	languages := strings.SplitN(pair, ":", 2)
+	if len(languages) != 2 {
+		return errTranslationRemoved
+	}
+
+	attributed := fmt.Sprintf("%s%s%s_", corrected, correctionAttribution, p.mentionUser(userID))
+	original := post.Message
+
+	updated := post.Clone()
+	previous, _ := post.GetProp(propTranslation).(string)
+	if post.GetProp(propTranslation) != nil {
+		updated.AddProp(propTranslation, attributed)
+	} else {
+		length, ok := originalLength(post)
+		if !ok {
+			return errTranslationRemoved
+		}
+		original = post.Message[:length]
+
+		// The translation follows the line of its banner.
+		bannerEnd := strings.Index(post.Message[length+2:], "\n")
+		if bannerEnd < 0 {
+			return errTranslationRemoved
+		}
+		previous = post.Message[length+2+bannerEnd+1:]
+		updated.Message = post.Message[:length+2+bannerEnd+1] + attributed
+	}
+
+	saved, appErr := p.API.UpdatePost(updated)
+	if appErr != nil {
+		return appErr
+	}
+	p.recordShownTranslation(saved)
+
+	original = p.getConfiguration().translatableText(original)
+	if err := p.rememberTranslation(original, languages[0], languages[1], corrected); err != nil {
+		p.API.LogWarn("Failed to save correction in translation memory", "post_id", post.Id, "err", err.Error())
+	}
+	if index := strings.LastIndex(previous, correctionAttribution); index >= 0 {
+		previous = previous[:index]
+	}
+	p.recordCorrection(p.postTeamID(post), languages[0], languages[1], original, previous, corrected)
+
+	return nil
+}
+
+// correctReaderTranslation replaces the translation of the post into the reading language of the
+// user, which readers of that language are shown from then on.
+func (p *Plugin) correctReaderTranslation(userID string, post *model.Post, corrected string) string {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return "Failed to get your settings."
+	}
+
+	target := p.readingLanguage(user)
+	if target == "" {
+		return "Set the language you read with `/autotranslate target` first."
+	}
+
+	requestID := newRequestID()
+	detected, err := p.getPostLanguage(requestID, post)
+	if err != nil {
+		return fmt.Sprintf("Failed to detect the language of the message (request ID: %s).", requestID)
+	}
+	if detected.Language == target {
+		return "This message is already in your language."
+	}
+
+	if previous := p.getCachedTranslation(post, detected.Language, target); previous != nil {
+		p.recordCorrection(p.postTeamID(post), detected.Language, target, post.Message, previous.TranslatedText, corrected)
+	}
+
+	p.cacheTranslation(requestID, post, detected.Language, target, &cachedTranslation{
+		TranslatedText: corrected,
+		Provider:       providerTranslationMemory,
+		UpdateAt:       post.UpdateAt,
+		CorrectedBy:    p.mentionUser(userID),
+	})
+
+	if err := p.rememberTranslation(post.Message, detected.Language, target, corrected); err != nil {
+		p.API.LogWarn("Failed to save correction in translation memory", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+	}
+
+	return fmt.Sprintf("Thanks! Readers of %s are now shown your translation of the message.", languageName(target))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const csvDateFmt = "2006-01-02"
+
+// dateRange is the inclusive range of days of a CSV export, in UTC. Zero bounds are open.
+type dateRange struct {
+	from time.Time
+	to   time.Time
+}
+
+// parseDateRange reads the from and to query parameters, both optional days.
+func parseDateRange(r *http.Request) (*dateRange, error) {
+	dates := &dateRange{}
+	if from := r.URL.Query().Get("from"); from != "" {
+		day, err := time.Parse(csvDateFmt, from)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parameter: from should be formatted as YYYY-MM-DD")
+		}
+		dates.from = day
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		day, err := time.Parse(csvDateFmt, to)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parameter: to should be formatted as YYYY-MM-DD")
+		}
+		dates.to = day.AddDate(0, 0, 1)
+	}
+
+	return dates, nil
+}
+
+func (d *dateRange) includes(t time.Time) bool {
+	return (d.from.IsZero() || !t.Before(d.from)) && (d.to.IsZero() || t.Before(d.to))
+}
+
+// includesMonth reports whether any day of the month, formatted as usageMonthFmt, is in range.
+func (d *dateRange) includesMonth(month string) bool {
+	start, err := time.Parse(usageMonthFmt, month)
+	if err != nil {
+		return false
+	}
+
+	return (d.from.IsZero() || start.AddDate(0, 1, 0).After(d.from)) && (d.to.IsZero() || start.Before(d.to))
+}
+
+// startCSVExport checks that the user may export data and prepares the response of a CSV
+// export. It returns nil when the export cannot proceed.
+func (p *Plugin) startCSVExport(w http.ResponseWriter, r *http.Request, name string, header []string) (*csv.Writer, *dateRange) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to export data", http.StatusForbidden)
+		return nil, nil
+	}
+
+	dates, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=autotranslate-%s-%s.csv", name, time.Now().UTC().Format("20060102")))
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+
+	return writer, dates
+}
+
+// exportUsageCSV streams the characters translated for each user by month and language pair.
+func (p *Plugin) exportUsageCSV(w http.ResponseWriter, r *http.Request) {
+	writer, dates := p.startCSVExport(w, r, "usage", []string{"month", "user_id", "source_language", "target_language", "characters"})
+	if writer == nil {
+		return
+	}
+
+	err := p.store.ForEachUserUsage(func(userID, month string, usage *userUsage) error {
+		if !dates.includesMonth(month) {
+			return nil
+		}
+
+		pairs := make([]string, 0, len(usage.Pairs))
+		for pair := range usage.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Strings(pairs)
+
+		for _, pair := range pairs {
+			languages := strings.SplitN(pair, ":", 2)
+			if len(languages) != 2 {
+				continue
+			}
+			writer.Write([]string{month, userID, languages[0], languages[1], strconv.FormatInt(usage.Pairs[pair], 10)})
+		}
+		writer.Flush()
+
+		return writer.Error()
+	})
+	if err != nil {
+		p.API.LogError("Failed to export usage", "err", err.Error())
+	}
+
+	writer.Flush()
+}
+
+// exportZeroRetentionCSV streams the calls made to providers in zero-retention mode by day.
+func (p *Plugin) exportZeroRetentionCSV(w http.ResponseWriter, r *http.Request) {
+	writer, dates := p.startCSVExport(w, r, "zero_retention", []string{"day", "provider", "calls"})
+	if writer == nil {
+		return
+	}
+
+	err := p.store.ForEachZeroRetentionCount(func(day, provider string, calls int64) error {
+		at, err := time.Parse(usageDayFmt, day)
+		if err != nil || !dates.includes(at) {
+			return nil
+		}
+
+		writer.Write([]string{day, provider, strconv.FormatInt(calls, 10)})
+		writer.Flush()
+
+		return writer.Error()
+	})
+	if err != nil {
+		p.API.LogError("Failed to export zero-retention calls", "err", err.Error())
+	}
+
+	writer.Flush()
+}
+
+// exportAuditCSV streams the settings changes made in the date range.
+func (p *Plugin) exportAuditCSV(w http.ResponseWriter, r *http.Request) {
+	writer, dates := p.startCSVExport(w, r, "audit", []string{"time", "kind", "subject_id", "actor_id", "request_id", "before", "after"})
+	if writer == nil {
+		return
+	}
+
+	err := p.store.ForEachSettingsAudit(func(changes []settingsChange) error {
+		for _, change := range changes {
+			at := time.Unix(0, change.CreateAt*int64(time.Millisecond)).UTC()
+			if !dates.includes(at) {
+				continue
+			}
+			writer.Write([]string{at.Format(time.RFC3339), change.Kind, change.SubjectID, change.ActorID, change.RequestID, string(change.Before), string(change.After)})
+		}
+		writer.Flush()
+
+		return writer.Error()
+	})
+	if err != nil {
+		p.API.LogError("Failed to export audit", "err", err.Error())
+	}
+
+	writer.Flush()
+}
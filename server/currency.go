@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	currencyRatesKey = "currency_rates"
+
+	// currencyRatesTTL is how long, in seconds, exchange rates are cached.
+	currencyRatesTTL = 24 * 60 * 60
+
+	defaultCurrencyRatesURL = "https://open.er-api.com/v6/latest/USD"
+	currencyRatesTimeout    = 10 * time.Second
+)
+
+// currencyAmountRegexp matches amounts with a currency symbol before them, or a currency code
+// or name after them.
+var currencyAmountRegexp = regexp.MustCompile(`([$€£¥₩₹])\s?(\d[\d,]*(?:\.\d+)?)|(\d[\d,]*(?:\.\d+)?)\s?(USD|EUR|GBP|JPY|CNY|KRW|INR|CAD|AUD|CHF|円|元|ドル|ユーロ|원)`)
+
+// currencyCodes maps the currency symbols and names of currencyAmountRegexp to ISO 4217 codes.
+var currencyCodes = map[string]string{
+	"$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "₩": "KRW", "₹": "INR",
+	"円": "JPY", "元": "CNY", "ドル": "USD", "ユーロ": "EUR", "원": "KRW",
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 currency code.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getCurrencyRates returns exchange rates relative to the base currency of the configured
+// rates API, fetching them at most once a day.
+func (p *Plugin) getCurrencyRates() (map[string]float64, error) {
+	var rates map[string]float64
+	if ok, err := p.Helpers.KVGetJSON(currencyRatesKey, &rates); err == nil && ok {
+		return rates, nil
+	}
+
+	ratesURL := strings.TrimSpace(p.getConfiguration().CurrencyRatesURL)
+	if ratesURL == "" {
+		ratesURL = defaultCurrencyRatesURL
+	}
+
+	resp, err := (&http.Client{Timeout: currencyRatesTimeout}).Get(ratesURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "exchange rates request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rates API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "failed to decode exchange rates")
+	}
+
+	if len(result.Rates) == 0 {
+		return nil, errors.New("exchange rates API returned no rates")
+	}
+
+	if err := p.Helpers.KVSetWithExpiryJSON(currencyRatesKey, result.Rates, currencyRatesTTL); err != nil {
+		p.API.LogWarn("Failed to cache exchange rates", "err", err.Error())
+	}
+
+	return result.Rates, nil
+}
+
+// annotateCurrencies follows each amount of money in the text with its approximate value in
+// the given currency, such as "$100 (≈ 15,000 JPY)".
+func (p *Plugin) annotateCurrencies(requestID, text, currency string) string {
+	if !currencyAmountRegexp.MatchString(text) {
+		return text
+	}
+
+	rates, err := p.getCurrencyRates()
+	if err != nil {
+		p.API.LogWarn("Failed to get exchange rates", "request_id", requestID, "err", err.Error())
+		return text
+	}
+
+	if rates[currency] == 0 {
+		return text
+	}
+
+	return currencyAmountRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		parts := currencyAmountRegexp.FindStringSubmatch(match)
+		symbol, amount := parts[1], parts[2]
+		if symbol == "" {
+			symbol, amount = parts[4], parts[3]
+		}
+
+		from := currencyCodes[symbol]
+		if from == "" {
+			from = symbol
+		}
+
+		value, err := strconv.ParseFloat(strings.Replace(amount, ",", "", -1), 64)
+		if err != nil || from == currency || rates[from] == 0 {
+			return match
+		}
+
+		converted := value / rates[from] * rates[currency]
+		return fmt.Sprintf("%s (≈ %s %s)", match, formatAmount(converted), currency)
+	})
+}
+
+// formatAmount rounds an amount to a precision fitting its size and groups its thousands.
+func formatAmount(amount float64) string {
+	decimals := 0
+	if amount < 100 {
+		decimals = 2
+	}
+
+	formatted := strconv.FormatFloat(math.Abs(amount), 'f', decimals, 64)
+	integer := formatted
+	fraction := ""
+	if dot := strings.Index(formatted, "."); dot != -1 {
+		integer, fraction = formatted[:dot], formatted[dot:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return grouped.String() + fraction
+}
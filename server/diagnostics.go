@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	diagnosticsKeyPrefix = "diagnostics_"
+	diagnosticsText      = "Hello"
+)
+
+// diagnosticCheck is the outcome of one check of the diagnostics command.
+type diagnosticCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// runDiagnostics checks the configuration, providers, storage, bot account and background jobs
+// of the plugin, so System Admins can paste a single report in support threads.
+func (p *Plugin) runDiagnostics(requestID string) []diagnosticCheck {
+	var checks []diagnosticCheck
+
+	if err := p.IsValid(); err != nil {
+		checks = append(checks, diagnosticCheck{Name: "Configuration", Detail: err.Error()})
+	} else {
+		checks = append(checks, diagnosticCheck{Name: "Configuration", OK: true, Detail: "Valid"})
+	}
+
+	checks = append(checks, p.diagnoseProviders(requestID)...)
+	checks = append(checks, p.diagnoseKVStore(requestID), p.diagnoseStore(), p.diagnoseBot(), p.diagnoseJobs())
+
+	return checks
+}
+
+// logSelfCheck runs the diagnostics once the plugin is activated and logs the failed checks.
+func (p *Plugin) logSelfCheck() {
+	requestID := newRequestID()
+	for _, check := range p.runDiagnostics(requestID) {
+		if !check.OK {
+			p.API.LogWarn("Autotranslate self-check failed", "check", check.Name, "detail", check.Detail, "request_id", requestID)
+		}
+	}
+}
+
+// diagnoseProviders translates a short text with every provider that has credentials.
+func (p *Plugin) diagnoseProviders(requestID string) []diagnosticCheck {
+	providers := p.getProviders()
+	if len(providers) == 0 {
+		return []diagnosticCheck{{Name: "Providers", Detail: "No provider has credentials"}}
+	}
+
+	var checks []diagnosticCheck
+	for _, provider := range providers {
+		check := diagnosticCheck{Name: "Provider " + provider.Name()}
+
+		start := time.Now()
+		if _, err := provider.Translate(requestID, diagnosticsText, enLanguage, "ja"); err != nil {
+			check.Detail = err.Error()
+		} else {
+			check.OK = true
+			check.Detail = fmt.Sprintf("Reachable in %d ms", time.Since(start).Milliseconds())
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// diagnoseKVStore writes, reads back and deletes a key of the KV store.
+func (p *Plugin) diagnoseKVStore(requestID string) diagnosticCheck {
+	check := diagnosticCheck{Name: "KV store"}
+	key := diagnosticsKeyPrefix + requestID
+
+	if appErr := p.API.KVSet(key, []byte(requestID)); appErr != nil {
+		check.Detail = "Write failed: " + appErr.Error()
+		return check
+	}
+	defer p.API.KVDelete(key)
+
+	value, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		check.Detail = "Read failed: " + appErr.Error()
+		return check
+	}
+	if !bytes.Equal(value, []byte(requestID)) {
+		check.Detail = "Read a different value than written"
+		return check
+	}
+
+	check.OK = true
+	check.Detail = "Read and write succeeded"
+	return check
+}
+
+// diagnoseStore reports the configured store backend and whether it is reachable.
+func (p *Plugin) diagnoseStore() diagnosticCheck {
+	check := diagnosticCheck{Name: "Store"}
+
+	switch s := p.store.(type) {
+	case *sqlStore:
+		if err := s.db.Ping(); err != nil {
+			check.Detail = "PostgreSQL unreachable: " + err.Error()
+			return check
+		}
+		check.Detail = "PostgreSQL"
+	case *kvStore:
+		check.Detail = "KV store"
+	default:
+		check.Detail = "Not opened"
+		return check
+	}
+
+	check.OK = true
+	return check
+}
+
+// diagnoseBot checks that the bot account posting translations and notices exists and is active.
+func (p *Plugin) diagnoseBot() diagnosticCheck {
+	check := diagnosticCheck{Name: "Bot account"}
+	if p.botUserID == "" {
+		check.Detail = "Not created"
+		return check
+	}
+
+	bot, appErr := p.API.GetUser(p.botUserID)
+	if appErr != nil {
+		check.Detail = appErr.Error()
+		return check
+	}
+	if bot.DeleteAt != 0 {
+		check.Detail = fmt.Sprintf("@%s is deactivated", bot.Username)
+		return check
+	}
+
+	check.OK = true
+	check.Detail = "@" + bot.Username
+	return check
+}
+
+// diagnoseJobs checks that the background jobs are running and reports the translation backlog.
+func (p *Plugin) diagnoseJobs() diagnosticCheck {
+	check := diagnosticCheck{Name: "Background jobs"}
+
+	var stopped []string
+	if p.queue == nil {
+		stopped = append(stopped, "translation queue")
+	}
+	if p.usageTracker == nil {
+		stopped = append(stopped, "usage tracker")
+	}
+	if p.wsBatcher == nil {
+		stopped = append(stopped, "websocket batcher")
+	}
+	if p.dataCleaner == nil {
+		stopped = append(stopped, "data cleaner")
+	}
+	if p.channelClassifier == nil {
+		stopped = append(stopped, "channel classifier")
+	}
+	if p.transcriptJobs == nil {
+		stopped = append(stopped, "transcript translation jobs")
+	}
+	if len(stopped) > 0 {
+		check.Detail = "Not running: " + strings.Join(stopped, ", ")
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d of %d translation jobs queued", p.queue.queued(), 2*translationQueueSize)
+	if p.usageTracker.isSuspended() {
+		check.Detail += ", auto-translation suspended by the monthly threshold"
+	}
+
+	return check
+}
+
+// renderDiagnostics formats the checks as a Markdown table.
+func renderDiagnostics(requestID string, checks []diagnosticCheck) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#### Autotranslate diagnostics\nRequest ID: `%s`\n\n", requestID)
+	b.WriteString("| Check | Status | Details |\n|:--|:--|:--|\n")
+	for _, check := range checks {
+		status := ":white_check_mark: OK"
+		if !check.OK {
+			status = ":x: Failed"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", check.Name, status, strings.NewReplacer("|", "\\|", "\n", " ").Replace(check.Detail))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// languageDirective overrides the languages used to translate a single message. It is written
+// as the first word of the message: "!fr" sets the target, "!ja>fr" the source and target, and
+// "!ja>" the source only.
+type languageDirective struct {
+	SourceLanguage string
+	TargetLanguage string
+}
+
+// parseLanguageDirective returns the directive at the start of the message, if any, and the
+// message without it.
+func parseLanguageDirective(message string) (*languageDirective, string) {
+	trimmed := strings.TrimLeft(message, " \t")
+	if !strings.HasPrefix(trimmed, "!") {
+		return nil, message
+	}
+
+	end := strings.IndexAny(trimmed, " \t\n")
+	if end == -1 {
+		end = len(trimmed)
+	}
+
+	token := trimmed[1:end]
+	directive := &languageDirective{TargetLanguage: token}
+	if parts := strings.SplitN(token, ">", 2); len(parts) == 2 {
+		directive.SourceLanguage = parts[0]
+		directive.TargetLanguage = parts[1]
+	}
+
+	if directive.SourceLanguage != "" && languageCodes[directive.SourceLanguage] == "" {
+		return nil, message
+	}
+
+	if directive.TargetLanguage != "" && (directive.TargetLanguage == autoLanguage || languageCodes[directive.TargetLanguage] == "") {
+		return nil, message
+	}
+
+	if directive.SourceLanguage == "" && directive.TargetLanguage == "" {
+		return nil, message
+	}
+
+	return directive, strings.TrimLeft(trimmed[end:], " \t\n")
+}
+
+// stripLanguageDirective removes a language directive from the post and returns it.
+func stripLanguageDirective(post *model.Post) *languageDirective {
+	directive, message := parseLanguageDirective(post.Message)
+	if directive != nil {
+		post.Message = message
+	}
+
+	return directive
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	displayModeAppend      = "append"
+	displayModeEphemeral   = "ephemeral"
+	displayModeThreadReply = "thread-reply"
+	displayModePropsToggle = "props-toggle"
+	displayModeDM          = "dm"
+
+	// propTranslation and propTranslationBanner hold the translation of a post in the
+	// props-toggle display mode, which clients show on demand.
+	propTranslation       = "autotranslate_translation"
+	propTranslationBanner = "autotranslate_banner"
+
+	// propTranslated marks posts whose message includes their translation.
+	propTranslated = "autotranslate_translated"
+
+	// propOriginalLength is the length in bytes of the message of a post before its
+	// translation was appended.
+	propOriginalLength = "autotranslate_original_length"
+
+	// propTranslationLanguages is the language pair of the translation shown in a post.
+	propTranslationLanguages = "autotranslate_languages"
+
+	// propTranslationOutdated marks posts whose author edited the message after it was
+	// translated: the translation shown is the one of the message before the edit.
+	propTranslationOutdated = "autotranslate_translation_outdated"
+
+	// pendingDeliveryTTL is how long a translation waits for its post to be saved before it
+	// is dropped, such as when another plugin rejects the post.
+	pendingDeliveryTTL = time.Minute
+)
+
+// displayModes lists the supported display modes.
+var displayModes = []string{displayModeAppend, displayModeEphemeral, displayModeThreadReply, displayModePropsToggle, displayModeDM}
+
+// isDisplayMode reports whether mode is a supported display mode.
+func isDisplayMode(mode string) bool {
+	for _, displayMode := range displayModes {
+		if mode == displayMode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getDisplayMode returns how the translations of the posts of the user are shown, appended to
+// the message by default.
+func (u *UserInfo) getDisplayMode() string {
+	if u == nil || u.DisplayMode == "" {
+		return displayModeAppend
+	}
+
+	return u.DisplayMode
+}
+
+// pendingDelivery is a translation delivered once its post is saved.
+type pendingDelivery struct {
+	mode        string
+	languages   string
+	translation string
+	createdAt   time.Time
+}
+
+func pendingDeliveryKey(post *model.Post) string {
+	return post.UserId + "|" + post.ChannelId + "|" + post.Message
+}
+
+// displayTranslation shows the translation of a new post according to the display mode: it is
+// appended to the message, stored in the post props, or delivered after the post is saved as
+// an ephemeral post, a thread reply or a direct message.
+func (p *Plugin) displayTranslation(post *model.Post, mode, languages, banner, translatedText string) {
+	switch mode {
+	case displayModePropsToggle:
+		post.AddProp(propTranslation, translatedText)
+		post.AddProp(propTranslationBanner, banner)
+	case displayModeEphemeral, displayModeThreadReply, displayModeDM:
+		p.pendingDeliveries.Range(func(key, value interface{}) bool {
+			if time.Since(value.(*pendingDelivery).createdAt) > pendingDeliveryTTL {
+				p.pendingDeliveries.Delete(key)
+			}
+			return true
+		})
+
+		p.pendingDeliveries.Store(pendingDeliveryKey(post), &pendingDelivery{
+			mode:        mode,
+			languages:   languages,
+			translation: fmt.Sprintf("%s\n%s", banner, translatedText),
+			createdAt:   time.Now(),
+		})
+	default:
+		post.AddProp(propOriginalLength, len(post.Message))
+		post.Message = fmt.Sprintf("%s\n\n%s\n%s", post.Message, banner, translatedText)
+		post.AddProp(propTranslated, true)
+	}
+}
+
+// isTranslatedPost reports whether the post already carries a translation.
+func isTranslatedPost(post *model.Post) bool {
+	return post.GetProp(propTranslated) != nil || post.GetProp(propTranslation) != nil
+}
+
+// replyDeliveryMode returns how to deliver a translation meant as a thread reply in the channel.
+// Archived channels take no new posts, so the translation is sent by direct message instead, and
+// it is only shown to the author in read-only channels, where the other members cannot reply.
+func (p *Plugin) replyDeliveryMode(channelID string) string {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return displayModeThreadReply
+	}
+	if channel.DeleteAt != 0 {
+		return displayModeDM
+	}
+
+	readOnlyTownSquare := p.API.GetConfig().TeamSettings.ExperimentalTownSquareIsReadOnly
+	if channel.Name == model.DEFAULT_CHANNEL && readOnlyTownSquare != nil && *readOnlyTownSquare {
+		return displayModeEphemeral
+	}
+
+	return displayModeThreadReply
+}
+
+// deliverTranslation delivers the translation waiting for the saved post, if any.
+func (p *Plugin) deliverTranslation(post *model.Post) {
+	value, ok := p.pendingDeliveries.Load(pendingDeliveryKey(post))
+	if !ok {
+		return
+	}
+	p.pendingDeliveries.Delete(pendingDeliveryKey(post))
+	delivery := value.(*pendingDelivery)
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+
+	mode := delivery.mode
+	if mode == displayModeThreadReply {
+		mode = p.replyDeliveryMode(post.ChannelId)
+	}
+
+	switch mode {
+	case displayModeEphemeral:
+		p.API.SendEphemeralPost(post.UserId, &model.Post{
+			ChannelId: post.ChannelId,
+			RootId:    rootID,
+			Message:   delivery.translation,
+		})
+	case displayModeThreadReply:
+		// The reply is posted once, even when the post is delivered again.
+		if !p.claimIdempotencyKey(idempotentReply, translationIdempotencyKey(post.Id, delivery.languages, post.UpdateAt), replyClaimTTL) {
+			return
+		}
+		if _, appErr := p.API.CreatePost(&model.Post{
+			UserId:    p.botUserID,
+			ChannelId: post.ChannelId,
+			RootId:    rootID,
+			Message:   delivery.translation,
+		}); appErr != nil {
+			p.API.LogWarn("Failed to post translation as a reply", "post_id", post.Id, "err", appErr.Error())
+
+			// The channel was archived or made read-only meanwhile, the author still gets the
+			// translation.
+			if appErr.StatusCode == http.StatusForbidden || appErr.StatusCode == http.StatusBadRequest {
+				p.API.SendEphemeralPost(post.UserId, &model.Post{
+					ChannelId: post.ChannelId,
+					RootId:    rootID,
+					Message:   delivery.translation,
+				})
+			}
+		}
+	case displayModeDM:
+		message := delivery.translation
+		if channel, appErr := p.API.GetChannel(post.ChannelId); appErr == nil {
+			if permalink := p.getPermalink(post, channel); permalink != "" {
+				message += fmt.Sprintf("\n\n[Jump to the original message](%s)", permalink)
+			}
+		}
+
+		if err := p.sendDirectMessage(post.UserId, message); err != nil {
+			p.API.LogWarn("Failed to send translation by direct message", "post_id", post.Id, "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// dmTranslation sends the translation of a post into the target language of the user as a
+// direct message from the plugin bot, leaving the channel untouched.
+func (p *Plugin) dmTranslation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate post", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		PostID string `json:"post_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.PostID == "" {
+		http.Error(w, "Invalid parameter: post_id", http.StatusBadRequest)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	post, appErr := p.API.GetPost(body.PostID)
+	if appErr != nil || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		httpErrorWithRequestID(w, requestID, "No post to translate", http.StatusBadRequest)
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		httpErrorWithRequestID(w, requestID, "No post to translate", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	target := enLanguage
+	if userInfo != nil {
+		target = userInfo.TargetLanguage
+	}
+
+	translated, apiErr := p.translatePost(requestID, userID, p.preferredProvider(userInfo), post, autoLanguage, target)
+	if apiErr != nil {
+		writeAPIErrorWithRequestID(w, requestID, apiErr)
+		return
+	}
+	p.personalizeTranslation(requestID, userInfo, post, translated)
+
+	message := fmt.Sprintf("(%s → %s)\n> %s", languageCodes[translated.SourceLanguage], languageCodes[target], translated.TranslatedText)
+	if translated.RomanizedText != "" {
+		message += fmt.Sprintf("\n\n_%s_", translated.RomanizedText)
+	}
+	if permalink := p.getPermalink(post, channel); permalink != "" {
+		message += fmt.Sprintf("\n\n[Jump to the original message](%s)", permalink)
+	}
+
+	if err := p.sendDirectMessage(userID, message); err != nil {
+		p.API.LogError("Failed to send translation by direct message", "request_id", requestID, "err", err.Error())
+		httpErrorWithRequestID(w, requestID, "Failed to send the translation", http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(translated)
+	w.Write(resp)
+}
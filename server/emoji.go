@@ -0,0 +1,177 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// emojiShortcodeRegexp matches Mattermost emoji such as :thumbsup: or :+1:. isShortcode
+	// tells them from the digits of times such as 10:30:45.
+	emojiShortcodeRegexp = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+	// kaomojiRegexp matches candidate kaomoji: a short parenthesized face with optional arms,
+	// such as (^_^), ヽ(°〇°)ﾉ or ¯\_(ツ)_/¯. isKaomoji tells faces from parenthesized text.
+	kaomojiRegexp = regexp.MustCompile(`(?:¯\\_)?[ヽ٩ᕕ\\(╯]?[(（][^()（）\n]{1,15}[)）][ﾉノ۶ᕗ/o╯]?(?:_/¯|︵ ?┻━┻)?`)
+)
+
+// isEmojiRune reports whether r starts an emoji.
+func isEmojiRune(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x2B00 && r <= 0x2BFF) || (r >= 0x2300 && r <= 0x23FF)
+}
+
+// isRegionalIndicator reports whether r is one of the letters flags are made of.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isEmojiContinuation reports whether r continues the emoji before it: zero width joiners,
+// variation selectors, skin tone modifiers, keycaps and tags.
+func isEmojiContinuation(r rune) bool {
+	return r == 0x200D || r == 0xFE0F || r == 0x20E3 || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+// isKeycapBase reports whether r is one of the characters keycaps like 1️⃣ or #️⃣ are made of.
+func isKeycapBase(r rune) bool {
+	return (r >= '0' && r <= '9') || r == '#' || r == '*'
+}
+
+// keycapLength returns the number of runes of the keycap starting the runes, 0 if none: its
+// character, an optional variation selector and the combining keycap.
+func keycapLength(runes []rune) int {
+	if len(runes) < 2 || !isKeycapBase(runes[0]) {
+		return 0
+	}
+
+	end := 1
+	if runes[end] == 0xFE0F {
+		end++
+	}
+	if end < len(runes) && runes[end] == 0x20E3 {
+		return end + 1
+	}
+
+	return 0
+}
+
+// kaomojiPunctuation is the punctuation of sentences, which alone does not make a face of text
+// in parentheses such as "(e.g.)" or "(a, b)".
+const kaomojiPunctuation = `.,;:!?'"-`
+
+// isKaomoji reports whether a candidate matched by kaomojiRegexp is a face rather than text
+// in parentheses: it has no word, no digit, and at least one symbol other than the punctuation
+// of sentences.
+func isKaomoji(candidate string) bool {
+	hasSymbol := strings.ContainsAny(candidate, `¯\╯ヽﾉノ`)
+	latinRun := 0
+	for _, r := range strings.Trim(candidate, "(（)）") {
+		switch {
+		case unicode.IsDigit(r), unicode.In(r, unicode.Hiragana, unicode.Han, unicode.Hangul):
+			return false
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latinRun++
+			if latinRun > 1 {
+				return false
+			}
+			continue
+		case strings.ContainsRune(kaomojiPunctuation, r):
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.In(r, unicode.Greek, unicode.Kannada):
+			hasSymbol = true
+		}
+		latinRun = 0
+	}
+
+	return hasSymbol
+}
+
+// isShortcode reports whether the match of emojiShortcodeRegexp at start:end of the text is an
+// emoji rather than part of a word or number, such as :30: in 10:30:45.
+func isShortcode(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (unicode.IsLetter(before) || unicode.IsDigit(before)) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && (unicode.IsLetter(after) || unicode.IsDigit(after)) {
+		return false
+	}
+
+	return true
+}
+
+// protectEmoji replaces the emoji, emoji shortcodes and kaomoji of text with numbered
+// placeholders, so that providers cannot drop or alter them, and returns the replaced values.
+func protectEmoji(text string) (string, []string) {
+	var protected []string
+
+	text = kaomojiRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		if !isKaomoji(match) {
+			return match
+		}
+		return emojiPlaceholders.protect(&protected, match)
+	})
+
+	var shortcodes strings.Builder
+	last := 0
+	for _, match := range emojiShortcodeRegexp.FindAllStringIndex(text, -1) {
+		if !isShortcode(text, match[0], match[1]) {
+			continue
+		}
+		shortcodes.WriteString(text[last:match[0]])
+		shortcodes.WriteString(emojiPlaceholders.protect(&protected, text[match[0]:match[1]]))
+		last = match[1]
+	}
+	shortcodes.WriteString(text[last:])
+	text = shortcodes.String()
+
+	var result strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if length := keycapLength(runes[i:]); length > 0 {
+			result.WriteString(emojiPlaceholders.protect(&protected, string(runes[i:i+length])))
+			i += length - 1
+			continue
+		}
+		if !isEmojiRune(runes[i]) {
+			result.WriteRune(runes[i])
+			continue
+		}
+
+		end := i + 1
+		// A flag is a pair of regional indicators.
+		if isRegionalIndicator(runes[i]) && end < len(runes) && isRegionalIndicator(runes[end]) {
+			end++
+		}
+		for end < len(runes) {
+			if isEmojiContinuation(runes[end]) {
+				end++
+			} else if runes[end-1] == 0x200D && isEmojiRune(runes[end]) {
+				end++
+			} else {
+				break
+			}
+		}
+
+		result.WriteString(emojiPlaceholders.protect(&protected, string(runes[i:end])))
+		i = end - 1
+	}
+
+	return result.String(), protected
+}
+
+// restoreEmoji puts back the values replaced by protectEmoji. Values whose placeholder the
+// provider dropped are appended, so no emoji is ever lost.
+func restoreEmoji(text string, protected []string) string {
+	if len(protected) == 0 {
+		return text
+	}
+
+	text, restored := emojiPlaceholders.restore(text, protected)
+	for i, value := range protected {
+		if !restored[i] {
+			text += " " + value
+		}
+	}
+
+	return text
+}
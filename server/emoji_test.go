@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectEmoji(t *testing.T) {
+	for name, test := range map[string]struct {
+		Text           string
+		ExpectedText   string
+		ExpectedValues []string
+	}{
+		"no emoji": {
+			Text:         "Hello world",
+			ExpectedText: "Hello world",
+		},
+		"emoji": {
+			Text:           "Thanks ❤️ see you 🎉",
+			ExpectedText:   "Thanks {{E0}} see you {{E1}}",
+			ExpectedValues: []string{"❤️", "🎉"},
+		},
+		"zwj sequence": {
+			Text:           "My family 👨‍👩‍👧‍👦 is here",
+			ExpectedText:   "My family {{E0}} is here",
+			ExpectedValues: []string{"👨‍👩‍👧‍👦"},
+		},
+		"zwj sequence with skin tones": {
+			Text:           "👩🏽‍💻 at work",
+			ExpectedText:   "{{E0}} at work",
+			ExpectedValues: []string{"👩🏽‍💻"},
+		},
+		"skin tone modifier": {
+			Text:           "OK 👍🏿👍🏻",
+			ExpectedText:   "OK {{E0}}{{E1}}",
+			ExpectedValues: []string{"👍🏿", "👍🏻"},
+		},
+		"flags": {
+			Text:           "Teams 🇯🇵🇫🇷 and 🇺🇸",
+			ExpectedText:   "Teams {{E0}}{{E1}} and {{E2}}",
+			ExpectedValues: []string{"🇯🇵", "🇫🇷", "🇺🇸"},
+		},
+		"tag sequence flag": {
+			Text:           "Go 🏴󠁧󠁢󠁥󠁮󠁧󠁿!",
+			ExpectedText:   "Go {{E0}}!",
+			ExpectedValues: []string{"🏴󠁧󠁢󠁥󠁮󠁧󠁿"},
+		},
+		"keycaps": {
+			Text:           "Vote 1️⃣ or 2⃣, see #️⃣",
+			ExpectedText:   "Vote {{E0}} or {{E1}}, see {{E2}}",
+			ExpectedValues: []string{"1️⃣", "2⃣", "#️⃣"},
+		},
+		"digits without keycap": {
+			Text:         "Room 12 #3",
+			ExpectedText: "Room 12 #3",
+		},
+		"shrug": {
+			Text:           `No idea ¯\_(ツ)_/¯`,
+			ExpectedText:   "No idea {{E0}}",
+			ExpectedValues: []string{`¯\_(ツ)_/¯`},
+		},
+		"kaomoji": {
+			Text:           "Done (^_^) finally (╯°□°)╯︵ ┻━┻",
+			ExpectedText:   "Done {{E0}} finally {{E1}}",
+			ExpectedValues: []string{"(^_^)", "(╯°□°)╯︵ ┻━┻"},
+		},
+		"kaomoji with letters": {
+			Text:           "What (o_O)",
+			ExpectedText:   "What {{E0}}",
+			ExpectedValues: []string{"(o_O)"},
+		},
+		"abbreviations in parentheses": {
+			Text:         "Some fruits (e.g. apples) and (i.e.) or (e.g.)",
+			ExpectedText: "Some fruits (e.g. apples) and (i.e.) or (e.g.)",
+		},
+		"text in parentheses": {
+			Text:         "Pick one (a, b) or (x) in (2020)",
+			ExpectedText: "Pick one (a, b) or (x) in (2020)",
+		},
+		"shortcodes": {
+			Text:           ":+1: thanks :tada::smile:",
+			ExpectedText:   "{{E0}} thanks {{E1}}{{E2}}",
+			ExpectedValues: []string{":+1:", ":tada:", ":smile:"},
+		},
+		"times": {
+			Text:         "Meet at 10:30:45 or 9:15:00",
+			ExpectedText: "Meet at 10:30:45 or 9:15:00",
+		},
+		"shortcode after a time": {
+			Text:           "At 10:30 :coffee:",
+			ExpectedText:   "At 10:30 {{E0}}",
+			ExpectedValues: []string{":coffee:"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			text, values := protectEmoji(test.Text)
+			assert.Equal(t, test.ExpectedText, text)
+			assert.Equal(t, test.ExpectedValues, values)
+		})
+	}
+}
+
+func TestRestoreEmoji(t *testing.T) {
+	for name, test := range map[string]struct {
+		Text     string
+		Values   []string
+		Expected string
+	}{
+		"no values": {
+			Text:     "Hallo Welt",
+			Expected: "Hallo Welt",
+		},
+		"placeholders": {
+			Text:     "Danke {{E0}} bis bald {{E1}}",
+			Values:   []string{"❤️", "🎉"},
+			Expected: "Danke ❤️ bis bald 🎉",
+		},
+		"spaces added inside placeholders": {
+			Text:     "Danke {{ E0 }} bis bald {{E1 }}",
+			Values:   []string{"❤️", ":tada:"},
+			Expected: "Danke ❤️ bis bald :tada:",
+		},
+		"moved placeholders": {
+			Text:     "{{E1}} und {{E0}}",
+			Values:   []string{"🇯🇵", "🇫🇷"},
+			Expected: "🇫🇷 und 🇯🇵",
+		},
+		"dropped placeholders": {
+			Text:     "Keine Ahnung",
+			Values:   []string{`¯\_(ツ)_/¯`, "1️⃣"},
+			Expected: `Keine Ahnung ¯\_(ツ)_/¯ 1️⃣`,
+		},
+		"unknown placeholder": {
+			Text:     "{{E0}} {{E5}}",
+			Values:   []string{"👍🏽"},
+			Expected: "👍🏽 {{E5}}",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, restoreEmoji(test.Text, test.Values))
+		})
+	}
+}
+
+func TestEmojiRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"👨‍👩‍👧 and 👍🏽 with 🇯🇵, 1️⃣ and ¯\\_(ツ)_/¯ at 10:30:45 :+1:",
+		"Plain text (e.g. this) (a, b)",
+	} {
+		protected, values := protectEmoji(text)
+		assert.Equal(t, text, restoreEmoji(protected, values))
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	glossaryKeyPrefix = "glossary_"
+
+	glossaryScopeTeam    = "team"
+	glossaryScopeChannel = "channel"
+	// The glossary of a domain applies to the channels tagged with it.
+	glossaryScopeDomain = "domain"
+
+	settingsKindGlossary = "glossary"
+
+	maxGlossaryTerms = 500
+)
+
+// glossaryTerm is the translation a team or channel requires for a term of a language pair.
+type glossaryTerm struct {
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	Source         string `json:"source"`
+	Target         string `json:"target"`
+}
+
+// sameSource reports whether both terms translate the same term of the same language pair.
+func (t glossaryTerm) sameSource(other glossaryTerm) bool {
+	return t.SourceLanguage == other.SourceLanguage && t.TargetLanguage == other.TargetLanguage && strings.EqualFold(t.Source, other.Source)
+}
+
+func (t glossaryTerm) validate() error {
+	if t.SourceLanguage == autoLanguage || languageCodes[t.SourceLanguage] == "" || t.TargetLanguage == autoLanguage || languageCodes[t.TargetLanguage] == "" {
+		return fmt.Errorf("Invalid language pair %s:%s", t.SourceLanguage, t.TargetLanguage)
+	}
+	if strings.TrimSpace(t.Source) == "" || strings.TrimSpace(t.Target) == "" {
+		return fmt.Errorf("Empty term or translation")
+	}
+
+	return nil
+}
+
+// getGlossary returns the terms of the glossary of a team or channel.
+func (p *Plugin) getGlossary(scope, id string) []glossaryTerm {
+	terms, err := p.store.GetGlossary(scope, id)
+	if err != nil {
+		p.API.LogWarn("Failed to get glossary", "scope", scope, "id", id, "err", err.Error())
+	}
+
+	return terms
+}
+
+// addGlossaryTerms adds terms to the glossary of a team or channel, replacing the terms of the
+// glossary with the same source, and records the change in the settings audit. The conflicts
+// of the added terms with the other glossaries are returned.
+func (p *Plugin) addGlossaryTerms(requestID, actorID, scope, id string, added []glossaryTerm) ([]glossaryConflict, error) {
+	for _, term := range added {
+		if err := term.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	previous := p.getGlossary(scope, id)
+	terms := append([]glossaryTerm{}, previous...)
+	for _, term := range added {
+		replaced := false
+		for i := range terms {
+			if terms[i].sameSource(term) {
+				terms[i] = term
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			terms = append(terms, term)
+		}
+	}
+
+	if len(terms) > maxGlossaryTerms {
+		return nil, fmt.Errorf("A glossary cannot have more than %d terms", maxGlossaryTerms)
+	}
+
+	if err := p.saveGlossary(requestID, actorID, scope, id, previous, terms); err != nil {
+		return nil, err
+	}
+
+	// The terms are saved, failing to check them only loses the warning.
+	conflicts, err := p.findGlossaryConflicts()
+	if err != nil {
+		p.API.LogWarn("Failed to check glossary conflicts", "scope", scope, "id", id, "err", err.Error())
+		return nil, nil
+	}
+
+	var related []glossaryConflict
+	for _, conflict := range conflicts {
+		for _, term := range added {
+			if conflict.term().sameSource(term) {
+				related = append(related, conflict)
+				break
+			}
+		}
+	}
+
+	return related, nil
+}
+
+// removeGlossaryTerm removes a term of a language pair from the glossary of a team or channel,
+// reporting whether it was there.
+func (p *Plugin) removeGlossaryTerm(requestID, actorID, scope, id string, removed glossaryTerm) (bool, error) {
+	previous := p.getGlossary(scope, id)
+
+	var terms []glossaryTerm
+	for _, term := range previous {
+		if !term.sameSource(removed) {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == len(previous) {
+		return false, nil
+	}
+
+	return true, p.saveGlossary(requestID, actorID, scope, id, previous, terms)
+}
+
+func (p *Plugin) saveGlossary(requestID, actorID, scope, id string, previous, terms []glossaryTerm) error {
+	if err := p.store.SaveGlossary(scope, id, terms); err != nil {
+		return err
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindGlossary, id, previous, terms)
+
+	return nil
+}
+
+// glossaryEntry is a term as defined by one glossary.
+type glossaryEntry struct {
+	Scope  string `json:"scope"`
+	ID     string `json:"id"`
+	Target string `json:"target"`
+}
+
+// glossaryConflict is a term of a language pair that glossaries translate differently.
+type glossaryConflict struct {
+	SourceLanguage string          `json:"source_lang"`
+	TargetLanguage string          `json:"target_lang"`
+	Source         string          `json:"source"`
+	Entries        []glossaryEntry `json:"entries"`
+}
+
+func (c glossaryConflict) term() glossaryTerm {
+	return glossaryTerm{SourceLanguage: c.SourceLanguage, TargetLanguage: c.TargetLanguage, Source: c.Source}
+}
+
+// findGlossaryConflicts returns the terms that the glossaries of teams and channels translate
+// differently, sorted by language pair and term.
+func (p *Plugin) findGlossaryConflicts() ([]glossaryConflict, error) {
+	byTerm := map[string]*glossaryConflict{}
+	err := p.store.ForEachGlossary(func(scope, glossaryID string, terms []glossaryTerm) error {
+		for _, term := range terms {
+			id := term.SourceLanguage + ":" + term.TargetLanguage + ":" + strings.ToLower(term.Source)
+			conflict, ok := byTerm[id]
+			if !ok {
+				conflict = &glossaryConflict{SourceLanguage: term.SourceLanguage, TargetLanguage: term.TargetLanguage, Source: term.Source}
+				byTerm[id] = conflict
+			}
+			conflict.Entries = append(conflict.Entries, glossaryEntry{Scope: scope, ID: glossaryID, Target: term.Target})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(byTerm))
+	for id, conflict := range byTerm {
+		for _, entry := range conflict.Entries[1:] {
+			if !strings.EqualFold(entry.Target, conflict.Entries[0].Target) {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+
+	conflicts := make([]glossaryConflict, 0, len(ids))
+	for _, id := range ids {
+		conflicts = append(conflicts, *byTerm[id])
+	}
+
+	return conflicts, nil
+}
+
+// getChannelGlossary returns the terms applying to translations of posts of a channel from the
+// source into the target language. The terms of the channel take precedence over the terms of
+// its team, and those over the terms of the domain of the channel, whatever the order they were
+// added in.
+func (p *Plugin) getChannelGlossary(channelID, sourceLang, targetLang string) []glossaryTerm {
+	var terms []glossaryTerm
+	add := func(candidates []glossaryTerm) {
+		for _, candidate := range candidates {
+			if candidate.SourceLanguage != sourceLang || candidate.TargetLanguage != targetLang {
+				continue
+			}
+
+			overridden := false
+			for _, term := range terms {
+				if term.sameSource(candidate) {
+					overridden = true
+					break
+				}
+			}
+			if !overridden {
+				terms = append(terms, candidate)
+			}
+		}
+	}
+
+	add(p.getGlossary(glossaryScopeChannel, channelID))
+	if channel, appErr := p.API.GetChannel(channelID); appErr == nil && channel.TeamId != "" {
+		add(p.getGlossary(glossaryScopeTeam, channel.TeamId))
+	}
+	if domain := p.getChannelDomain(channelID); domain != "" {
+		add(p.getGlossary(glossaryScopeDomain, domain))
+	}
+
+	return terms
+}
+
+// useGlossary makes the translations of the request apply the glossaries of the channel, until
+// the returned function is called.
+func (p *Plugin) useGlossary(requestID, channelID string) func() {
+	p.requestGlossaries.Store(requestID, channelID)
+
+	return func() {
+		p.requestGlossaries.Delete(requestID)
+	}
+}
+
+// getRequestGlossary returns the glossary terms the translations of the request apply.
+func (p *Plugin) getRequestGlossary(requestID, sourceLang, targetLang string) []glossaryTerm {
+	channelID, ok := p.requestGlossaries.Load(requestID)
+	if !ok {
+		return nil
+	}
+
+	return p.getChannelGlossary(channelID.(string), sourceLang, targetLang)
+}
+
+// glossaryProcessor replaces the glossary terms of the text with placeholders before the
+// translation, and the placeholders with the required translations after it. With
+// inflections, the terms are also found in their inflected forms.
+type glossaryProcessor struct {
+	inflections bool
+}
+
+func (glossaryProcessor) Name() string {
+	return "glossary"
+}
+
+func (g glossaryProcessor) Before(text string, state *processingState) string {
+	// Longer terms first, so that a term containing another one wins.
+	terms := append([]glossaryTerm{}, state.glossary...)
+	sort.SliceStable(terms, func(i, j int) bool {
+		return utf8.RuneCountInString(terms[i].Source) > utf8.RuneCountInString(terms[j].Source)
+	})
+
+	var values []string
+	for _, term := range terms {
+		text = newGlossaryMatcher(term.Source, state.sourceLang, g.inflections).replaceAll(text, func(string) string {
+			return glossaryPlaceholders.protect(&values, term.Target)
+		})
+	}
+	state.values[g.Name()] = values
+
+	return text
+}
+
+func (g glossaryProcessor) After(text string, state *processingState) string {
+	text, _ = glossaryPlaceholders.restore(text, state.values[g.Name()])
+	return text
+}
+
+// executeGlossaryCommand runs "/autotranslate glossary" with the words following it and returns
+// the response text.
+func (p *Plugin) executeGlossaryCommand(requestID string, args *model.CommandArgs, words []string) string {
+	const usage = "Invalid parameters. Should be `list`, `add ja:en [term] = [translation]` or `remove ja:en [term]`, with `team` after the action for the glossary of the team, or `domain` for the glossary of the domain of the channel."
+	if len(words) == 0 {
+		return usage
+	}
+	action, words := words[0], words[1:]
+
+	scope, id := glossaryScopeChannel, args.ChannelId
+	if len(words) > 0 && words[0] == glossaryScopeTeam {
+		scope, id, words = glossaryScopeTeam, args.TeamId, words[1:]
+	} else if len(words) > 0 && words[0] == glossaryScopeDomain {
+		scope, id, words = glossaryScopeDomain, p.getChannelDomain(args.ChannelId), words[1:]
+	}
+	if id == "" {
+		return "This glossary is not available here."
+	}
+
+	if action == "list" {
+		terms := p.getGlossary(scope, id)
+		if len(terms) == 0 {
+			return fmt.Sprintf("The glossary of this %s is empty.", scope)
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Glossary of this %s:\n", scope)
+		for _, term := range terms {
+			fmt.Fprintf(&b, "* `%s:%s` %s → %s\n", term.SourceLanguage, term.TargetLanguage, term.Source, term.Target)
+		}
+		return b.String()
+	}
+
+	if (action != "add" && action != "remove") || len(words) < 2 {
+		return usage
+	}
+	if !p.canManageGlossary(args.UserId, scope, id) {
+		return fmt.Sprintf("You do not have permission to change the glossary of this %s.", scope)
+	}
+
+	languages := strings.SplitN(words[0], ":", 2)
+	if len(languages) != 2 {
+		return usage
+	}
+	term := glossaryTerm{SourceLanguage: languages[0], TargetLanguage: languages[1]}
+
+	if action == "remove" {
+		term.Source = strings.Join(words[1:], " ")
+		removed, err := p.removeGlossaryTerm(requestID, args.UserId, scope, id, term)
+		switch {
+		case err != nil:
+			return "An error occurred while saving the glossary."
+		case !removed:
+			return fmt.Sprintf("%q is not in the glossary of this %s.", term.Source, scope)
+		default:
+			return fmt.Sprintf("%q was removed from the glossary of this %s.", term.Source, scope)
+		}
+	}
+
+	parts := strings.SplitN(strings.Join(words[1:], " "), "=", 2)
+	if len(parts) != 2 {
+		return usage
+	}
+	term.Source, term.Target = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	conflicts, err := p.addGlossaryTerms(requestID, args.UserId, scope, id, []glossaryTerm{term})
+	if err != nil {
+		return fmt.Sprintf("The term was not added: %s.", err.Error())
+	}
+
+	text := fmt.Sprintf("%q is now translated as %q in this %s.", term.Source, term.Target, scope)
+	for _, conflict := range conflicts {
+		for _, entry := range conflict.Entries {
+			if entry.Scope != scope || entry.ID != id {
+				text += fmt.Sprintf("\n* Conflict: the glossary of %s `%s` translates it as %q.", entry.Scope, entry.ID, entry.Target)
+			}
+		}
+	}
+
+	return text
+}
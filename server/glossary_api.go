@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// canManageGlossary reports whether the user may change the glossary of the team or channel.
+func (p *Plugin) canManageGlossary(userID, scope, id string) bool {
+	switch scope {
+	case glossaryScopeTeam:
+		return p.canManageTeam(userID, id)
+	case glossaryScopeChannel:
+		channel, appErr := p.API.GetChannel(id)
+		return appErr == nil && p.canManageChannel(userID, channel)
+	case glossaryScopeDomain:
+		// Domain glossaries apply to the channels of every team.
+		return p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM)
+	default:
+		return false
+	}
+}
+
+// handleGlossary returns the glossary of a team or channel on GET, and imports terms into it on
+// POST, answering with the conflicts of the imported terms with other glossaries.
+func (p *Plugin) handleGlossary(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to manage glossaries", http.StatusUnauthorized)
+		return
+	}
+
+	scope := r.URL.Query().Get("scope")
+	id := r.URL.Query().Get("id")
+	validID := model.IsValidId(id)
+	if scope == glossaryScopeDomain {
+		validID = channelDomainPrompts[id] != ""
+	}
+	if (scope != glossaryScopeTeam && scope != glossaryScopeChannel && scope != glossaryScopeDomain) || !validID {
+		http.Error(w, "Invalid parameters: scope and id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		readable := false
+		if scope == glossaryScopeTeam {
+			readable = p.API.HasPermissionToTeam(userID, id, model.PERMISSION_VIEW_TEAM)
+		} else if scope == glossaryScopeDomain {
+			readable = true
+		} else {
+			readable = p.API.HasPermissionToChannel(userID, id, model.PERMISSION_READ_CHANNEL)
+		}
+		if !readable {
+			http.Error(w, "Not authorized to read this glossary", http.StatusForbidden)
+			return
+		}
+
+		terms := p.getGlossary(scope, id)
+		if terms == nil {
+			terms = []glossaryTerm{}
+		}
+
+		resp, _ := json.Marshal(terms)
+		w.Write(resp)
+	case http.MethodPost:
+		if !p.canManageGlossary(userID, scope, id) {
+			http.Error(w, "Not authorized to change this glossary", http.StatusForbidden)
+			return
+		}
+
+		var terms []glossaryTerm
+		if err := json.NewDecoder(r.Body).Decode(&terms); err != nil || len(terms) == 0 {
+			http.Error(w, "Invalid parameter: terms", http.StatusBadRequest)
+			return
+		}
+
+		conflicts, err := p.addGlossaryTerms(newRequestID(), userID, scope, id, terms)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if conflicts == nil {
+			conflicts = []glossaryConflict{}
+		}
+
+		resp, _ := json.Marshal(map[string]interface{}{
+			"imported":  len(terms),
+			"conflicts": conflicts,
+		})
+		w.Write(resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getGlossaryConflicts is the admin report of the terms glossaries translate differently.
+func (p *Plugin) getGlossaryConflicts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to read glossary conflicts", http.StatusForbidden)
+		return
+	}
+
+	conflicts, err := p.findGlossaryConflicts()
+	if err != nil {
+		p.API.LogError("Failed to find glossary conflicts", "err", err.Error())
+		http.Error(w, "Failed to find glossary conflicts", http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(conflicts)
+	w.Write(resp)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minInflectionStem is the length, in characters, under which the ending of a glossary term is
+// not taken for an inflection, so that short terms are not matched by unrelated words.
+const minInflectionStem = 4
+
+// inflectionSuffixes are the common inflectional endings of nouns of languages whose words
+// change form, such as with their case or number.
+var inflectionSuffixes = map[string][]string{
+	"en": {"'s", "es", "s"},
+	"de": {"ern", "en", "er", "es", "em", "e", "n", "s"},
+	"fr": {"es", "s", "x"},
+	"es": {"es", "s"},
+	"it": {"i", "e", "a", "o"},
+	"pt": {"ões", "es", "s"},
+	"nl": {"en", "s"},
+	"sv": {"erna", "arna", "orna", "er", "ar", "or", "en", "et", "s"},
+	"pl": {"ami", "ach", "owi", "ów", "om", "em", "ie", "y", "i", "a", "u", "e", "ę", "ą", "o"},
+	"cs": {"ách", "ech", "ami", "ům", "em", "ou", "y", "u", "a", "e", "i", "ů"},
+	"ru": {"ами", "ями", "ов", "ев", "ей", "ах", "ях", "ом", "ем", "ам", "ям", "ой", "ы", "и", "а", "я", "у", "ю", "е", "о"},
+	"uk": {"ами", "ями", "ів", "ах", "ях", "ом", "ем", "ам", "ям", "ою", "ею", "и", "і", "ї", "а", "я", "у", "ю", "е", "о"},
+	"fi": {"ssa", "ssä", "sta", "stä", "lla", "llä", "lta", "ltä", "lle", "ksi", "na", "nä", "n", "t", "a", "ä"},
+	"hu": {"ban", "ben", "nak", "nek", "ból", "ből", "ról", "ről", "hoz", "hez", "höz", "val", "vel", "ok", "ek", "ra", "re", "ba", "be", "t", "k"},
+	"tr": {"ları", "leri", "lar", "ler", "dan", "den", "tan", "ten", "da", "de", "ta", "te", "ya", "ye", "ın", "in", "un", "ün", "ı", "i", "u", "ü", "a", "e"},
+}
+
+// isSpacedWordRune reports whether the rune is a letter or digit of a script separating words
+// with spaces, whose terms must be matched as whole words.
+func isSpacedWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+}
+
+// glossaryMatcher finds a glossary term in texts, case insensitively and, when asked, in its
+// inflected forms.
+type glossaryMatcher struct {
+	pattern   *regexp.Regexp
+	wordStart bool
+	wordEnd   bool
+}
+
+// newGlossaryMatcher returns the matcher of a term of the language. With inflections, the term
+// stripped of its own ending is matched followed by any ending of the language, so that
+// "deploymentów" matches the Polish term "deployment" and "wdrożenia" the term "wdrożenie".
+func newGlossaryMatcher(term, language string, inflections bool) glossaryMatcher {
+	first, _ := utf8.DecodeRuneInString(term)
+	last, _ := utf8.DecodeLastRuneInString(term)
+	matcher := glossaryMatcher{
+		wordStart: isSpacedWordRune(first),
+		wordEnd:   isSpacedWordRune(last),
+	}
+
+	suffixes := inflectionSuffixes[language]
+	if !inflections || !matcher.wordEnd || len(suffixes) == 0 {
+		matcher.pattern = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(term))
+		return matcher
+	}
+
+	sorted := append([]string{}, suffixes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return utf8.RuneCountInString(sorted[i]) > utf8.RuneCountInString(sorted[j])
+	})
+
+	// The shortest ending is stripped, the longer ones often being part of the stem.
+	stem := term
+	lower := strings.ToLower(term)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		suffix := sorted[i]
+		if strings.HasSuffix(lower, suffix) && utf8.RuneCountInString(term)-utf8.RuneCountInString(suffix) >= minInflectionStem {
+			stem = term[:len(term)-len(suffix)]
+			break
+		}
+	}
+
+	quoted := make([]string, len(sorted))
+	for i, suffix := range sorted {
+		quoted[i] = regexp.QuoteMeta(suffix)
+	}
+	// Up to two endings follow the stem, such as the number then the case.
+	matcher.pattern = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(stem) + `(?:` + strings.Join(quoted, "|") + `){0,2}`)
+
+	return matcher
+}
+
+// replaceAll replaces the occurrences of the term in the text with the result of replace.
+// Occurrences inside a longer word are left alone.
+func (m glossaryMatcher) replaceAll(text string, replace func(match string) string) string {
+	var b strings.Builder
+	previous := 0
+	for _, match := range m.pattern.FindAllStringIndex(text, -1) {
+		start, end := match[0], match[1]
+		if before, _ := utf8.DecodeLastRuneInString(text[:start]); m.wordStart && isSpacedWordRune(before) {
+			continue
+		}
+		if after, _ := utf8.DecodeRuneInString(text[end:]); m.wordEnd && isSpacedWordRune(after) {
+			continue
+		}
+
+		b.WriteString(text[previous:start])
+		b.WriteString(replace(text[start:end]))
+		previous = end
+	}
+	b.WriteString(text[previous:])
+
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	groupLanguagesKeyPrefix = "gm_langs_"
+
+	// groupLanguagesTTL is how long, in seconds, the reading languages of the members of a group
+	// message are cached.
+	groupLanguagesTTL = 10 * 60
+
+	// maxGroupMembers is the number of members of a group message, which Mattermost limits to 8.
+	maxGroupMembers = 8
+
+	// propSkipped marks posts whose author asked for them not to be translated.
+	propSkipped = "autotranslate_skipped"
+)
+
+// getGroupLanguages returns the reading language of each member of a group message, inferred
+// from their settings or else their locale. Members who turned auto-translation off are left
+// out.
+func (p *Plugin) getGroupLanguages(channelID string) map[string]string {
+	languages := map[string]string{}
+	if ok, err := p.Helpers.KVGetJSON(groupLanguagesKeyPrefix+channelID, &languages); err == nil && ok {
+		return languages
+	}
+
+	users, appErr := p.API.GetUsersInChannel(channelID, model.CHANNEL_SORT_BY_USERNAME, 0, maxGroupMembers)
+	if appErr != nil {
+		return nil
+	}
+
+	for _, user := range users {
+		if user.IsBot {
+			continue
+		}
+		if userInfo, _ := p.getUserInfo(user.Id); userInfo != nil && !userInfo.Activated {
+			continue
+		}
+		if language := p.readingLanguage(user); language != "" {
+			languages[user.Id] = language
+		}
+	}
+
+	if err := p.Helpers.KVSetWithExpiryJSON(groupLanguagesKeyPrefix+channelID, languages, groupLanguagesTTL); err != nil {
+		p.API.LogWarn("Failed to cache group message languages", "channel_id", channelID, "err", err.Error())
+	}
+
+	return languages
+}
+
+// translateGroupMessage sends every member of a group message who reads another language than
+// the one of the post its translation as an ephemeral post, unless the author's own translation
+// already is in that language.
+func (p *Plugin) translateGroupMessage(post *model.Post) {
+	configuration := p.getConfiguration()
+	if !configuration.TranslateGroupMessages || post.IsSystemMessage() || post.UserId == p.botUserID || post.GetProp(propSkipped) != nil {
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil || channel.Type != model.CHANNEL_GROUP || configuration.ExcludeDirectMessages {
+		return
+	}
+
+	if p.isAutoTranslationSuspended() || p.isOverUserQuota(post.UserId) {
+		return
+	}
+
+	text := post.Message
+	translatedInto := ""
+	if length, ok := originalLength(post); ok {
+		text = post.Message[:length]
+		if authorInfo := p.getCachedUserInfo(post.UserId); authorInfo != nil {
+			translatedInto = authorInfo.TargetLanguage
+		}
+	}
+	if text = configuration.translatableText(text); text == "" {
+		return
+	}
+
+	requestID := newRequestID()
+	var detected *postLanguage
+	translations := map[string]string{}
+
+	for userID, target := range p.getGroupLanguages(channel.Id) {
+		if userID == post.UserId || target == translatedInto {
+			continue
+		}
+
+		if detected == nil {
+			var err error
+			if detected, err = p.getPostLanguage(requestID, post); err != nil {
+				return
+			}
+			if p.blockedLanguage(text, detected.Language) != "" {
+				return
+			}
+		}
+
+		if detected.Language == target || !configuration.getAllowedPairs().allows(detected.Language, target) {
+			continue
+		}
+
+		message, ok := translations[target]
+		if !ok {
+			translated, provider, appErr := p.translateTextWithProvider(requestID, "", text, detected.Language, target, nil)
+			if appErr != nil {
+				p.API.LogWarn("Failed to translate group message", "request_id", requestID, "post_id", post.Id, "target", target, "err", appErr.Error())
+				translations[target] = ""
+				continue
+			}
+			if !isRecalledTranslation(provider) {
+				p.recordUserUsage(post.UserId, detected.Language, target, utf8.RuneCountInString(text))
+			}
+
+			banner := configuration.renderBanner(bannerDetails{
+				SourceLanguage: detected.Language,
+				TargetLanguage: target,
+				Provider:       provider,
+				Confidence:     detected.Confidence,
+				Detected:       true,
+			})
+			message = fmt.Sprintf("%s\n%s", banner, translated)
+			translations[target] = message
+		}
+		if message == "" {
+			continue
+		}
+
+		rootID := post.RootId
+		if rootID == "" {
+			rootID = post.Id
+		}
+		p.API.SendEphemeralPost(userID, &model.Post{
+			ChannelId: post.ChannelId,
+			RootId:    rootID,
+			Message:   message,
+		})
+	}
+}
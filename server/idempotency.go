@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	idempotencyKeyPrefix = "idem_"
+
+	// Operations guarded by idempotency keys: the provider call translating a post, and the
+	// thread reply delivering the translation of a new post.
+	idempotentTranslation = "t_"
+	idempotentReply       = "r_"
+
+	// translationClaimTTL is how long, in seconds, a translation in flight holds its key. Once it
+	// is done, the translation is cached and the key is released.
+	translationClaimTTL = 2 * 60
+
+	// replyClaimTTL is how long, in seconds, a delivered thread reply holds its key.
+	replyClaimTTL = 24 * 60 * 60
+
+	// translationClaimWait is how long a translation whose key is held waits for the
+	// translation in flight to be cached, polling every translationClaimPoll.
+	translationClaimWait = 10 * time.Second
+	translationClaimPoll = 500 * time.Millisecond
+)
+
+// translationIdempotencyKey identifies the translation of a version of a post between the
+// languages of a pair, so that a translation redelivered by the queue or retried on another
+// server of the cluster is neither paid for nor delivered twice.
+func translationIdempotencyKey(postID, languages string, updateAt int64) string {
+	sum := sha256.Sum256([]byte(postID + "|" + languages + "|" + strconv.FormatInt(updateAt, 10)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// claimIdempotencyKey holds the key for the operation, reporting false when the operation was
+// already done, or is being done, under the same key.
+func (p *Plugin) claimIdempotencyKey(operation, key string, ttl int64) bool {
+	claimed, appErr := p.API.KVSetWithOptions(idempotencyKeyPrefix+operation+key, []byte{1}, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: ttl,
+	})
+	if appErr != nil {
+		// Doing the operation twice is better than not at all.
+		p.API.LogWarn("Failed to claim idempotency key", "idempotency_key", key, "err", appErr.Error())
+		return true
+	}
+
+	return claimed
+}
+
+// releaseIdempotencyKey lets the operation be done again under the key, after it failed.
+func (p *Plugin) releaseIdempotencyKey(operation, key string) {
+	if appErr := p.API.KVDelete(idempotencyKeyPrefix + operation + key); appErr != nil {
+		p.API.LogWarn("Failed to release idempotency key", "idempotency_key", key, "err", appErr.Error())
+	}
+}
+
+// awaitCachedTranslation waits for the translation of the post being made by another request to
+// be cached, returning nil when it is not in time.
+func (p *Plugin) awaitCachedTranslation(post *model.Post, sourceLang, targetLang string) *cachedTranslation {
+	deadline := time.Now().Add(translationClaimWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(translationClaimPoll)
+		if translation := p.getCachedTranslation(post, sourceLang, targetLang); translation != nil {
+			return translation
+		}
+	}
+
+	return nil
+}
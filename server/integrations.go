@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	playbooksPluginID = "playbooks"
+	boardsPluginID    = "focalboard"
+)
+
+// TranslatedContent is a piece of content of another plugin translated into the target language
+// of the user who asked for it.
+type TranslatedContent struct {
+	ID             string `json:"id"`
+	CreateAt       int64  `json:"create_at"`
+	SourceText     string `json:"source_text"`
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	TranslatedText string `json:"translated_text"`
+}
+
+// callPlugin sends a GET request to the API of another plugin on behalf of the user and decodes
+// the JSON response. The other plugin enforces its own permissions for the user.
+func (p *Plugin) callPlugin(userID, pluginID, path string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, "/"+pluginID+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create inter-plugin request")
+	}
+	req.Header.Set("Mattermost-User-ID", userID)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp := p.API.PluginHTTP(req)
+	if resp == nil {
+		return fmt.Errorf("plugin %s did not respond", pluginID)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plugin %s returned status %d", pluginID, resp.StatusCode)
+	}
+
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(result), "failed to decode plugin response")
+}
+
+// translateContent detects the language of a text and translates it into the target language.
+func (p *Plugin) translateContent(requestID, preferredProvider, id string, createAt int64, text, targetLang string) (*TranslatedContent, error) {
+	sourceLang, err := p.detectLanguage(requestID, text)
+	if err != nil {
+		return nil, err
+	}
+
+	translated := text
+	if sourceLang != targetLang {
+		var appErr *model.AppError
+		translated, appErr = p.translateText(requestID, preferredProvider, text, sourceLang, targetLang)
+		if appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	return &TranslatedContent{
+		ID:             id,
+		CreateAt:       createAt,
+		SourceText:     text,
+		SourceLanguage: sourceLang,
+		TargetLanguage: targetLang,
+		TranslatedText: translated,
+	}, nil
+}
+
+// translatePlaybookStatusUpdates returns the status updates of a Playbooks run translated into
+// the target language of the user. Status updates are posts in the channel of the run.
+func (p *Plugin) translatePlaybookStatusUpdates(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate status updates", http.StatusUnauthorized)
+		return
+	}
+
+	runID := r.URL.Query().Get("run_id")
+	if runID == "" {
+		http.Error(w, "Invalid parameter: run_id is required", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	if userInfo == nil {
+		http.Error(w, "No record found. Try `/autotranslate on` to enable.", http.StatusBadRequest)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	var run struct {
+		StatusPosts []struct {
+			ID       string `json:"id"`
+			DeleteAt int64  `json:"delete_at"`
+		} `json:"status_posts"`
+	}
+	if err := p.callPlugin(userID, playbooksPluginID, "/api/v0/runs/"+url.PathEscape(runID), &run); err != nil {
+		p.API.LogWarn("Failed to get playbook run", "request_id", requestID, "run_id", runID, "err", err.Error())
+		httpErrorWithRequestID(w, requestID, "Failed to get the playbook run", http.StatusBadGateway)
+		return
+	}
+
+	updates := []*TranslatedContent{}
+	for _, statusPost := range run.StatusPosts {
+		if statusPost.DeleteAt != 0 {
+			continue
+		}
+
+		post, appErr := p.API.GetPost(statusPost.ID)
+		if appErr != nil || post.Message == "" || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+			continue
+		}
+
+		update, err := p.translateContent(requestID, p.preferredProvider(userInfo), post.Id, post.CreateAt, post.Message, userInfo.TargetLanguage)
+		if err != nil {
+			p.API.LogWarn("Failed to translate status update", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+			continue
+		}
+		updates = append(updates, update)
+	}
+
+	resp, _ := json.Marshal(updates)
+	w.Write(resp)
+}
+
+// translateBoardCard returns the title and the text blocks of the description of a Boards card
+// translated into the target language of the user.
+func (p *Plugin) translateBoardCard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate cards", http.StatusUnauthorized)
+		return
+	}
+
+	boardID := r.URL.Query().Get("board_id")
+	cardID := r.URL.Query().Get("card_id")
+	if boardID == "" || cardID == "" {
+		http.Error(w, "Invalid parameter: board_id and card_id are required", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	if userInfo == nil {
+		http.Error(w, "No record found. Try `/autotranslate on` to enable.", http.StatusBadRequest)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	type block struct {
+		ID       string `json:"id"`
+		ParentID string `json:"parentId"`
+		Type     string `json:"type"`
+		Title    string `json:"title"`
+		CreateAt int64  `json:"createAt"`
+	}
+
+	var cards, blocks []block
+	path := "/api/v2/boards/" + url.PathEscape(boardID) + "/blocks"
+	if err := p.callPlugin(userID, boardsPluginID, path+"?block_id="+url.QueryEscape(cardID), &cards); err != nil {
+		p.API.LogWarn("Failed to get board card", "request_id", requestID, "card_id", cardID, "err", err.Error())
+		httpErrorWithRequestID(w, requestID, "Failed to get the card", http.StatusBadGateway)
+		return
+	}
+	if err := p.callPlugin(userID, boardsPluginID, path+"?parent_id="+url.QueryEscape(cardID), &blocks); err != nil {
+		p.API.LogWarn("Failed to get board card content", "request_id", requestID, "card_id", cardID, "err", err.Error())
+		httpErrorWithRequestID(w, requestID, "Failed to get the card content", http.StatusBadGateway)
+		return
+	}
+
+	contents := []*TranslatedContent{}
+	for _, b := range append(cards, blocks...) {
+		if (b.Type != "card" && b.Type != "text") || b.Title == "" {
+			continue
+		}
+
+		content, err := p.translateContent(requestID, p.preferredProvider(userInfo), b.ID, b.CreateAt, b.Title, userInfo.TargetLanguage)
+		if err != nil {
+			p.API.LogWarn("Failed to translate card block", "request_id", requestID, "block_id", b.ID, "err", err.Error())
+			continue
+		}
+		contents = append(contents, content)
+	}
+
+	resp, _ := json.Marshal(contents)
+	w.Write(resp)
+}
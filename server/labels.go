@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	translationModeTranslate  = "translate"
+	translationModeDetectOnly = "detect_only"
+
+	// propDetectedLanguage holds the language code detected for a post, which clients show
+	// as a badge next to the translate action.
+	propDetectedLanguage = "autotranslate_language"
+)
+
+// isDetectOnly reports whether auto-translation only labels posts with their language.
+func (c *configuration) isDetectOnly() bool {
+	return c.TranslationMode == translationModeDetectOnly
+}
+
+// labelLanguage detects the language of the post and stores it in the post props, leaving the
+// message untouched. Failures are ignored as the label is informative only.
+func (p *Plugin) labelLanguage(requestID string, post *model.Post) *model.Post {
+	language, err := p.resolveSourceLanguage(requestID, post.UserId, post.Message)
+	if err != nil {
+		return post
+	}
+
+	post.AddProp(propDetectedLanguage, language)
+	return post
+}
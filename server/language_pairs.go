@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	apiErrorPairNotAllowed = "language_pair_not_allowed"
+	appErrorPairNotAllowed = "LanguagePairNotAllowed"
+
+	// anyLanguage matches every language in allowed language pairs.
+	anyLanguage = "*"
+)
+
+// allowedPair is a source and target language translations are allowed between, either of
+// which can be anyLanguage.
+type allowedPair struct {
+	source string
+	target string
+}
+
+// allowedPairs lists the language pairs System Admins allow. No pair allows every pair.
+type allowedPairs []allowedPair
+
+// parseAllowedPairs parses pairs in the form "ja:en, ko<>en, *:en" where "<>" allows both
+// directions of a pair and "*" any language.
+func parseAllowedPairs(value string) (allowedPairs, error) {
+	var pairs allowedPairs
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		separator := ":"
+		if strings.Contains(entry, "<>") {
+			separator = "<>"
+		}
+
+		languages := strings.Split(entry, separator)
+		if len(languages) != 2 {
+			return nil, fmt.Errorf("Invalid allowed language pair %q, expected source:target", entry)
+		}
+
+		source, target := strings.TrimSpace(languages[0]), strings.TrimSpace(languages[1])
+		for _, language := range []string{source, target} {
+			if language != anyLanguage && (language == autoLanguage || languageCodes[language] == "") {
+				return nil, fmt.Errorf("Invalid language %q in allowed language pair %q", language, entry)
+			}
+		}
+
+		pairs = append(pairs, allowedPair{source: source, target: target})
+		if separator == "<>" {
+			pairs = append(pairs, allowedPair{source: target, target: source})
+		}
+	}
+
+	return pairs, nil
+}
+
+func matchesLanguage(pattern, language string) bool {
+	return pattern == anyLanguage || pattern == language
+}
+
+// allows reports whether translations from the source to the target language are allowed.
+func (a allowedPairs) allows(sourceLang, targetLang string) bool {
+	if len(a) == 0 {
+		return true
+	}
+
+	for _, pair := range a {
+		if matchesLanguage(pair.source, sourceLang) && matchesLanguage(pair.target, targetLang) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsTarget reports whether translations into the target language are allowed from at
+// least one language, which is what settings with a detected source language need.
+func (a allowedPairs) allowsTarget(targetLang string) bool {
+	if len(a) == 0 {
+		return true
+	}
+
+	for _, pair := range a {
+		if matchesLanguage(pair.target, targetLang) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getAllowedPairs returns the language pairs allowed by System Admins. Invalid pairs are
+// reported by IsValid.
+func (c *configuration) getAllowedPairs() allowedPairs {
+	pairs, _ := parseAllowedPairs(c.AllowedLanguagePairs)
+	return pairs
+}
+
+// pairNotAllowedError is returned when a translation between languages System Admins do not
+// allow is requested.
+func pairNotAllowedError(sourceLang, targetLang string) *APIErrorResponse {
+	return &APIErrorResponse{
+		ID:         apiErrorPairNotAllowed,
+		Message:    fmt.Sprintf("Translation from %s to %s is not allowed by your System Admin.", languageName(sourceLang), languageName(targetLang)),
+		StatusCode: http.StatusForbidden,
+	}
+}
+
+// checkSettingsPair returns an error when the languages of the settings cannot be translated
+// between. An automatic source only needs the target to be allowed from some language.
+func (c *configuration) checkSettingsPair(sourceLang, targetLang string) *APIErrorResponse {
+	pairs := c.getAllowedPairs()
+	if sourceLang == autoLanguage {
+		if pairs.allowsTarget(targetLang) {
+			return nil
+		}
+
+		return &APIErrorResponse{
+			ID:         apiErrorPairNotAllowed,
+			Message:    fmt.Sprintf("Translation into %s is not allowed by your System Admin.", languageName(targetLang)),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	if pairs.allows(sourceLang, targetLang) {
+		return nil
+	}
+
+	return pairNotAllowedError(sourceLang, targetLang)
+}
+
+// pairNotAllowedAppError is pairNotAllowedError for the translation functions returning
+// application errors.
+func pairNotAllowedAppError(requestID, sourceLang, targetLang string) *model.AppError {
+	return model.NewAppError("translateText", appErrorPairNotAllowed, nil, fmt.Sprintf("Translation from %s to %s is not allowed, request_id=%s", sourceLang, targetLang, requestID), http.StatusForbidden)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// lateTranslationTimeout is how long the translation of a post that overran the latency budget
+// is waited for after the post is saved.
+const lateTranslationTimeout = 2 * time.Minute
+
+// newPostResult is the outcome of translateNewPost.
+type newPostResult struct {
+	replacement *model.Post
+	rejection   string
+}
+
+// lateTranslation is the translation of a new post still running when the latency budget ran
+// out, which the post is updated with once it is saved.
+type lateTranslation struct {
+	original  *model.Post
+	result    chan *newPostResult
+	createdAt time.Time
+}
+
+// getHookLatencyBudget returns how long new posts may be held for their translation, or 0 when
+// they are held until it completes.
+func (c *configuration) getHookLatencyBudget() time.Duration {
+	milliseconds, err := strconv.Atoi(strings.TrimSpace(c.HookLatencyBudget))
+	if err != nil || milliseconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(milliseconds) * time.Millisecond
+}
+
+// translateNewPostWithinBudget runs translateNewPost for at most the latency budget. When the
+// translation takes longer, the post is posted unchanged and updated with the translation once
+// it completes, so that slow providers never hold messages back.
+func (p *Plugin) translateNewPostWithinBudget(post *model.Post) (*model.Post, string) {
+	budget := p.getConfiguration().getHookLatencyBudget()
+	if budget == 0 {
+		return p.translateNewPost(post)
+	}
+
+	original := post.Clone()
+	result := make(chan *newPostResult, 1)
+	go func() {
+		defer close(result)
+		defer p.recoverHookPanic("MessageWillBePosted")
+
+		replacement, rejection := p.translateNewPost(post)
+		result <- &newPostResult{replacement: replacement, rejection: rejection}
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+
+	select {
+	case res, ok := <-result:
+		if !ok {
+			return nil, ""
+		}
+		return res.replacement, res.rejection
+	case <-timer.C:
+	}
+
+	p.lateTranslations.Range(func(key, value interface{}) bool {
+		if time.Since(value.(*lateTranslation).createdAt) > pendingDeliveryTTL {
+			p.lateTranslations.Delete(key)
+		}
+		return true
+	})
+	p.lateTranslations.Store(pendingDeliveryKey(original), &lateTranslation{
+		original:  original,
+		result:    result,
+		createdAt: time.Now(),
+	})
+
+	return nil, ""
+}
+
+// completeLateTranslation waits for the translation of the saved post if it overran the latency
+// budget, then updates the post with it and delivers what the display mode sends separately.
+func (p *Plugin) completeLateTranslation(post *model.Post) {
+	value, ok := p.lateTranslations.Load(pendingDeliveryKey(post))
+	if !ok {
+		return
+	}
+	p.lateTranslations.Delete(pendingDeliveryKey(post))
+	late := value.(*lateTranslation)
+
+	timer := time.NewTimer(lateTranslationTimeout)
+	defer timer.Stop()
+
+	var res *newPostResult
+	select {
+	case res, ok = <-late.result:
+		if !ok {
+			return
+		}
+	case <-timer.C:
+		p.API.LogWarn("Gave up waiting for the translation of a post", "post_id", post.Id)
+		return
+	}
+
+	// The post is already posted, it can no longer be rejected.
+	if res.rejection != "" || res.replacement == nil || p.isPostGone(post.Id) {
+		return
+	}
+
+	translated := res.replacement.Clone()
+	translated.Id = post.Id
+	if translated.Message != late.original.Message || model.StringInterfaceToJson(translated.GetProps()) != model.StringInterfaceToJson(late.original.GetProps()) {
+		saved, appErr := p.API.GetPost(post.Id)
+		if appErr != nil {
+			return
+		}
+		if saved.EditAt != 0 {
+			// The author edited the message meanwhile, their edit is kept.
+			return
+		}
+
+		updated := saved.Clone()
+		updated.Message = translated.Message
+		for key, value := range translated.GetProps() {
+			updated.AddProp(key, value)
+		}
+		updated, appErr = p.API.UpdatePost(updated)
+		if appErr != nil {
+			p.API.LogWarn("Failed to add late translation to post", "post_id", post.Id, "err", appErr.Error())
+			return
+		}
+		p.trackAppendedTranslation(updated)
+		p.recordShownTranslation(updated)
+	}
+
+	p.deliverTranslation(translated)
+	p.postForReview(translated)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	learningModeKeyPrefix = "learning_"
+
+	learningModeOff       = "off"
+	learningModeOn        = "on"
+	learningModeAnnotated = "annotated"
+)
+
+// getLearningMode returns the learning mode of a channel: "off", "on" to show each line of the
+// original above its translation, or "annotated" to also romanize the original lines.
+func (p *Plugin) getLearningMode(channelID string) string {
+	value, appErr := p.API.KVGet(learningModeKeyPrefix + channelID)
+	if appErr != nil || value == nil {
+		return learningModeOff
+	}
+
+	return string(value)
+}
+
+// setLearningMode changes the learning mode of a channel, recording the change in the
+// settings audit.
+func (p *Plugin) setLearningMode(requestID, actorID, channelID, mode string) *model.AppError {
+	previous := p.getLearningMode(channelID)
+
+	var appErr *model.AppError
+	if mode == learningModeOff {
+		appErr = p.API.KVDelete(learningModeKeyPrefix + channelID)
+	} else {
+		appErr = p.API.KVSet(learningModeKeyPrefix+channelID, []byte(mode))
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindChannelLearning, channelID, previous, mode)
+
+	return nil
+}
+
+// canManageChannel reports whether the user may change the settings of the channel.
+func (p *Plugin) canManageChannel(userID string, channel *model.Channel) bool {
+	permission := model.PERMISSION_MANAGE_PUBLIC_CHANNEL_PROPERTIES
+	if channel.Type == model.CHANNEL_PRIVATE {
+		permission = model.PERMISSION_MANAGE_PRIVATE_CHANNEL_PROPERTIES
+	}
+
+	return p.API.HasPermissionToChannel(userID, channel.Id, permission)
+}
+
+// renderLearningBlock lays out the original and the translation line by line, quoting each
+// original line above its translation, so that readers learning one of the languages can
+// compare them. It returns false when the translation does not keep the lines of the original.
+func (p *Plugin) renderLearningBlock(requestID, mode, original, translated string) (string, bool) {
+	originalLines := strings.Split(original, "\n")
+	translatedLines := strings.Split(translated, "\n")
+	if len(originalLines) != len(translatedLines) {
+		return "", false
+	}
+
+	var block strings.Builder
+	for i, line := range originalLines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if block.Len() > 0 {
+			block.WriteString("\n\n")
+		}
+
+		block.WriteString("> ")
+		block.WriteString(line)
+		if mode == learningModeAnnotated && hasRomanizableScript(line) {
+			block.WriteString("\n> _")
+			block.WriteString(p.romanizeText(requestID, line))
+			block.WriteString("_")
+		}
+		block.WriteString("\n")
+		block.WriteString(translatedLines[i])
+	}
+
+	return block.String(), true
+}
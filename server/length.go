@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	oversizePolicyTruncate = "truncate"
+	oversizePolicySplit    = "split"
+	oversizePolicySkip     = "skip"
+
+	// defaultMaxMessageCharacters stays below the 5000 bytes Amazon Translate accepts per
+	// request for most scripts.
+	defaultMaxMessageCharacters = 4500
+
+	appErrorTextTooLong = "TextTooLong"
+)
+
+// getMaxMessageCharacters returns the number of characters above which the oversize policy
+// applies.
+func (c *configuration) getMaxMessageCharacters() int {
+	maxCharacters, err := strconv.Atoi(strings.TrimSpace(c.MaxMessageCharacters))
+	if err != nil || maxCharacters <= 0 {
+		return defaultMaxMessageCharacters
+	}
+
+	return maxCharacters
+}
+
+// translateText translates text, applying the oversize policy to text longer than the
+// configured maximum: it is truncated with a notice, split into chunks translated one by one,
+// or not translated at all.
+func (p *Plugin) translateText(requestID, preferredProvider, text, sourceLang, targetLang string) (string, *model.AppError) {
+	translated, _, appErr := p.translateTextWithProvider(requestID, preferredProvider, text, sourceLang, targetLang, nil)
+	return translated, appErr
+}
+
+// translateTextWithProvider is translateText also returning the name of the provider that
+// translated the text, and taking the preceding messages of the conversation, if any.
+func (p *Plugin) translateTextWithProvider(requestID, preferredProvider, text, sourceLang, targetLang string, conversation []string) (string, string, *model.AppError) {
+	// Texts translated by a person before are not sent to providers again.
+	if translation, ok := p.recallTranslation(requestID, text, sourceLang, targetLang); ok {
+		return translation, providerTranslationMemory, nil
+	}
+
+	// Repeated boilerplate is translated once per channel, only the rest of the text is sent.
+	if translation, provider, ok := p.translateBoilerplate(requestID, preferredProvider, text, sourceLang, targetLang, conversation); ok {
+		return translation, provider, nil
+	}
+
+	configuration := p.getConfiguration()
+	maxCharacters := configuration.getMaxMessageCharacters()
+
+	length := utf8.RuneCountInString(text)
+	if length <= maxCharacters {
+		return p.translateWithProviders(requestID, preferredProvider, text, sourceLang, targetLang, conversation)
+	}
+
+	switch configuration.OversizePolicy {
+	case oversizePolicySkip:
+		return "", "", model.NewAppError("translateText", appErrorTextTooLong, nil, fmt.Sprintf("Text of %d characters exceeds the limit of %d, request_id=%s", length, maxCharacters, requestID), http.StatusRequestEntityTooLarge)
+	case oversizePolicySplit:
+		var translated strings.Builder
+		provider := ""
+		for _, chunk := range splitText(text, maxCharacters) {
+			translatedChunk, chunkProvider, appErr := p.translateWithProviders(requestID, preferredProvider, chunk.text, sourceLang, targetLang, conversation)
+			if appErr != nil {
+				return "", "", appErr
+			}
+			translated.WriteString(translatedChunk)
+			translated.WriteString(chunk.separator)
+			provider = chunkProvider
+		}
+		return translated.String(), provider, nil
+	default:
+		chunks := splitText(text, maxCharacters)
+		translated, provider, appErr := p.translateWithProviders(requestID, preferredProvider, chunks[0].text, sourceLang, targetLang, conversation)
+		if appErr != nil {
+			return "", "", appErr
+		}
+		return fmt.Sprintf("%s\n\n_(Only the first %d of %d characters were translated.)_", translated, utf8.RuneCountInString(chunks[0].text), length), provider, nil
+	}
+}
+
+type textChunk struct {
+	text      string
+	separator string
+}
+
+// splitText cuts text into chunks of at most maxCharacters characters, preferably at line
+// breaks, then at spaces. The separator a chunk was cut at is kept apart so it survives the
+// translation of the chunk.
+func splitText(text string, maxCharacters int) []textChunk {
+	var chunks []textChunk
+
+	remaining := []rune(text)
+	for len(remaining) > maxCharacters {
+		window := string(remaining[:maxCharacters])
+
+		cut := strings.LastIndex(window, "\n")
+		if cut <= 0 {
+			cut = strings.LastIndex(window, " ")
+		}
+
+		if cut <= 0 {
+			chunks = append(chunks, textChunk{text: window})
+			remaining = remaining[maxCharacters:]
+			continue
+		}
+
+		chunks = append(chunks, textChunk{text: window[:cut], separator: window[cut : cut+1]})
+		remaining = remaining[utf8.RuneCountInString(window[:cut])+1:]
+	}
+
+	return append(chunks, textChunk{text: string(remaining)})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	languageDetectionComprehend = "comprehend"
+	languageDetectionLocal      = "local"
+
+	// localDetectionMinConfidence is the confidence under which a local detection is confirmed
+	// with Comprehend.
+	localDetectionMinConfidence = 0.7
+
+	// localDetectionFullTrigrams is the number of trigrams from which the length of a text no
+	// longer lowers the confidence of its local detection.
+	localDetectionFullTrigrams = 40
+)
+
+// singleLanguageScripts maps the scripts told apart by textScript that are written in a single
+// supported language to that language.
+var singleLanguageScripts = map[string]string{
+	"Kana":       "ja",
+	"Hangul":     "ko",
+	"Thai":       "th",
+	"Hebrew":     "he",
+	"Greek":      "el",
+	"Devanagari": "hi",
+}
+
+// trigramSamples are short texts of the languages told apart by their trigrams: the first
+// article of the Universal Declaration of Human Rights followed by everyday work chat.
+var trigramSamples = map[string]string{
+	"en": "All human beings are born free and equal in dignity and rights. They are endowed with reason and conscience and should act towards one another in a spirit of brotherhood. Can you take a look at this when you have time? I think we should move the meeting to next week. Thanks for the update, the new version works well and the team is happy with it. What do you think about the proposal? Let me know if there is anything I can do to help.",
+	"de": "Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen. Kannst du dir das bitte ansehen, wenn du Zeit hast? Ich denke, wir sollten das Treffen auf nächste Woche verschieben. Danke für die Information, die neue Version funktioniert gut und das Team ist zufrieden damit. Was hältst du von dem Vorschlag? Sag mir Bescheid, wenn ich helfen kann.",
+	"fr": "Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont doués de raison et de conscience et doivent agir les uns envers les autres dans un esprit de fraternité. Est-ce que tu peux regarder ça quand tu as le temps ? Je pense que nous devrions déplacer la réunion à la semaine prochaine. Merci pour la mise à jour, la nouvelle version fonctionne bien et l'équipe en est contente. Qu'est-ce que tu penses de la proposition ? Dis-moi si je peux aider.",
+	"es": "Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados como están de razón y conciencia, deben comportarse fraternalmente los unos con los otros. ¿Puedes revisar esto cuando tengas tiempo? Creo que deberíamos mover la reunión a la próxima semana. Gracias por la actualización, la nueva versión funciona bien y el equipo está contento con ella. ¿Qué piensas de la propuesta? Avísame si puedo ayudar en algo.",
+	"it": "Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri in spirito di fratellanza. Puoi dare un'occhiata a questo quando hai tempo? Penso che dovremmo spostare la riunione alla prossima settimana. Grazie per l'aggiornamento, la nuova versione funziona bene e il gruppo ne è contento. Cosa ne pensi della proposta? Fammi sapere se posso aiutare.",
+	"pt": "Todos os seres humanos nascem livres e iguais em dignidade e em direitos. Dotados de razão e de consciência, devem agir uns para com os outros em espírito de fraternidade. Você pode dar uma olhada nisso quando tiver tempo? Acho que devemos mudar a reunião para a próxima semana. Obrigado pela atualização, a nova versão funciona bem e a equipe está contente com ela. O que você acha da proposta? Me avise se eu puder ajudar.",
+	"nl": "Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn begiftigd met verstand en geweten, en behoren zich jegens elkander in een geest van broederschap te gedragen. Kun je hier even naar kijken als je tijd hebt? Ik denk dat we de vergadering naar volgende week moeten verplaatsen. Bedankt voor de update, de nieuwe versie werkt goed en het team is er blij mee. Wat vind je van het voorstel? Laat het me weten als ik kan helpen.",
+	"pl": "Wszyscy ludzie rodzą się wolni i równi pod względem swej godności i swych praw. Są oni obdarzeni rozumem i sumieniem i powinni postępować wobec innych w duchu braterstwa. Czy możesz na to spojrzeć, kiedy będziesz miał czas? Myślę, że powinniśmy przenieść spotkanie na przyszły tydzień. Dziękuję za informację, nowa wersja działa dobrze i zespół jest z niej zadowolony. Co myślisz o tej propozycji? Daj mi znać, jeśli mogę pomóc.",
+	"tr": "Bütün insanlar hür, haysiyet ve haklar bakımından eşit doğarlar. Akıl ve vicdana sahiptirler ve birbirlerine karşı kardeşlik zihniyeti ile hareket etmelidirler. Vaktin olduğunda buna bir bakabilir misin? Bence toplantıyı gelecek haftaya almalıyız. Güncelleme için teşekkürler, yeni sürüm iyi çalışıyor ve ekip bundan memnun. Teklif hakkında ne düşünüyorsun? Yardım edebileceğim bir şey olursa haber ver.",
+	"sv": "Alla människor är födda fria och lika i värde och rättigheter. De är utrustade med förnuft och samvete och bör handla gentemot varandra i en anda av broderskap. Kan du titta på det här när du har tid? Jag tycker att vi borde flytta mötet till nästa vecka. Tack för uppdateringen, den nya versionen fungerar bra och teamet är nöjt med den. Vad tycker du om förslaget? Säg till om jag kan hjälpa till.",
+	"id": "Semua orang dilahirkan merdeka dan mempunyai martabat dan hak-hak yang sama. Mereka dikaruniai akal dan hati nurani dan hendaknya bergaul satu sama lain dalam semangat persaudaraan. Bisakah kamu melihat ini kalau ada waktu? Saya pikir kita harus memindahkan rapat ke minggu depan. Terima kasih atas informasinya, versi baru berjalan dengan baik dan tim senang dengan itu. Apa pendapatmu tentang usulan itu? Beri tahu saya kalau saya bisa membantu.",
+	"ru": "Все люди рождаются свободными и равными в своем достоинстве и правах. Они наделены разумом и совестью и должны поступать в отношении друг друга в духе братства. Можешь посмотреть на это, когда будет время? Я думаю, нам стоит перенести встречу на следующую неделю. Спасибо за обновление, новая версия работает хорошо, и команда ею довольна. Что ты думаешь о предложении? Дай знать, если я могу помочь.",
+	"uk": "Всі люди народжуються вільними і рівними у своїй гідності та правах. Вони наділені розумом і совістю і повинні діяти у відношенні один до одного в дусі братерства. Можеш подивитися на це, коли матимеш час? Я думаю, що нам варто перенести зустріч на наступний тиждень. Дякую за оновлення, нова версія працює добре, і команда нею задоволена. Що ти думаєш про пропозицію? Дай знати, якщо я можу допомогти.",
+	"ar": "يولد جميع الناس أحرارا متساوين في الكرامة والحقوق. وقد وهبوا عقلا وضميرا وعليهم أن يعامل بعضهم بعضا بروح الإخاء. هل يمكنك أن تلقي نظرة على هذا عندما يكون لديك وقت؟ أعتقد أنه يجب علينا نقل الاجتماع إلى الأسبوع القادم. شكرا على التحديث، النسخة الجديدة تعمل بشكل جيد والفريق راض عنها.",
+	"fa": "تمام افراد بشر آزاد به دنیا می‌آیند و از لحاظ حیثیت و حقوق با هم برابرند. همه دارای عقل و وجدان هستند و باید نسبت به یکدیگر با روح برادری رفتار کنند. می‌توانی وقتی وقت داشتی به این نگاه کنی؟ فکر می‌کنم باید جلسه را به هفته بعد منتقل کنیم. ممنون بابت به‌روزرسانی، نسخه جدید خوب کار می‌کند و تیم از آن راضی است.",
+}
+
+// trigramProfile is the normalized frequency of the trigrams of a language.
+type trigramProfile struct {
+	language string
+	script   string
+	weights  map[string]float64
+}
+
+var trigramProfiles = buildTrigramProfiles()
+
+func buildTrigramProfiles() []trigramProfile {
+	profiles := make([]trigramProfile, 0, len(trigramSamples))
+	for language, sample := range trigramSamples {
+		profiles = append(profiles, trigramProfile{
+			language: language,
+			script:   textScript(sample),
+			weights:  normalizeTrigrams(countTrigrams(sample)),
+		})
+	}
+
+	return profiles
+}
+
+// countTrigrams counts the trigrams of the lowercased words of the text, padded with spaces so
+// that the starts and ends of words count.
+func countTrigrams(text string) map[string]int {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	return counts
+}
+
+func normalizeTrigrams(counts map[string]int) map[string]float64 {
+	var norm float64
+	for _, count := range counts {
+		norm += float64(count * count)
+	}
+	norm = math.Sqrt(norm)
+
+	weights := make(map[string]float64, len(counts))
+	for trigram, count := range counts {
+		weights[trigram] = float64(count) / norm
+	}
+
+	return weights
+}
+
+// detectLanguageLocally detects the language of the text in process. Texts in a script written
+// in a single language are detected with certainty, others by the similarity of their trigrams
+// with the profiles of the languages of their script. The confidence drops with the margin
+// over the second best language and with the length of short texts.
+func detectLanguageLocally(text string) (string, float64) {
+	script := textScript(text)
+	if language, ok := singleLanguageScripts[script]; ok {
+		return language, 1
+	}
+
+	counts := countTrigrams(text)
+	if len(counts) == 0 {
+		return "", 0
+	}
+	weights := normalizeTrigrams(counts)
+
+	best, bestScore, secondScore := "", 0.0, 0.0
+	for _, profile := range trigramProfiles {
+		if profile.script != script {
+			continue
+		}
+
+		var score float64
+		for trigram, weight := range weights {
+			score += weight * profile.weights[trigram]
+		}
+
+		switch {
+		case score > bestScore:
+			best, bestScore, secondScore = profile.language, score, bestScore
+		case score > secondScore:
+			secondScore = score
+		}
+	}
+
+	if bestScore == 0 {
+		return "", 0
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	confidence := (bestScore - secondScore) / bestScore * 2
+	confidence *= math.Min(1, float64(total)/localDetectionFullTrigrams)
+	return best, math.Min(1, confidence)
+}
+
+// detectLanguageLocallyIfConfident returns the local detection of the text when local detection
+// is enabled and confident enough to skip Comprehend.
+func (p *Plugin) detectLanguageLocallyIfConfident(text string) (string, float64, bool) {
+	if p.getConfiguration().LanguageDetection != languageDetectionLocal {
+		return "", 0, false
+	}
+
+	language, confidence := detectLanguageLocally(text)
+	if language == "" || confidence < localDetectionMinConfidence {
+		return "", 0, false
+	}
+
+	return language, confidence, true
+}
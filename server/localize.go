@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// usDateRegexp matches month/day dates, with an optional year, as written in US English.
+	usDateRegexp = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})(?:/(\d{4}|\d{2}))?\b`)
+
+	// imperialUnitRegexp matches a quantity in an imperial unit.
+	imperialUnitRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?) ?(miles?|mi|feet|ft|pounds?|lbs?|°F|inch(?:es)?|gallons?|gal)\b`)
+
+	// dotDecimalRegexp matches numbers using commas as thousands separators and a dot as
+	// decimal separator.
+	dotDecimalRegexp = regexp.MustCompile(`\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+\.\d+`)
+)
+
+var monthAbbreviations = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// commaDecimalLanguages are the target languages writing 1.234,5 instead of 1,234.5.
+var commaDecimalLanguages = map[string]bool{
+	"de": true, "es": true, "fr": true, "fr-CA": true, "it": true, "pt": true, "pt-PT": true,
+	"nl": true, "ru": true, "uk": true, "pl": true, "cs": true, "sv": true, "da": true,
+	"no": true, "fi": true, "tr": true, "id": true, "ro": true, "hu": true, "el": true,
+}
+
+type unitConversion struct {
+	unit    string
+	convert func(float64) float64
+}
+
+var (
+	milesToKilometers   = unitConversion{"km", func(v float64) float64 { return v * 1.609344 }}
+	feetToMeters        = unitConversion{"m", func(v float64) float64 { return v * 0.3048 }}
+	poundsToKilograms   = unitConversion{"kg", func(v float64) float64 { return v * 0.45359237 }}
+	fahrenheitToCelsius = unitConversion{"°C", func(v float64) float64 { return (v - 32) * 5 / 9 }}
+	inchesToCentimeters = unitConversion{"cm", func(v float64) float64 { return v * 2.54 }}
+	gallonsToLiters     = unitConversion{"L", func(v float64) float64 { return v * 3.785411784 }}
+)
+
+// imperialUnits maps the imperial units matched by imperialUnitRegexp to their conversion.
+var imperialUnits = map[string]unitConversion{
+	"mile": milesToKilometers, "miles": milesToKilometers, "mi": milesToKilometers,
+	"feet": feetToMeters, "ft": feetToMeters,
+	"pound": poundsToKilograms, "pounds": poundsToKilograms, "lb": poundsToKilograms, "lbs": poundsToKilograms,
+	"°F":   fahrenheitToCelsius,
+	"inch": inchesToCentimeters, "inches": inchesToCentimeters,
+	"gallon": gallonsToLiters, "gallons": gallonsToLiters, "gal": gallonsToLiters,
+}
+
+// localizeTranslation adapts the dates, units and numbers of a translation to the conventions
+// of the target language: US month/day dates of English messages are written out, imperial
+// units are converted to metric ones and decimal separators are swapped where needed.
+func localizeTranslation(text, sourceLang, targetLang string) string {
+	if targetLang == enLanguage {
+		return text
+	}
+
+	if sourceLang == enLanguage {
+		text = usDateRegexp.ReplaceAllStringFunc(text, func(match string) string {
+			parts := usDateRegexp.FindStringSubmatch(match)
+			month, _ := strconv.Atoi(parts[1])
+			day, _ := strconv.Atoi(parts[2])
+			if month < 1 || month > 12 || day < 1 || day > 31 {
+				return match
+			}
+			return formatDate(targetLang, day, month, parts[3])
+		})
+	}
+
+	text = imperialUnitRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		parts := imperialUnitRegexp.FindStringSubmatch(match)
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return match
+		}
+
+		conversion, ok := imperialUnits[parts[2]]
+		if !ok {
+			return match
+		}
+
+		converted := math.Round(conversion.convert(value)*10) / 10
+		return strconv.FormatFloat(converted, 'f', -1, 64) + " " + conversion.unit
+	})
+
+	if commaDecimalLanguages[targetLang] {
+		text = swapDecimalSeparators(text)
+	}
+
+	return text
+}
+
+// swapDecimalSeparators rewrites 1,234.5 as 1.234,5. Numbers that are part of a longer
+// dotted sequence or of a word, such as versions and IP addresses, are left alone.
+func swapDecimalSeparators(text string) string {
+	isPartOfToken := func(b byte) bool {
+		return b == '.' || b == ',' || b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, loc := range dotDecimalRegexp.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && isPartOfToken(text[start-1]) {
+			continue
+		}
+
+		// A trailing dot or comma is punctuation unless a digit follows it.
+		if end < len(text) && isPartOfToken(text[end]) && (text[end] != '.' && text[end] != ',' || end+1 < len(text) && text[end+1] >= '0' && text[end+1] <= '9') {
+			continue
+		}
+
+		result.WriteString(text[last:start])
+		result.WriteString(strings.NewReplacer(",", ".", ".", ",").Replace(text[start:end]))
+		last = end
+	}
+	result.WriteString(text[last:])
+
+	return result.String()
+}
+
+// formatDate writes a date in the usual short form of the target language.
+func formatDate(targetLang string, day, month int, year string) string {
+	switch targetLang {
+	case "ja", "zh", "zh-TW":
+		if year != "" {
+			return fmt.Sprintf("%s年%d月%d日", year, month, day)
+		}
+		return fmt.Sprintf("%d月%d日", month, day)
+	case "ko":
+		if year != "" {
+			return fmt.Sprintf("%s년 %d월 %d일", year, month, day)
+		}
+		return fmt.Sprintf("%d월 %d일", month, day)
+	}
+
+	if year != "" {
+		return fmt.Sprintf("%d %s %s", day, monthAbbreviations[month-1], year)
+	}
+	return fmt.Sprintf("%d %s", day, monthAbbreviations[month-1])
+}
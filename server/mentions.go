@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+// MessageHasBeenPosted is invoked after the message has been committed to the database.
+func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
+	defer p.recoverHookPanic("MessageHasBeenPosted")
+
+	if p.IsValid() != nil || p.isWatchdogTripped() {
+		return
+	}
+
+	p.deliverTranslation(post)
+	p.postForReview(post)
+	p.trackAppendedTranslation(post)
+	p.recordShownTranslation(post)
+	p.translateMentions(post)
+	p.translateGroupMessage(post)
+	p.translateUrgentPost(post)
+	p.nudgeOfficialLanguage(post)
+	p.observeBoilerplate(post)
+
+	// Translations overrunning the latency budget are added once they complete.
+	go p.safely("late translation", func() { p.completeLateTranslation(post) })
+
+	// Transcripts can be long, do not hold the hook while they are translated.
+	go p.safely("call transcript translation", func() { p.translateCallTranscript(post) })
+}
+
+// translateMentions sends a direct message with a translated copy of the post to every
+// @mentioned channel member whose reading language differs from the language of the post,
+// regardless of whether they have auto-translation turned on.
+func (p *Plugin) translateMentions(post *model.Post) {
+	if !p.getConfiguration().TranslateMentions || post.IsSystemMessage() || post.UserId == p.botUserID {
+		return
+	}
+
+	usernames := model.PossibleAtMentions(post.Message)
+	if len(usernames) == 0 {
+		return
+	}
+
+	users, appErr := p.API.GetUsersByUsernames(usernames)
+	if appErr != nil || len(users) == 0 {
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return
+	}
+
+	requestID := newRequestID()
+	sourceLang := ""
+	translations := map[string]string{}
+
+	for _, user := range users {
+		if user.Id == post.UserId || user.IsBot {
+			continue
+		}
+
+		// Never leak the content of a channel to someone who cannot read it.
+		if _, appErr := p.API.GetChannelMember(channel.Id, user.Id); appErr != nil {
+			continue
+		}
+
+		targetLang := p.readingLanguage(user)
+		if targetLang == "" {
+			continue
+		}
+
+		if sourceLang == "" {
+			detected, err := p.getPostLanguage(requestID, post)
+			if err != nil {
+				return
+			}
+			sourceLang = detected.Language
+		}
+
+		if sourceLang == targetLang {
+			continue
+		}
+
+		translated, ok := translations[targetLang]
+		if !ok {
+			text, err := p.translateText(requestID, "", post.Message, sourceLang, targetLang)
+			if err != nil {
+				continue
+			}
+			translated = text
+			translations[targetLang] = translated
+		}
+
+		if err := p.sendDirectMessage(user.Id, p.mentionMessage(post, channel, sourceLang, targetLang, translated)); err != nil {
+			p.API.LogWarn("Failed to send translated mention", "request_id", requestID, "user_id", user.Id, "err", err.Error())
+		}
+	}
+}
+
+// readingLanguage returns the language a user reads: the target language of their settings,
+// or else their Mattermost locale when it is a supported language code.
+func (p *Plugin) readingLanguage(user *model.User) string {
+	if userInfo, _ := p.getUserInfo(user.Id); userInfo != nil {
+		return userInfo.TargetLanguage
+	}
+
+	locale := user.Locale
+	if languageCodes[locale] == "" {
+		locale = strings.SplitN(locale, "-", 2)[0]
+	}
+
+	if locale == autoLanguage || languageCodes[locale] == "" {
+		return ""
+	}
+
+	return locale
+}
+
+func (p *Plugin) mentionMessage(post *model.Post, channel *model.Channel, sourceLang, targetLang, translated string) string {
+	author := "someone"
+	if user, appErr := p.API.GetUser(post.UserId); appErr == nil {
+		author = "@" + user.Username
+	}
+
+	where := "a conversation"
+	if channel.Type == model.CHANNEL_OPEN || channel.Type == model.CHANNEL_PRIVATE {
+		where = fmt.Sprintf("~%s", channel.Name)
+	}
+
+	text := fmt.Sprintf("You were mentioned by %s in %s (%s → %s):\n> %s", author, where, languageCodes[sourceLang], languageCodes[targetLang], translated)
+	if permalink := p.getPermalink(post, channel); permalink != "" {
+		text += fmt.Sprintf("\n\n[Jump to the original message](%s)", permalink)
+	}
+
+	return text
+}
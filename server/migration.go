@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	kvExportVersion = 1
+	kvListPerPage   = 1000
+)
+
+// kvTransientKeys lists the keys, and prefixes of keys, of locks, claims and secrets that only
+// make sense on the server they were set on. They are neither exported nor imported: values
+// encrypted at rest are read again only if the other server is given the same key.
+var kvTransientKeys = []string{
+	cleanupLockKey,
+	classificationLockKey,
+	idempotencyKeyPrefix,
+	queueClaimKeyPrefix,
+	watchdogKey,
+	atRestDataKeyKey,
+}
+
+// kvExpiringKeys lists the prefixes of keys set with an expiry, and the expiry in seconds.
+var kvExpiringKeys = []struct {
+	prefix string
+	ttl    int64
+}{
+	{boilerplateKeyPrefix, boilerplateTTL},
+	{channelUsageKeyPrefix, channelUsageTTL},
+	{channelLanguagesKeyPrefix, channelLanguagesTTL},
+	{currencyRatesKey, currencyRatesTTL},
+	{groupLanguagesKeyPrefix, groupLanguagesTTL},
+	{postLanguageKeyPrefix, postLanguageTTL},
+	{reviewKeyPrefix, reviewTTL},
+	{senderLanguageKeyPrefix, senderLanguageTTL},
+	{skipNextKeyPrefix, skipNextTTL},
+	{teamCensusKeyPrefix, teamCensusTTL},
+	{termCorrectionKeyPrefix, termCorrectionTTL},
+	{threadContextKeyPrefix, translationTTL},
+	{threadMemoryKeyPrefix, threadMemoryTTL},
+	{translationMemoryKeyPrefix, translationMemoryTTL},
+}
+
+func isTransientKey(key string) bool {
+	for _, prefix := range kvTransientKeys {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kvExpiry returns the expiry, in seconds, to import the key with, 0 for none, and false when
+// the key is not to be kept at all: cached translations and their history expire after the
+// retention period, and are not kept when it is 0.
+func (p *Plugin) kvExpiry(key string) (int64, bool) {
+	if strings.HasPrefix(key, translationKeyPrefix) || strings.HasPrefix(key, translationHistoryKeyPrefix) {
+		days := p.getConfiguration().getTranslationRetentionDays()
+		return int64(days * secondsPerDay), days > 0
+	}
+
+	for _, entry := range kvExpiringKeys {
+		if strings.HasPrefix(key, entry.prefix) {
+			return entry.ttl, true
+		}
+	}
+
+	return 0, true
+}
+
+// kvExport holds all the data the plugin stores, to be moved to another server. Values are
+// kept as stored, base64 encoded in JSON.
+type kvExport struct {
+	Version    int               `json:"version"`
+	ExportedAt int64             `json:"exported_at"`
+	Entries    map[string][]byte `json:"entries"`
+}
+
+// exportKV returns the keys and values stored by the plugin but transient ones: user settings,
+// profiles, team and channel settings, usage and caches.
+func (p *Plugin) exportKV() (*kvExport, *model.AppError) {
+	export := &kvExport{
+		Version:    kvExportVersion,
+		ExportedAt: model.GetMillis(),
+		Entries:    map[string][]byte{},
+	}
+
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, kvListPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		for _, key := range keys {
+			value, appErr := p.API.KVGet(key)
+			if appErr != nil {
+				return nil, appErr
+			}
+			if value != nil && !isTransientKey(key) {
+				export.Entries[key] = value
+			}
+		}
+
+		if len(keys) < kvListPerPage {
+			return export, nil
+		}
+	}
+}
+
+// handleKVMigration exports the plugin data with GET and imports an export with POST. Imported
+// entries overwrite existing ones, other entries are kept. Entries that expire are imported
+// with their full expiry again, as their remaining time to live is not exported.
+func (p *Plugin) handleKVMigration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to migrate plugin data", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		export, appErr := p.exportKV()
+		if appErr != nil {
+			p.API.LogError("Failed to export plugin data", "err", appErr.Error())
+			http.Error(w, "Failed to export plugin data", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=autotranslate-%s.json", time.Now().UTC().Format("20060102")))
+		resp, _ := json.Marshal(export)
+		w.Write(resp)
+	case http.MethodPost:
+		var export kvExport
+		if err := json.NewDecoder(r.Body).Decode(&export); err != nil || export.Version != kvExportVersion {
+			http.Error(w, fmt.Sprintf("Invalid export, expected version %d", kvExportVersion), http.StatusBadRequest)
+			return
+		}
+
+		// Imported entries may replace user info, even when the import fails part way.
+		defer p.invalidateUserInfoCache()
+
+		imported := 0
+		for key, value := range export.Entries {
+			if isTransientKey(key) {
+				continue
+			}
+			ttl, keep := p.kvExpiry(key)
+			if !keep {
+				continue
+			}
+
+			if appErr := p.API.KVSetWithExpiry(key, value, ttl); appErr != nil {
+				p.API.LogError("Failed to import plugin data", "key", key, "err", appErr.Error())
+				http.Error(w, fmt.Sprintf("Failed to import plugin data after %d entries", imported), http.StatusInternalServerError)
+				return
+			}
+			imported++
+		}
+
+		p.API.LogInfo("Imported plugin data", "user_id", userID, "entries", imported)
+		resp, _ := json.Marshal(map[string]int{"imported": imported})
+		w.Write(resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// pushTargetLanguage returns the target language of the recipient of a direct message, so the
+// push notification preview generated from the post is in a language the recipient reads.
+//
+// The plugin API has no per-recipient notification hook, so only direct messages, which have a
+// single recipient, can be covered. An empty string is returned when the feature is disabled,
+// the post is not a direct message or the recipient has not activated auto-translation.
+func (p *Plugin) pushTargetLanguage(post *model.Post) string {
+	// Direct messages kept from translation services are not translated for notifications either.
+	if configuration := p.getConfiguration(); !configuration.TranslatePushNotifications || configuration.ExcludeDirectMessages {
+		return ""
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil || channel.Type != model.CHANNEL_DIRECT {
+		return ""
+	}
+
+	recipientID := channel.GetOtherUserIdForDM(post.UserId)
+	if recipientID == "" || recipientID == post.UserId {
+		return ""
+	}
+
+	recipientInfo := p.getCachedUserInfo(recipientID)
+	if !p.isAutoTranslating(recipientID, recipientInfo) {
+		return ""
+	}
+
+	return recipientInfo.TargetLanguage
+}
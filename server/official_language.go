@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	officialLanguageKeyPrefix = "official_lang_"
+
+	settingsKindChannelOfficialLanguage = "channel_official_language"
+
+	officialLanguageActionReplace    = "replace"
+	officialLanguageActionSupplement = "supplement"
+)
+
+// getOfficialLanguage returns the language the posts of a channel are expected in, or an empty
+// string when the channel has none.
+func (p *Plugin) getOfficialLanguage(channelID string) string {
+	value, appErr := p.API.KVGet(officialLanguageKeyPrefix + channelID)
+	if appErr != nil || value == nil {
+		return ""
+	}
+
+	return string(value)
+}
+
+// setOfficialLanguage changes the official language of a channel, an empty language removing
+// it, and records the change in the settings audit.
+func (p *Plugin) setOfficialLanguage(requestID, actorID, channelID, language string) *model.AppError {
+	previous := p.getOfficialLanguage(channelID)
+
+	var appErr *model.AppError
+	if language == "" {
+		appErr = p.API.KVDelete(officialLanguageKeyPrefix + channelID)
+	} else {
+		appErr = p.API.KVSet(officialLanguageKeyPrefix+channelID, []byte(language))
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindChannelOfficialLanguage, channelID, previous, language)
+
+	return nil
+}
+
+// nudgeOfficialLanguage tells the author of a post written in another language than the
+// official language of the channel, offering to translate the post.
+func (p *Plugin) nudgeOfficialLanguage(post *model.Post) {
+	if post.IsSystemMessage() || post.UserId == p.botUserID || post.Message == "" || isTranslatedPost(post) {
+		return
+	}
+
+	official := p.getOfficialLanguage(post.ChannelId)
+	if official == "" {
+		return
+	}
+
+	requestID := newRequestID()
+	detected, err := p.getPostLanguage(requestID, post)
+	if err != nil || detected.Language == official {
+		return
+	}
+
+	action := func(name, officialAction string) *model.PostAction {
+		return &model.PostAction{
+			Name: name,
+			Type: model.POST_ACTION_TYPE_BUTTON,
+			Integration: &model.PostActionIntegration{
+				URL: fmt.Sprintf("/plugins/%s/api/official_language", manifest.Id),
+				Context: map[string]interface{}{
+					"post_id": post.Id,
+					"action":  officialAction,
+				},
+			},
+		}
+	}
+
+	nudge := &model.Post{
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   fmt.Sprintf("The official language of this channel is %s, and your message looks written in %s.", languageName(official), languageName(detected.Language)),
+	}
+	model.ParseSlackAttachment(nudge, []*model.SlackAttachment{{
+		Actions: []*model.PostAction{
+			action("Post translated version", officialLanguageActionReplace),
+			action("Add translation", officialLanguageActionSupplement),
+		},
+	}})
+	p.API.SendEphemeralPost(post.UserId, nudge)
+}
+
+// translateIntoOfficialLanguage is the post action of the nudge, replacing the message of the
+// post with its translation into the official language of the channel, or adding the
+// translation to the message.
+func (p *Plugin) translateIntoOfficialLanguage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate posts", http.StatusUnauthorized)
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+	postID, _ := request.Context["post_id"].(string)
+	officialAction, _ := request.Context["action"].(string)
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil || post.UserId != userID {
+		httpErrorWithRequestID(w, requestID, "No post to translate", http.StatusBadRequest)
+		return
+	}
+
+	official := p.getOfficialLanguage(post.ChannelId)
+	if official == "" {
+		httpErrorWithRequestID(w, requestID, "This channel has no official language", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	translated, apiErr := p.translatePost(requestID, userID, p.preferredProvider(userInfo), post, autoLanguage, official)
+	if apiErr != nil {
+		writeAPIErrorWithRequestID(w, requestID, apiErr)
+		return
+	}
+
+	updated := post.Clone()
+	if officialAction == officialLanguageActionReplace {
+		updated.Message = translated.TranslatedText
+	} else {
+		banner := p.getConfiguration().renderBanner(bannerDetails{SourceLanguage: translated.SourceLanguage, TargetLanguage: official})
+		p.displayTranslation(updated, displayModeAppend, languagePair(translated.SourceLanguage, official), banner, translated.TranslatedText)
+	}
+
+	if _, appErr := p.API.UpdatePost(updated); appErr != nil {
+		p.API.LogError("Failed to update post with its translation", "request_id", requestID, "post_id", post.Id, "err", appErr.Error())
+		httpErrorWithRequestID(w, requestID, "Failed to update the post", http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(&model.PostActionIntegrationResponse{
+		EphemeralText: fmt.Sprintf("Your message was translated into %s.", languageName(official)),
+	})
+	w.Write(resp)
+}
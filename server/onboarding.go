@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+const (
+	onboardingActionEnable  = "enable"
+	onboardingActionDecline = "decline"
+)
+
+// UserHasJoinedTeam is invoked after the membership has been committed to the database.
+func (p *Plugin) UserHasJoinedTeam(c *plugin.Context, teamMember *model.TeamMember, actor *model.User) {
+	if !p.getConfiguration().OnboardNewMembers || p.IsValid() != nil {
+		return
+	}
+
+	// The census can read the settings of many members, do not hold the hook.
+	go p.safely("onboarding", func() { p.offerOnboarding(teamMember.TeamId, teamMember.UserId) })
+}
+
+// offerOnboarding offers a new member of a team who reads another language than most of its
+// members to turn auto-translation on, so that their messages are translated into the
+// language of the team. Users who already have settings are not bothered.
+func (p *Plugin) offerOnboarding(teamID, userID string) {
+	if userInfo, _ := p.getUserInfo(userID); userInfo != nil {
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil || user.IsBot {
+		return
+	}
+
+	language := p.readingLanguage(user)
+	teamLanguage := p.getTeamLanguageCensus(teamID).dominant()
+	if language == "" || teamLanguage == "" || language == teamLanguage {
+		return
+	}
+	if !p.getConfiguration().getAllowedPairs().allows(language, teamLanguage) {
+		return
+	}
+
+	team, appErr := p.API.GetTeam(teamID)
+	if appErr != nil {
+		return
+	}
+
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		return
+	}
+
+	action := func(name, onboardingAction string) *model.PostAction {
+		return &model.PostAction{
+			Name: name,
+			Type: model.POST_ACTION_TYPE_BUTTON,
+			Integration: &model.PostActionIntegration{
+				URL: fmt.Sprintf("/plugins/%s/api/onboarding", manifest.Id),
+				Context: map[string]interface{}{
+					"team_id":       teamID,
+					"team_language": teamLanguage,
+					"action":        onboardingAction,
+				},
+			},
+		}
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message: fmt.Sprintf("Welcome to **%s**! Most members of this team read %s. Do you want your messages to be translated into %s automatically? You can change this at any time with /autotranslate.",
+			team.DisplayName, languageName(teamLanguage), languageName(teamLanguage)),
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Actions: []*model.PostAction{
+			action("Turn on auto-translation", onboardingActionEnable),
+			action("No, thanks", onboardingActionDecline),
+		},
+	}})
+
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.API.LogWarn("Failed to offer auto-translation to new team member", "user_id", userID, "team_id", teamID, "err", appErr.Error())
+	}
+}
+
+// handleOnboarding is the post action of the onboarding offer, turning auto-translation on
+// into the language of the team with the defaults of the team.
+func (p *Plugin) handleOnboarding(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to change settings", http.StatusUnauthorized)
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+	teamID, _ := request.Context["team_id"].(string)
+	teamLanguage, _ := request.Context["team_language"].(string)
+	onboardingAction, _ := request.Context["action"].(string)
+
+	// Only the offer sent to the user can be answered.
+	post, appErr := p.API.GetPost(request.PostId)
+	if appErr != nil || post.UserId != p.botUserID || languageCodes[teamLanguage] == "" {
+		http.Error(w, "No offer to answer", http.StatusBadRequest)
+		return
+	}
+	if channel, appErr := p.API.GetDirectChannel(userID, p.botUserID); appErr != nil || channel.Id != post.ChannelId {
+		http.Error(w, "No offer to answer", http.StatusBadRequest)
+		return
+	}
+
+	message := "No problem. You can turn auto-translation on at any time with /autotranslate on."
+	if onboardingAction == onboardingActionEnable {
+		userInfo := p.NewUserInfo(userID)
+		userInfo.TargetLanguage = teamLanguage
+		p.getTeamSettings(teamID).applyTeamDefaults(userInfo)
+
+		if apiErr := p.setUserInfo(newRequestID(), userInfo); apiErr != nil {
+			resp, _ := json.Marshal(&model.PostActionIntegrationResponse{EphemeralText: apiErr.Message})
+			w.Write(resp)
+			return
+		}
+		message = fmt.Sprintf("Auto-translation is on: your messages are translated into %s. Use /autotranslate to change your settings.", languageName(userInfo.TargetLanguage))
+	}
+
+	// The buttons are removed so the offer is answered once.
+	updated := post.Clone()
+	updated.Message = post.Message + "\n\n" + message
+	updated.DelProp("attachments")
+
+	resp, _ := json.Marshal(&model.PostActionIntegrationResponse{Update: updated})
+	w.Write(resp)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+type pairTotals struct {
+	calls          int
+	failures       int
+	totalLatencyMs float64
+	cacheLookups   int
+	cacheHits      int
+}
+
+// pairStatsTracker counts the provider calls, failures, latencies and cache hits of each
+// language pair on this server since activation, so that System Admins see where glossaries
+// and provider pins matter.
+type pairStatsTracker struct {
+	lock   sync.Mutex
+	totals map[string]*pairTotals
+}
+
+// get returns the totals of the pair, the lock being held.
+func (t *pairStatsTracker) get(pair string) *pairTotals {
+	if t.totals == nil {
+		t.totals = map[string]*pairTotals{}
+	}
+
+	totals, ok := t.totals[pair]
+	if !ok {
+		totals = &pairTotals{}
+		t.totals[pair] = totals
+	}
+
+	return totals
+}
+
+// recordCall counts a provider call translating the pair.
+func (t *pairStatsTracker) recordCall(pair string, latency time.Duration, failed bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	totals := t.get(pair)
+	totals.calls++
+	totals.totalLatencyMs += float64(latency.Milliseconds())
+	if failed {
+		totals.failures++
+	}
+}
+
+// recordCacheLookup counts a translation of the pair looked up in the cache.
+func (t *pairStatsTracker) recordCacheLookup(pair string, hit bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	totals := t.get(pair)
+	totals.cacheLookups++
+	if hit {
+		totals.cacheHits++
+	}
+}
+
+// pairStats is the statistics of a language pair returned to System Admins.
+type pairStats struct {
+	SourceLanguage   string  `json:"source_lang"`
+	TargetLanguage   string  `json:"target_lang"`
+	Calls            int     `json:"calls"`
+	Failures         int     `json:"failures"`
+	FailureRate      float64 `json:"failure_rate"`
+	AverageLatencyMs float64 `json:"average_latency_ms"`
+	CacheLookups     int     `json:"cache_lookups"`
+	CacheHits        int     `json:"cache_hits"`
+	CacheHitRate     float64 `json:"cache_hit_rate"`
+}
+
+// snapshot returns the statistics of every pair, the most failing first, then the most used.
+func (t *pairStatsTracker) snapshot() []*pairStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := make([]*pairStats, 0, len(t.totals))
+	for pair, totals := range t.totals {
+		languages := strings.SplitN(pair, ":", 2)
+		if len(languages) != 2 {
+			continue
+		}
+
+		entry := &pairStats{
+			SourceLanguage: languages[0],
+			TargetLanguage: languages[1],
+			Calls:          totals.calls,
+			Failures:       totals.failures,
+			CacheLookups:   totals.cacheLookups,
+			CacheHits:      totals.cacheHits,
+		}
+		if totals.calls > 0 {
+			entry.FailureRate = float64(totals.failures) / float64(totals.calls)
+			entry.AverageLatencyMs = totals.totalLatencyMs / float64(totals.calls)
+		}
+		if totals.cacheLookups > 0 {
+			entry.CacheHitRate = float64(totals.cacheHits) / float64(totals.cacheLookups)
+		}
+		stats = append(stats, entry)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Failures != stats[j].Failures {
+			return stats[i].Failures > stats[j].Failures
+		}
+		if stats[i].Calls != stats[j].Calls {
+			return stats[i].Calls > stats[j].Calls
+		}
+		return stats[i].SourceLanguage+stats[i].TargetLanguage < stats[j].SourceLanguage+stats[j].TargetLanguage
+	})
+
+	return stats
+}
+
+// getPairStats returns the statistics of the language pairs translated on this server.
+func (p *Plugin) getPairStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to read language pair statistics", http.StatusForbidden)
+		return
+	}
+
+	resp, _ := json.Marshal(p.pairStats.snapshot())
+	w.Write(resp)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxPermalinkPreviews is the number of permalinks of a message whose preview is translated.
+const maxPermalinkPreviews = 3
+
+var permalinkPattern = regexp.MustCompile(`/[a-z0-9_-]+/pl/([a-z0-9]{26})\b`)
+
+// PermalinkPreview is the translation of a message linked by a permalink, which clients show in
+// a preview under the linking message.
+type PermalinkPreview struct {
+	PostID         string `json:"post_id"`
+	SourceLanguage string `json:"source_lang"`
+	TranslatedText string `json:"translated_text"`
+}
+
+// permalinkPostIDs returns the IDs of the posts of this server the message links to.
+func (p *Plugin) permalinkPostIDs(message string) []string {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return nil
+	}
+	prefix := strings.TrimSuffix(*siteURL, "/")
+
+	var postIDs []string
+	seen := map[string]bool{}
+	for _, match := range permalinkPattern.FindAllStringSubmatchIndex(message, -1) {
+		if !strings.HasSuffix(message[:match[0]], prefix) {
+			continue
+		}
+
+		postID := message[match[2]:match[3]]
+		if seen[postID] {
+			continue
+		}
+		seen[postID] = true
+		postIDs = append(postIDs, postID)
+
+		if len(postIDs) == maxPermalinkPreviews {
+			break
+		}
+	}
+
+	return postIDs
+}
+
+// translatePermalinkPreviews adds to the translation of a post the translations of the messages
+// it links to by permalink, so that the reader understands what they were. Messages the reader
+// cannot read, or that are already in the target language, are left out.
+func (p *Plugin) translatePermalinkPreviews(requestID, userID, preferredProvider string, post *model.Post, translated *TranslatedMessage) {
+	for _, postID := range p.permalinkPostIDs(post.Message) {
+		if postID == post.Id {
+			continue
+		}
+
+		linked, appErr := p.API.GetPost(postID)
+		if appErr != nil || linked.DeleteAt != 0 || linked.Message == "" {
+			continue
+		}
+		if !p.API.HasPermissionToChannel(userID, linked.ChannelId, model.PERMISSION_READ_CHANNEL) {
+			continue
+		}
+
+		preview, apiErr := p.translatePost(requestID, userID, preferredProvider, linked, autoLanguage, translated.TargetLanguage)
+		if apiErr != nil {
+			if apiErr.ID != apiErrorAlreadyInLanguage {
+				p.API.LogWarn("Failed to translate permalink preview", "request_id", requestID, "post_id", postID, "err", apiErr.Message)
+			}
+			continue
+		}
+
+		translated.PermalinkPreviews = append(translated.PermalinkPreviews, PermalinkPreview{
+			PostID:         postID,
+			SourceLanguage: preview.SourceLanguage,
+			TranslatedText: preview.TranslatedText,
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultProcessingPipeline = "code, emoji, pii, glossary, localize"
+
+// processingState is what the processors of one translation share: the language pair, the
+// glossary terms of the translation and the values processors take out of the text before it
+// is translated, to put them back after.
+type processingState struct {
+	sourceLang string
+	targetLang string
+	glossary   []glossaryTerm
+	values     map[string][]string
+}
+
+func newProcessingState(sourceLang, targetLang string) *processingState {
+	return &processingState{
+		sourceLang: sourceLang,
+		targetLang: targetLang,
+		values:     map[string][]string{},
+	}
+}
+
+// textProcessor transforms text on its way to and back from a translation provider.
+type textProcessor interface {
+	// Name returns the identifier used for the processor in the pipeline configuration.
+	Name() string
+
+	// Before transforms the text sent to the provider.
+	Before(text string, state *processingState) string
+
+	// After transforms the translation returned by the provider.
+	After(text string, state *processingState) string
+}
+
+// textProcessors lists the available processors by name.
+var textProcessors = map[string]func(*configuration) textProcessor{
+	"code":     func(c *configuration) textProcessor { return codeProcessor{mode: c.CodeBlocks} },
+	"emoji":    func(*configuration) textProcessor { return emojiProcessor{} },
+	"pii":      func(*configuration) textProcessor { return piiProcessor{} },
+	"glossary": func(c *configuration) textProcessor { return glossaryProcessor{inflections: c.GlossaryInflections} },
+	"localize": func(c *configuration) textProcessor { return localizeProcessor{enabled: c.LocalizeFormats} },
+}
+
+// processingPipeline runs processors in order before a translation and in reverse order after
+// it, so that each processor undoes its changes on the text it produced.
+type processingPipeline []textProcessor
+
+// parseProcessingPipeline parses a comma separated list of processor names.
+func parseProcessingPipeline(configuration *configuration, names string) (processingPipeline, error) {
+	var pipeline processingPipeline
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		newProcessor, ok := textProcessors[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown text processor %q in processing pipeline", name)
+		}
+		pipeline = append(pipeline, newProcessor(configuration))
+	}
+
+	return pipeline, nil
+}
+
+// getProcessingPipeline returns the configured pipeline, or the default one when the
+// configuration is empty or invalid.
+func (c *configuration) getProcessingPipeline() processingPipeline {
+	names := c.ProcessingPipeline
+	if strings.TrimSpace(names) == "" {
+		names = defaultProcessingPipeline
+	}
+
+	pipeline, err := parseProcessingPipeline(c, names)
+	if err != nil {
+		pipeline, _ = parseProcessingPipeline(c, defaultProcessingPipeline)
+	}
+
+	return pipeline
+}
+
+func (pipeline processingPipeline) before(text string, state *processingState) string {
+	for _, processor := range pipeline {
+		text = processor.Before(text, state)
+	}
+
+	return text
+}
+
+func (pipeline processingPipeline) after(text string, state *processingState) string {
+	for i := len(pipeline) - 1; i >= 0; i-- {
+		text = pipeline[i].After(text, state)
+	}
+
+	return text
+}
+
+// emojiProcessor protects emoji, emoji shortcodes and kaomoji with placeholders.
+type emojiProcessor struct{}
+
+func (emojiProcessor) Name() string {
+	return "emoji"
+}
+
+func (e emojiProcessor) Before(text string, state *processingState) string {
+	protected, values := protectEmoji(text)
+	state.values[e.Name()] = values
+	return protected
+}
+
+func (e emojiProcessor) After(text string, state *processingState) string {
+	return restoreEmoji(text, state.values[e.Name()])
+}
+
+var (
+	// piiRegexp matches e-mail addresses and phone numbers.
+	piiRegexp = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}|\+?\d[\d -]{7,}\d`)
+)
+
+// piiProcessor keeps e-mail addresses and phone numbers from being sent to providers, putting
+// them back in the translation.
+type piiProcessor struct{}
+
+func (piiProcessor) Name() string {
+	return "pii"
+}
+
+func (pr piiProcessor) Before(text string, state *processingState) string {
+	var values []string
+	redacted := piiRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		return piiPlaceholders.protect(&values, match)
+	})
+	state.values[pr.Name()] = values
+	return redacted
+}
+
+func (pr piiProcessor) After(text string, state *processingState) string {
+	text, _ = piiPlaceholders.restore(text, state.values[pr.Name()])
+	return text
+}
+
+// localizeProcessor adapts dates, units and numbers of translations to the target language.
+type localizeProcessor struct {
+	enabled bool
+}
+
+func (localizeProcessor) Name() string {
+	return "localize"
+}
+
+func (localizeProcessor) Before(text string, _ *processingState) string {
+	return text
+}
+
+func (l localizeProcessor) After(text string, state *processingState) string {
+	if !l.enabled {
+		return text
+	}
+
+	return localizeTranslation(text, state.sourceLang, state.targetLang)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// placeholderKind is a kind of numbered placeholder, such as {{E0}}, standing for a value that
+// processors take out of the text sent to providers and put back in the translation. Each kind
+// has its own letter, so that the placeholders of processors never mix.
+type placeholderKind struct {
+	letter string
+	// pattern matches a placeholder, capturing its index, including the spaces some providers
+	// add inside them.
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+func newPlaceholderKind(letter string) placeholderKind {
+	pattern := `\{\{ ?` + letter + `(\d+) ?\}\}`
+	return placeholderKind{
+		letter:  letter,
+		pattern: pattern,
+		regexp:  regexp.MustCompile(pattern),
+	}
+}
+
+var (
+	emojiPlaceholders               = newPlaceholderKind("E")
+	piiPlaceholders                 = newPlaceholderKind("P")
+	glossaryPlaceholders            = newPlaceholderKind("G")
+	codePlaceholders                = newPlaceholderKind("C")
+	codeCommentPlaceholders         = newPlaceholderKind("K")
+	boilerplateVariablePlaceholders = newPlaceholderKind("V")
+	boilerplateLinePlaceholders     = newPlaceholderKind("B")
+)
+
+// placeholder returns the placeholder of the value at the index.
+func (k placeholderKind) placeholder(index int) string {
+	return fmt.Sprintf("{{%s%d}}", k.letter, index)
+}
+
+// protect appends the value to the values and returns its placeholder.
+func (k placeholderKind) protect(values *[]string, value string) string {
+	*values = append(*values, value)
+	return k.placeholder(len(*values) - 1)
+}
+
+// normalize removes the spaces providers added inside the placeholders of the text.
+func (k placeholderKind) normalize(text string) string {
+	return k.regexp.ReplaceAllString(text, "{{"+k.letter+"$1}}")
+}
+
+// strip removes the placeholders of the text.
+func (k placeholderKind) strip(text string) string {
+	return k.regexp.ReplaceAllString(text, "")
+}
+
+// restoreFunc replaces the placeholders of the text with what fn returns for their index, fn
+// being only called with indexes below count. Placeholders of other indexes are left as they
+// are.
+func (k placeholderKind) restoreFunc(text string, count int, fn func(index int) string) string {
+	return k.regexp.ReplaceAllStringFunc(text, func(match string) string {
+		index, err := strconv.Atoi(k.regexp.FindStringSubmatch(match)[1])
+		if err != nil || index >= count {
+			return match
+		}
+
+		return fn(index)
+	})
+}
+
+// restore replaces the placeholders of the text with the values, and reports which values were
+// put back, so that callers can tell the placeholders providers dropped.
+func (k placeholderKind) restore(text string, values []string) (string, []bool) {
+	restored := make([]bool, len(values))
+	text = k.restoreFunc(text, len(values), func(index int) string {
+		restored[index] = true
+		return values[index]
+	})
+
+	return text, restored
+}
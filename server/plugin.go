@@ -1,10 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
@@ -17,6 +19,9 @@ import (
 
 const (
 	apiErrorNoRecordFound = "no_record_found"
+
+	// apiErrorAlreadyInLanguage reports that a post needs no translation into the target language.
+	apiErrorAlreadyInLanguage = "already_in_language"
 )
 
 // Plugin is a collection of fields for plugin
@@ -29,6 +34,105 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// unconfiguredHints records the users that were already told the plugin is not configured,
+	// so the hint is not repeated on every post. It is reset whenever the configuration changes.
+	unconfiguredHints sync.Map
+
+	// queue runs translations that are not answered within the request that asked for them.
+	queue *translationQueue
+
+	// wsBatcher groups outgoing WebSocket events per target.
+	wsBatcher *wsBatcher
+
+	// botUserID is the user ID of the plugin bot account.
+	botUserID string
+
+	// providerScorer tracks provider latency and errors to route translations.
+	providerScorer *providerScorer
+
+	// pendingDeliveries holds the translations delivered once their post is saved, by
+	// pendingDeliveryKey.
+	pendingDeliveries sync.Map
+
+	// usageTracker counts translated characters and suspends auto-translation over the
+	// monthly threshold.
+	usageTracker *usageTracker
+
+	// userInfoCache keeps the user info read by the post hooks in memory by user ID, so that
+	// posts of users who never activated the plugin do not cost a KV read each. Entries are
+	// replaced whenever the info is saved on this server and expire after userInfoCacheTTL.
+	userInfoCache sync.Map
+
+	// partialListeners holds, by request ID, the functions reporting partial translations of
+	// streaming providers. See streamTranslation.
+	partialListeners sync.Map
+
+	// dataCleaner removes the data of deactivated and deleted users.
+	dataCleaner *dataCleaner
+
+	// channelClassifier classifies channels from their recent posts.
+	channelClassifier *channelClassifier
+
+	// transcriptJobs posts the translations of call transcripts done by asynchronous jobs.
+	transcriptJobs *transcriptJobPoller
+
+	// store persists user settings, usage, the settings audit, glossaries, cached detections and
+	// translations.
+	store store
+
+	// providerCtx is the context of provider calls, cancelled on deactivation so that running
+	// calls are aborted instead of holding the plugin.
+	providerCtx     context.Context
+	cancelProviders context.CancelFunc
+
+	// channelProfiles holds the languages recently detected in the new posts of each channel,
+	// by channel ID. See resolveNewPostLanguage.
+	channelProfiles sync.Map
+
+	// requestGlossaries holds, by request ID, the channel whose glossaries the translations of
+	// the request apply. See useGlossary.
+	requestGlossaries sync.Map
+
+	// providerThrottles holds, by provider name, the time until which a provider that throttled
+	// requests is left alone. See throttleProvider.
+	providerThrottles sync.Map
+
+	// pendingReviews holds the translations sent to the review queue once their post is saved,
+	// by pendingDeliveryKey.
+	pendingReviews sync.Map
+
+	// lateTranslations holds the translations of new posts that overran the latency budget until
+	// their post is saved, by pendingDeliveryKey.
+	lateTranslations sync.Map
+
+	// privateMessageHints holds the users who were told why their direct and group messages
+	// are not translated.
+	privateMessageHints sync.Map
+
+	// hookWatchdog turns auto-translation off when the posting hooks keep crashing.
+	hookWatchdog hookWatchdog
+
+	// atRest encrypts the cached translations and the settings audit in the store.
+	atRest atRestCipher
+
+	// pairStats counts the calls, failures and cache hits of each language pair.
+	pairStats pairStatsTracker
+
+	// boilerplate counts the lines repeated in the posts of each channel.
+	boilerplate boilerplateTracker
+
+	// rollout compares the posts of activated users in and out of the rollout.
+	rollout rolloutTracker
+}
+
+// providerContext returns the context provider calls are made with.
+func (p *Plugin) providerContext() context.Context {
+	if p.providerCtx == nil {
+		return context.Background()
+	}
+
+	return p.providerCtx
 }
 
 // TranslatedMessage is a collection of fields for translated message
@@ -39,7 +143,26 @@ type TranslatedMessage struct {
 	SourceText     string `json:"source_text"`
 	TargetLanguage string `json:"target_lang"`
 	TranslatedText string `json:"translated_text"`
+	RomanizedText  string `json:"romanized_text,omitempty"`
 	UpdateAt       int64  `json:"update_at"`
+
+	// Confidence of the detection of the source language, when it was detected.
+	Confidence float64 `json:"confidence,omitempty"`
+	// Provider that translated the message.
+	Provider string `json:"provider"`
+	// Characters is the length of the source text in characters.
+	Characters int `json:"characters"`
+	// Cached is set when the translation was reused instead of requested from the provider.
+	Cached bool `json:"cached"`
+	// PermalinkPreviews are the translations of the messages linked by the message.
+	PermalinkPreviews []PermalinkPreview `json:"permalink_previews,omitempty"`
+	// ThreadContext is the translated excerpt of the root of the thread of a reply.
+	ThreadContext string `json:"thread_context,omitempty"`
+	// CorrectedBy is the @mention of the user who corrected the translation, if any.
+	CorrectedBy string `json:"corrected_by,omitempty"`
+	// IdempotencyKey identifies the translation of this version of the message between these
+	// languages. See translationIdempotencyKey.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 // UserInfo is a collection of fields for user info
@@ -48,6 +171,12 @@ type UserInfo struct {
 	Activated      bool   `json:"activated"`
 	SourceLanguage string `json:"source_language"`
 	TargetLanguage string `json:"target_language"`
+	Provider       string `json:"provider,omitempty"`
+	Romanize       bool   `json:"romanize,omitempty"`
+	PreCorrect     bool   `json:"pre_correct,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	DisplayMode    string `json:"display_mode,omitempty"`
+	UpdateAt       int64  `json:"update_at"`
 }
 
 // NewUserInfo returns new user info
@@ -90,36 +219,75 @@ func (u *UserInfo) IsValid() error {
 		return fmt.Errorf("Invalid: target_language must not be \"auto\"")
 	}
 
+	if u.DisplayMode != "" && !isDisplayMode(u.DisplayMode) {
+		return fmt.Errorf("Invalid: display_mode must be one of %s", strings.Join(displayModes, ", "))
+	}
+
+	if u.Currency != "" && !isCurrencyCode(u.Currency) {
+		return fmt.Errorf("Invalid: currency must be a three letter currency code")
+	}
+
+	if u.Provider != "" && !isProviderName(u.Provider) {
+		return fmt.Errorf("Invalid: provider must be one of %s", strings.Join(providerNames, ", "))
+	}
+
 	return nil
 }
 
 func (p *Plugin) getUserInfo(userID string) (*UserInfo, *APIErrorResponse) {
-	var userInfo UserInfo
+	userInfo, err := p.store.GetUserInfo(userID)
+	if err != nil {
+		p.API.LogWarn("Failed to get user info", "user_id", userID, "err", err.Error())
+		return nil, &APIErrorResponse{ID: "unable_to_get", Message: "Unable to get user info.", StatusCode: http.StatusBadRequest}
+	}
 
-	if infoBytes, err := p.API.KVGet(userID); err != nil || infoBytes == nil {
+	if userInfo == nil {
 		return nil, &APIErrorResponse{ID: apiErrorNoRecordFound, Message: "No record found.", StatusCode: http.StatusBadRequest}
-	} else if err := json.Unmarshal(infoBytes, &userInfo); err != nil {
-		return nil, &APIErrorResponse{ID: "unable_to_unmarshal", Message: "Unable to unmarshal json.", StatusCode: http.StatusBadRequest}
 	}
 
-	return &userInfo, nil
+	return userInfo, nil
+}
+
+func (p *Plugin) setUserInfo(requestID string, userInfo *UserInfo) *APIErrorResponse {
+	return p.setUserInfoAs(requestID, userInfo.UserID, userInfo)
+}
+
+// setUserInfoAs saves the user info changed by the actor, recording the change in the
+// settings audit, and tells the user about it.
+func (p *Plugin) setUserInfoAs(requestID, actorID string, userInfo *UserInfo) *APIErrorResponse {
+	if apiErr := p.saveUserInfoAs(requestID, actorID, userInfo); apiErr != nil {
+		return apiErr
+	}
+
+	p.emitUserInfoChange(userInfo)
+
+	return nil
 }
 
-func (p *Plugin) setUserInfo(userInfo *UserInfo) *APIErrorResponse {
+// saveUserInfoAs saves the user info changed by the actor, recording the change in the settings
+// audit, leaving it to the caller to tell the user.
+func (p *Plugin) saveUserInfoAs(requestID, actorID string, userInfo *UserInfo) *APIErrorResponse {
 	if err := userInfo.IsValid(); err != nil {
 		return &APIErrorResponse{ID: "invalid_user_info", Message: err.Error(), StatusCode: http.StatusBadRequest}
 	}
 
-	jsonUserInfo, err := json.Marshal(userInfo)
-	if err != nil {
-		return &APIErrorResponse{ID: "unable_to_unmarshal", Message: "Unable to marshal json.", StatusCode: http.StatusBadRequest}
+	// Users can always turn auto-translation off, even with languages no longer allowed.
+	if userInfo.Activated {
+		if pairErr := p.getConfiguration().checkSettingsPair(userInfo.SourceLanguage, userInfo.TargetLanguage); pairErr != nil {
+			return pairErr
+		}
 	}
 
-	if err := p.API.KVSet(userInfo.UserID, jsonUserInfo); err != nil {
+	userInfo.UpdateAt = model.GetMillis()
+
+	previous, _ := p.getUserInfo(userInfo.UserID)
+
+	if err := p.store.SaveUserInfo(userInfo); err != nil {
 		return &APIErrorResponse{ID: "unable_to_save", Message: "Unable to save user info.", StatusCode: http.StatusBadRequest}
 	}
 
-	p.emitUserInfoChange(userInfo)
+	p.cacheUserInfo(userInfo)
+	p.recordSettingsChange(requestID, actorID, settingsKindUser, userInfo.UserID, previous, userInfo)
 
 	return nil
 }
@@ -134,35 +302,188 @@ func (u *UserInfo) getActivatedString() string {
 }
 
 func (p *Plugin) emitUserInfoChange(userInfo *UserInfo) {
-	p.API.PublishWebSocketEvent(
-		"info_change",
+	p.publishToUser(
+		wsEventInfoChange,
+		userInfo.UserID,
 		map[string]interface{}{
 			"user_id":         userInfo.UserID,
 			"activated":       userInfo.Activated,
 			"source_language": userInfo.SourceLanguage,
 			"target_language": userInfo.TargetLanguage,
+			"provider":        userInfo.Provider,
+			"romanize":        userInfo.Romanize,
+			"pre_correct":     userInfo.PreCorrect,
+			"currency":        userInfo.Currency,
+			"display_mode":    userInfo.DisplayMode,
+			"update_at":       userInfo.UpdateAt,
 		},
-		&model.WebsocketBroadcast{UserId: userInfo.UserID},
 	)
 }
 
+// MessageWillBePosted appends the translation of the message to posts of activated users.
+//
+// The plugin only receives the fields of the post known to the server version it is built
+// against, so a returned post would lose the metadata of newer servers, such as the message
+// priority and acknowledgement requests. The post is therefore only returned when it changed.
+//
+// Translations overrunning the latency budget are added to the post once it is saved. A crash of
+// the plugin posts the message unchanged, and auto-translation is turned off when it
+// keeps crashing.
 func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*model.Post, string) {
+	defer p.recoverHookPanic("MessageWillBePosted")
+
+	if p.isWatchdogTripped() {
+		return nil, ""
+	}
+
+	message := post.Message
+	props := model.StringInterfaceToJson(post.GetProps())
+
+	replacement, rejection := p.translateNewPostWithinBudget(post)
+	if rejection == "" && replacement != nil && replacement.Message == message && model.StringInterfaceToJson(replacement.GetProps()) == props {
+		return nil, ""
+	}
+
+	return replacement, rejection
+}
+
+// isInteractivePost reports whether the post is being sent by its author from a client, which
+// sets a pending post ID to match the post with its optimistic copy. Scheduled posts and posts
+// created through the API or integrations have none: rejecting them on a translation failure
+// would drop them without the author noticing, so they are posted untranslated instead.
+func isInteractivePost(post *model.Post) bool {
+	return post.PendingPostId != ""
+}
+
+// translateNewPost runs a new post through auto-translation. Scheduled posts go through it
+// when they are published, like any other post.
+func (p *Plugin) translateNewPost(post *model.Post) (*model.Post, string) {
 	userID := post.UserId
-	userInfo, _ := p.getUserInfo(userID)
-	if userInfo == nil || !userInfo.Activated {
+	userInfo := p.getCachedUserInfo(userID)
+	activated := p.isAutoTranslating(userID, userInfo)
+
+	if err := p.IsValid(); err != nil {
+		if !activated {
+			return post, ""
+		}
+
+		if _, hinted := p.unconfiguredHints.LoadOrStore(userID, true); !hinted {
+			p.API.SendEphemeralPost(userID, &model.Post{
+				ChannelId: post.ChannelId,
+				Message:   p.unconfiguredMessage(userID, err),
+			})
+		}
+		return post, ""
+	}
+
+	if p.isAutoTranslationSuspended() {
+		return post, ""
+	}
+
+	// Translations are never translated again, whether posted by the plugin, kept in the props
+	// of an edited post or copied into a new message.
+	if post.UserId == p.botUserID || isTranslatedPost(post) {
+		return post, ""
+	}
+	if configuration := p.getConfiguration(); configuration.containsBanner(configuration.translatableText(post.Message)) {
+		return post, ""
+	}
+
+	// Posts of activated users are counted in their rollout cohort, translated or not.
+	cohort := ""
+	if userInfo != nil && userInfo.Activated {
+		cohort = p.rolloutCohort(userID)
+		p.rollout.recordPost(cohort, userID)
+	}
+
+	// The mark keeps the members of group messages from getting a translation after the post.
+	if p.stripSkipMarker(post) || (activated && p.consumeSkipNext(userID)) {
+		post.AddProp(propSkipped, true)
+		return post, ""
+	}
+
+	// The channel is only looked up for posts that would be translated otherwise: posts of
+	// activated users and posts with a directive. Direct messages translated for notifications
+	// are left out by pushTargetLanguage.
+	if directive, _ := parseLanguageDirective(post.Message); (activated || directive != nil) && p.isPrivateMessageExcluded(post.ChannelId) {
+		if activated && isInteractivePost(post) {
+			p.hintPrivateMessageExcluded(userID, post.ChannelId)
+		}
+		return post, ""
+	}
+
+	// A directive such as "!fr" overrides the languages for this message only.
+	directive := stripLanguageDirective(post)
+
+	// Direct messages are translated into the recipient's language so that push notification
+	// previews are readable, even when the author has not activated the plugin.
+	pushTarget := p.pushTargetLanguage(post)
+	if !activated && pushTarget == "" && directive == nil {
+		return post, ""
+	}
+
+	// The usage of the author is only read for posts that would be translated.
+	if p.isOverUserQuota(userID) {
 		return post, ""
 	}
 
-	sourceLang := userInfo.SourceLanguage
-	targetLang := userInfo.TargetLanguage
+	// Channels over their monthly cap fall back to detect-only mode.
+	requestID := newRequestID()
+	if p.getConfiguration().isDetectOnly() || p.isOverChannelCap(post.ChannelId) {
+		return p.labelLanguage(requestID, post), ""
+	}
+	defer p.useGlossary(requestID, post.ChannelId)()
+
+	sourceLang := autoLanguage
+	targetLang := pushTarget
+	if activated {
+		sourceLang = userInfo.SourceLanguage
+		if targetLang == "" {
+			targetLang = userInfo.TargetLanguage
+		}
+	}
 
-	// 自動検出の場合、翻訳エンジンの言語検出機能を使う（仮の関数 detectLanguage）
+	if directive != nil {
+		activated = true
+		if directive.SourceLanguage != "" {
+			sourceLang = directive.SourceLanguage
+		}
+		if directive.TargetLanguage != "" {
+			targetLang = directive.TargetLanguage
+		}
+	}
+
+	if targetLang == "" {
+		return post, ""
+	}
+
+	// Quotes of earlier messages were translated with them, only the new text is.
+	source := post
+	newText, quoted := splitQuotes(post.Message)
+	if p.getConfiguration().translatesQuotes() {
+		quoted = nil
+	} else if len(quoted) > 0 {
+		if newText == "" {
+			return post, ""
+		}
+		source = post.Clone()
+		source.Message = newText
+	}
+	original := source.Message
+
+	// 自動検出の場合、翻訳エンジンの言語検出機能を使う
+	details := bannerDetails{}
 	if sourceLang == autoLanguage {
-		detectedLang, err := p.detectLanguage(post.Message) // 言語検出関数（要実装）
+		detectedLang, confidence, err := p.resolveNewPostLanguage(requestID, post.ChannelId, userID, original)
 		if err != nil {
-			return post, "Failed to detect language"
+			if !activated || !isInteractivePost(post) {
+				return post, ""
+			}
+			return post, fmt.Sprintf("Failed to detect language (request ID: %s)", requestID)
 		}
 		sourceLang = detectedLang
+		details.Confidence = confidence
+		details.Detected = true
 	}
 
 	// 同じ言語なら翻訳しない
@@ -170,53 +491,157 @@ func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*mode
 		return post, ""
 	}
 
-	translatedText, err := p.translateText(post.Message, sourceLang, targetLang)
+	if language := p.blockedLanguage(original, sourceLang); language != "" {
+		if activated && isInteractivePost(post) {
+			p.API.SendEphemeralPost(userID, &model.Post{
+				ChannelId: post.ChannelId,
+				Message:   languageBlockedMessage(language),
+			})
+		}
+		return post, ""
+	}
+
+	// The post is not rejected, the languages are not the author's fault.
+	if !p.getConfiguration().getAllowedPairs().allows(sourceLang, targetLang) {
+		if activated && isInteractivePost(post) {
+			p.API.SendEphemeralPost(userID, &model.Post{
+				ChannelId: post.ChannelId,
+				Message:   pairNotAllowedError(sourceLang, targetLang).Message + " Your message was posted untranslated.",
+			})
+		}
+		return post, ""
+	}
+
+	// A third block would only repeat what the author wrote in both languages.
+	if p.getConfiguration().SkipBilingualMessages && p.isBilingual(requestID, original, sourceLang, targetLang) {
+		return post, ""
+	}
+
+	// Authors who opted in have their typos fixed before translation, the posted original is
+	// left as written.
+	if userInfo != nil && userInfo.PreCorrect {
+		source = source.Clone()
+		source.Message = p.preCorrect(requestID, original, sourceLang)
+	}
+
+	translatedText, provider, err := p.translateInThread(requestID, p.preferredProvider(userInfo), source, sourceLang, targetLang)
+	if cohort != "" {
+		p.rollout.recordTranslation(cohort, utf8.RuneCountInString(source.Message), err != nil)
+	}
 	if err != nil {
-		return post, "Failed to translate message"
+		if !activated || err.Id == appErrorTextTooLong || !isInteractivePost(post) {
+			return post, ""
+		}
+		return post, fmt.Sprintf("%s (request ID: %s)", p.translationError(userID, err).Message, requestID)
+	}
+	if !isRecalledTranslation(provider) {
+		p.recordUserUsage(userID, sourceLang, targetLang, utf8.RuneCountInString(source.Message))
+		p.recordChannelUsage(post.ChannelId, utf8.RuneCountInString(source.Message))
 	}
 
 	// 翻訳後のメッセージが元のメッセージと同じなら追加しない
-	if translatedText == post.Message {
+	if translatedText == original {
 		return post, ""
 	}
 
-	// 言語コードを言語名に変換
-	sourceLangName, sourceExists := languageCodes[sourceLang]
-	if !sourceExists {
-		sourceLangName = sourceLang // 言語名がない場合はコードのまま
+	gatedText, ok := p.gateProfanity(post, translatedText)
+	if !ok {
+		return post, ""
+	}
+	flagged := gatedText != translatedText
+	translatedText = gatedText
+
+	details.SourceLanguage = sourceLang
+	details.TargetLanguage = targetLang
+	details.Provider = provider
+
+	// Channels in learning mode show each original line above its translation.
+	if mode := p.getLearningMode(post.ChannelId); mode != learningModeOff {
+		if block, ok := p.renderLearningBlock(requestID, mode, original, translatedText); ok {
+			translatedText = block
+		}
 	}
 
-	targetLangName, targetExists := languageCodes[targetLang]
-	if !targetExists {
-		targetLangName = targetLang // 言語名がない場合はコードのまま
+	if link := p.quotedTranslationLink(post, quoted); link != "" {
+		translatedText += "\n" + link
+	}
+
+	// Translations for push notifications must be in the message to show in the preview.
+	mode := displayModeAppend
+	if pushTarget == "" {
+		mode = userInfo.getDisplayMode()
 	}
 
 	// 翻訳結果を追加
-	post.Message = fmt.Sprintf("%s\n\n(Translated: %s → %s)\n%s", post.Message, sourceLangName, targetLangName, translatedText)
+	p.displayTranslation(post, mode, languagePair(sourceLang, targetLang), p.getConfiguration().renderBanner(details), translatedText)
+	if mode == displayModeAppend || mode == displayModePropsToggle {
+		post.AddProp(propTranslationLanguages, languagePair(sourceLang, targetLang))
+	}
+
+	// Uncertain translations are sent to reviewers once the post is saved.
+	if reason := p.reviewReason(mode, details, flagged); reason != "" {
+		p.queueForReview(post, &reviewItem{
+			SourceLanguage: sourceLang,
+			TargetLanguage: targetLang,
+			Original:       source.Message,
+			Translation:    translatedText,
+			Reason:         reason,
+			Mode:           mode,
+		})
+	}
 
 	return post, ""
 }
 
-func (p *Plugin) detectLanguage(text string) (string, error) {
-	configuration := p.getConfiguration()
-	sess := session.Must(session.NewSession())
-	creds := credentials.NewStaticCredentials(configuration.AWSAccessKeyID, configuration.AWSSecretAccessKey, "")
-	_, awsErr := creds.Get()
-	if awsErr != nil {
-		return "", fmt.Errorf("Invalid AWS credentials")
+func (p *Plugin) detectLanguage(requestID, text string) (string, error) {
+	language, _, err := p.detectLanguageWithConfidence(requestID, text)
+	return language, err
+}
+
+// detectLanguageWithConfidence returns the dominant language of the text along with the
+// confidence of the detection, between 0 and 1.
+func (p *Plugin) detectLanguageWithConfidence(requestID, text string) (string, float64, error) {
+	// Texts that may be in a blocked language are not sent to Comprehend either.
+	if language := p.blockedLanguage(text, ""); language != "" {
+		return language, 0, nil
+	}
+
+	if language, confidence, ok := p.detectLanguageLocallyIfConfident(text); ok {
+		return language, confidence, nil
 	}
 
-	svc := comprehend.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(configuration.AWSRegion))
+	svc, err := p.newComprehendClient(requestID)
+	if err != nil {
+		return "", 0, err
+	}
 
 	input := &comprehend.DetectDominantLanguageInput{
 		Text: aws.String(text),
 	}
 
-	result, err := svc.DetectDominantLanguage(input)
-	if err != nil || len(result.Languages) == 0 {
-		return "", fmt.Errorf("Failed to detect language")
+	result, err := svc.DetectDominantLanguageWithContext(p.providerContext(), input, withRequestID(requestID))
+	if err != nil {
+		p.API.LogError("Language detection API error", "request_id", requestID, "err", err.Error())
+		return "", 0, fmt.Errorf("Failed to detect language")
+	}
+
+	if len(result.Languages) == 0 {
+		return "", 0, fmt.Errorf("Failed to detect language")
 	}
 
 	language := *result.Languages[0].LanguageCode
-	return language, nil
+	return language, aws.Float64Value(result.Languages[0].Score), nil
+}
+
+func (p *Plugin) newComprehendClient(requestID string) (*comprehend.Comprehend, error) {
+	configuration := p.getConfiguration()
+	sess := session.Must(session.NewSession())
+	creds := credentials.NewStaticCredentials(configuration.AWSAccessKeyID, configuration.AWSSecretAccessKey, "")
+	_, awsErr := creds.Get()
+	if awsErr != nil {
+		p.API.LogError("Invalid AWS credentials", "request_id", requestID, "err", awsErr.Error())
+		return nil, fmt.Errorf("Invalid AWS credentials")
+	}
+
+	return comprehend.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(configuration.AWSRegion)), nil
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	postLanguageKeyPrefix = "post_lang_"
+
+	// postLanguageTTL is how long, in seconds, the detected language of a post is cached.
+	postLanguageTTL = 7 * 24 * 60 * 60
+)
+
+// postLanguage is the detected language of a version of a post.
+type postLanguage struct {
+	PostID     string  `json:"post_id"`
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+	UpdateAt   int64   `json:"update_at"`
+}
+
+// getPostLanguage returns the language of the post, detecting it unless the current version of
+// the post was already detected.
+func (p *Plugin) getPostLanguage(requestID string, post *model.Post) (*postLanguage, error) {
+	if cached, err := p.store.GetPostLanguage(post.Id); err == nil && cached != nil && cached.UpdateAt == post.UpdateAt {
+		return cached, nil
+	}
+
+	if p.isPrivateMessageExcluded(post.ChannelId) {
+		return nil, errPrivateMessage
+	}
+
+	language, confidence, err := p.resolveSourceLanguageWithConfidence(requestID, post.UserId, post.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	detected := &postLanguage{
+		PostID:     post.Id,
+		Language:   language,
+		Confidence: confidence,
+		UpdateAt:   post.UpdateAt,
+	}
+	if err := p.store.SavePostLanguage(detected); err != nil {
+		p.API.LogWarn("Failed to cache post language", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+	}
+
+	return detected, nil
+}
+
+// detectPost returns the language of a post, so that clients can pre-select the source
+// language and hide the translate action for posts already in the language of the user.
+func (p *Plugin) detectPost(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to detect the language of posts", http.StatusUnauthorized)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	post, appErr := p.API.GetPost(r.URL.Query().Get("post_id"))
+	if appErr != nil || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		httpErrorWithRequestID(w, requestID, "No post to detect", http.StatusBadRequest)
+		return
+	}
+
+	detected, err := p.getPostLanguage(requestID, post)
+	if err != nil {
+		httpErrorWithRequestID(w, requestID, "Language detection failed", http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(detected)
+	w.Write(resp)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	preCorrectionOff          = "off"
+	preCorrectionLLM          = "llm"
+	preCorrectionLanguageTool = "languagetool"
+
+	defaultLanguageToolURL = "https://api.languagetool.org/v2/check"
+	languageToolTimeout    = 10 * time.Second
+)
+
+// preCorrect fixes typos and grammar mistakes in text before it is translated, since machine
+// translation of a faulty source is much worse. The text is returned unchanged when the
+// correction is disabled or fails: correcting is only an improvement.
+func (p *Plugin) preCorrect(requestID, text, sourceLang string) string {
+	configuration := p.getConfiguration()
+	if p.blockedLanguage(text, sourceLang) != "" {
+		return text
+	}
+
+	var corrected string
+	var err error
+	switch configuration.PreCorrection {
+	case preCorrectionLLM:
+		if configuration.LLMAPIKey == "" {
+			return text
+		}
+		llm := newLLMProvider(p.providerContext(), configuration)
+		if corrected, err = llm.Correct(requestID, text); err == nil {
+			p.logZeroRetention(requestID, llm, "pre-correction")
+		}
+	case preCorrectionLanguageTool:
+		corrected, err = correctWithLanguageTool(configuration, requestID, text, sourceLang)
+	default:
+		return text
+	}
+
+	if err != nil {
+		p.API.LogWarn("Failed to pre-correct text", "request_id", requestID, "err", err.Error())
+		return text
+	}
+
+	return corrected
+}
+
+// correctWithLanguageTool applies the first replacement suggested by LanguageTool for each
+// issue it finds.
+func correctWithLanguageTool(configuration *configuration, requestID, text, sourceLang string) (string, error) {
+	apiURL := strings.TrimSpace(configuration.LanguageToolURL)
+	if apiURL == "" {
+		apiURL = defaultLanguageToolURL
+	}
+
+	form := url.Values{}
+	form.Set("text", text)
+	form.Set("language", sourceLang)
+
+	req, err := http.NewRequest(http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create LanguageTool request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", requestIDUserAgentPrefix+requestID)
+
+	resp, err := (&http.Client{Timeout: languageToolTimeout}).Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "LanguageTool request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("LanguageTool returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Matches []struct {
+			Offset       int `json:"offset"`
+			Length       int `json:"length"`
+			Replacements []struct {
+				Value string `json:"value"`
+			} `json:"replacements"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "failed to decode LanguageTool response")
+	}
+
+	// Offsets count UTF-16 code units. Replacing from the end keeps the earlier offsets valid.
+	units := utf16.Encode([]rune(text))
+	sort.Slice(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Offset > result.Matches[j].Offset
+	})
+
+	end := len(units)
+	for _, match := range result.Matches {
+		if len(match.Replacements) == 0 || match.Offset < 0 || match.Offset+match.Length > end {
+			continue
+		}
+
+		replacement := utf16.Encode([]rune(match.Replacements[0].Value))
+		units = append(units[:match.Offset], append(replacement, units[match.Offset+match.Length:]...)...)
+		end = match.Offset
+	}
+
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	presetCostSaver     = "cost-saver"
+	presetQualityFirst  = "quality-first"
+	presetPrivacyStrict = "privacy-strict"
+
+	settingsKindPreset = "preset"
+)
+
+// presetNames lists the presets in the order they are shown.
+var presetNames = []string{presetCostSaver, presetQualityFirst, presetPrivacyStrict}
+
+// presetDescriptions explains what each preset is for.
+var presetDescriptions = map[string]string{
+	presetCostSaver:     "fewer and cheaper provider calls: translations are cached longer, languages detected on the server, users get a quota",
+	presetQualityFirst:  "the best translations: the most capable provider, thread context, languages detected by Comprehend, no quota",
+	presetPrivacyStrict: "the least data leaving and kept on the server: no caching, no direct messages, no-trace providers, no thread context",
+}
+
+// preset returns the settings the preset sets, by setting key. Settings that depend on the
+// providers are only set when the provider is configured.
+func (c *configuration) preset(name string) map[string]interface{} {
+	switch name {
+	case presetCostSaver:
+		return map[string]interface{}{
+			"TranslationRetentionDays":  "30",
+			"LanguageDetection":         languageDetectionLocal,
+			"ChannelLanguagePrior":      true,
+			"SkipBilingualMessages":     true,
+			"QuoteHandling":             quoteHandlingNewText,
+			"LLMContextMessages":        "0",
+			"ProviderPinning":           defaultPin + "=" + providerAWS,
+			"AllowUserProvider":         false,
+			"UserMonthlyCharacterQuota": "100000",
+		}
+	case presetQualityFirst:
+		settings := map[string]interface{}{
+			"TranslationRetentionDays":  "7",
+			"LanguageDetection":         languageDetectionComprehend,
+			"ChannelLanguagePrior":      false,
+			"QuoteHandling":             quoteHandlingNewText,
+			"LLMContextMessages":        fmt.Sprint(defaultLLMContextMessages),
+			"GlossaryInflections":       true,
+			"UserMonthlyCharacterQuota": "0",
+		}
+		if c.DeepLAPIKey != "" {
+			settings["ProviderPinning"] = defaultPin + "=" + providerDeepL
+		} else if c.LLMAPIKey != "" {
+			settings["ProviderPinning"] = defaultPin + "=" + providerLLM
+		}
+		return settings
+	case presetPrivacyStrict:
+		return map[string]interface{}{
+			"TranslationRetentionDays": "0",
+			"AuditRetentionDays":       "365",
+			"UsageRetentionDays":       "365",
+			"ExcludeDirectMessages":    true,
+			"DeepLNoTrace":             true,
+			"LLMNoTrace":               true,
+			"LanguageDetection":        languageDetectionLocal,
+			"LLMContextMessages":       "0",
+			"ThreadContextLine":        false,
+			"AllowUserProvider":        false,
+		}
+	default:
+		return nil
+	}
+}
+
+// applyPreset saves the settings of the preset into the plugin configuration, leaving the
+// others as they are, and records the change in the settings audit.
+func (p *Plugin) applyPreset(requestID, actorID, name string) (map[string]interface{}, error) {
+	settings := p.getConfiguration().preset(name)
+	if settings == nil {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+
+	config := p.API.GetPluginConfig()
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+
+	before := map[string]interface{}{}
+	for key, value := range settings {
+		// The server keeps the keys of plugin settings in lower case.
+		for existing := range config {
+			if strings.EqualFold(existing, key) {
+				before[key] = config[existing]
+				delete(config, existing)
+			}
+		}
+		config[strings.ToLower(key)] = value
+	}
+
+	if appErr := p.API.SavePluginConfig(config); appErr != nil {
+		return nil, appErr
+	}
+
+	// Presets are recorded under the System Admin applying them, so that the audit of the
+	// System Admin lists them.
+	p.recordSettingsChange(requestID, actorID, settingsKindPreset, actorID, before, map[string]interface{}{
+		"preset":   name,
+		"settings": settings,
+	})
+
+	return settings, nil
+}
+
+// renderPresetSettings lists the settings of a preset, sorted by key.
+func renderPresetSettings(settings map[string]interface{}) string {
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var text strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&text, "* %s: `%v`\n", key, settings[key])
+	}
+
+	return text.String()
+}
+
+// executePresetCommand lists the presets, or applies one.
+func (p *Plugin) executePresetCommand(requestID, actorID string, parameters []string) string {
+	if len(parameters) == 0 {
+		var text strings.Builder
+		text.WriteString("Available configuration presets, applied with `/autotranslate preset <name>`:\n")
+		for _, name := range presetNames {
+			fmt.Fprintf(&text, "* `%s` - %s\n", name, presetDescriptions[name])
+		}
+		return text.String()
+	}
+
+	name := strings.ToLower(parameters[0])
+	settings, err := p.applyPreset(requestID, actorID, name)
+	if err != nil {
+		return fmt.Sprintf("Failed to apply the preset: %s. Available presets: %s.", err.Error(), strings.Join(presetNames, ", "))
+	}
+
+	return fmt.Sprintf("Applied the `%s` preset. The other settings were left as they were:\n%s", name, renderPresetSettings(settings))
+}
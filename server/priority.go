@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	// propPriority is the post prop integrations and clients set to "important" or "urgent".
+	// Newer servers keep the priority in the post metadata, which the plugin API this plugin is
+	// built against does not expose.
+	propPriority = "priority"
+
+	urgentChannelMembersPerPage = 200
+	maxUrgentChannelMembers     = 2000
+)
+
+// isUrgentPost reports whether the post is marked as important or urgent.
+func isUrgentPost(post *model.Post) bool {
+	priority, _ := post.GetProp(propPriority).(string)
+	return priority == "important" || priority == "urgent"
+}
+
+// translateUrgentPost sends a direct message with a translated copy of an important or urgent
+// post to every activated channel member reading another language, whatever the settings of
+// the channel, so that nobody misses it because of the language it is written in.
+func (p *Plugin) translateUrgentPost(post *model.Post) {
+	if !p.getConfiguration().AlwaysTranslateUrgent || !isUrgentPost(post) || post.UserId == p.botUserID {
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return
+	}
+
+	requestID := newRequestID()
+	detected, err := p.getPostLanguage(requestID, post)
+	if err != nil {
+		return
+	}
+	sourceLang := detected.Language
+
+	translations := map[string]string{}
+	for page := 0; page*urgentChannelMembersPerPage < maxUrgentChannelMembers; page++ {
+		members, appErr := p.API.GetChannelMembers(channel.Id, page, urgentChannelMembersPerPage)
+		if appErr != nil || members == nil || len(*members) == 0 {
+			return
+		}
+
+		for _, member := range *members {
+			if member.UserId == post.UserId {
+				continue
+			}
+
+			userInfo, _ := p.getUserInfo(member.UserId)
+			if !p.isAutoTranslating(member.UserId, userInfo) || userInfo.TargetLanguage == sourceLang {
+				continue
+			}
+
+			targetLang := userInfo.TargetLanguage
+			translated, ok := translations[targetLang]
+			if !ok {
+				text, appErr := p.translateText(requestID, p.preferredProvider(userInfo), post.Message, sourceLang, targetLang)
+				if appErr != nil {
+					continue
+				}
+				translated = text
+				translations[targetLang] = translated
+			}
+
+			if err := p.sendDirectMessage(member.UserId, p.urgentMessage(post, channel, sourceLang, targetLang, translated)); err != nil {
+				p.API.LogWarn("Failed to send translated urgent post", "request_id", requestID, "user_id", member.UserId, "err", err.Error())
+			}
+		}
+
+		if len(*members) < urgentChannelMembersPerPage {
+			return
+		}
+	}
+}
+
+func (p *Plugin) urgentMessage(post *model.Post, channel *model.Channel, sourceLang, targetLang, translated string) string {
+	author := "someone"
+	if user, appErr := p.API.GetUser(post.UserId); appErr == nil {
+		author = "@" + user.Username
+	}
+
+	where := "a conversation"
+	if channel.Type == model.CHANNEL_OPEN || channel.Type == model.CHANNEL_PRIVATE {
+		where = fmt.Sprintf("~%s", channel.Name)
+	}
+
+	text := fmt.Sprintf("**%s** message from %s in %s (%s → %s):\n> %s", post.GetProp(propPriority), author, where, languageCodes[sourceLang], languageCodes[targetLang], translated)
+	if permalink := p.getPermalink(post, channel); permalink != "" {
+		text += fmt.Sprintf("\n\n[Jump to the original message](%s)", permalink)
+	}
+
+	return text
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	storageKV  = "plugin key value store"
+	storageSQL = "PostgreSQL database"
+)
+
+// privacyRecipient is an external service receiving data of users, and for what.
+type privacyRecipient struct {
+	Service string   `json:"service"`
+	Purpose string   `json:"purpose"`
+	Host    string   `json:"host"`
+	Region  string   `json:"region,omitempty"`
+	Data    []string `json:"data"`
+	// ZeroRetention is set when the service is asked not to keep the data.
+	ZeroRetention bool `json:"zero_retention,omitempty"`
+}
+
+// privacyRetention is how long the plugin keeps a kind of data, 0 days meaning until it is
+// deleted, and whether it is encrypted at rest.
+type privacyRetention struct {
+	Data      string `json:"data"`
+	Storage   string `json:"storage"`
+	Days      int    `json:"days"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// privacyDisclosure describes what the plugin sends where and what it keeps, as configured.
+type privacyDisclosure struct {
+	Recipients []*privacyRecipient `json:"recipients"`
+	NeverSent  []string            `json:"never_sent"`
+	Retention  []*privacyRetention `json:"retention"`
+}
+
+// urlHost returns the host of the URL, or the URL itself when it cannot be parsed.
+func urlHost(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+
+	return parsed.Host
+}
+
+// privacyRecipients returns the external services the configuration sends data to.
+func (c *configuration) privacyRecipients() []*privacyRecipient {
+	recipients := []*privacyRecipient{}
+	if c.AWSAccessKeyID != "" && c.AWSSecretAccessKey != "" {
+		if !c.isDetectOnly() {
+			recipients = append(recipients, &privacyRecipient{
+				Service: "Amazon Translate",
+				Purpose: "translation",
+				Host:    fmt.Sprintf("translate.%s.amazonaws.com", c.AWSRegion),
+				Region:  c.AWSRegion,
+				Data:    []string{"message text"},
+			})
+		}
+		recipients = append(recipients, &privacyRecipient{
+			Service: "Amazon Comprehend",
+			Purpose: "language detection",
+			Host:    fmt.Sprintf("comprehend.%s.amazonaws.com", c.AWSRegion),
+			Region:  c.AWSRegion,
+			Data:    []string{"message text"},
+		})
+		if bucket, _, ok := c.getTranscriptJobBucket(); ok && len(c.getCallTranscriptLanguages()) > 0 {
+			recipients = append(recipients, &privacyRecipient{
+				Service: "Amazon S3",
+				Purpose: "translation of large call transcripts, deleted once translated",
+				Host:    fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, c.AWSRegion),
+				Region:  c.AWSRegion,
+				Data:    []string{"call transcripts"},
+			})
+		}
+	}
+
+	if c.DeepLAPIKey != "" && !c.isDetectOnly() {
+		recipients = append(recipients, &privacyRecipient{
+			Service: "DeepL",
+			Purpose: "translation",
+			Host:    urlHost(deepLURL(c.DeepLAPIKey)),
+			Data:    []string{"message text"},
+			// DeepL Free is not called at all in no-trace mode.
+			ZeroRetention: c.DeepLNoTrace,
+		})
+	}
+
+	if c.LLMAPIKey != "" {
+		apiURL := strings.TrimSpace(c.LLMAPIURL)
+		if apiURL == "" {
+			apiURL = defaultLLMAPIURL
+		}
+
+		purposes := []string{"romanization"}
+		data := []string{"message text"}
+		if !c.isDetectOnly() {
+			purposes = append([]string{"translation"}, purposes...)
+			if size := c.getLLMContextMessages(); size > 0 {
+				data = append(data, fmt.Sprintf("up to %d preceding messages of the thread", size))
+			}
+		}
+		if c.PreCorrection == preCorrectionLLM {
+			purposes = append(purposes, "pre-correction")
+		}
+
+		recipients = append(recipients, &privacyRecipient{
+			Service:       "LLM API",
+			Purpose:       strings.Join(purposes, ", "),
+			Host:          urlHost(apiURL),
+			Data:          data,
+			ZeroRetention: c.LLMNoTrace,
+		})
+	}
+
+	if c.PreCorrection == preCorrectionLanguageTool {
+		apiURL := strings.TrimSpace(c.LanguageToolURL)
+		if apiURL == "" {
+			apiURL = defaultLanguageToolURL
+		}
+
+		recipients = append(recipients, &privacyRecipient{
+			Service: "LanguageTool",
+			Purpose: "pre-correction",
+			Host:    urlHost(apiURL),
+			Data:    []string{"message text of users who turned pre-correction on"},
+		})
+	}
+
+	return recipients
+}
+
+// privacyNeverSent returns what the configuration keeps from every external service.
+func (c *configuration) privacyNeverSent() []string {
+	neverSent := []string{}
+	if c.ExcludeDirectMessages {
+		neverSent = append(neverSent, "direct and group messages")
+	}
+
+	var blocked []string
+	for language := range c.getBlockedLanguages() {
+		blocked = append(blocked, languageName(language))
+	}
+	if len(blocked) > 0 {
+		sort.Strings(blocked)
+		neverSent = append(neverSent, "messages in "+strings.Join(blocked, ", "))
+	}
+
+	return neverSent
+}
+
+// privacyRetention returns how long the plugin keeps the data it stores.
+func (c *configuration) privacyRetention() []*privacyRetention {
+	storage := storageKV
+	if strings.TrimSpace(c.StoreDataSource) != "" {
+		storage = storageSQL
+	}
+	encrypted := strings.TrimSpace(c.AtRestEncryptionKey) != "" || strings.TrimSpace(c.AtRestKMSKeyID) != ""
+
+	retention := []*privacyRetention{
+		{Data: "translations of threads", Storage: storageKV, Days: threadMemoryTTL / secondsPerDay},
+		{Data: "translation memory", Storage: storageKV, Days: translationMemoryTTL / secondsPerDay},
+		{Data: "translations waiting for review", Storage: storageKV, Days: reviewTTL / secondsPerDay},
+		{Data: "corrections of translations", Storage: storageKV, Days: termCorrectionTTL / secondsPerDay},
+		{Data: "detected languages of messages", Storage: storage, Days: postLanguageTTL / secondsPerDay},
+		{Data: "settings audit", Storage: storage, Days: c.getAuditRetentionDays(), Encrypted: encrypted && storage == storageKV},
+		{Data: "usage counters", Storage: storage, Days: c.getUsageRetentionDays()},
+	}
+
+	// Translations of messages are not kept at all without a retention period.
+	if days := c.getTranslationRetentionDays(); days > 0 {
+		retention = append([]*privacyRetention{
+			{Data: "translations of messages", Storage: storageKV, Days: days, Encrypted: encrypted},
+			{Data: "translation history of messages", Storage: storageKV, Days: days, Encrypted: encrypted},
+		}, retention...)
+	}
+
+	return retention
+}
+
+// getPrivacy returns the description of what the plugin sends where and what it keeps, so that
+// clients can disclose it before users turn auto-translation on.
+func (p *Plugin) getPrivacy(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Mattermost-User-ID") == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	configuration := p.getConfiguration()
+	resp, _ := json.Marshal(&privacyDisclosure{
+		Recipients: configuration.privacyRecipients(),
+		NeverSent:  configuration.privacyNeverSent(),
+		Retention:  configuration.privacyRetention(),
+	})
+	w.Write(resp)
+}
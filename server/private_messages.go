@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	apiErrorPrivateMessage = "private_message"
+
+	privateMessageExcludedMessage = "Your System Admin does not allow direct and group messages to be sent to translation services. This message was not translated."
+)
+
+// errPrivateMessage is returned when detecting or translating a direct or group message that
+// must not leave the server.
+var errPrivateMessage = errors.New("direct and group messages are not sent to translation services")
+
+// isPrivateMessageExcluded reports whether the posts of the channel are kept from translation
+// and detection services because it is a direct or group message channel.
+func (p *Plugin) isPrivateMessageExcluded(channelID string) bool {
+	if !p.getConfiguration().ExcludeDirectMessages {
+		return false
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		// Not knowing, the message is not sent.
+		return channelID != ""
+	}
+
+	return channel.Type == model.CHANNEL_DIRECT || channel.Type == model.CHANNEL_GROUP
+}
+
+// privateMessageError is returned when translating a direct or group message is requested.
+func privateMessageError() *APIErrorResponse {
+	return &APIErrorResponse{ID: apiErrorPrivateMessage, Message: privateMessageExcludedMessage, StatusCode: http.StatusForbidden}
+}
+
+// hintPrivateMessageExcluded tells the author of a direct or group message once why it was not
+// translated.
+func (p *Plugin) hintPrivateMessageExcluded(userID, channelID string) {
+	if _, hinted := p.privateMessageHints.LoadOrStore(userID, true); hinted {
+		return
+	}
+
+	p.API.SendEphemeralPost(userID, &model.Post{
+		ChannelId: channelID,
+		Message:   privateMessageExcludedMessage,
+	})
+}
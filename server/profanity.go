@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	profanityGateOff  = "off"
+	profanityGateMask = "mask"
+	profanityGateHold = "hold"
+)
+
+// defaultProfanityWords is used when admins do not provide their own list.
+var defaultProfanityWords = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "dick", "fuck", "fucking", "motherfucker", "shit", "slut", "whore",
+}
+
+// getProfanityWords returns the configured words, one per line or comma separated.
+func (c *configuration) getProfanityWords() []string {
+	fields := strings.FieldsFunc(c.ProfanityWords, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+
+	var words []string
+	for _, field := range fields {
+		if word := strings.ToLower(strings.TrimSpace(field)); word != "" {
+			words = append(words, word)
+		}
+	}
+
+	if len(words) == 0 {
+		return defaultProfanityWords
+	}
+
+	return words
+}
+
+func profanityRegexp(word string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
+}
+
+// introducedProfanity returns the listed words found in the translation but not in the source,
+// a known failure mode of machine translation.
+func introducedProfanity(words []string, source, translated string) []string {
+	var introduced []string
+	for _, word := range words {
+		re := profanityRegexp(word)
+		if re.MatchString(translated) && !re.MatchString(source) {
+			introduced = append(introduced, word)
+		}
+	}
+
+	return introduced
+}
+
+// maskProfanity replaces every occurrence of the words with asterisks.
+func maskProfanity(text string, words []string) string {
+	for _, word := range words {
+		text = profanityRegexp(word).ReplaceAllStringFunc(text, func(match string) string {
+			return strings.Repeat("*", len([]rune(match)))
+		})
+	}
+
+	return text
+}
+
+// gateProfanity applies the profanity gate to a translation about to be appended to a post. It
+// returns the translation to append, masked if needed, or false when it must be held back. The
+// author is told about it in both cases.
+func (p *Plugin) gateProfanity(post *model.Post, translated string) (string, bool) {
+	configuration := p.getConfiguration()
+	if configuration.ProfanityGate == "" || configuration.ProfanityGate == profanityGateOff {
+		return translated, true
+	}
+
+	introduced := introducedProfanity(configuration.getProfanityWords(), post.Message, translated)
+	if len(introduced) == 0 {
+		return translated, true
+	}
+
+	message := fmt.Sprintf("The translation of your message contained offensive words that are not in the original (%s), so they were masked.", strings.Join(introduced, ", "))
+	if configuration.ProfanityGate == profanityGateHold {
+		message = fmt.Sprintf("The translation of your message contained offensive words that are not in the original (%s), so it was not added. Consider rephrasing your message.", strings.Join(introduced, ", "))
+	}
+
+	p.API.SendEphemeralPost(post.UserId, &model.Post{
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   message,
+	})
+
+	if configuration.ProfanityGate == profanityGateHold {
+		return "", false
+	}
+
+	return maskProfanity(translated, introduced), true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const (
+	profileKeyPrefix      = "profile_"
+	profileIndexKeyPrefix = "profiles_"
+
+	maxProfiles = 20
+)
+
+// profileNameRegexp matches valid profile names such as "work-es" or "family_ja".
+var profileNameRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// languageProfile is a named combination of settings a user can switch to.
+type languageProfile struct {
+	Name           string `json:"name"`
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+	DisplayMode    string `json:"display_mode,omitempty"`
+}
+
+func profileKey(userID, name string) string {
+	return profileKeyPrefix + userID + "_" + name
+}
+
+// getProfileNames returns the names of the profiles of the user, sorted.
+func (p *Plugin) getProfileNames(userID string) ([]string, error) {
+	var names []string
+	if _, err := p.Helpers.KVGetJSON(profileIndexKeyPrefix+userID, &names); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// saveProfile stores the current settings of the user under the name.
+func (p *Plugin) saveProfile(userInfo *UserInfo, name string) error {
+	if !profileNameRegexp.MatchString(name) {
+		return fmt.Errorf("Invalid profile name %q, use up to 32 lower case letters, digits, \"-\" and \"_\"", name)
+	}
+
+	names, err := p.getProfileNames(userInfo.UserID)
+	if err != nil {
+		return err
+	}
+
+	exists := false
+	for _, existing := range names {
+		exists = exists || existing == name
+	}
+
+	if !exists {
+		if len(names) >= maxProfiles {
+			return fmt.Errorf("You cannot have more than %d profiles", maxProfiles)
+		}
+		names = append(names, name)
+		sort.Strings(names)
+	}
+
+	profile := &languageProfile{
+		Name:           name,
+		SourceLanguage: userInfo.SourceLanguage,
+		TargetLanguage: userInfo.TargetLanguage,
+		DisplayMode:    userInfo.DisplayMode,
+	}
+	if err := p.Helpers.KVSetJSON(profileKey(userInfo.UserID, name), profile); err != nil {
+		return err
+	}
+
+	return p.Helpers.KVSetJSON(profileIndexKeyPrefix+userInfo.UserID, names)
+}
+
+// getProfile returns the profile of the user with the name, or nil if there is none.
+func (p *Plugin) getProfile(userID, name string) (*languageProfile, error) {
+	var profile languageProfile
+	ok, err := p.Helpers.KVGetJSON(profileKey(userID, name), &profile)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// deleteProfile removes the profile of the user with the name.
+func (p *Plugin) deleteProfile(userID, name string) error {
+	names, err := p.getProfileNames(userID)
+	if err != nil {
+		return err
+	}
+
+	remaining := []string{}
+	for _, existing := range names {
+		if existing != name {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if appErr := p.API.KVDelete(profileKey(userID, name)); appErr != nil {
+		return appErr
+	}
+
+	return p.Helpers.KVSetJSON(profileIndexKeyPrefix+userID, remaining)
+}
+
+// applyProfile copies the settings of the profile to the user info.
+func (u *UserInfo) applyProfile(profile *languageProfile) {
+	u.SourceLanguage = profile.SourceLanguage
+	u.TargetLanguage = profile.TargetLanguage
+	u.DisplayMode = profile.DisplayMode
+}
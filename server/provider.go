@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	providerAWS   = "aws"
+	providerDeepL = "deepl"
+	providerLLM   = "llm"
+)
+
+// providerNames lists the supported providers.
+var providerNames = []string{providerAWS, providerDeepL, providerLLM}
+
+// translationProvider is a machine translation service.
+type translationProvider interface {
+	// Name returns the identifier used for the provider in configuration and logs.
+	Name() string
+
+	// Translate translates text from the source to the target language. Language codes are
+	// the ones of languageCodes, providers map them to their own codes.
+	Translate(requestID, text, sourceLang, targetLang string) (string, error)
+}
+
+// conversationalProvider is a translationProvider that can take the preceding messages of the
+// conversation into account.
+type conversationalProvider interface {
+	TranslateInConversation(requestID, text, sourceLang, targetLang string, conversation []string) (string, error)
+}
+
+// streamingProvider is a translationProvider that can report the translation as it is
+// produced. Partial is called with the translation produced so far.
+type streamingProvider interface {
+	TranslateStream(requestID, text, sourceLang, targetLang string, conversation []string, partial func(string)) (string, error)
+}
+
+// domainProvider is a translationProvider that can be told the domain of the texts, such as
+// legal or medical, to use its terminology.
+type domainProvider interface {
+	SetDomain(domain string)
+}
+
+// zeroRetentionProvider is a translationProvider that can be asked not to keep the texts it
+// translates.
+type zeroRetentionProvider interface {
+	// ZeroRetention reports whether the provider is called in zero-retention mode.
+	ZeroRetention() bool
+}
+
+// logZeroRetention records a call made to the provider in zero-retention mode, for every call,
+// so that System Admins can show that no text was kept by the provider. Besides the server log,
+// the calls are counted per provider and day next to usage, for the zero-retention export.
+func (p *Plugin) logZeroRetention(requestID string, provider translationProvider, operation string) {
+	if zeroRetention, ok := provider.(zeroRetentionProvider); ok && zeroRetention.ZeroRetention() {
+		p.API.LogInfo("Provider called in zero-retention mode", "request_id", requestID, "provider", provider.Name(), "operation", operation)
+		if p.usageTracker != nil {
+			p.usageTracker.addZeroRetentionCall(provider.Name())
+		}
+	}
+}
+
+// getProviders returns the providers that have credentials in the configuration.
+func (p *Plugin) getProviders() []translationProvider {
+	configuration := p.getConfiguration()
+
+	var providers []translationProvider
+	if configuration.AWSAccessKeyID != "" && configuration.AWSSecretAccessKey != "" {
+		providers = append(providers, &awsProvider{ctx: p.providerContext(), configuration: configuration})
+	}
+
+	if configuration.DeepLAPIKey != "" {
+		providers = append(providers, newDeepLProvider(p.providerContext(), configuration.DeepLAPIKey, configuration.DeepLNoTrace))
+	}
+
+	if configuration.LLMAPIKey != "" {
+		providers = append(providers, newLLMProvider(p.providerContext(), configuration))
+	}
+
+	return providers
+}
+
+// isProviderName reports whether name identifies a supported provider.
+func isProviderName(name string) bool {
+	for _, providerName := range providerNames {
+		if name == providerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// preferredProvider returns the provider the user chose, if admins allow users to choose one.
+func (p *Plugin) preferredProvider(userInfo *UserInfo) string {
+	if userInfo == nil || !p.getConfiguration().AllowUserProvider {
+		return ""
+	}
+
+	return userInfo.Provider
+}
+
+// languagePair returns the key identifying a translation direction.
+func languagePair(sourceLang, targetLang string) string {
+	return sourceLang + ":" + targetLang
+}
+
+// defaultPin is the pin applying to the language pairs that are not pinned explicitly.
+const defaultPin = "*"
+
+// parseProviderPinning parses pins in the form "ja:en=deepl, ko<>en=deepl, *=aws" into a map
+// from language pair to provider name. "<>" pins both directions of a pair and "*" every pair
+// without a pin of its own.
+func parseProviderPinning(pinning string) (map[string]string, error) {
+	pins := map[string]string{}
+	for _, entry := range strings.Split(pinning, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid provider pin %q, expected source:target=provider", entry)
+		}
+
+		provider := strings.TrimSpace(parts[1])
+		if !isProviderName(provider) {
+			return nil, fmt.Errorf("Unknown provider %q in provider pin %q", provider, entry)
+		}
+
+		languages := strings.TrimSpace(parts[0])
+		if languages == defaultPin {
+			pins[defaultPin] = provider
+			continue
+		}
+
+		separator := ":"
+		if strings.Contains(languages, "<>") {
+			separator = "<>"
+		}
+
+		pair := strings.Split(languages, separator)
+		if len(pair) != 2 || languageCodes[pair[0]] == "" || languageCodes[pair[1]] == "" {
+			return nil, fmt.Errorf("Invalid language pair in provider pin %q", entry)
+		}
+
+		pins[languagePair(pair[0], pair[1])] = provider
+		if separator == "<>" {
+			pins[languagePair(pair[1], pair[0])] = provider
+		}
+	}
+
+	return pins, nil
+}
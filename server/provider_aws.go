@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/translate"
+	"github.com/pkg/errors"
+)
+
+// awsProvider translates with Amazon Translate.
+type awsProvider struct {
+	ctx           context.Context
+	configuration *configuration
+}
+
+func (a *awsProvider) Name() string {
+	return providerAWS
+}
+
+func (a *awsProvider) Translate(requestID, text, sourceLang, targetLang string) (string, error) {
+	sess := session.Must(session.NewSession())
+	creds := credentials.NewStaticCredentials(a.configuration.AWSAccessKeyID, a.configuration.AWSSecretAccessKey, "")
+	if _, err := creds.Get(); err != nil {
+		return "", newProviderError(appErrorBadCredentials, errors.Wrap(err, "invalid AWS credentials"))
+	}
+
+	svc := translate.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(a.configuration.AWSRegion))
+
+	input := translate.TextInput{
+		SourceLanguageCode: &sourceLang,
+		TargetLanguageCode: &targetLang,
+		Text:               &text,
+	}
+
+	output, err := svc.TextWithContext(a.ctx, &input, withRequestID(requestID))
+	if err != nil {
+		return "", err
+	}
+
+	return *output.TranslatedText, nil
+}
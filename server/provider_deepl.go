@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	deepLAPIURL     = "https://api.deepl.com/v2/translate"
+	deepLFreeAPIURL = "https://api-free.deepl.com/v2/translate"
+	deepLTimeout    = 30 * time.Second
+)
+
+// deepLTargetLanguages maps the language codes whose DeepL target code is not simply the upper
+// cased language code.
+var deepLTargetLanguages = map[string]string{
+	"en":    "EN-US",
+	"pt":    "PT-BR",
+	"pt-PT": "PT-PT",
+	"zh-TW": "ZH-HANT",
+}
+
+// deepLProvider translates with the DeepL API.
+type deepLProvider struct {
+	ctx    context.Context
+	apiKey string
+	apiURL string
+	client *http.Client
+	// noTrace refuses to send texts to DeepL Free, which keeps them to train its models.
+	noTrace bool
+}
+
+// deepLURL returns the endpoint of the plan of the API key.
+func deepLURL(apiKey string) string {
+	// Keys of the free plan end with ":fx" and only work on the free endpoint.
+	if strings.HasSuffix(apiKey, ":fx") {
+		return deepLFreeAPIURL
+	}
+
+	return deepLAPIURL
+}
+
+func newDeepLProvider(ctx context.Context, apiKey string, noTrace bool) *deepLProvider {
+	return &deepLProvider{
+		ctx:     ctx,
+		apiKey:  apiKey,
+		apiURL:  deepLURL(apiKey),
+		client:  &http.Client{Timeout: deepLTimeout},
+		noTrace: noTrace,
+	}
+}
+
+func (d *deepLProvider) Name() string {
+	return providerDeepL
+}
+
+// ZeroRetention reports whether texts are only sent to DeepL API Pro, which deletes them once
+// translated.
+func (d *deepLProvider) ZeroRetention() bool {
+	return d.noTrace
+}
+
+func (d *deepLProvider) Translate(requestID, text, sourceLang, targetLang string) (string, error) {
+	if d.noTrace && d.apiURL == deepLFreeAPIURL {
+		return "", errors.New("DeepL Free keeps translated texts, no-trace mode requires a DeepL API Pro key")
+	}
+
+	target := deepLTargetLanguages[targetLang]
+	if target == "" {
+		target = strings.ToUpper(targetLang)
+	}
+
+	form := url.Values{}
+	form.Set("text", text)
+	form.Set("target_lang", target)
+	if sourceLang != autoLanguage {
+		form.Set("source_lang", strings.ToUpper(strings.SplitN(sourceLang, "-", 2)[0]))
+	}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, d.apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create DeepL request")
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+d.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", requestIDUserAgentPrefix+requestID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "DeepL request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", httpProviderError("DeepL", resp)
+	}
+
+	var result struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "failed to decode DeepL response")
+	}
+
+	if len(result.Translations) == 0 {
+		return "", errors.New("DeepL returned no translation")
+	}
+
+	return result.Translations[0].Text, nil
+}
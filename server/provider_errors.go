@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	apiErrorTranslationFailed = "translation_failed"
+	apiErrorUnsupportedPair   = "unsupported_language_pair"
+	apiErrorTextTooLong       = "text_too_long"
+	apiErrorThrottled         = "throttled"
+	apiErrorBadCredentials    = "bad_credentials"
+	apiErrorRegionMismatch    = "region_mismatch"
+
+	appErrorTranslationFailed = "TranslationFailed"
+	appErrorUnsupportedPair   = "UnsupportedLanguagePair"
+	appErrorThrottled         = "Throttled"
+	appErrorBadCredentials    = "BadCredentials"
+	appErrorRegionMismatch    = "RegionMismatch"
+
+	// defaultThrottleDelay is how long a provider that throttled without saying for how long is
+	// left alone.
+	defaultThrottleDelay = 10 * time.Second
+
+	// maxThrottleDelay caps the delays asked by providers.
+	maxThrottleDelay = 5 * time.Minute
+)
+
+// providerError is a provider error of a known kind, identified by its app error ID. Throttled
+// requests can carry how long the provider asked to wait before retrying.
+type providerError struct {
+	id         string
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *providerError) Error() string {
+	return e.err.Error()
+}
+
+// newProviderError returns an error of a known kind.
+func newProviderError(id string, err error) error {
+	return &providerError{id: id, err: err}
+}
+
+// httpProviderError returns the error of a provider whose HTTP API answered with the response.
+func httpProviderError(provider string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned status %d", provider, resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return newProviderError(appErrorBadCredentials, err)
+	case http.StatusRequestEntityTooLarge:
+		return newProviderError(appErrorTextTooLong, err)
+	case http.StatusTooManyRequests:
+		return &providerError{id: appErrorThrottled, err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	default:
+		return err
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given in seconds or as a date, or 0
+// when there is none.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// throttleDelay returns how long to leave alone a provider that throttled a request.
+func throttleDelay(err error) time.Duration {
+	delay := defaultThrottleDelay
+	var known *providerError
+	if errors.As(err, &known) && known.retryAfter > 0 {
+		delay = known.retryAfter
+	}
+
+	if delay > maxThrottleDelay {
+		return maxThrottleDelay
+	}
+
+	return delay
+}
+
+// throttleProvider leaves the provider alone for the delay, so that it is not sent requests it
+// would refuse again.
+func (p *Plugin) throttleProvider(name string, delay time.Duration) {
+	p.providerThrottles.Store(name, time.Now().Add(delay))
+}
+
+// providerThrottledFor returns how long the provider is still left alone, 0 when it is not.
+func (p *Plugin) providerThrottledFor(name string) time.Duration {
+	value, ok := p.providerThrottles.Load(name)
+	if !ok {
+		return 0
+	}
+
+	wait := time.Until(value.(time.Time))
+	if wait <= 0 {
+		p.providerThrottles.Delete(name)
+		return 0
+	}
+
+	return wait
+}
+
+// throttledRetryAfter returns the number of seconds, rounded up, until the first throttled
+// provider accepts requests again.
+func (p *Plugin) throttledRetryAfter() int {
+	var first time.Duration
+	for _, provider := range p.getProviders() {
+		if wait := p.providerThrottledFor(provider.Name()); wait > 0 && (first == 0 || wait < first) {
+			first = wait
+		}
+	}
+
+	return int((first + time.Second - 1) / time.Second)
+}
+
+// awsErrorIDs maps the error codes of Amazon Translate to app error IDs.
+var awsErrorIDs = map[string]string{
+	"UnsupportedLanguagePairException": appErrorUnsupportedPair,
+	"TextSizeLimitExceededException":   appErrorTextTooLong,
+	"TooManyRequestsException":         appErrorThrottled,
+	"ThrottlingException":              appErrorThrottled,
+	"LimitExceededException":           appErrorThrottled,
+	"UnrecognizedClientException":      appErrorBadCredentials,
+	"InvalidClientTokenId":             appErrorBadCredentials,
+	"ExpiredTokenException":            appErrorBadCredentials,
+	"AccessDeniedException":            appErrorBadCredentials,
+	"MissingAuthenticationToken":       appErrorBadCredentials,
+	"InvalidSignatureException":        appErrorBadCredentials,
+	"SignatureDoesNotMatch":            appErrorBadCredentials,
+}
+
+// providerErrorID returns the app error ID of the kind of a provider error, TranslationFailed
+// when the kind is unknown.
+func providerErrorID(err error) string {
+	var known *providerError
+	if errors.As(err, &known) {
+		return known.id
+	}
+
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return appErrorTranslationFailed
+	}
+
+	// Signatures are scoped to a region, and hosts only exist for the regions of the service.
+	message := strings.ToLower(awsErr.Message())
+	if strings.Contains(message, "region") || awsErr.Code() == "UnknownEndpoint" || (awsErr.Code() == "RequestError" && strings.Contains(strings.ToLower(awsErr.Error()), "no such host")) {
+		return appErrorRegionMismatch
+	}
+
+	if id, ok := awsErrorIDs[awsErr.Code()]; ok {
+		return id
+	}
+
+	return appErrorTranslationFailed
+}
+
+// translationErrorStatus returns the HTTP status of a translation error.
+func translationErrorStatus(id string) int {
+	switch id {
+	case appErrorTextTooLong:
+		return http.StatusRequestEntityTooLarge
+	case appErrorThrottled:
+		return http.StatusTooManyRequests
+	case appErrorBadCredentials, appErrorRegionMismatch:
+		return http.StatusBadGateway
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// translationErrorIDs maps the app error IDs of translation errors to the IDs of the errors
+// returned to clients.
+var translationErrorIDs = map[string]string{
+	appErrorUnsupportedPair:   apiErrorUnsupportedPair,
+	appErrorTextTooLong:       apiErrorTextTooLong,
+	appErrorThrottled:         apiErrorThrottled,
+	appErrorBadCredentials:    apiErrorBadCredentials,
+	appErrorRegionMismatch:    apiErrorRegionMismatch,
+	appErrorTranslationFailed: apiErrorTranslationFailed,
+}
+
+// translationErrorMessages are the messages of translation errors, by error ID and language.
+var translationErrorMessages = map[string]map[string]string{
+	apiErrorUnsupportedPair: {
+		"en": "The translation provider cannot translate between these languages. Choose another target language.",
+		"ja": "翻訳プロバイダーはこの言語の組み合わせに対応していません。別の翻訳先の言語を選んでください。",
+		"es": "El proveedor de traducción no puede traducir entre estos idiomas. Elige otro idioma de destino.",
+		"fr": "Le fournisseur de traduction ne peut pas traduire entre ces langues. Choisissez une autre langue cible.",
+		"de": "Der Übersetzungsanbieter kann nicht zwischen diesen Sprachen übersetzen. Wähle eine andere Zielsprache.",
+	},
+	apiErrorTextTooLong: {
+		"en": "This message is too long to be translated. Translate a shorter part of it.",
+		"ja": "このメッセージは長すぎて翻訳できません。短く分けて翻訳してください。",
+		"es": "Este mensaje es demasiado largo para traducirlo. Traduce una parte más corta.",
+		"fr": "Ce message est trop long pour être traduit. Traduisez-en une partie plus courte.",
+		"de": "Diese Nachricht ist zu lang für eine Übersetzung. Übersetze einen kürzeren Teil davon.",
+	},
+	apiErrorThrottled: {
+		"en": "The translation provider is receiving too many requests. Try again in a moment.",
+		"ja": "翻訳プロバイダーへのリクエストが多すぎます。しばらくしてからもう一度お試しください。",
+		"es": "El proveedor de traducción está recibiendo demasiadas solicitudes. Vuelve a intentarlo en un momento.",
+		"fr": "Le fournisseur de traduction reçoit trop de demandes. Réessayez dans un instant.",
+		"de": "Der Übersetzungsanbieter erhält zu viele Anfragen. Versuche es gleich noch einmal.",
+	},
+	apiErrorBadCredentials: {
+		"en": "The translation provider rejected the credentials of the plugin. Ask your System Admin to check them in the plugin settings.",
+		"ja": "翻訳プロバイダーがプラグインの認証情報を拒否しました。システム管理者にプラグイン設定の確認を依頼してください。",
+		"es": "El proveedor de traducción rechazó las credenciales del plugin. Pide a tu administrador del sistema que las revise en la configuración del plugin.",
+		"fr": "Le fournisseur de traduction a refusé les identifiants du plugin. Demandez à votre administrateur système de les vérifier dans les paramètres du plugin.",
+		"de": "Der Übersetzungsanbieter hat die Zugangsdaten des Plugins abgelehnt. Bitte deinen Systemadministrator, sie in den Plugin-Einstellungen zu prüfen.",
+	},
+	apiErrorRegionMismatch: {
+		"en": "The translation provider is not available in the region set for the plugin. Ask your System Admin to check the AWS region in the plugin settings.",
+		"ja": "プラグインに設定されたリージョンでは翻訳プロバイダーを利用できません。システム管理者にプラグイン設定の AWS リージョンの確認を依頼してください。",
+		"es": "El proveedor de traducción no está disponible en la región configurada para el plugin. Pide a tu administrador del sistema que revise la región de AWS en la configuración del plugin.",
+		"fr": "Le fournisseur de traduction n'est pas disponible dans la région configurée pour le plugin. Demandez à votre administrateur système de vérifier la région AWS dans les paramètres du plugin.",
+		"de": "Der Übersetzungsanbieter ist in der für das Plugin eingestellten Region nicht verfügbar. Bitte deinen Systemadministrator, die AWS-Region in den Plugin-Einstellungen zu prüfen.",
+	},
+	apiErrorTranslationFailed: {
+		"en": "Translation failed. Try again later.",
+		"ja": "翻訳に失敗しました。後でもう一度お試しください。",
+		"es": "La traducción falló. Vuelve a intentarlo más tarde.",
+		"fr": "La traduction a échoué. Réessayez plus tard.",
+		"de": "Die Übersetzung ist fehlgeschlagen. Versuche es später noch einmal.",
+	},
+}
+
+// translationError returns the error of a failed translation for a user, with a message in
+// their Mattermost language when it is available, in English otherwise.
+func (p *Plugin) translationError(userID string, appErr *model.AppError) *APIErrorResponse {
+	id, ok := translationErrorIDs[appErr.Id]
+	if !ok {
+		id = apiErrorTranslationFailed
+	}
+
+	locale := "en"
+	if user, userErr := p.API.GetUser(userID); userErr == nil && user.Locale != "" {
+		locale = strings.SplitN(user.Locale, "-", 2)[0]
+	}
+
+	message, ok := translationErrorMessages[id][locale]
+	if !ok {
+		message = translationErrorMessages[id]["en"]
+	}
+
+	apiErr := &APIErrorResponse{ID: id, Message: message, StatusCode: translationErrorStatus(appErr.Id)}
+	if id == apiErrorThrottled {
+		apiErr.RetryAfter = p.throttledRetryAfter()
+	}
+
+	return apiErr
+}
+
+// isPermanentTranslationError reports whether retrying a translation that failed with the error
+// cannot succeed.
+func isPermanentTranslationError(id string) bool {
+	switch id {
+	case apiErrorUnsupportedPair, apiErrorTextTooLong, apiErrorBadCredentials, apiErrorRegionMismatch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultLLMAPIURL = "https://api.openai.com/v1/chat/completions"
+	defaultLLMModel  = "gpt-4o-mini"
+	llmTimeout       = 60 * time.Second
+
+	// defaultLLMContextMessages is the number of preceding thread messages given to the LLM.
+	defaultLLMContextMessages = 5
+
+	// llmPartialInterval is the minimum time between two reports of a streamed translation.
+	llmPartialInterval = 250 * time.Millisecond
+)
+
+// llmProvider translates with a large language model behind an OpenAI compatible chat
+// completions API.
+type llmProvider struct {
+	ctx    context.Context
+	apiURL string
+	apiKey string
+	model  string
+	client *http.Client
+	// noTrace asks the API not to store the requests and replies.
+	noTrace bool
+	// domain is the domain of the channel of the texts, see channelDomainPrompts.
+	domain string
+}
+
+func newLLMProvider(ctx context.Context, configuration *configuration) *llmProvider {
+	apiURL := strings.TrimSpace(configuration.LLMAPIURL)
+	if apiURL == "" {
+		apiURL = defaultLLMAPIURL
+	}
+
+	llmModel := strings.TrimSpace(configuration.LLMModel)
+	if llmModel == "" {
+		llmModel = defaultLLMModel
+	}
+
+	return &llmProvider{
+		ctx:     ctx,
+		apiURL:  apiURL,
+		apiKey:  configuration.LLMAPIKey,
+		model:   llmModel,
+		client:  &http.Client{Timeout: llmTimeout},
+		noTrace: configuration.LLMNoTrace,
+	}
+}
+
+// getLLMContextMessages returns the number of preceding thread messages included in LLM
+// prompts, 0 disabling the context.
+func (c *configuration) getLLMContextMessages() int {
+	messages, err := strconv.Atoi(strings.TrimSpace(c.LLMContextMessages))
+	if err != nil || messages < 0 {
+		return defaultLLMContextMessages
+	}
+
+	return messages
+}
+
+func (l *llmProvider) Name() string {
+	return providerLLM
+}
+
+// ZeroRetention reports whether the API is asked not to store the requests and replies.
+func (l *llmProvider) ZeroRetention() bool {
+	return l.noTrace
+}
+
+// SetDomain makes the prompts ask for the terminology of the domain.
+func (l *llmProvider) SetDomain(domain string) {
+	l.domain = domain
+}
+
+func (l *llmProvider) Translate(requestID, text, sourceLang, targetLang string) (string, error) {
+	return l.TranslateInConversation(requestID, text, sourceLang, targetLang, nil)
+}
+
+// TranslateInConversation translates text, giving the preceding messages of the conversation
+// to the model so that omitted subjects and pronouns are resolved the way the participants
+// meant them.
+func (l *llmProvider) TranslateInConversation(requestID, text, sourceLang, targetLang string, conversation []string) (string, error) {
+	system, user := translationPrompt(text, sourceLang, targetLang, conversation, l.domain)
+	return l.complete(requestID, system, user)
+}
+
+// TranslateStream is TranslateInConversation reporting the translation as the model writes it.
+func (l *llmProvider) TranslateStream(requestID, text, sourceLang, targetLang string, conversation []string, partial func(string)) (string, error) {
+	system, user := translationPrompt(text, sourceLang, targetLang, conversation, l.domain)
+	return l.completeStream(requestID, system, user, partial)
+}
+
+// translationPrompt returns the system prompt and the user message asking for the translation
+// of text.
+func translationPrompt(text, sourceLang, targetLang string, conversation []string, domain string) (string, string) {
+	source := "the language of the message"
+	if sourceLang != autoLanguage {
+		source = languageCodes[sourceLang]
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Translate the chat message below from %s to %s. Reply with the translation only, keeping Markdown, mentions, links and emoji unchanged.", source, languageCodes[targetLang])
+	if len(conversation) > 0 {
+		prompt.WriteString(" The earlier messages of the conversation are given for context only, do not translate them.")
+	}
+	if domainPrompt := channelDomainPrompts[domain]; domainPrompt != "" {
+		prompt.WriteString(" ")
+		prompt.WriteString(domainPrompt)
+	}
+
+	var user strings.Builder
+	if len(conversation) > 0 {
+		user.WriteString("Earlier messages:\n")
+		for _, message := range conversation {
+			user.WriteString("> ")
+			user.WriteString(strings.Replace(message, "\n", "\n> ", -1))
+			user.WriteString("\n")
+		}
+		user.WriteString("\nMessage to translate:\n")
+	}
+	user.WriteString(text)
+
+	return prompt.String(), user.String()
+}
+
+// Romanize transliterates text written in a non Latin script, using pinyin for Chinese and
+// Hepburn romaji for Japanese.
+func (l *llmProvider) Romanize(requestID, text string) (string, error) {
+	return l.complete(requestID, "Romanize the chat message below: use Hanyu Pinyin with tone marks for Chinese, Hepburn romaji for Japanese and the Revised Romanization for Korean. Reply with the romanized text only, keeping punctuation and line breaks.", text)
+}
+
+// Correct fixes the spelling and grammar mistakes of text, in its own language.
+func (l *llmProvider) Correct(requestID, text string) (string, error) {
+	return l.complete(requestID, "Fix the spelling and grammar mistakes of the chat message below without translating, rephrasing or changing its tone. Reply with the corrected message only, keeping Markdown, mentions, links and emoji unchanged.", text)
+}
+
+// complete sends a system prompt and a user message to the chat completions API and returns
+// the reply.
+func (l *llmProvider) complete(requestID, system, user string) (string, error) {
+	resp, err := l.post(requestID, system, user, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "failed to decode LLM response")
+	}
+
+	if len(result.Choices) == 0 || strings.TrimSpace(result.Choices[0].Message.Content) == "" {
+		return "", errors.New("LLM API returned an empty reply")
+	}
+
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// completeStream is complete receiving the reply as server-sent events, calling partial with
+// the reply received so far at most every llmPartialInterval.
+func (l *llmProvider) completeStream(requestID, system, user string, partial func(string)) (string, error) {
+	resp, err := l.post(requestID, system, user, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var reply strings.Builder
+	lastPartial := time.Now()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "data:"))
+		if data == "" || data == scanner.Text() {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", errors.Wrap(err, "failed to decode LLM response")
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		reply.WriteString(chunk.Choices[0].Delta.Content)
+
+		if time.Since(lastPartial) >= llmPartialInterval {
+			partial(strings.TrimSpace(reply.String()))
+			lastPartial = time.Now()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrap(err, "failed to read LLM response")
+	}
+
+	if strings.TrimSpace(reply.String()) == "" {
+		return "", errors.New("LLM API returned an empty reply")
+	}
+
+	return strings.TrimSpace(reply.String()), nil
+}
+
+// post sends a chat completions request, asking for server-sent events when stream is set.
+// The caller closes the body of the returned response.
+func (l *llmProvider) post(requestID, system, user string, stream bool) (*http.Response, error) {
+	request := map[string]interface{}{
+		"model":       l.model,
+		"temperature": 0,
+		"stream":      stream,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+	}
+	if l.noTrace {
+		// OpenAI keeps completions for its dashboards and evaluations unless told otherwise.
+		request["store"] = false
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode LLM request")
+	}
+
+	req, err := http.NewRequestWithContext(l.ctx, http.MethodPost, l.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create LLM request")
+	}
+	req.Header.Set("Authorization", "Bearer "+l.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", requestIDUserAgentPrefix+requestID)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "LLM request failed")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, httpProviderError("LLM API", resp)
+	}
+
+	return resp, nil
+}
+
+// getConversationContext returns the messages preceding the post in its thread, oldest first,
+// when the LLM provider is configured to use them.
+func (p *Plugin) getConversationContext(post *model.Post) []string {
+	configuration := p.getConfiguration()
+	size := configuration.getLLMContextMessages()
+	if post.RootId == "" || configuration.LLMAPIKey == "" || size == 0 {
+		return nil
+	}
+
+	postList, appErr := p.API.GetPostThread(post.RootId)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get thread for conversation context", "root_id", post.RootId, "err", appErr.Error())
+		return nil
+	}
+
+	var conversation []string
+	for _, threadPost := range postList.ToSlice() {
+		if threadPost.Id == post.Id || threadPost.IsSystemMessage() || threadPost.Message == "" {
+			continue
+		}
+		conversation = append(conversation, threadPost.Message)
+		if len(conversation) == size {
+			break
+		}
+	}
+
+	// ToSlice returns the newest post first.
+	for i, j := 0, len(conversation)-1; i < j; i, j = i+1, j-1 {
+		conversation[i], conversation[j] = conversation[j], conversation[i]
+	}
+
+	return conversation
+}
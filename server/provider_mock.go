@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	providerMock = "mock"
+
+	mockMinLatency = 20 * time.Millisecond
+	mockMaxLatency = 120 * time.Millisecond
+)
+
+// mockProvider pretends to translate, taking as long as a fast provider, so that the plugin
+// can be load tested without cost. It is only used by the benchmark.
+type mockProvider struct {
+	ctx context.Context
+}
+
+func (m *mockProvider) Name() string {
+	return providerMock
+}
+
+func (m *mockProvider) Translate(requestID, text, sourceLang, targetLang string) (string, error) {
+	latency := mockMinLatency + time.Duration(rand.Int63n(int64(mockMaxLatency-mockMinLatency)))
+
+	select {
+	case <-m.ctx.Done():
+		return "", m.ctx.Err()
+	case <-time.After(latency):
+	}
+
+	return "[" + targetLang + "] " + text, nil
+}
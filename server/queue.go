@@ -0,0 +1,423 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	translationQueueSize     = 256
+	translationQueueWorkers  = 4
+	translationJobMaxAttempt = 3
+	translationJobRetryDelay = 2 * time.Second
+
+	// interactiveQueueWorkers of the workers only run interactive jobs, so that a user waiting
+	// for a translation never waits for background jobs to finish.
+	interactiveQueueWorkers = 1
+
+	// Interactive jobs were requested by a user waiting for them, background jobs by nobody in
+	// particular: retries, jobs resumed from a previous instance and batch work.
+	jobPriorityInteractive = "interactive"
+	jobPriorityBackground  = "background"
+
+	// Queued jobs are persisted until they are done, so that jobs left by a previous instance of
+	// the plugin, on this or another server, are resumed. The server running a job claims it
+	// for queueClaimTTLSeconds, renewed on each attempt.
+	queuedJobKeyPrefix   = "queued_job_"
+	queueClaimKeyPrefix  = "queue_claim_"
+	queueClaimTTLSeconds = 5 * 60
+	queueResumeInterval  = 10 * time.Minute
+
+	// queueFullRetryAfter is how long, in seconds, clients are asked to wait before submitting
+	// a translation again when the queue is full.
+	queueFullRetryAfter = 30
+
+	apiErrorQueueFull = "queue_full"
+
+	wsEventTranslationComplete = "translation_complete"
+	wsEventTranslationFailed   = "translation_failed"
+)
+
+var (
+	errQueueStopped = errors.New("translation queue stopped")
+	errQueueFull    = errors.New("translation queue is full")
+)
+
+// translationJob is a request to translate a post outside of the HTTP request that asked for it.
+type translationJob struct {
+	RequestID      string `json:"request_id"`
+	UserID         string `json:"user_id"`
+	PostID         string `json:"post_id"`
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+	Provider       string `json:"provider,omitempty"`
+	Attempts       int    `json:"attempts"`
+	Priority       string `json:"priority,omitempty"`
+
+	// IdempotencyKey identifies the requested translation across the retries and redeliveries
+	// of the job, in logs and events.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// id identifies the translation requested by the job, so that a request repeated while the
+// first one is queued is not translated twice.
+func (j *translationJob) id() string {
+	sum := sha256.Sum256([]byte(j.UserID + "|" + j.PostID + "|" + j.SourceLanguage + "|" + j.TargetLanguage + "|" + j.Provider))
+	return hex.EncodeToString(sum[:16])
+}
+
+// translationQueue runs translation jobs on a fixed pool of workers and retries failed jobs
+// with a linear backoff. Interactive jobs have their own lane, which workers always serve
+// first.
+type translationQueue struct {
+	plugin      *Plugin
+	interactive chan *translationJob
+	background  chan *translationJob
+	stop        chan struct{}
+	workers     sync.WaitGroup
+}
+
+func newTranslationQueue(p *Plugin) *translationQueue {
+	return &translationQueue{
+		plugin:      p,
+		interactive: make(chan *translationJob, translationQueueSize),
+		background:  make(chan *translationJob, translationQueueSize),
+		stop:        make(chan struct{}),
+	}
+}
+
+func (q *translationQueue) start() {
+	for i := 0; i < translationQueueWorkers; i++ {
+		q.workers.Add(1)
+		go q.work(i < interactiveQueueWorkers)
+	}
+
+	q.workers.Add(1)
+	go func() {
+		defer q.workers.Done()
+
+		ticker := time.NewTicker(queueResumeInterval)
+		defer ticker.Stop()
+
+		for {
+			q.plugin.safely("translation queue resume", q.resume)
+
+			select {
+			case <-q.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// close stops accepting jobs and waits for the running ones to finish. The claims of the queued
+// jobs are released so that the next instance of the plugin resumes them.
+func (q *translationQueue) close() {
+	close(q.stop)
+	q.workers.Wait()
+
+	for {
+		select {
+		case job := <-q.interactive:
+			q.release(job)
+		case job := <-q.background:
+			q.release(job)
+		default:
+			return
+		}
+	}
+}
+
+// queued returns the number of jobs waiting for a worker.
+func (q *translationQueue) queued() int {
+	return len(q.interactive) + len(q.background)
+}
+
+// submit persists and queues the job, unless the same translation is already queued, in which
+// case the queued job is returned instead. It fails with errQueueFull, forgetting the job, when
+// its lane is full.
+func (q *translationQueue) submit(job *translationJob) (*translationJob, error) {
+	p := q.plugin
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, appErr := p.API.KVSetWithOptions(queuedJobKeyPrefix+job.id(), data, model.PluginKVSetOptions{
+		Atomic:   true,
+		OldValue: nil,
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if !saved {
+		var queued *translationJob
+		if _, err := p.Helpers.KVGetJSON(queuedJobKeyPrefix+job.id(), &queued); err != nil {
+			return nil, err
+		}
+		if queued != nil {
+			return queued, nil
+		}
+	}
+
+	if q.claim(job) && !q.enqueue(job) {
+		q.finish(job)
+		return nil, errQueueFull
+	}
+
+	return job, nil
+}
+
+// resume queues the persisted jobs that no server is running.
+func (q *translationQueue) resume() {
+	p := q.plugin
+
+	err := forEachKVKey(p.API, queuedJobKeyPrefix, func(key string) error {
+		select {
+		case <-q.stop:
+			return errQueueStopped
+		default:
+		}
+
+		var job *translationJob
+		if _, err := p.Helpers.KVGetJSON(key, &job); err != nil || job == nil {
+			return nil
+		}
+
+		// Jobs of posts deleted since they were queued are dropped.
+		if p.isPostGone(job.PostID) {
+			if appErr := p.API.KVDelete(key); appErr != nil {
+				p.API.LogWarn("Failed to delete queued translation", "request_id", job.RequestID, "err", appErr.Error())
+			}
+			return nil
+		}
+
+		if q.claim(job) {
+			p.API.LogDebug("Resuming queued translation", "request_id", job.RequestID, "idempotency_key", job.IdempotencyKey, "post_id", job.PostID)
+			job.Priority = jobPriorityBackground
+			if !q.enqueue(job) {
+				return errQueueFull
+			}
+		}
+
+		return nil
+	})
+	if err != nil && err != errQueueStopped && err != errQueueFull {
+		p.API.LogWarn("Failed to resume queued translations", "err", err.Error())
+	}
+}
+
+// claim marks the job as run by this server, failing when another server already runs it.
+func (q *translationQueue) claim(job *translationJob) bool {
+	claimed, appErr := q.plugin.API.KVSetWithOptions(queueClaimKeyPrefix+job.id(), []byte(job.RequestID), model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: queueClaimTTLSeconds,
+	})
+	if appErr != nil {
+		q.plugin.API.LogWarn("Failed to claim queued translation", "request_id", job.RequestID, "err", appErr.Error())
+		return false
+	}
+
+	return claimed
+}
+
+// renewClaim extends the claim of the job before an attempt.
+func (q *translationQueue) renewClaim(job *translationJob) {
+	if _, appErr := q.plugin.API.KVSetWithOptions(queueClaimKeyPrefix+job.id(), []byte(job.RequestID), model.PluginKVSetOptions{
+		ExpireInSeconds: queueClaimTTLSeconds,
+	}); appErr != nil {
+		q.plugin.API.LogWarn("Failed to renew claim of queued translation", "request_id", job.RequestID, "err", appErr.Error())
+	}
+}
+
+// release gives up the claim of the job, leaving it persisted for another server.
+func (q *translationQueue) release(job *translationJob) {
+	if appErr := q.plugin.API.KVDelete(queueClaimKeyPrefix + job.id()); appErr != nil {
+		q.plugin.API.LogWarn("Failed to release queued translation", "request_id", job.RequestID, "err", appErr.Error())
+	}
+}
+
+// finish removes a job that succeeded or failed for good.
+func (q *translationQueue) finish(job *translationJob) {
+	if appErr := q.plugin.API.KVDelete(queuedJobKeyPrefix + job.id()); appErr != nil {
+		q.plugin.API.LogWarn("Failed to delete queued translation", "request_id", job.RequestID, "err", appErr.Error())
+	}
+	q.release(job)
+}
+
+// enqueue hands the claimed job to the workers. When the queue is closed or the lane of the job
+// is full, the claim is released, leaving the persisted job to be resumed later, and false is
+// returned.
+func (q *translationQueue) enqueue(job *translationJob) bool {
+	lane := q.background
+	if job.Priority == jobPriorityInteractive {
+		lane = q.interactive
+	}
+
+	select {
+	case <-q.stop:
+		q.plugin.API.LogWarn("Translation queue is closed, leaving job to the next instance", "request_id", job.RequestID)
+		q.release(job)
+		return false
+	case lane <- job:
+		return true
+	default:
+		q.plugin.API.LogWarn("Translation queue is full, leaving job for later", "request_id", job.RequestID, "priority", job.Priority)
+		q.release(job)
+		return false
+	}
+}
+
+// work runs queued jobs, interactive ones first. Workers reserved for interactive jobs leave
+// the background ones to the others.
+func (q *translationQueue) work(interactiveOnly bool) {
+	defer q.workers.Done()
+
+	background := q.background
+	if interactiveOnly {
+		background = nil
+	}
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case job := <-q.interactive:
+			q.process(job)
+			continue
+		default:
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case job := <-q.interactive:
+			q.process(job)
+		case job := <-background:
+			q.process(job)
+		}
+	}
+}
+
+func (q *translationQueue) process(job *translationJob) {
+	p := q.plugin
+	// A job crashing the worker is dropped rather than retried.
+	defer p.recoverPanic("translation queue", func(interface{}) {
+		p.emitTranslationFailed(job, "Translation failed")
+		q.finish(job)
+	})
+
+	job.Attempts++
+	q.renewClaim(job)
+
+	post, appErr := p.API.GetPost(job.PostID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get post for queued translation", "request_id", job.RequestID, "post_id", job.PostID, "err", appErr.Error())
+		p.emitTranslationFailed(job, "No post to translate")
+		q.finish(job)
+		return
+	}
+	if p.isPostGone(job.PostID) {
+		p.emitTranslationFailed(job, "The message was deleted")
+		q.finish(job)
+		return
+	}
+
+	stopStreaming := p.streamTranslation(job.RequestID, job.UserID, job.PostID, job.TargetLanguage)
+	translated, apiErr := p.translatePost(job.RequestID, job.UserID, job.Provider, post, job.SourceLanguage, job.TargetLanguage)
+	stopStreaming()
+	// The post may have been deleted while it was translated.
+	if p.isPostGone(job.PostID) {
+		p.emitTranslationFailed(job, "The message was deleted")
+		q.finish(job)
+		return
+	}
+
+	if apiErr == nil {
+		userInfo, _ := p.getUserInfo(job.UserID)
+		p.personalizeTranslation(job.RequestID, userInfo, post, translated)
+		p.translatePermalinkPreviews(job.RequestID, job.UserID, job.Provider, post, translated)
+		p.addThreadContext(job.RequestID, job.UserID, job.Provider, post, translated)
+		p.emitTranslationComplete(job, translated)
+		q.finish(job)
+		return
+	}
+
+	if apiErr.ID == apiErrorAlreadyInLanguage || apiErr.ID == apiErrorQuotaExceeded || apiErr.ID == apiErrorPairNotAllowed || apiErr.ID == apiErrorLanguageBlocked || apiErr.ID == apiErrorPrivateMessage || isPermanentTranslationError(apiErr.ID) {
+		p.emitTranslationFailed(job, apiErr.Message)
+		q.finish(job)
+		return
+	}
+
+	if job.Attempts >= translationJobMaxAttempt {
+		p.API.LogError("Queued translation failed", "request_id", job.RequestID, "idempotency_key", job.IdempotencyKey, "post_id", job.PostID, "attempts", job.Attempts)
+		p.emitTranslationFailed(job, apiErr.Message)
+		q.finish(job)
+		return
+	}
+
+	// Throttled translations wait for as long as the provider asked.
+	delay := time.Duration(job.Attempts) * translationJobRetryDelay
+	if retryAfter := time.Duration(apiErr.RetryAfter) * time.Second; retryAfter > delay {
+		delay = retryAfter
+	}
+
+	// Nobody waits on a retry the way they waited on the first attempt.
+	job.Priority = jobPriorityBackground
+	time.AfterFunc(delay, func() {
+		q.enqueue(job)
+	})
+}
+
+func (p *Plugin) emitTranslationComplete(job *translationJob, translated *TranslatedMessage) {
+	payload := map[string]interface{}{
+		"request_id":      job.RequestID,
+		"idempotency_key": job.IdempotencyKey,
+		"id":              translated.ID,
+		"post_id":         translated.PostID,
+		"source_lang":     translated.SourceLanguage,
+		"target_lang":     translated.TargetLanguage,
+		"translated_text": translated.TranslatedText,
+		"update_at":       translated.UpdateAt,
+	}
+
+	if translated.ThreadContext != "" {
+		payload["thread_context"] = translated.ThreadContext
+	}
+	if translated.CorrectedBy != "" {
+		payload["corrected_by"] = translated.CorrectedBy
+	}
+
+	// WebSocket payloads only carry plain values, so the previews are sent as JSON.
+	if len(translated.PermalinkPreviews) > 0 {
+		encoded, _ := json.Marshal(translated.PermalinkPreviews)
+		payload["permalink_previews"] = string(encoded)
+	}
+
+	p.publishToUser(wsEventTranslationComplete, job.UserID, payload)
+}
+
+func (p *Plugin) emitTranslationFailed(job *translationJob, message string) {
+	p.publishToUser(
+		wsEventTranslationFailed,
+		job.UserID,
+		map[string]interface{}{
+			"request_id":      job.RequestID,
+			"idempotency_key": job.IdempotencyKey,
+			"post_id":         job.PostID,
+			"source_lang":     job.SourceLanguage,
+			"target_lang":     job.TargetLanguage,
+			"message":         message,
+		},
+	)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	quoteHandlingNewText = "new_text"
+	quoteHandlingAll     = "all"
+
+	// quotedPostSearchSize is the number of recent posts of the channel searched for the post a
+	// message quotes.
+	quotedPostSearchSize = 30
+)
+
+// translatesQuotes reports whether quotes are translated again with the new text of messages.
+func (c *configuration) translatesQuotes() bool {
+	return c.QuoteHandling == quoteHandlingAll
+}
+
+// translatableText returns the part of the message that auto-translation translates.
+func (c *configuration) translatableText(message string) string {
+	if c.translatesQuotes() {
+		return message
+	}
+
+	newText, _ := splitQuotes(message)
+	return newText
+}
+
+// splitQuotes separates the new text of a message from its Markdown quotes, returned without
+// their quote markers. Lines of code blocks are always new text.
+func splitQuotes(message string) (string, []string) {
+	var lines, quoted []string
+	inCode := false
+	for _, line := range strings.Split(message, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+
+		if !inCode && strings.HasPrefix(trimmed, ">") {
+			quoted = append(quoted, strings.TrimSpace(strings.TrimLeft(trimmed, ">")))
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), quoted
+}
+
+// quotedTranslationLink returns a link to the translated post of the channel the quote comes
+// from, or an empty string when it is not among the recent posts or has no translation.
+func (p *Plugin) quotedTranslationLink(post *model.Post, quoted []string) string {
+	quote := strings.TrimSpace(strings.Join(quoted, "\n"))
+	if !p.getConfiguration().LinkQuotedTranslations || quote == "" {
+		return ""
+	}
+
+	postList, appErr := p.API.GetPostsForChannel(post.ChannelId, 0, quotedPostSearchSize)
+	if appErr != nil {
+		return ""
+	}
+
+	for _, candidate := range postList.ToSlice() {
+		if !isTranslatedPost(candidate) || !strings.Contains(candidate.Message, quote) {
+			continue
+		}
+
+		channel, appErr := p.API.GetChannel(post.ChannelId)
+		if appErr != nil {
+			return ""
+		}
+
+		if permalink := p.getPermalink(candidate, channel); permalink != "" {
+			return fmt.Sprintf("[Translation of the quoted message](%s)", permalink)
+		}
+		return ""
+	}
+
+	return ""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const reactionLanguagesKey = "reaction_languages"
+
+var emojiNameRegexp = regexp.MustCompile(`^[a-z0-9_+-]{1,64}$`)
+
+// defaultReactionLanguages maps flag emojis to their most common language. Admins can replace
+// the map, including non-flag emojis, through the admin endpoint.
+var defaultReactionLanguages = map[string]string{
+	"us":      "en",
+	"gb":      "en",
+	"jp":      "ja",
+	"cn":      "zh",
+	"kr":      "ko",
+	"fr":      "fr",
+	"de":      "de",
+	"es":      "es",
+	"it":      "it",
+	"ru":      "ru",
+	"flag-br": "pt",
+	"flag-pt": "pt-PT",
+	"flag-nl": "nl",
+	"flag-vn": "vi",
+}
+
+// validateReactionLanguages checks that every key is an emoji name and every value a
+// supported target language.
+func validateReactionLanguages(reactionLanguages map[string]string) error {
+	for emojiName, language := range reactionLanguages {
+		if !emojiNameRegexp.MatchString(emojiName) {
+			return fmt.Errorf("Invalid: emoji name %q", emojiName)
+		}
+
+		if language == autoLanguage || languageCodes[language] == "" {
+			return fmt.Errorf("Invalid: %q is not a supported target language for emoji %q", language, emojiName)
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) getReactionLanguages() map[string]string {
+	var reactionLanguages map[string]string
+	if ok, err := p.Helpers.KVGetJSON(reactionLanguagesKey, &reactionLanguages); err != nil || !ok {
+		return defaultReactionLanguages
+	}
+
+	return reactionLanguages
+}
+
+func (p *Plugin) setReactionLanguages(reactionLanguages map[string]string) error {
+	if err := validateReactionLanguages(reactionLanguages); err != nil {
+		return err
+	}
+
+	return p.Helpers.KVSetJSON(reactionLanguagesKey, reactionLanguages)
+}
+
+// handleReactionLanguages lets system admins read and replace the emoji to language map.
+func (p *Plugin) handleReactionLanguages(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to manage reaction languages", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var reactionLanguages map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&reactionLanguages); err != nil || reactionLanguages == nil {
+			http.Error(w, "Invalid parameter: reaction languages", http.StatusBadRequest)
+			return
+		}
+
+		if err := p.setReactionLanguages(reactionLanguages); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set reaction languages: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, _ := json.Marshal(p.getReactionLanguages())
+	w.Write(resp)
+}
+
+// reactionTranslate translates a post into the language mapped to the emoji the user reacted
+// with, and shows the result to that user only, in the thread of the post.
+func (p *Plugin) reactionTranslate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate post", http.StatusUnauthorized)
+		return
+	}
+
+	var reaction struct {
+		PostID    string `json:"post_id"`
+		EmojiName string `json:"emoji_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reaction); err != nil {
+		http.Error(w, "Invalid parameter: reaction", http.StatusBadRequest)
+		return
+	}
+
+	target := p.getReactionLanguages()[reaction.EmojiName]
+	if target == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	post, appErr := p.API.GetPost(reaction.PostID)
+	if appErr != nil || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		httpErrorWithRequestID(w, requestID, "No post to translate", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	translated, apiErr := p.translatePost(requestID, userID, p.preferredProvider(userInfo), post, autoLanguage, target)
+	if apiErr != nil {
+		writeAPIErrorWithRequestID(w, requestID, apiErr)
+		return
+	}
+	p.personalizeTranslation(requestID, userInfo, post, translated)
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+
+	p.API.SendEphemeralPost(userID, &model.Post{
+		ChannelId: post.ChannelId,
+		RootId:    rootID,
+		Message:   fmt.Sprintf(":%s: (%s → %s)\n> %s", reaction.EmojiName, languageCodes[translated.SourceLanguage], languageCodes[target], translated.TranslatedText),
+	})
+
+	resp, _ := json.Marshal(translated)
+	w.Write(resp)
+}
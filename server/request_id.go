@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	requestIDHeader          = "X-Autotranslate-Request-Id"
+	requestIDUserAgentPrefix = "mattermost-autotranslate/"
+)
+
+// newRequestID returns an identifier used to correlate a single translation flow across
+// plugin logs, error responses and provider calls.
+func newRequestID() string {
+	return model.NewId()
+}
+
+// withRequestID tags an AWS request with the given request ID. The synchronous Translate and
+// Comprehend APIs do not accept a client token, so the ID is appended to the user agent which
+// is recorded by CloudTrail.
+func withRequestID(requestID string) request.Option {
+	return request.WithAppendUserAgent(requestIDUserAgentPrefix + requestID)
+}
+
+// httpErrorWithRequestID writes a plain text error that carries the request ID so users can
+// quote it when reporting problems.
+func httpErrorWithRequestID(w http.ResponseWriter, requestID, message string, code int) {
+	w.Header().Set(requestIDHeader, requestID)
+	http.Error(w, fmt.Sprintf("%s (request ID: %s)", message, requestID), code)
+}
+
+// writeAPIErrorWithRequestID writes an API error whose message carries the request ID, so that
+// clients can tell the errors apart by their ID and users can quote the request ID.
+func writeAPIErrorWithRequestID(w http.ResponseWriter, requestID string, apiErr *APIErrorResponse) {
+	w.Header().Set(requestIDHeader, requestID)
+	w.Header().Set("Content-Type", "application/json")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	writeAPIError(w, &APIErrorResponse{
+		ID:         apiErr.ID,
+		Message:    fmt.Sprintf("%s (request ID: %s)", apiErr.Message, requestID),
+		StatusCode: apiErr.StatusCode,
+		RetryAfter: apiErr.RetryAfter,
+	})
+}
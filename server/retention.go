@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// secondsPerDay converts the retention periods, set in days, to the TTLs of the KV store.
+const secondsPerDay = 24 * 60 * 60
+
+// parseRetentionDays returns the number of days of a retention setting, or the default when the
+// setting is empty or invalid.
+func parseRetentionDays(value string, defaultDays int) int {
+	days, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || days < 0 {
+		return defaultDays
+	}
+
+	return days
+}
+
+// getTranslationRetentionDays returns how many days translations of posts are cached, 0 for
+// not at all.
+func (c *configuration) getTranslationRetentionDays() int {
+	return parseRetentionDays(c.TranslationRetentionDays, translationTTL/secondsPerDay)
+}
+
+// getAuditRetentionDays returns how many days changes of settings are kept in the audit, 0 for
+// as long as they are among the latest changes of their subject.
+func (c *configuration) getAuditRetentionDays() int {
+	return parseRetentionDays(c.AuditRetentionDays, 0)
+}
+
+// getUsageRetentionDays returns how many days usage counters are kept after their month ended,
+// 0 for ever.
+func (c *configuration) getUsageRetentionDays() int {
+	return parseRetentionDays(c.UsageRetentionDays, 0)
+}
+
+// enforceRetention deletes the cached translations and their history, settings changes and
+// usage counters older than their retention period.
+func (p *Plugin) enforceRetention() {
+	configuration := p.getConfiguration()
+	now := time.Now()
+
+	p.deleteCachedTranslationsBefore(now.AddDate(0, 0, -configuration.getTranslationRetentionDays()))
+	p.deleteTranslationHistoryBefore(now.AddDate(0, 0, -configuration.getTranslationRetentionDays()))
+
+	if days := configuration.getAuditRetentionDays(); days > 0 {
+		if err := p.store.DeleteSettingsChangesBefore(model.GetMillisForTime(now.AddDate(0, 0, -days))); err != nil {
+			p.API.LogWarn("Failed to delete expired settings changes", "err", err.Error())
+		}
+	}
+
+	// Counters of a month are deleted once the whole month is past the retention period.
+	if days := configuration.getUsageRetentionDays(); days > 0 {
+		month := now.AddDate(0, 0, -days).UTC().Format(usageMonthFmt)
+		if err := p.store.DeleteUsageBefore(month); err != nil {
+			p.API.LogWarn("Failed to delete expired usage counters", "err", err.Error())
+		}
+	}
+}
+
+// deleteCachedTranslationsBefore deletes the translations of posts cached before the time.
+func (p *Plugin) deleteCachedTranslationsBefore(before time.Time) {
+	deleted, err := p.store.DeleteCachedTranslationsBefore(model.GetMillisForTime(before))
+	if err != nil {
+		p.API.LogWarn("Failed to delete expired translations", "err", err.Error())
+	}
+
+	if deleted > 0 {
+		p.API.LogInfo("Removed expired translations", "count", deleted)
+	}
+}
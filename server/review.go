@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	reviewKeyPrefix = "review_"
+
+	// reviewTTL is how long, in seconds, a translation waits for its review.
+	reviewTTL = 30 * 24 * 60 * 60
+
+	reviewActionApprove = "approve"
+	reviewActionCorrect = "correct"
+
+	reviewReasonLowConfidence = "low confidence"
+	reviewReasonFlagged       = "flagged"
+
+	// maxCorrectionLength is the longest text of the correction dialog.
+	maxCorrectionLength = 3000
+)
+
+// reviewItem is a translation appended to a post waiting for a reviewer to approve or correct it.
+type reviewItem struct {
+	PostID         string `json:"post_id"`
+	ReviewPostID   string `json:"review_post_id"`
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	Original       string `json:"original"`
+	Translation    string `json:"translation"`
+	Reason         string `json:"reason"`
+	Mode           string `json:"mode"`
+
+	createdAt time.Time
+}
+
+// getReviewThreshold returns the detection confidence under which translations are reviewed,
+// 0 when only flagged translations are.
+func (c *configuration) getReviewThreshold() float64 {
+	threshold, err := strconv.ParseFloat(c.ReviewConfidenceThreshold, 64)
+	if err != nil || threshold < 0 {
+		return 0
+	}
+
+	return threshold / 100
+}
+
+// getReviewChannel returns the channel of the review queue, configured as "team/channel", or
+// nil when there is no review queue.
+func (p *Plugin) getReviewChannel() *model.Channel {
+	parts := strings.SplitN(strings.TrimSpace(p.getConfiguration().ReviewChannel), "/", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	channel, appErr := p.API.GetChannelByNameForTeamName(parts[0], parts[1], false)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get review channel", "channel", p.getConfiguration().ReviewChannel, "err", appErr.Error())
+		return nil
+	}
+
+	return channel
+}
+
+// reviewReason returns why the translation of a new post must be reviewed, or an empty string.
+// Only translations shown in the post itself are reviewed, as the others cannot be corrected.
+func (p *Plugin) reviewReason(mode string, details bannerDetails, flagged bool) string {
+	configuration := p.getConfiguration()
+	if configuration.ReviewChannel == "" || (mode != displayModeAppend && mode != displayModePropsToggle) {
+		return ""
+	}
+
+	if flagged {
+		return reviewReasonFlagged
+	}
+	if details.Detected && details.Confidence < configuration.getReviewThreshold() {
+		return reviewReasonLowConfidence
+	}
+
+	return ""
+}
+
+// queueForReview holds the translation of a new post until the post is saved, when it is sent
+// to the review queue.
+func (p *Plugin) queueForReview(post *model.Post, item *reviewItem) {
+	p.pendingReviews.Range(func(key, value interface{}) bool {
+		if time.Since(value.(*reviewItem).createdAt) > pendingDeliveryTTL {
+			p.pendingReviews.Delete(key)
+		}
+		return true
+	})
+
+	item.createdAt = time.Now()
+	p.pendingReviews.Store(pendingDeliveryKey(post), item)
+}
+
+// postForReview posts the translation of the saved post waiting for review, if any, in the
+// review channel, with buttons for reviewers to approve or correct it.
+func (p *Plugin) postForReview(post *model.Post) {
+	value, ok := p.pendingReviews.Load(pendingDeliveryKey(post))
+	if !ok {
+		return
+	}
+	p.pendingReviews.Delete(pendingDeliveryKey(post))
+	item := value.(*reviewItem)
+	item.PostID = post.Id
+
+	reviewChannel := p.getReviewChannel()
+	if reviewChannel == nil {
+		return
+	}
+
+	message := fmt.Sprintf("#### Translation to review (%s)", item.Reason)
+	if channel, appErr := p.API.GetChannel(post.ChannelId); appErr == nil {
+		if permalink := p.getPermalink(post, channel); permalink != "" {
+			message += fmt.Sprintf("\n[Original message](%s)", permalink)
+		}
+	}
+	message += fmt.Sprintf("\n\n**%s:**\n%s\n\n**%s:**\n%s", languageName(item.SourceLanguage), quoteText(item.Original), languageName(item.TargetLanguage), quoteText(item.Translation))
+
+	action := func(name, reviewAction string) *model.PostAction {
+		return &model.PostAction{
+			Name: name,
+			Type: model.POST_ACTION_TYPE_BUTTON,
+			Integration: &model.PostActionIntegration{
+				URL: fmt.Sprintf("/plugins/%s/api/review", manifest.Id),
+				Context: map[string]interface{}{
+					"post_id": post.Id,
+					"action":  reviewAction,
+				},
+			},
+		}
+	}
+
+	reviewPost := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: reviewChannel.Id,
+		Message:   message,
+	}
+	model.ParseSlackAttachment(reviewPost, []*model.SlackAttachment{{
+		Actions: []*model.PostAction{
+			action("Approve", reviewActionApprove),
+			action("Correct", reviewActionCorrect),
+		},
+	}})
+
+	created, appErr := p.API.CreatePost(reviewPost)
+	if appErr != nil {
+		p.API.LogWarn("Failed to post translation for review", "post_id", post.Id, "err", appErr.Error())
+		return
+	}
+	item.ReviewPostID = created.Id
+
+	if err := p.Helpers.KVSetWithExpiryJSON(reviewKeyPrefix+post.Id, item, reviewTTL); err != nil {
+		p.API.LogWarn("Failed to save translation for review", "post_id", post.Id, "err", err.Error())
+	}
+}
+
+// quoteText returns the text as a Markdown block quote.
+func quoteText(text string) string {
+	return "> " + strings.Replace(text, "\n", "\n> ", -1)
+}
+
+// getReviewItem returns the translation of the post waiting for review, or nil when it was
+// reviewed already.
+func (p *Plugin) getReviewItem(postID string) *reviewItem {
+	item := &reviewItem{}
+	if ok, err := p.Helpers.KVGetJSON(reviewKeyPrefix+postID, item); err != nil || !ok {
+		return nil
+	}
+
+	return item
+}
+
+// isReviewer reports whether the user is a member of the review channel.
+func (p *Plugin) isReviewer(userID string) bool {
+	reviewChannel := p.getReviewChannel()
+	if reviewChannel == nil {
+		return false
+	}
+
+	_, appErr := p.API.GetChannelMember(reviewChannel.Id, userID)
+	return appErr == nil
+}
+
+// closeReview removes the translation from the review queue and replaces the buttons of its
+// review post with the outcome.
+func (p *Plugin) closeReview(item *reviewItem, outcome string) {
+	if appErr := p.API.KVDelete(reviewKeyPrefix + item.PostID); appErr != nil {
+		p.API.LogWarn("Failed to delete reviewed translation", "post_id", item.PostID, "err", appErr.Error())
+	}
+
+	reviewPost, appErr := p.API.GetPost(item.ReviewPostID)
+	if appErr != nil {
+		return
+	}
+
+	updated := reviewPost.Clone()
+	updated.Message = reviewPost.Message + "\n\n" + outcome
+	updated.DelProp("attachments")
+	if _, appErr := p.API.UpdatePost(updated); appErr != nil {
+		p.API.LogWarn("Failed to update review post", "post_id", item.ReviewPostID, "err", appErr.Error())
+	}
+}
+
+// applyCorrection replaces the translation shown in the post with the corrected one and saves
+// it in the translation memory.
+func (p *Plugin) applyCorrection(item *reviewItem, corrected string) error {
+	post, appErr := p.API.GetPost(item.PostID)
+	if appErr != nil {
+		return appErr
+	}
+
+	updated := post.Clone()
+	switch item.Mode {
+	case displayModePropsToggle:
+		if post.GetProp(propTranslation) != item.Translation {
+			return fmt.Errorf("the translation of the message changed since it was queued")
+		}
+		updated.AddProp(propTranslation, corrected)
+	default:
+		length, ok := originalLength(post)
+		if !ok {
+			return errTranslationRemoved
+		}
+		index := strings.LastIndex(post.Message[length:], item.Translation)
+		if index < 0 {
+			return fmt.Errorf("the translation of the message changed since it was queued")
+		}
+		index += length
+		updated.Message = post.Message[:index] + corrected + post.Message[index+len(item.Translation):]
+	}
+
+	saved, appErr := p.API.UpdatePost(updated)
+	if appErr != nil {
+		return appErr
+	}
+	p.recordShownTranslation(saved)
+
+	if err := p.rememberTranslation(item.Original, item.SourceLanguage, item.TargetLanguage, corrected); err != nil {
+		p.API.LogWarn("Failed to save correction in translation memory", "post_id", item.PostID, "err", err.Error())
+	}
+	p.recordCorrection(p.postTeamID(post), item.SourceLanguage, item.TargetLanguage, item.Original, item.Translation, corrected)
+
+	return nil
+}
+
+// handleReview is the post action of the review buttons: it approves the translation, or opens
+// a dialog to correct it.
+func (p *Plugin) handleReview(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to review translations", http.StatusUnauthorized)
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+	postID, _ := request.Context["post_id"].(string)
+	reviewAction, _ := request.Context["action"].(string)
+
+	respond := func(text string) {
+		resp, _ := json.Marshal(&model.PostActionIntegrationResponse{EphemeralText: text})
+		w.Write(resp)
+	}
+
+	if !p.isReviewer(userID) {
+		respond("Only members of the review channel can review translations.")
+		return
+	}
+
+	item := p.getReviewItem(postID)
+	if item == nil {
+		respond("This translation was reviewed already.")
+		return
+	}
+
+	switch reviewAction {
+	case reviewActionApprove:
+		p.closeReview(item, fmt.Sprintf(":white_check_mark: Approved by %s", p.mentionUser(userID)))
+		respond("")
+	case reviewActionCorrect:
+		appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+			TriggerId: request.TriggerId,
+			URL:       fmt.Sprintf("/plugins/%s/api/review/correct", manifest.Id),
+			Dialog: model.Dialog{
+				CallbackId:  postID,
+				Title:       "Correct translation",
+				SubmitLabel: "Save",
+				Elements: []model.DialogElement{{
+					DisplayName: languageName(item.TargetLanguage),
+					Name:        "translation",
+					Type:        "textarea",
+					Default:     item.Translation,
+					MaxLength:   maxCorrectionLength,
+				}},
+			},
+		})
+		if appErr != nil {
+			p.API.LogWarn("Failed to open correction dialog", "post_id", postID, "err", appErr.Error())
+			respond("Failed to open the correction dialog.")
+			return
+		}
+		respond("")
+	default:
+		http.Error(w, "Invalid parameter: action", http.StatusBadRequest)
+	}
+}
+
+// handleReviewCorrection is the submission of the correction dialog.
+func (p *Plugin) handleReviewCorrection(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to review translations", http.StatusUnauthorized)
+		return
+	}
+
+	request := model.SubmitDialogRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+
+	respond := func(message string) {
+		w.Write((&model.SubmitDialogResponse{Error: message}).ToJson())
+	}
+
+	if !p.isReviewer(userID) {
+		respond("Only members of the review channel can review translations.")
+		return
+	}
+
+	item := p.getReviewItem(request.CallbackId)
+	if item == nil {
+		respond("This translation was reviewed already.")
+		return
+	}
+
+	corrected, _ := request.Submission["translation"].(string)
+	corrected = strings.TrimSpace(corrected)
+	if corrected == "" {
+		w.Write((&model.SubmitDialogResponse{Errors: map[string]string{"translation": "The translation cannot be empty."}}).ToJson())
+		return
+	}
+
+	if corrected == item.Translation {
+		p.closeReview(item, fmt.Sprintf(":white_check_mark: Approved by %s", p.mentionUser(userID)))
+		respond("")
+		return
+	}
+
+	if err := p.applyCorrection(item, corrected); err != nil {
+		p.API.LogWarn("Failed to apply translation correction", "post_id", item.PostID, "err", err.Error())
+		respond(fmt.Sprintf("Failed to correct the translation: %s.", err.Error()))
+		return
+	}
+
+	p.closeReview(item, fmt.Sprintf(":pencil2: Corrected by %s:\n%s", p.mentionUser(userID), quoteText(corrected)))
+	respond("")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	rolloutCohortIn  = "rollout"
+	rolloutCohortOut = "holdout"
+)
+
+// getRolloutPercentage returns the share of activated users, between 0 and 100, whose messages
+// are auto-translated. All of them are unless the setting says otherwise.
+func (c *configuration) getRolloutPercentage() int {
+	value := strings.TrimSpace(c.RolloutPercentage)
+	if value == "" {
+		return 100
+	}
+
+	percentage, err := strconv.Atoi(value)
+	if err != nil || percentage > 100 {
+		return 100
+	}
+	if percentage < 0 {
+		return 0
+	}
+
+	return percentage
+}
+
+// isInRollout decides whether auto-translation is on for an activated user. It hashes the user
+// ID so that a user stays on as the percentage is raised.
+func isInRollout(userID string, percentage int) bool {
+	if percentage >= 100 {
+		return true
+	}
+	if percentage <= 0 {
+		return false
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte("rollout_" + userID))
+	return int(hash.Sum32()%100) < percentage
+}
+
+// isAutoTranslating reports whether the user turned auto-translation on and is among the users
+// it is rolled out to.
+func (p *Plugin) isAutoTranslating(userID string, userInfo *UserInfo) bool {
+	return userInfo != nil && userInfo.Activated && isInRollout(userID, p.getConfiguration().getRolloutPercentage())
+}
+
+// rolloutCohort returns the cohort of an activated user.
+func (p *Plugin) rolloutCohort(userID string) string {
+	if isInRollout(userID, p.getConfiguration().getRolloutPercentage()) {
+		return rolloutCohortIn
+	}
+
+	return rolloutCohortOut
+}
+
+type rolloutTotals struct {
+	authors    map[string]bool
+	posts      int
+	translated int
+	failures   int
+	characters int
+}
+
+// rolloutTracker counts, on this server since activation, the posts of activated users in and
+// out of the rollout, and what translating them cost, so that System Admins can compare the
+// cohorts while ramping up.
+type rolloutTracker struct {
+	lock   sync.Mutex
+	totals map[string]*rolloutTotals
+}
+
+// get returns the totals of the cohort, the lock being held.
+func (t *rolloutTracker) get(cohort string) *rolloutTotals {
+	if t.totals == nil {
+		t.totals = map[string]*rolloutTotals{}
+	}
+
+	totals, ok := t.totals[cohort]
+	if !ok {
+		totals = &rolloutTotals{authors: map[string]bool{}}
+		t.totals[cohort] = totals
+	}
+
+	return totals
+}
+
+// recordPost counts a new post of an activated user.
+func (t *rolloutTracker) recordPost(cohort, userID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	totals := t.get(cohort)
+	totals.posts++
+	totals.authors[userID] = true
+}
+
+// recordTranslation counts the translation of a new post of an activated user.
+func (t *rolloutTracker) recordTranslation(cohort string, characters int, failed bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	totals := t.get(cohort)
+	if failed {
+		totals.failures++
+		return
+	}
+	totals.translated++
+	totals.characters += characters
+}
+
+// rolloutCohortStats is the statistics of a cohort returned to System Admins.
+type rolloutCohortStats struct {
+	Cohort            string  `json:"cohort"`
+	Authors           int     `json:"authors"`
+	Posts             int     `json:"posts"`
+	TranslatedPosts   int     `json:"translated_posts"`
+	Failures          int     `json:"failures"`
+	Characters        int     `json:"characters"`
+	CharactersPerPost float64 `json:"characters_per_post"`
+}
+
+// rolloutStats compares the cohorts of the rollout.
+type rolloutStats struct {
+	Percentage int                   `json:"percentage"`
+	Cohorts    []*rolloutCohortStats `json:"cohorts"`
+}
+
+// snapshot returns the statistics of the rollout, then the holdout cohort.
+func (t *rolloutTracker) snapshot() []*rolloutCohortStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	stats := []*rolloutCohortStats{}
+	for _, cohort := range []string{rolloutCohortIn, rolloutCohortOut} {
+		totals, ok := t.totals[cohort]
+		if !ok {
+			stats = append(stats, &rolloutCohortStats{Cohort: cohort})
+			continue
+		}
+
+		entry := &rolloutCohortStats{
+			Cohort:          cohort,
+			Authors:         len(totals.authors),
+			Posts:           totals.posts,
+			TranslatedPosts: totals.translated,
+			Failures:        totals.failures,
+			Characters:      totals.characters,
+		}
+		if totals.posts > 0 {
+			entry.CharactersPerPost = float64(totals.characters) / float64(totals.posts)
+		}
+		stats = append(stats, entry)
+	}
+
+	return stats
+}
+
+// getRolloutStats returns the statistics of the users in and out of the rollout on this server.
+func (p *Plugin) getRolloutStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to read rollout statistics", http.StatusForbidden)
+		return
+	}
+
+	resp, _ := json.Marshal(&rolloutStats{
+		Percentage: p.getConfiguration().getRolloutPercentage(),
+		Cohorts:    p.rollout.snapshot(),
+	})
+	w.Write(resp)
+}
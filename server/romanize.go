@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// kanaRomaji maps hiragana, and pairs of hiragana forming one sound, to Hepburn romaji.
+// Katakana are converted to hiragana before the lookup.
+var kanaRomaji = map[string]string{
+	"あ": "a", "い": "i", "う": "u", "え": "e", "お": "o",
+	"か": "ka", "き": "ki", "く": "ku", "け": "ke", "こ": "ko",
+	"が": "ga", "ぎ": "gi", "ぐ": "gu", "げ": "ge", "ご": "go",
+	"さ": "sa", "し": "shi", "す": "su", "せ": "se", "そ": "so",
+	"ざ": "za", "じ": "ji", "ず": "zu", "ぜ": "ze", "ぞ": "zo",
+	"た": "ta", "ち": "chi", "つ": "tsu", "て": "te", "と": "to",
+	"だ": "da", "ぢ": "ji", "づ": "zu", "で": "de", "ど": "do",
+	"な": "na", "に": "ni", "ぬ": "nu", "ね": "ne", "の": "no",
+	"は": "ha", "ひ": "hi", "ふ": "fu", "へ": "he", "ほ": "ho",
+	"ば": "ba", "び": "bi", "ぶ": "bu", "べ": "be", "ぼ": "bo",
+	"ぱ": "pa", "ぴ": "pi", "ぷ": "pu", "ぺ": "pe", "ぽ": "po",
+	"ま": "ma", "み": "mi", "む": "mu", "め": "me", "も": "mo",
+	"や": "ya", "ゆ": "yu", "よ": "yo",
+	"ら": "ra", "り": "ri", "る": "ru", "れ": "re", "ろ": "ro",
+	"わ": "wa", "を": "o", "ん": "n", "ゔ": "vu",
+	"ぁ": "a", "ぃ": "i", "ぅ": "u", "ぇ": "e", "ぉ": "o",
+	"ゃ": "ya", "ゅ": "yu", "ょ": "yo", "ゎ": "wa",
+	"きゃ": "kya", "きゅ": "kyu", "きょ": "kyo", "ぎゃ": "gya", "ぎゅ": "gyu", "ぎょ": "gyo",
+	"しゃ": "sha", "しゅ": "shu", "しょ": "sho", "じゃ": "ja", "じゅ": "ju", "じょ": "jo",
+	"ちゃ": "cha", "ちゅ": "chu", "ちょ": "cho", "にゃ": "nya", "にゅ": "nyu", "にょ": "nyo",
+	"ひゃ": "hya", "ひゅ": "hyu", "ひょ": "hyo", "びゃ": "bya", "びゅ": "byu", "びょ": "byo",
+	"ぴゃ": "pya", "ぴゅ": "pyu", "ぴょ": "pyo", "みゃ": "mya", "みゅ": "myu", "みょ": "myo",
+	"りゃ": "rya", "りゅ": "ryu", "りょ": "ryo",
+	"ふぁ": "fa", "ふぃ": "fi", "ふぇ": "fe", "ふぉ": "fo", "てぃ": "ti", "でぃ": "di",
+	"しぇ": "she", "じぇ": "je", "ちぇ": "che", "うぃ": "wi", "うぇ": "we",
+	"、": ", ", "。": ". ", "「": "\"", "」": "\"",
+}
+
+// hangulInitials, hangulMedials and hangulFinals are the Revised Romanization of the jamo a
+// Hangul syllable is composed of.
+var (
+	hangulInitials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulMedials  = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinals   = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+)
+
+const (
+	hangulFirstSyllable = 0xAC00
+	hangulLastSyllable  = 0xD7A3
+)
+
+// cyrillicLatin maps lower case Cyrillic letters of Russian and Ukrainian to Latin letters.
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// arabicLatin maps Arabic letters and short vowel marks to Latin letters.
+var arabicLatin = map[rune]string{
+	'ا': "a", 'ب': "b", 'ت': "t", 'ث': "th", 'ج': "j", 'ح': "h", 'خ': "kh", 'د': "d",
+	'ذ': "dh", 'ر': "r", 'ز': "z", 'س': "s", 'ش': "sh", 'ص': "s", 'ض': "d", 'ط': "t",
+	'ظ': "z", 'ع': "'", 'غ': "gh", 'ف': "f", 'ق': "q", 'ك': "k", 'ل': "l", 'م': "m",
+	'ن': "n", 'ه': "h", 'و': "w", 'ي': "y", 'ء': "'", 'ة': "a", 'ى': "a", 'أ': "a",
+	'إ': "i", 'آ': "aa", 'ؤ': "'", 'ئ': "'", 'َ': "a", 'ِ': "i", 'ُ': "u", 'ً': "an",
+	'ٍ': "in", 'ٌ': "un", 'ْ': "", 'ّ': "", '،': ",", '؟': "?",
+}
+
+// hasRomanizableScript reports whether the text contains characters of a script romanize
+// handles, or Han characters.
+func hasRomanizableScript(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Cyrillic, unicode.Arabic, unicode.Han) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasHan reports whether the text contains Han characters, which cannot be romanized without
+// knowing the words they form.
+func hasHan(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// romanize transliterates kana, Hangul, Cyrillic and Arabic letters of the text into Latin
+// letters. Other characters, Han characters included, are kept as they are.
+func romanize(text string) string {
+	var result strings.Builder
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == 'ー':
+			// The prolonged sound mark repeats the previous vowel.
+			if written := result.String(); written != "" && strings.ContainsAny(written[len(written)-1:], "aiueo") {
+				result.WriteString(written[len(written)-1:])
+			}
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana) || kanaRomaji[string(r)] != "":
+			romaji, consumed := romanizeKana(runes[i:])
+			result.WriteString(romaji)
+			i += consumed - 1
+		case r >= hangulFirstSyllable && r <= hangulLastSyllable:
+			index := int(r - hangulFirstSyllable)
+			result.WriteString(hangulInitials[index/(21*28)])
+			result.WriteString(hangulMedials[index%(21*28)/28])
+			result.WriteString(hangulFinals[index%28])
+		case unicode.Is(unicode.Cyrillic, r):
+			latin, ok := cyrillicLatin[unicode.ToLower(r)]
+			if !ok {
+				result.WriteRune(r)
+			} else if unicode.IsUpper(r) && latin != "" {
+				result.WriteString(strings.ToUpper(latin[:1]) + latin[1:])
+			} else {
+				result.WriteString(latin)
+			}
+		case unicode.Is(unicode.Arabic, r):
+			if latin, ok := arabicLatin[r]; ok {
+				result.WriteString(latin)
+			} else {
+				result.WriteRune(r)
+			}
+		default:
+			result.WriteRune(r)
+		}
+	}
+
+	return result.String()
+}
+
+// romanizeKana romanizes the kana at the start of runes and returns the number of runes it
+// consumed.
+func romanizeKana(runes []rune) (string, int) {
+	kana := make([]rune, 0, 3)
+	for _, r := range runes {
+		if len(kana) == 3 {
+			break
+		}
+		// Katakana letters are 0x60 code points after the matching hiragana.
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 0x60
+		}
+		kana = append(kana, r)
+	}
+
+	switch kana[0] {
+	case 'っ':
+		// A small tsu doubles the consonant of the next sound.
+		if len(kana) > 1 {
+			next, consumed := romanizeKana(runes[1:])
+			if next != "" && next[0] != 'a' && next[0] != 'i' && next[0] != 'u' && next[0] != 'e' && next[0] != 'o' {
+				return next[:1] + next, consumed + 1
+			}
+			return next, consumed + 1
+		}
+		return "", 1
+	}
+
+	if len(kana) > 1 {
+		if romaji, ok := kanaRomaji[string(kana[:2])]; ok {
+			return romaji, 2
+		}
+	}
+
+	if romaji, ok := kanaRomaji[string(kana[:1])]; ok {
+		return romaji, 1
+	}
+
+	return string(runes[:1]), 1
+}
+
+// romanizeText romanizes the text, using the LLM provider for Han characters when it is
+// configured.
+func (p *Plugin) romanizeText(requestID, text string) string {
+	if hasHan(text) && p.getConfiguration().LLMAPIKey != "" && p.blockedLanguage(text, "") == "" {
+		llm := newLLMProvider(p.providerContext(), p.getConfiguration())
+		romanized, err := llm.Romanize(requestID, text)
+		if err == nil {
+			p.logZeroRetention(requestID, llm, "romanization")
+			return romanized
+		}
+		p.API.LogWarn("Failed to romanize with the LLM provider", "request_id", requestID, "err", err.Error())
+	}
+
+	return romanize(text)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// providerScoreWeight is the weight of the latest sample in the moving averages.
+	providerScoreWeight = 0.2
+
+	// providerMinSamples is the number of calls a provider gets for a language pair before its
+	// score is trusted, so every configured provider is measured.
+	providerMinSamples = 3
+
+	// providerErrorPenalty scales the latency by the error rate, so a fast but failing
+	// provider ranks behind a slower reliable one.
+	providerErrorPenalty = 10
+)
+
+type providerStats struct {
+	samples   int
+	latencyMs float64
+	errorRate float64
+}
+
+type providerTotals struct {
+	calls          int
+	failures       int
+	totalLatencyMs float64
+}
+
+// providerScorer keeps moving averages of latency and error rate per provider and language
+// pair, where a lower score is better, as well as totals per provider since activation.
+type providerScorer struct {
+	lock   sync.Mutex
+	stats  map[string]*providerStats
+	totals map[string]*providerTotals
+}
+
+func newProviderScorer() *providerScorer {
+	return &providerScorer{
+		stats:  map[string]*providerStats{},
+		totals: map[string]*providerTotals{},
+	}
+}
+
+func (s *providerScorer) record(provider, pair string, latency time.Duration, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := provider + "|" + pair
+	stats, ok := s.stats[key]
+	if !ok {
+		stats = &providerStats{latencyMs: float64(latency.Milliseconds())}
+		s.stats[key] = stats
+	}
+
+	failure := 0.0
+	if failed {
+		failure = 1
+	}
+
+	stats.samples++
+	stats.latencyMs += providerScoreWeight * (float64(latency.Milliseconds()) - stats.latencyMs)
+	stats.errorRate += providerScoreWeight * (failure - stats.errorRate)
+
+	totals, ok := s.totals[provider]
+	if !ok {
+		totals = &providerTotals{}
+		s.totals[provider] = totals
+	}
+
+	totals.calls++
+	totals.totalLatencyMs += float64(latency.Milliseconds())
+	if failed {
+		totals.failures++
+	}
+}
+
+// getTotals returns the number of calls and failures of a provider and its average latency.
+func (s *providerScorer) getTotals(provider string) (int, int, float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	totals, ok := s.totals[provider]
+	if !ok || totals.calls == 0 {
+		return 0, 0, 0
+	}
+
+	return totals.calls, totals.failures, totals.totalLatencyMs / float64(totals.calls)
+}
+
+func (s *providerScorer) score(provider, pair string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats, ok := s.stats[provider+"|"+pair]
+	if !ok || stats.samples < providerMinSamples {
+		return 0
+	}
+
+	return stats.latencyMs * (1 + providerErrorPenalty*stats.errorRate)
+}
+
+// rankProviders orders the configured providers for a language pair: the provider pinned to
+// the pair first, else the preferred provider, else the default pinned provider, else the
+// canary if the request was selected for it, then the others by score.
+func (p *Plugin) rankProviders(requestID, preferredProvider, sourceLang, targetLang string) []translationProvider {
+	providers := p.getProviders()
+	pair := languagePair(sourceLang, targetLang)
+
+	first := preferredProvider
+	if pins, err := parseProviderPinning(p.getConfiguration().ProviderPinning); err == nil {
+		if pins[pair] != "" {
+			first = pins[pair]
+		} else if first == "" {
+			first = pins[defaultPin]
+		}
+	}
+
+	sort.SliceStable(providers, func(i, j int) bool {
+		if providers[i].Name() == first || providers[j].Name() == first {
+			return providers[i].Name() == first
+		}
+		return p.providerScorer.score(providers[i].Name(), pair) < p.providerScorer.score(providers[j].Name(), pair)
+	})
+
+	if first != "" {
+		return providers
+	}
+
+	return p.applyCanary(requestID, providers)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxSavedDigestPosts caps how many saved posts a single digest translates.
+const maxSavedDigestPosts = 50
+
+// savedDigest translates the saved posts of the user that are written in a foreign language and
+// sends them as a direct message digest.
+//
+// The plugin API cannot list the saved posts of a user, so the client sends the IDs it knows
+// about. Posts in channels the user cannot read are ignored.
+func (p *Plugin) savedDigest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to translate saved posts", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		PostIDs []string `json:"post_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid parameter: post_ids", http.StatusBadRequest)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	if userInfo == nil {
+		http.Error(w, "No record found. Try `/autotranslate on` to enable.", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.PostIDs) > maxSavedDigestPosts {
+		request.PostIDs = request.PostIDs[:maxSavedDigestPosts]
+	}
+
+	var posts []*model.Post
+	for _, postID := range request.PostIDs {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil || post.Message == "" || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	// The digest may take a while, so it is delivered asynchronously by direct message.
+	provider, targetLang := p.preferredProvider(userInfo), userInfo.TargetLanguage
+	go p.safely("saved digest", func() { p.sendSavedDigest(requestID, userID, provider, posts, targetLang) })
+
+	w.WriteHeader(http.StatusAccepted)
+	resp, _ := json.Marshal(map[string]interface{}{"request_id": requestID, "count": len(posts)})
+	w.Write(resp)
+}
+
+func (p *Plugin) sendSavedDigest(requestID, userID, preferredProvider string, posts []*model.Post, targetLang string) {
+	var entries []string
+	for _, result := range p.translateBatch(requestID, preferredProvider, posts, targetLang) {
+		if result.Err != nil || result.TranslatedText == "" {
+			continue
+		}
+
+		entry := fmt.Sprintf("* (%s → %s) %s", languageCodes[result.SourceLanguage], languageCodes[targetLang], result.TranslatedText)
+		if channel, appErr := p.API.GetChannel(result.Post.ChannelId); appErr == nil {
+			if permalink := p.getPermalink(result.Post, channel); permalink != "" {
+				entry += fmt.Sprintf(" ([original](%s))", permalink)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	text := "None of your saved messages needed a translation."
+	if len(entries) > 0 {
+		text = fmt.Sprintf("###### Translated saved messages\n%s", strings.Join(entries, "\n"))
+	}
+
+	if err := p.sendDirectMessage(userID, text); err != nil {
+		p.API.LogWarn("Failed to send saved messages digest", "request_id", requestID, "user_id", userID, "err", err.Error())
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxSearchResults caps how many search results are translated per request.
+const maxSearchResults = 20
+
+// SearchResult is a post found by a search along with its translation into the target
+// language of the user who searched.
+type SearchResult struct {
+	PostID         string `json:"post_id"`
+	ChannelID      string `json:"channel_id"`
+	UserID         string `json:"user_id"`
+	CreateAt       int64  `json:"create_at"`
+	Message        string `json:"message"`
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	TranslatedText string `json:"translated_text"`
+}
+
+// searchPosts runs a search in the team on behalf of the user. The plugin API searches without
+// regard to permissions, so posts in channels the user cannot read are filtered out here.
+func (p *Plugin) searchPosts(userID, teamID, terms string) ([]*model.Post, *model.AppError) {
+	posts, appErr := p.API.SearchPostsInTeam(teamID, model.ParseSearchParams(terms, 0))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	readable := map[string]bool{}
+	var results []*model.Post
+	for _, post := range posts {
+		allowed, ok := readable[post.ChannelId]
+		if !ok {
+			allowed = p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL)
+			readable[post.ChannelId] = allowed
+		}
+
+		if allowed {
+			results = append(results, post)
+		}
+	}
+
+	return results, nil
+}
+
+// searchPostsExpanded runs the search once with the original terms and once per dominant
+// language of the channel with the terms translated into it, merging the results newest first.
+func (p *Plugin) searchPostsExpanded(requestID, userID, teamID, channelID, terms string) ([]*model.Post, *model.AppError) {
+	posts, appErr := p.searchPosts(userID, teamID, terms)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	termsLang, err := p.detectLanguage(requestID, terms)
+	if err != nil {
+		return posts, nil
+	}
+
+	seen := map[string]bool{}
+	for _, post := range posts {
+		seen[post.Id] = true
+	}
+
+	for _, language := range p.getChannelLanguages(requestID, channelID) {
+		if language == termsLang || languageCodes[language] == "" {
+			continue
+		}
+
+		translatedTerms, appErr := p.translateText(requestID, "", terms, termsLang, language)
+		if appErr != nil {
+			continue
+		}
+
+		morePosts, appErr := p.searchPosts(userID, teamID, translatedTerms)
+		if appErr != nil {
+			continue
+		}
+
+		for _, post := range morePosts {
+			if !seen[post.Id] {
+				seen[post.Id] = true
+				posts = append(posts, post)
+			}
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt > posts[j].CreateAt
+	})
+
+	return posts, nil
+}
+
+// searchAndTranslate searches the team for the given terms and returns the results translated
+// into the target language of the user. With expand=true and a channel_id, the terms are also
+// translated into the dominant languages of that channel to find posts written in them.
+func (p *Plugin) searchAndTranslate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to search", http.StatusUnauthorized)
+		return
+	}
+
+	teamID := r.URL.Query().Get("team_id")
+	terms := r.URL.Query().Get("terms")
+	if teamID == "" || terms == "" {
+		http.Error(w, "Invalid parameter: team_id and terms are required", http.StatusBadRequest)
+		return
+	}
+
+	if _, appErr := p.API.GetTeamMember(teamID, userID); appErr != nil {
+		http.Error(w, "Not authorized to search this team", http.StatusForbidden)
+		return
+	}
+
+	userInfo, _ := p.getUserInfo(userID)
+	if userInfo == nil {
+		http.Error(w, "No record found. Try `/autotranslate on` to enable.", http.StatusBadRequest)
+		return
+	}
+
+	requestID := newRequestID()
+	w.Header().Set(requestIDHeader, requestID)
+
+	var posts []*model.Post
+	var appErr *model.AppError
+	if channelID := r.URL.Query().Get("channel_id"); r.URL.Query().Get("expand") == "true" && channelID != "" {
+		if !p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_READ_CHANNEL) {
+			httpErrorWithRequestID(w, requestID, "Not authorized to read this channel", http.StatusForbidden)
+			return
+		}
+		posts, appErr = p.searchPostsExpanded(requestID, userID, teamID, channelID, terms)
+	} else {
+		posts, appErr = p.searchPosts(userID, teamID, terms)
+	}
+	if appErr != nil {
+		p.API.LogError("Search failed", "request_id", requestID, "err", appErr.Error())
+		httpErrorWithRequestID(w, requestID, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	if len(posts) > maxSearchResults {
+		posts = posts[:maxSearchResults]
+	}
+
+	results := []*SearchResult{}
+	for _, translation := range p.translateBatch(requestID, p.preferredProvider(userInfo), posts, userInfo.TargetLanguage) {
+		results = append(results, &SearchResult{
+			PostID:         translation.Post.Id,
+			ChannelID:      translation.Post.ChannelId,
+			UserID:         translation.Post.UserId,
+			CreateAt:       translation.Post.CreateAt,
+			Message:        translation.Post.Message,
+			SourceLanguage: translation.SourceLanguage,
+			TargetLanguage: userInfo.TargetLanguage,
+			TranslatedText: translation.TranslatedText,
+		})
+	}
+
+	resp, _ := json.Marshal(results)
+	w.Write(resp)
+}
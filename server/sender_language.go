@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	senderLanguageKeyPrefix = "sender_lang_"
+
+	// senderLanguageTTL is how long, in seconds, a remembered sender language is trusted.
+	senderLanguageTTL = 14 * 24 * 60 * 60
+)
+
+// rememberSenderLanguage stores the source language a user explicitly chose when manually
+// translating a post. Readers often pick the wrong language, so a language chosen by another
+// user than the sender is only remembered when language detection agrees with it.
+func (p *Plugin) rememberSenderLanguage(requestID, userID string, post *model.Post, language string) {
+	if language == autoLanguage || languageCodes[language] == "" {
+		return
+	}
+
+	senderID := post.UserId
+	if userID != senderID {
+		detected, _, err := p.detectLanguageWithConfidence(requestID, post.Message)
+		if err != nil || detected != language {
+			return
+		}
+	}
+
+	if appErr := p.API.KVSetWithExpiry(senderLanguageKeyPrefix+senderID, []byte(language), senderLanguageTTL); appErr != nil {
+		p.API.LogWarn("Failed to remember sender language", "sender_id", senderID, "err", appErr.Error())
+	}
+}
+
+// getSenderLanguage returns the remembered language of a sender, if any.
+func (p *Plugin) getSenderLanguage(senderID string) string {
+	value, appErr := p.API.KVGet(senderLanguageKeyPrefix + senderID)
+	if appErr != nil || value == nil {
+		return ""
+	}
+
+	return string(value)
+}
+
+// resolveSourceLanguage returns the language of a message written by the sender, using the
+// remembered sender language when there is one and language detection otherwise.
+func (p *Plugin) resolveSourceLanguage(requestID, senderID, text string) (string, error) {
+	language, _, err := p.resolveSourceLanguageWithConfidence(requestID, senderID, text)
+	return language, err
+}
+
+// resolveSourceLanguageWithConfidence is resolveSourceLanguage also returning the confidence,
+// which is 1 for a language chosen explicitly by a user.
+func (p *Plugin) resolveSourceLanguageWithConfidence(requestID, senderID, text string) (string, float64, error) {
+	if language := p.getSenderLanguage(senderID); language != "" {
+		return language, 1, nil
+	}
+
+	return p.detectLanguageWithConfidence(requestID, text)
+}
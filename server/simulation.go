@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// simulationRequest is a message a System Admin wants to see processed as if the user posted
+// it in the channel.
+type simulationRequest struct {
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	Message   string `json:"message"`
+	// Translate calls the providers for the output, which is billed like any translation.
+	// Otherwise the output is previewed with the original text in place of the translation.
+	Translate bool `json:"translate"`
+}
+
+// simulationStep is a check of the processing of new posts and its result.
+type simulationStep struct {
+	Check  string `json:"check"`
+	Result string `json:"result"`
+}
+
+// simulationOutput is what the post would look like, or what would be delivered separately.
+type simulationOutput struct {
+	Message  string                 `json:"message"`
+	Props    map[string]interface{} `json:"props,omitempty"`
+	Delivery string                 `json:"delivery,omitempty"`
+	Provider string                 `json:"provider,omitempty"`
+	Review   string                 `json:"review,omitempty"`
+}
+
+// simulation describes how a message would be processed by MessageWillBePosted, without
+// posting, delivering or recording anything.
+type simulation struct {
+	Steps          []*simulationStep `json:"steps"`
+	Skipped        bool              `json:"skipped"`
+	Reason         string            `json:"reason,omitempty"`
+	SourceLanguage string            `json:"source_language,omitempty"`
+	TargetLanguage string            `json:"target_language,omitempty"`
+	Detected       bool              `json:"detected,omitempty"`
+	Providers      []string          `json:"providers,omitempty"`
+	Domain         string            `json:"domain,omitempty"`
+	Glossary       []glossaryTerm    `json:"glossary,omitempty"`
+	DisplayMode    string            `json:"display_mode,omitempty"`
+	LearningMode   string            `json:"learning_mode,omitempty"`
+	Output         *simulationOutput `json:"output,omitempty"`
+}
+
+func (s *simulation) step(check, result string) {
+	s.Steps = append(s.Steps, &simulationStep{Check: check, Result: result})
+}
+
+func (s *simulation) skip(check, reason string) *simulation {
+	s.step(check, "skipped: "+reason)
+	s.Skipped = true
+	s.Reason = reason
+	return s
+}
+
+// simulateNewPost walks through the checks of translateNewPost for the message. Posting hints,
+// consuming skip requests and learning channel languages are left out, so that the simulation
+// changes nothing.
+func (p *Plugin) simulateNewPost(request *simulationRequest) *simulation {
+	s := &simulation{}
+	configuration := p.getConfiguration()
+	post := &model.Post{UserId: request.UserID, ChannelId: request.ChannelID, Message: request.Message}
+
+	userInfo := p.getCachedUserInfo(request.UserID)
+	activated := userInfo != nil && userInfo.Activated
+	s.step("author", fmt.Sprintf("auto-translation on: %t", activated))
+	if activated && !isInRollout(request.UserID, configuration.getRolloutPercentage()) {
+		activated = false
+		s.step("rollout", fmt.Sprintf("the author is not among the %d%% of users auto-translation is rolled out to", configuration.getRolloutPercentage()))
+	}
+
+	if err := p.IsValid(); err != nil {
+		return s.skip("configuration", "the plugin is not configured: "+err.Error())
+	}
+	if p.isWatchdogTripped() {
+		return s.skip("watchdog", "auto-translation was turned off after repeated crashes")
+	}
+	if p.isAutoTranslationSuspended() {
+		return s.skip("usage", "auto-translation is suspended for the month")
+	}
+	if p.isOverUserQuota(request.UserID) {
+		return s.skip("usage", "the author is over their quota")
+	}
+
+	if post.UserId == p.botUserID {
+		return s.skip("translations", "posts of the bot are never translated")
+	}
+	if configuration.containsBanner(configuration.translatableText(post.Message)) {
+		return s.skip("translations", "the message contains a translation banner")
+	}
+
+	if p.stripSkipMarker(post) {
+		return s.skip("skip", "the message starts with the skip marker")
+	}
+	if value, appErr := p.API.KVGet(skipNextKeyPrefix + request.UserID); activated && appErr == nil && value != nil {
+		return s.skip("skip", "the author asked to skip their next message")
+	}
+
+	if p.isPrivateMessageExcluded(post.ChannelId) {
+		return s.skip("private messages", "direct and group messages are not sent to translation services")
+	}
+
+	directive := stripLanguageDirective(post)
+	if directive != nil {
+		s.step("directive", fmt.Sprintf("source %q, target %q", directive.SourceLanguage, directive.TargetLanguage))
+	}
+
+	pushTarget := p.pushTargetLanguage(post)
+	if pushTarget != "" {
+		s.step("push notifications", "translated into the language of the recipient: "+pushTarget)
+	}
+	if !activated && pushTarget == "" && directive == nil {
+		return s.skip("author", "the author has not turned auto-translation on")
+	}
+
+	if configuration.isDetectOnly() {
+		return s.skip("translation mode", "only the language of the message is labelled")
+	}
+	if p.isOverChannelCap(post.ChannelId) {
+		return s.skip("channel cap", "the channel reached its monthly cap, only the language of the message is labelled")
+	}
+
+	sourceLang := autoLanguage
+	targetLang := pushTarget
+	if activated {
+		sourceLang = userInfo.SourceLanguage
+		if targetLang == "" {
+			targetLang = userInfo.TargetLanguage
+		}
+	}
+	if directive != nil {
+		activated = true
+		if directive.SourceLanguage != "" {
+			sourceLang = directive.SourceLanguage
+		}
+		if directive.TargetLanguage != "" {
+			targetLang = directive.TargetLanguage
+		}
+	}
+	if targetLang == "" {
+		return s.skip("languages", "no target language")
+	}
+	s.TargetLanguage = targetLang
+
+	newText, quoted := splitQuotes(post.Message)
+	original := post.Message
+	if configuration.translatesQuotes() {
+		quoted = nil
+	} else if len(quoted) > 0 {
+		if newText == "" {
+			return s.skip("quotes", "the message only quotes earlier messages")
+		}
+		original = newText
+		s.step("quotes", "quoted lines are left untranslated")
+	}
+
+	requestID := newRequestID()
+	details := bannerDetails{}
+	if sourceLang == autoLanguage {
+		language, confidence, err := p.simulateDetection(requestID, post.ChannelId, request.UserID, original)
+		if err != nil {
+			return s.skip("detection", "the language could not be detected: "+err.Error())
+		}
+		sourceLang = language
+		details.Confidence = confidence
+		details.Detected = true
+		s.Detected = true
+		s.step("detection", fmt.Sprintf("%s with a confidence of %.2f", language, confidence))
+	}
+	s.SourceLanguage = sourceLang
+
+	if sourceLang == targetLang {
+		return s.skip("languages", "the message is already in the target language")
+	}
+	if language := p.blockedLanguage(original, sourceLang); language != "" {
+		return s.skip("blocked languages", "messages in "+languageName(language)+" are never sent")
+	}
+	if !configuration.getAllowedPairs().allows(sourceLang, targetLang) {
+		return s.skip("language pairs", "the language pair is not allowed")
+	}
+	if configuration.SkipBilingualMessages && p.isBilingual(requestID, original, sourceLang, targetLang) {
+		return s.skip("bilingual messages", "the message is already written in both languages")
+	}
+	if userInfo != nil && userInfo.PreCorrect {
+		s.step("pre-correction", "typos are corrected before translation")
+	}
+
+	preferred := p.preferredProvider(userInfo)
+	for _, provider := range p.rankProviders(requestID, preferred, sourceLang, targetLang) {
+		name := provider.Name()
+		if p.providerThrottledFor(name) > 0 {
+			name += " (throttled)"
+		}
+		s.Providers = append(s.Providers, name)
+	}
+	s.step("providers", strings.Join(s.Providers, ", "))
+
+	s.Domain = p.getChannelDomain(post.ChannelId)
+	s.Glossary = p.getChannelGlossary(post.ChannelId, sourceLang, targetLang)
+	s.step("glossary", fmt.Sprintf("%d terms of the channel, team and domain glossaries", len(s.Glossary)))
+
+	s.DisplayMode = displayModeAppend
+	if pushTarget == "" {
+		s.DisplayMode = userInfo.getDisplayMode()
+	}
+	s.LearningMode = p.getLearningMode(post.ChannelId)
+	s.step("display", fmt.Sprintf("display mode %s, learning mode %s", s.DisplayMode, s.LearningMode))
+
+	output := &simulationOutput{}
+	translatedText := original
+	if request.Translate {
+		defer p.useGlossary(requestID, post.ChannelId)()
+
+		translated, provider, appErr := p.translateWithProviders(requestID, preferred, original, sourceLang, targetLang, nil)
+		if appErr != nil {
+			return s.skip("translation", "the translation failed: "+appErr.Id)
+		}
+		if translated == original {
+			return s.skip("translation", "the translation is the original message")
+		}
+		translatedText = translated
+		output.Provider = provider
+		details.Provider = provider
+	}
+
+	flagged := false
+	if gate := configuration.ProfanityGate; gate != "" && gate != profanityGateOff {
+		if introduced := introducedProfanity(configuration.getProfanityWords(), post.Message, translatedText); len(introduced) > 0 {
+			if gate == profanityGateHold {
+				return s.skip("profanity", "the translation would introduce offensive words")
+			}
+			translatedText = maskProfanity(translatedText, introduced)
+			flagged = true
+			s.step("profanity", "offensive words introduced by the translation are masked")
+		}
+	}
+
+	details.SourceLanguage = sourceLang
+	details.TargetLanguage = targetLang
+	if request.Translate && s.LearningMode != learningModeOff {
+		if block, ok := p.renderLearningBlock(requestID, s.LearningMode, original, translatedText); ok {
+			translatedText = block
+		}
+	}
+	if link := p.quotedTranslationLink(post, quoted); link != "" {
+		translatedText += "\n" + link
+	}
+
+	banner := configuration.renderBanner(details)
+	switch s.DisplayMode {
+	case displayModePropsToggle:
+		output.Message = post.Message
+		output.Props = map[string]interface{}{propTranslation: translatedText, propTranslationBanner: banner}
+	case displayModeEphemeral, displayModeThreadReply, displayModeDM:
+		output.Message = post.Message
+		output.Delivery = fmt.Sprintf("%s\n%s", banner, translatedText)
+	default:
+		output.Message = fmt.Sprintf("%s\n\n%s\n%s", post.Message, banner, translatedText)
+	}
+	output.Review = p.reviewReason(s.DisplayMode, details, flagged)
+	s.Output = output
+
+	return s
+}
+
+// simulateDetection is resolveNewPostLanguage without recording the detected language in the
+// profile of the channel.
+func (p *Plugin) simulateDetection(requestID, channelID, senderID, text string) (string, float64, error) {
+	if !p.getConfiguration().ChannelLanguagePrior {
+		return p.resolveSourceLanguageWithConfidence(requestID, senderID, text)
+	}
+
+	if language := p.getSenderLanguage(senderID); language != "" {
+		return language, 1, nil
+	}
+	if language, share, ok := p.getChannelProfile(channelID).guess(textScript(text)); ok {
+		return language, share, nil
+	}
+
+	return p.detectLanguageWithConfidence(requestID, text)
+}
+
+// handleSimulation shows System Admins how a message of a user would be processed, for support.
+func (p *Plugin) handleSimulation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to simulate translations", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request simulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Message) == "" {
+		http.Error(w, "Invalid parameter: message", http.StatusBadRequest)
+		return
+	}
+	if _, appErr := p.API.GetUser(request.UserID); appErr != nil {
+		http.Error(w, "Invalid parameter: user_id", http.StatusBadRequest)
+		return
+	}
+	if _, appErr := p.API.GetChannel(request.ChannelID); appErr != nil {
+		http.Error(w, "Invalid parameter: channel_id", http.StatusBadRequest)
+		return
+	}
+
+	resp, _ := json.Marshal(p.simulateNewPost(&request))
+	w.Write(resp)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	defaultSkipMarker = "!nt"
+
+	skipNextKeyPrefix = "skip_next_"
+
+	// skipNextTTL is how long, in seconds, /autotranslate skip waits for the next message.
+	skipNextTTL = 10 * 60
+)
+
+// getSkipMarker returns the token that, at the start of a message, suppresses its translation.
+func (c *configuration) getSkipMarker() string {
+	if marker := strings.TrimSpace(c.SkipMarker); marker != "" {
+		return marker
+	}
+
+	return defaultSkipMarker
+}
+
+// stripSkipMarker removes the skip marker from the start of the message and reports whether it
+// was there.
+func (p *Plugin) stripSkipMarker(post *model.Post) bool {
+	marker := p.getConfiguration().getSkipMarker()
+
+	message := strings.TrimLeft(post.Message, " \t")
+	if message != marker && !strings.HasPrefix(message, marker+" ") && !strings.HasPrefix(message, marker+"\n") {
+		return false
+	}
+
+	post.Message = strings.TrimLeft(strings.TrimPrefix(message, marker), " \t\n")
+	return true
+}
+
+// skipNextMessage suppresses the auto-translation of the next message of the user.
+func (p *Plugin) skipNextMessage(userID string) error {
+	if appErr := p.API.KVSetWithExpiry(skipNextKeyPrefix+userID, []byte("1"), skipNextTTL); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+// consumeSkipNext reports whether the user asked to skip the translation of this message, and
+// clears the request.
+func (p *Plugin) consumeSkipNext(userID string) bool {
+	value, appErr := p.API.KVGet(skipNextKeyPrefix + userID)
+	if appErr != nil || value == nil {
+		return false
+	}
+
+	if appErr := p.API.KVDelete(skipNextKeyPrefix + userID); appErr != nil {
+		p.API.LogWarn("Failed to clear skip request", "user_id", userID, "err", appErr.Error())
+	}
+
+	return true
+}
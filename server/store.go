@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+// store persists the data of the plugin: user settings, usage counters, the settings audit,
+// glossaries and the caches of detected post languages and of translations. The KV store of the
+// plugin is the default backend. Data private to a single feature, like profiles or learning
+// mode, still uses the KV store directly.
+type store interface {
+	// GetUserInfo returns the info of the user, or nil when the user has none.
+	GetUserInfo(userID string) (*UserInfo, error)
+	SaveUserInfo(userInfo *UserInfo) error
+
+	// IncrementUsage atomically adds characters to the usage of the month and returns the new
+	// total.
+	IncrementUsage(month string, characters int64) (int64, error)
+
+	// GetUserUsage returns the usage of the user in the month, empty when there is none.
+	GetUserUsage(userID, month string) (*userUsage, error)
+	// AddUserUsage atomically adds characters translated for a language pair to the usage of
+	// the user in the month.
+	AddUserUsage(userID, month, pair string, characters int64) error
+	// ForEachUserUsage calls fn with the usage of every user and month, until fn fails.
+	ForEachUserUsage(fn func(userID, month string, usage *userUsage) error) error
+	// DeleteUsageBefore deletes the usage counters, of the server and of users, and the counts
+	// of zero-retention calls of the months before the month.
+	DeleteUsageBefore(month string) error
+
+	// AddZeroRetentionCalls atomically adds calls made to the provider in zero-retention mode
+	// to the count of the day.
+	AddZeroRetentionCalls(day, provider string, calls int64) error
+	// ForEachZeroRetentionCount calls fn with the count of every day and provider, until fn
+	// fails.
+	ForEachZeroRetentionCount(fn func(day, provider string, calls int64) error) error
+
+	// GetSettingsAudit returns the recorded changes of the settings of a subject, oldest first.
+	GetSettingsAudit(subjectID string) ([]settingsChange, error)
+	// AppendSettingsChange atomically records a change, keeping the latest max changes of its
+	// subject.
+	AppendSettingsChange(change settingsChange, max int) error
+	// ForEachSettingsAudit calls fn with the recorded changes of every subject, until fn fails.
+	ForEachSettingsAudit(fn func(changes []settingsChange) error) error
+	// DeleteSettingsChangesBefore deletes the changes recorded before the time, in
+	// milliseconds.
+	DeleteSettingsChangesBefore(createAt int64) error
+
+	// GetPostLanguage returns the cached language of the post, or nil when it is not cached.
+	GetPostLanguage(postID string) (*postLanguage, error)
+	SavePostLanguage(detected *postLanguage) error
+
+	// GetGlossary returns the terms of the glossary of a team, channel or domain.
+	GetGlossary(scope, id string) ([]glossaryTerm, error)
+	// SaveGlossary replaces the terms of a glossary, deleting it when there are none left.
+	SaveGlossary(scope, id string, terms []glossaryTerm) error
+	// ForEachGlossary calls fn with the terms of every glossary, until fn fails.
+	ForEachGlossary(fn func(scope, id string, terms []glossaryTerm) error) error
+
+	// GetCachedTranslation returns the cached translation of the post between the languages,
+	// or nil when it is not cached. Translations encrypted with a previous key fail to be read.
+	GetCachedTranslation(postID, source, target string) (*cachedTranslation, error)
+	// SaveCachedTranslation caches the translation of the post for ttl seconds.
+	SaveCachedTranslation(postID, source, target string, translation *cachedTranslation, ttl int64) error
+	// DeleteCachedTranslationsBefore deletes the translations cached before the time, in
+	// milliseconds, along with those that can no longer be read, and returns how many were
+	// deleted.
+	DeleteCachedTranslationsBefore(cachedAt int64) (int, error)
+}
+
+// kvStore is the store backed by the KV store of the plugin.
+type kvStore struct {
+	api     plugin.API
+	helpers plugin.Helpers
+	// atRest encrypts the settings audit and the cached translations.
+	atRest *atRestCipher
+}
+
+func newKVStore(api plugin.API, helpers plugin.Helpers, atRest *atRestCipher) *kvStore {
+	return &kvStore{
+		api:     api,
+		helpers: helpers,
+		atRest:  atRest,
+	}
+}
+
+// openStore opens the store configured by the System Admin, the KV store unless a PostgreSQL
+// data source is set.
+func (p *Plugin) openStore() error {
+	kv := newKVStore(p.API, p.Helpers, &p.atRest)
+
+	dataSource := p.getConfiguration().StoreDataSource
+	if dataSource == "" {
+		p.store = kv
+		return nil
+	}
+
+	sqlStore, err := newSQLStore(kv, dataSource)
+	if err != nil {
+		return err
+	}
+
+	p.store = sqlStore
+	return nil
+}
+
+// forEachKVKey calls fn with every key of the KV store starting with the prefix, until fn fails.
+func forEachKVKey(api plugin.API, prefix string, fn func(key string) error) error {
+	for page := 0; ; page++ {
+		keys, appErr := api.KVList(page, kvListPerPage)
+		if appErr != nil {
+			return appErr
+		}
+
+		for _, key := range keys {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < kvListPerPage {
+			return nil
+		}
+	}
+}
+
+func (s *kvStore) GetUserInfo(userID string) (*UserInfo, error) {
+	infoBytes, appErr := s.api.KVGet(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if infoBytes == nil {
+		return nil, nil
+	}
+
+	var userInfo UserInfo
+	if err := json.Unmarshal(infoBytes, &userInfo); err != nil {
+		return nil, err
+	}
+
+	return &userInfo, nil
+}
+
+func (s *kvStore) SaveUserInfo(userInfo *UserInfo) error {
+	jsonUserInfo, err := json.Marshal(userInfo)
+	if err != nil {
+		return err
+	}
+
+	if appErr := s.api.KVSet(userInfo.UserID, jsonUserInfo); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+func (s *kvStore) IncrementUsage(month string, characters int64) (int64, error) {
+	key := usageKeyPrefix + month
+	for {
+		var old *monthlyUsage
+		if _, err := s.helpers.KVGetJSON(key, &old); err != nil {
+			return 0, err
+		}
+
+		updated := &monthlyUsage{Characters: characters}
+		var oldValue interface{}
+		if old != nil {
+			updated.Characters += old.Characters
+			oldValue = old
+		}
+
+		saved, err := s.helpers.KVCompareAndSetJSON(key, oldValue, updated)
+		if err != nil {
+			return 0, err
+		}
+
+		if saved {
+			return updated.Characters, nil
+		}
+	}
+}
+
+func userUsageKey(userID, month string) string {
+	return userUsageKeyPrefix + month + "_" + userID
+}
+
+func (s *kvStore) GetUserUsage(userID, month string) (*userUsage, error) {
+	usage := &userUsage{}
+	if _, err := s.helpers.KVGetJSON(userUsageKey(userID, month), usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+func (s *kvStore) AddUserUsage(userID, month, pair string, characters int64) error {
+	key := userUsageKey(userID, month)
+	for {
+		var old *userUsage
+		if _, err := s.helpers.KVGetJSON(key, &old); err != nil {
+			return err
+		}
+
+		updated := &userUsage{Pairs: map[string]int64{}}
+		var oldValue interface{}
+		if old != nil {
+			updated.Characters = old.Characters
+			for oldPair, count := range old.Pairs {
+				updated.Pairs[oldPair] = count
+			}
+			oldValue = old
+		}
+		updated.Characters += characters
+		updated.Pairs[pair] += characters
+
+		saved, err := s.helpers.KVCompareAndSetJSON(key, oldValue, updated)
+		if err != nil {
+			return err
+		}
+
+		if saved {
+			return nil
+		}
+	}
+}
+
+func (s *kvStore) ForEachUserUsage(fn func(userID, month string, usage *userUsage) error) error {
+	return forEachKVKey(s.api, userUsageKeyPrefix, func(key string) error {
+		// Keys are user_usage_<month>_<user ID>.
+		parts := strings.SplitN(strings.TrimPrefix(key, userUsageKeyPrefix), "_", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+
+		usage, err := s.GetUserUsage(parts[1], parts[0])
+		if err != nil {
+			return err
+		}
+
+		return fn(parts[1], parts[0], usage)
+	})
+}
+
+func (s *kvStore) DeleteUsageBefore(month string) error {
+	var keys []string
+	err := forEachKVKey(s.api, "", func(key string) error {
+		switch {
+		case strings.HasPrefix(key, usageKeyPrefix):
+			if keyMonth := strings.TrimPrefix(key, usageKeyPrefix); len(keyMonth) == len(usageMonthFmt) && keyMonth < month {
+				keys = append(keys, key)
+			}
+		case strings.HasPrefix(key, userUsageKeyPrefix):
+			// Keys are user_usage_<month>_<user ID>.
+			if keyMonth := strings.SplitN(strings.TrimPrefix(key, userUsageKeyPrefix), "_", 2)[0]; keyMonth < month {
+				keys = append(keys, key)
+			}
+		case strings.HasPrefix(key, zeroRetentionKeyPrefix):
+			// Keys are zero_retention_<day>_<provider>, days of the month sorting after it.
+			if keyDay := strings.SplitN(strings.TrimPrefix(key, zeroRetentionKeyPrefix), "_", 2)[0]; keyDay < month {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if appErr := s.api.KVDelete(key); appErr != nil {
+			return appErr
+		}
+	}
+
+	return nil
+}
+
+// zeroRetentionCount is the number of calls made to a provider in zero-retention mode in a day.
+type zeroRetentionCount struct {
+	Calls int64 `json:"calls"`
+}
+
+func (s *kvStore) AddZeroRetentionCalls(day, provider string, calls int64) error {
+	key := zeroRetentionKeyPrefix + day + "_" + provider
+	for {
+		var old *zeroRetentionCount
+		if _, err := s.helpers.KVGetJSON(key, &old); err != nil {
+			return err
+		}
+
+		updated := &zeroRetentionCount{Calls: calls}
+		var oldValue interface{}
+		if old != nil {
+			updated.Calls += old.Calls
+			oldValue = old
+		}
+
+		saved, err := s.helpers.KVCompareAndSetJSON(key, oldValue, updated)
+		if err != nil {
+			return err
+		}
+
+		if saved {
+			return nil
+		}
+	}
+}
+
+func (s *kvStore) ForEachZeroRetentionCount(fn func(day, provider string, calls int64) error) error {
+	return forEachKVKey(s.api, zeroRetentionKeyPrefix, func(key string) error {
+		// Keys are zero_retention_<day>_<provider>.
+		parts := strings.SplitN(strings.TrimPrefix(key, zeroRetentionKeyPrefix), "_", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+
+		var count *zeroRetentionCount
+		if _, err := s.helpers.KVGetJSON(key, &count); err != nil {
+			return err
+		}
+		if count == nil {
+			return nil
+		}
+
+		return fn(parts[0], parts[1], count.Calls)
+	})
+}
+
+func (s *kvStore) GetSettingsAudit(subjectID string) ([]settingsChange, error) {
+	changes, oldValue, err := s.getSettingsAudit(settingsAuditKeyPrefix + subjectID)
+	if isUnreadableAudit(oldValue, err) {
+		return nil, nil
+	}
+
+	return changes, err
+}
+
+// getSettingsAudit returns the changes under the key along with the value they were read from,
+// which compare-and-set operations need as encrypted values are not reproducible.
+func (s *kvStore) getSettingsAudit(key string) ([]settingsChange, []byte, error) {
+	value, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if value == nil {
+		return nil, nil, nil
+	}
+
+	var changes []settingsChange
+	if err := s.atRest.openJSON(value, &changes); err != nil {
+		return nil, value, err
+	}
+
+	return changes, value, nil
+}
+
+// isUnreadableAudit reports whether reading an audit failed because it was encrypted with a
+// previous key, and can no longer be read at all.
+func isUnreadableAudit(oldValue []byte, err error) bool {
+	return err != nil && err != errAtRestKeyUnavailable && oldValue != nil
+}
+
+// setSettingsAudit replaces the changes under the key if it still holds the old value.
+func (s *kvStore) setSettingsAudit(key string, old []byte, changes []settingsChange) (bool, error) {
+	value, err := s.atRest.sealJSON(changes)
+	if err != nil {
+		return false, err
+	}
+
+	saved, appErr := s.api.KVSetWithOptions(key, value, model.PluginKVSetOptions{
+		Atomic:   true,
+		OldValue: old,
+	})
+	if appErr != nil {
+		return false, appErr
+	}
+
+	return saved, nil
+}
+
+func (s *kvStore) AppendSettingsChange(change settingsChange, max int) error {
+	key := settingsAuditKeyPrefix + change.SubjectID
+	for {
+		old, oldValue, err := s.getSettingsAudit(key)
+		if err != nil && !isUnreadableAudit(oldValue, err) {
+			return err
+		}
+
+		// An audit encrypted with a previous key can no longer be read and starts over.
+		updated := append(append([]settingsChange{}, old...), change)
+		if len(updated) > max {
+			updated = updated[len(updated)-max:]
+		}
+
+		saved, err := s.setSettingsAudit(key, oldValue, updated)
+		if err != nil {
+			return err
+		}
+
+		if saved {
+			return nil
+		}
+	}
+}
+
+func (s *kvStore) ForEachSettingsAudit(fn func(changes []settingsChange) error) error {
+	return forEachKVKey(s.api, settingsAuditKeyPrefix, func(key string) error {
+		changes, oldValue, err := s.getSettingsAudit(key)
+		if isUnreadableAudit(oldValue, err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return fn(changes)
+	})
+}
+
+func (s *kvStore) DeleteSettingsChangesBefore(createAt int64) error {
+	var keys []string
+	if err := forEachKVKey(s.api, settingsAuditKeyPrefix, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		for {
+			old, oldValue, err := s.getSettingsAudit(key)
+			unreadable := isUnreadableAudit(oldValue, err)
+			if err != nil && !unreadable {
+				return err
+			}
+
+			// Audits that can no longer be read are deleted.
+			var kept []settingsChange
+			for _, change := range old {
+				if change.CreateAt >= createAt {
+					kept = append(kept, change)
+				}
+			}
+			if !unreadable && len(kept) == len(old) {
+				break
+			}
+
+			var saved bool
+			if len(kept) == 0 {
+				var appErr *model.AppError
+				if saved, appErr = s.api.KVCompareAndDelete(key, oldValue); appErr != nil {
+					return appErr
+				}
+			} else if saved, err = s.setSettingsAudit(key, oldValue, kept); err != nil {
+				return err
+			}
+			if saved {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *kvStore) GetPostLanguage(postID string) (*postLanguage, error) {
+	var cached *postLanguage
+	if _, err := s.helpers.KVGetJSON(postLanguageKeyPrefix+postID, &cached); err != nil {
+		return nil, err
+	}
+
+	return cached, nil
+}
+
+func (s *kvStore) SavePostLanguage(detected *postLanguage) error {
+	return s.helpers.KVSetWithExpiryJSON(postLanguageKeyPrefix+detected.PostID, detected, postLanguageTTL)
+}
+
+func glossaryKey(scope, id string) string {
+	return glossaryKeyPrefix + scope + "_" + id
+}
+
+func (s *kvStore) GetGlossary(scope, id string) ([]glossaryTerm, error) {
+	var terms []glossaryTerm
+	if _, err := s.helpers.KVGetJSON(glossaryKey(scope, id), &terms); err != nil {
+		return nil, err
+	}
+
+	return terms, nil
+}
+
+func (s *kvStore) SaveGlossary(scope, id string, terms []glossaryTerm) error {
+	if len(terms) == 0 {
+		if appErr := s.api.KVDelete(glossaryKey(scope, id)); appErr != nil {
+			return appErr
+		}
+		return nil
+	}
+
+	return s.helpers.KVSetJSON(glossaryKey(scope, id), terms)
+}
+
+func (s *kvStore) ForEachGlossary(fn func(scope, id string, terms []glossaryTerm) error) error {
+	return forEachKVKey(s.api, glossaryKeyPrefix, func(key string) error {
+		// Keys are glossary_<scope>_<ID>.
+		parts := strings.SplitN(strings.TrimPrefix(key, glossaryKeyPrefix), "_", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+
+		terms, err := s.GetGlossary(parts[0], parts[1])
+		if err != nil {
+			return err
+		}
+
+		return fn(parts[0], parts[1], terms)
+	})
+}
+
+func translationKey(postID, source, target string) string {
+	return translationKeyPrefix + postID + "_" + source + "_" + target
+}
+
+func (s *kvStore) GetCachedTranslation(postID, source, target string) (*cachedTranslation, error) {
+	return s.getCachedTranslation(translationKey(postID, source, target))
+}
+
+func (s *kvStore) getCachedTranslation(key string) (*cachedTranslation, error) {
+	value, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	var cached cachedTranslation
+	if err := s.atRest.openJSON(value, &cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+func (s *kvStore) SaveCachedTranslation(postID, source, target string, translation *cachedTranslation, ttl int64) error {
+	value, err := s.atRest.sealJSON(translation)
+	if err != nil {
+		return err
+	}
+
+	if _, appErr := s.api.KVSetWithOptions(translationKey(postID, source, target), value, model.PluginKVSetOptions{
+		ExpireInSeconds: ttl,
+	}); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+// DeleteCachedTranslationsBefore deletes translations the KV store would otherwise keep until
+// the expiry set when they were cached, with the retention period of that time.
+func (s *kvStore) DeleteCachedTranslationsBefore(cachedAt int64) (int, error) {
+	var keys []string
+	err := forEachKVKey(s.api, translationKeyPrefix, func(key string) error {
+		cached, err := s.getCachedTranslation(key)
+		if err == errAtRestKeyUnavailable {
+			return nil
+		}
+		if err != nil {
+			// Translations encrypted with a previous key can no longer be read.
+			keys = append(keys, key)
+			return nil
+		}
+		if cached == nil {
+			return nil
+		}
+
+		// Translations cached before their time was recorded expire with the default TTL.
+		if (cached.CachedAt == 0 && cachedAt > model.GetMillis()-translationTTL*1000) || (cached.CachedAt != 0 && cached.CachedAt < cachedAt) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if appErr := s.api.KVDelete(key); appErr != nil {
+			return 0, appErr
+		}
+	}
+
+	return len(keys), nil
+}
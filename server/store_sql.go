@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	// Registers the postgres driver of database/sql.
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const sqlStoreConnectTimeout = 10 * time.Second
+
+// sqlStoreSchema creates the tables of the store when they do not exist yet.
+var sqlStoreSchema = []string{
+	`CREATE TABLE IF NOT EXISTS autotranslate_usage (
+		month VARCHAR(7) PRIMARY KEY,
+		characters BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS autotranslate_user_usage (
+		user_id VARCHAR(26) NOT NULL,
+		month VARCHAR(7) NOT NULL,
+		pair VARCHAR(64) NOT NULL,
+		characters BIGINT NOT NULL,
+		PRIMARY KEY (user_id, month, pair)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_autotranslate_user_usage_month ON autotranslate_user_usage (month)`,
+	`CREATE TABLE IF NOT EXISTS autotranslate_zero_retention (
+		day VARCHAR(10) NOT NULL,
+		provider VARCHAR(32) NOT NULL,
+		calls BIGINT NOT NULL,
+		PRIMARY KEY (day, provider)
+	)`,
+	`CREATE TABLE IF NOT EXISTS autotranslate_settings_audit (
+		id BIGSERIAL PRIMARY KEY,
+		subject_id VARCHAR(26) NOT NULL,
+		kind VARCHAR(64) NOT NULL,
+		actor_id VARCHAR(26) NOT NULL,
+		before_value TEXT NOT NULL,
+		after_value TEXT NOT NULL,
+		create_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_autotranslate_settings_audit_subject ON autotranslate_settings_audit (subject_id, id)`,
+	`ALTER TABLE autotranslate_settings_audit ADD COLUMN IF NOT EXISTS request_id VARCHAR(26) NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS autotranslate_post_languages (
+		post_id VARCHAR(26) PRIMARY KEY,
+		language VARCHAR(16) NOT NULL,
+		confidence DOUBLE PRECISION NOT NULL,
+		update_at BIGINT NOT NULL,
+		expire_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_autotranslate_post_languages_expire ON autotranslate_post_languages (expire_at)`,
+	`CREATE TABLE IF NOT EXISTS autotranslate_translations (
+		post_id VARCHAR(26) NOT NULL,
+		source_lang VARCHAR(16) NOT NULL,
+		target_lang VARCHAR(16) NOT NULL,
+		translation TEXT NOT NULL,
+		cached_at BIGINT NOT NULL,
+		expire_at BIGINT NOT NULL,
+		PRIMARY KEY (post_id, source_lang, target_lang)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_autotranslate_translations_expire ON autotranslate_translations (expire_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_autotranslate_translations_cached ON autotranslate_translations (cached_at)`,
+}
+
+// sqlStore keeps usage counters, counts of zero-retention calls, the settings audit, detected post languages and cached
+// translations in a PostgreSQL database, where reports are queries instead of scans of every KV
+// key. User settings and glossaries are read on each post and stay in the KV store. Values of the audit and
+// translations are encrypted at rest like in the KV store.
+type sqlStore struct {
+	*kvStore
+	db *sql.DB
+}
+
+// newSQLStore connects to the database and creates the missing tables.
+func newSQLStore(kv *kvStore, dataSource string) (*sqlStore, error) {
+	db, err := sql.Open("postgres", dataSource)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	if err := migrateSQLStore(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{
+		kvStore: kv,
+		db:      db,
+	}, nil
+}
+
+func migrateSQLStore(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlStoreConnectTimeout)
+	defer cancel()
+
+	for _, statement := range sqlStoreSchema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return errors.Wrap(err, "failed to create tables")
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connections to the database.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) IncrementUsage(month string, characters int64) (int64, error) {
+	var total int64
+	err := s.db.QueryRow(`INSERT INTO autotranslate_usage (month, characters) VALUES ($1, $2)
+		ON CONFLICT (month) DO UPDATE SET characters = autotranslate_usage.characters + EXCLUDED.characters
+		RETURNING characters`, month, characters).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (s *sqlStore) GetUserUsage(userID, month string) (*userUsage, error) {
+	rows, err := s.db.Query(`SELECT pair, characters FROM autotranslate_user_usage
+		WHERE user_id = $1 AND month = $2`, userID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &userUsage{Pairs: map[string]int64{}}
+	for rows.Next() {
+		var pair string
+		var characters int64
+		if err := rows.Scan(&pair, &characters); err != nil {
+			return nil, err
+		}
+		usage.Pairs[pair] = characters
+		usage.Characters += characters
+	}
+
+	return usage, rows.Err()
+}
+
+func (s *sqlStore) AddUserUsage(userID, month, pair string, characters int64) error {
+	_, err := s.db.Exec(`INSERT INTO autotranslate_user_usage (user_id, month, pair, characters) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, month, pair) DO UPDATE SET characters = autotranslate_user_usage.characters + EXCLUDED.characters`,
+		userID, month, pair, characters)
+	return err
+}
+
+func (s *sqlStore) ForEachUserUsage(fn func(userID, month string, usage *userUsage) error) error {
+	rows, err := s.db.Query(`SELECT user_id, month, pair, characters FROM autotranslate_user_usage
+		ORDER BY month, user_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var userID, month string
+	var usage *userUsage
+	for rows.Next() {
+		var rowUserID, rowMonth, pair string
+		var characters int64
+		if err := rows.Scan(&rowUserID, &rowMonth, &pair, &characters); err != nil {
+			return err
+		}
+
+		if usage != nil && (rowUserID != userID || rowMonth != month) {
+			if err := fn(userID, month, usage); err != nil {
+				return err
+			}
+			usage = nil
+		}
+
+		if usage == nil {
+			userID, month = rowUserID, rowMonth
+			usage = &userUsage{Pairs: map[string]int64{}}
+		}
+		usage.Pairs[pair] = characters
+		usage.Characters += characters
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if usage != nil {
+		return fn(userID, month, usage)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) GetSettingsAudit(subjectID string) ([]settingsChange, error) {
+	rows, err := s.db.Query(`SELECT kind, subject_id, actor_id, request_id, before_value, after_value, create_at
+		FROM autotranslate_settings_audit WHERE subject_id = $1 ORDER BY id`, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []settingsChange
+	for rows.Next() {
+		change, err := s.scanSettingsChange(rows)
+		if isUnreadableAudit(change.Before, err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+func (s *sqlStore) AppendSettingsChange(change settingsChange, max int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := s.sealColumn(change.Before)
+	if err != nil {
+		return err
+	}
+	after, err := s.sealColumn(change.After)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO autotranslate_settings_audit (subject_id, kind, actor_id, request_id, before_value, after_value, create_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		change.SubjectID, change.Kind, change.ActorID, change.RequestID, before, after, change.CreateAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM autotranslate_settings_audit WHERE subject_id = $1 AND id NOT IN (
+		SELECT id FROM autotranslate_settings_audit WHERE subject_id = $1 ORDER BY id DESC LIMIT $2)`,
+		change.SubjectID, max); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) ForEachSettingsAudit(fn func(changes []settingsChange) error) error {
+	rows, err := s.db.Query(`SELECT kind, subject_id, actor_id, request_id, before_value, after_value, create_at
+		FROM autotranslate_settings_audit ORDER BY subject_id, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var changes []settingsChange
+	for rows.Next() {
+		change, err := s.scanSettingsChange(rows)
+		if isUnreadableAudit(change.Before, err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(changes) > 0 && changes[0].SubjectID != change.SubjectID {
+			if err := fn(changes); err != nil {
+				return err
+			}
+			changes = nil
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		return fn(changes)
+	}
+
+	return nil
+}
+
+// scanSettingsChange reads a change of the audit. When its values fail to be decrypted, the
+// change is returned with its encrypted values along with the error.
+func (s *sqlStore) scanSettingsChange(rows *sql.Rows) (settingsChange, error) {
+	var change settingsChange
+	var before, after string
+	if err := rows.Scan(&change.Kind, &change.SubjectID, &change.ActorID, &change.RequestID, &before, &after, &change.CreateAt); err != nil {
+		return change, err
+	}
+
+	var err error
+	if change.Before, err = s.openColumn(before); err != nil {
+		change.Before, change.After = []byte(before), []byte(after)
+		return change, err
+	}
+	if change.After, err = s.openColumn(after); err != nil {
+		change.Before, change.After = []byte(before), []byte(after)
+		return change, err
+	}
+
+	return change, nil
+}
+
+// sealColumn encrypts a value for a text column, the encrypted bytes being base64 encoded
+// after the prefix of encrypted values.
+func (s *sqlStore) sealColumn(value []byte) (string, error) {
+	sealed, err := s.atRest.seal(value)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(sealed, atRestPrefix) {
+		return string(sealed), nil
+	}
+
+	return string(atRestPrefix) + base64.StdEncoding.EncodeToString(sealed[len(atRestPrefix):]), nil
+}
+
+// openColumn decrypts a value written by sealColumn, or returns it unchanged when it was
+// written in the clear.
+func (s *sqlStore) openColumn(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, string(atRestPrefix)) {
+		return []byte(value), nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value[len(atRestPrefix):])
+	if err != nil {
+		return nil, err
+	}
+
+	return s.atRest.open(append(append([]byte{}, atRestPrefix...), sealed...))
+}
+
+func (s *sqlStore) DeleteUsageBefore(month string) error {
+	if _, err := s.db.Exec(`DELETE FROM autotranslate_usage WHERE month < $1`, month); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM autotranslate_user_usage WHERE month < $1`, month); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`DELETE FROM autotranslate_zero_retention WHERE day < $1`, month)
+	return err
+}
+
+func (s *sqlStore) AddZeroRetentionCalls(day, provider string, calls int64) error {
+	_, err := s.db.Exec(`INSERT INTO autotranslate_zero_retention (day, provider, calls) VALUES ($1, $2, $3)
+		ON CONFLICT (day, provider) DO UPDATE SET calls = autotranslate_zero_retention.calls + EXCLUDED.calls`,
+		day, provider, calls)
+	return err
+}
+
+func (s *sqlStore) ForEachZeroRetentionCount(fn func(day, provider string, calls int64) error) error {
+	rows, err := s.db.Query(`SELECT day, provider, calls FROM autotranslate_zero_retention ORDER BY day, provider`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day, provider string
+		var calls int64
+		if err := rows.Scan(&day, &provider, &calls); err != nil {
+			return err
+		}
+		if err := fn(day, provider, calls); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *sqlStore) DeleteSettingsChangesBefore(createAt int64) error {
+	_, err := s.db.Exec(`DELETE FROM autotranslate_settings_audit WHERE create_at < $1`, createAt)
+	return err
+}
+
+func (s *sqlStore) GetPostLanguage(postID string) (*postLanguage, error) {
+	detected := &postLanguage{PostID: postID}
+	err := s.db.QueryRow(`SELECT language, confidence, update_at FROM autotranslate_post_languages
+		WHERE post_id = $1 AND expire_at > $2`, postID, time.Now().Unix()).
+		Scan(&detected.Language, &detected.Confidence, &detected.UpdateAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return detected, nil
+}
+
+func (s *sqlStore) SavePostLanguage(detected *postLanguage) error {
+	now := time.Now().Unix()
+	if _, err := s.db.Exec(`INSERT INTO autotranslate_post_languages (post_id, language, confidence, update_at, expire_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (post_id) DO UPDATE SET language = EXCLUDED.language, confidence = EXCLUDED.confidence,
+			update_at = EXCLUDED.update_at, expire_at = EXCLUDED.expire_at`,
+		detected.PostID, detected.Language, detected.Confidence, detected.UpdateAt, now+postLanguageTTL); err != nil {
+		return err
+	}
+
+	// The KV store expires keys by itself, here expired detections are removed as new ones come.
+	_, err := s.db.Exec(`DELETE FROM autotranslate_post_languages WHERE expire_at <= $1`, now)
+	return err
+}
+
+func (s *sqlStore) GetCachedTranslation(postID, source, target string) (*cachedTranslation, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT translation FROM autotranslate_translations
+		WHERE post_id = $1 AND source_lang = $2 AND target_lang = $3 AND expire_at > $4`,
+		postID, source, target, time.Now().Unix()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := s.openColumn(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedTranslation
+	if err := json.Unmarshal(opened, &cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+func (s *sqlStore) SaveCachedTranslation(postID, source, target string, translation *cachedTranslation, ttl int64) error {
+	encoded, err := json.Marshal(translation)
+	if err != nil {
+		return err
+	}
+	value, err := s.sealColumn(encoded)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	if _, err := s.db.Exec(`INSERT INTO autotranslate_translations (post_id, source_lang, target_lang, translation, cached_at, expire_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (post_id, source_lang, target_lang) DO UPDATE SET translation = EXCLUDED.translation,
+			cached_at = EXCLUDED.cached_at, expire_at = EXCLUDED.expire_at`,
+		postID, source, target, value, translation.CachedAt, now+ttl); err != nil {
+		return err
+	}
+
+	// The KV store expires keys by itself, here expired translations are removed as new ones come.
+	_, err = s.db.Exec(`DELETE FROM autotranslate_translations WHERE expire_at <= $1`, now)
+	return err
+}
+
+func (s *sqlStore) DeleteCachedTranslationsBefore(cachedAt int64) (int, error) {
+	result, err := s.db.Exec(`DELETE FROM autotranslate_translations WHERE cached_at < $1 OR expire_at <= $2`,
+		cachedAt, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Translations encrypted with a previous key can no longer be read.
+	rows, err := s.db.Query(`SELECT post_id, source_lang, target_lang, translation FROM autotranslate_translations
+		WHERE translation LIKE $1`, string(atRestPrefix)+"%")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type translationID struct{ postID, source, target string }
+	var unreadable []translationID
+	for rows.Next() {
+		var id translationID
+		var value string
+		if err := rows.Scan(&id.postID, &id.source, &id.target, &value); err != nil {
+			return 0, err
+		}
+		if _, err := s.openColumn(value); err != nil && err != errAtRestKeyUnavailable {
+			unreadable = append(unreadable, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range unreadable {
+		if _, err := s.db.Exec(`DELETE FROM autotranslate_translations WHERE post_id = $1 AND source_lang = $2 AND target_lang = $3`,
+			id.postID, id.source, id.target); err != nil {
+			return 0, err
+		}
+	}
+
+	return int(deleted) + len(unreadable), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"unicode/utf8"
+)
+
+const (
+	wsEventTranslationPartial = "translation_partial"
+
+	// minStreamedCharacters is the length from which translations by streaming providers are
+	// reported as they are produced. Shorter ones complete about as fast as a first report.
+	minStreamedCharacters = 500
+)
+
+// streamTranslation reports the partial translations made for the request to the user as
+// WebSocket events about the post, until the returned function is called.
+func (p *Plugin) streamTranslation(requestID, userID, postID, targetLang string) func() {
+	p.partialListeners.Store(requestID, func(text string) {
+		p.publishToUser(
+			wsEventTranslationPartial,
+			userID,
+			map[string]interface{}{
+				"request_id":      requestID,
+				"post_id":         postID,
+				"target_lang":     targetLang,
+				"translated_text": text,
+			},
+		)
+	})
+
+	return func() {
+		p.partialListeners.Delete(requestID)
+	}
+}
+
+// getPartialListener returns the function to report the partial translations of text made for
+// the request, or nil when nobody waits for them or the text is short.
+func (p *Plugin) getPartialListener(requestID, text string) func(string) {
+	if utf8.RuneCountInString(text) < minStreamedCharacters {
+		return nil
+	}
+
+	listener, ok := p.partialListeners.Load(requestID)
+	if !ok {
+		return nil
+	}
+
+	return listener.(func(string))
+}
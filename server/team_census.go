@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	teamCensusKeyPrefix = "team_census_"
+
+	// teamCensusTTL is how long, in seconds, the census of the languages of a team is cached.
+	teamCensusTTL = 24 * 60 * 60
+
+	teamCensusPageSize = 200
+	teamCensusMaxPages = 5
+)
+
+// teamLanguageCensus counts the reading languages of the members of a team.
+type teamLanguageCensus struct {
+	Languages map[string]int `json:"languages"`
+	Members   int            `json:"members"`
+}
+
+// dominant returns the language read by most members, or an empty string when none is known.
+func (c *teamLanguageCensus) dominant() string {
+	languages := make([]string, 0, len(c.Languages))
+	for language := range c.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	best := ""
+	for _, language := range languages {
+		if best == "" || c.Languages[language] > c.Languages[best] {
+			best = language
+		}
+	}
+
+	return best
+}
+
+// getTeamLanguageCensus returns the census of the reading languages of the members of a team,
+// counting the first thousand members. The result is cached since it reads the settings of
+// every member.
+func (p *Plugin) getTeamLanguageCensus(teamID string) *teamLanguageCensus {
+	census := &teamLanguageCensus{}
+	if ok, err := p.Helpers.KVGetJSON(teamCensusKeyPrefix+teamID, census); err == nil && ok {
+		return census
+	}
+
+	census.Languages = map[string]int{}
+	for page := 0; page < teamCensusMaxPages; page++ {
+		users, appErr := p.API.GetUsersInTeam(teamID, page, teamCensusPageSize)
+		if appErr != nil {
+			return census
+		}
+
+		for _, user := range users {
+			if user.IsBot || user.DeleteAt != 0 {
+				continue
+			}
+			census.Members++
+			if language := p.readingLanguage(user); language != "" {
+				census.Languages[language]++
+			}
+		}
+
+		if len(users) < teamCensusPageSize {
+			break
+		}
+	}
+
+	if err := p.Helpers.KVSetWithExpiryJSON(teamCensusKeyPrefix+teamID, census, teamCensusTTL); err != nil {
+		p.API.LogWarn("Failed to cache team language census", "team_id", teamID, "err", err.Error())
+	}
+
+	return census
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const teamSettingsKeyPrefix = "team_settings_"
+
+// teamSettings are the defaults a team admin sets for the members of a team. When Locked is
+// set, members cannot change their target language and display mode away from them.
+type teamSettings struct {
+	TargetLanguage string `json:"target_language,omitempty"`
+	DisplayMode    string `json:"display_mode,omitempty"`
+	Locked         bool   `json:"locked"`
+}
+
+// getTeamSettings returns the settings of a team, empty when none were set.
+func (p *Plugin) getTeamSettings(teamID string) *teamSettings {
+	settings := &teamSettings{}
+	if _, err := p.Helpers.KVGetJSON(teamSettingsKeyPrefix+teamID, settings); err != nil {
+		p.API.LogWarn("Failed to get team settings", "team_id", teamID, "err", err.Error())
+	}
+
+	return settings
+}
+
+// setTeamSettings saves the team settings changed by the actor, recording the change in the
+// settings audit.
+func (p *Plugin) setTeamSettings(requestID, actorID, teamID string, settings *teamSettings) error {
+	previous := p.getTeamSettings(teamID)
+
+	if err := p.Helpers.KVSetJSON(teamSettingsKeyPrefix+teamID, settings); err != nil {
+		return err
+	}
+
+	p.recordSettingsChange(requestID, actorID, settingsKindTeam, teamID, previous, settings)
+
+	return nil
+}
+
+// applyTeamDefaults sets the team defaults on user info being created.
+func (settings *teamSettings) applyTeamDefaults(userInfo *UserInfo) {
+	if settings.TargetLanguage != "" && settings.TargetLanguage != userInfo.SourceLanguage {
+		userInfo.TargetLanguage = settings.TargetLanguage
+	}
+
+	if settings.DisplayMode != "" {
+		userInfo.DisplayMode = settings.DisplayMode
+	}
+}
+
+// getLockedTeamSettings returns the settings of the first team of the user that locks them,
+// or nil when no team does.
+func (p *Plugin) getLockedTeamSettings(userID string) *teamSettings {
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return nil
+	}
+
+	for _, team := range teams {
+		if settings := p.getTeamSettings(team.Id); settings.Locked {
+			return settings
+		}
+	}
+
+	return nil
+}
+
+// violatesTeamLock reports whether the user info departs from the locked settings of a team
+// of the user.
+func (p *Plugin) violatesTeamLock(userInfo *UserInfo) bool {
+	settings := p.getLockedTeamSettings(userInfo.UserID)
+	if settings == nil {
+		return false
+	}
+
+	if settings.TargetLanguage != "" && userInfo.TargetLanguage != settings.TargetLanguage {
+		return true
+	}
+
+	return settings.DisplayMode != "" && userInfo.getDisplayMode() != settings.DisplayMode
+}
+
+// canManageTeam reports whether the user may change the settings of the team.
+func (p *Plugin) canManageTeam(userID, teamID string) bool {
+	return p.API.HasPermissionToTeam(userID, teamID, model.PERMISSION_MANAGE_TEAM)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	termCorrectionKeyPrefix = "term_fix_"
+
+	// termCorrectionTTL is how long, in seconds, the corrections of a term are counted after
+	// the last one.
+	termCorrectionTTL = 90 * 24 * 60 * 60
+
+	// termSuggestionThreshold is the number of corrections of the same term after which System
+	// Admins are suggested to add it to the glossary of the team.
+	termSuggestionThreshold = 3
+
+	// maxCorrectedTermWords is the number of words above which a change is not taken for the
+	// correction of a term.
+	maxCorrectedTermWords = 3
+
+	termSuggestionActionAdd     = "add"
+	termSuggestionActionDismiss = "dismiss"
+)
+
+// termCorrection counts the corrections replacing the same words of machine translations of a
+// language pair with the same other words.
+type termCorrection struct {
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	Replaced       string `json:"replaced"`
+	Replacement    string `json:"replacement"`
+	Count          int    `json:"count"`
+	TeamID         string `json:"team_id"`
+	Example        string `json:"example"`
+	Suggested      bool   `json:"suggested"`
+}
+
+func termCorrectionKey(sourceLang, targetLang, replaced, replacement string) string {
+	sum := sha256.Sum256([]byte(languagePair(sourceLang, targetLang) + "\n" + strings.ToLower(replaced) + "\n" + strings.ToLower(replacement)))
+	return termCorrectionKeyPrefix + hex.EncodeToString(sum[:])[:32]
+}
+
+// correctedTerm returns the words of the translation the correction replaced and the words
+// replacing them, when the correction changed a single term of a few words.
+func correctedTerm(translation, corrected string) (string, string, bool) {
+	before := strings.Fields(translation)
+	after := strings.Fields(corrected)
+
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix && before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+
+	replaced := before[prefix : len(before)-suffix]
+	replacement := after[prefix : len(after)-suffix]
+	if len(replaced) == 0 || len(replacement) == 0 || len(replaced) > maxCorrectedTermWords || len(replacement) > maxCorrectedTermWords {
+		return "", "", false
+	}
+
+	trim := func(words []string) string {
+		return strings.TrimFunc(strings.Join(words, " "), unicode.IsPunct)
+	}
+	if trim(replaced) == "" || trim(replacement) == "" || strings.EqualFold(trim(replaced), trim(replacement)) {
+		return "", "", false
+	}
+
+	return trim(replaced), trim(replacement), true
+}
+
+// recordCorrection counts the term a user corrected in a translation of a message of a team,
+// and suggests System Admins to add it to the glossary of the team once it was corrected the
+// same way several times.
+func (p *Plugin) recordCorrection(teamID, sourceLang, targetLang, original, translation, corrected string) {
+	replaced, replacement, ok := correctedTerm(translation, corrected)
+	if !ok || teamID == "" {
+		return
+	}
+
+	key := termCorrectionKey(sourceLang, targetLang, replaced, replacement)
+	for {
+		oldData, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get term corrections", "err", appErr.Error())
+			return
+		}
+
+		updated := &termCorrection{SourceLanguage: sourceLang, TargetLanguage: targetLang, Replaced: replaced, Replacement: replacement}
+		if oldData != nil {
+			if err := json.Unmarshal(oldData, updated); err != nil {
+				p.API.LogWarn("Failed to decode term corrections", "err", err.Error())
+				return
+			}
+		}
+		updated.Count++
+		updated.TeamID = teamID
+		updated.Example = original
+		suggest := !updated.Suggested && updated.Count >= termSuggestionThreshold
+		updated.Suggested = updated.Suggested || suggest
+
+		data, err := json.Marshal(updated)
+		if err != nil {
+			return
+		}
+
+		saved, appErr := p.API.KVSetWithOptions(key, data, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        oldData,
+			ExpireInSeconds: termCorrectionTTL,
+		})
+		if appErr != nil {
+			p.API.LogWarn("Failed to save term corrections", "err", appErr.Error())
+			return
+		}
+		if !saved {
+			continue
+		}
+
+		if suggest {
+			p.suggestGlossaryTerm(key, updated)
+		}
+		return
+	}
+}
+
+// suggestGlossaryTerm sends System Admins the term users corrected repeatedly, with buttons to
+// add it to the glossary of the team or to dismiss the suggestion.
+func (p *Plugin) suggestGlossaryTerm(key string, correction *termCorrection) {
+	admins, appErr := p.API.GetUsers(&model.UserGetOptions{Role: model.SYSTEM_ADMIN_ROLE_ID, Page: 0, PerPage: 100})
+	if appErr != nil {
+		p.API.LogError("Failed to get system admins", "err", appErr.Error())
+		return
+	}
+
+	teamName := correction.TeamID
+	if team, appErr := p.API.GetTeam(correction.TeamID); appErr == nil {
+		teamName = team.DisplayName
+	}
+
+	message := fmt.Sprintf("Users corrected the %s translation \"%s\" into \"%s\" %d times in **%s**, for example in:\n%s\n\nAdd the term to the glossary of the team so that it is translated this way from now on?",
+		languageName(correction.TargetLanguage), correction.Replaced, correction.Replacement, correction.Count, teamName, quoteText(correction.Example))
+
+	action := func(name, suggestionAction string) *model.PostAction {
+		return &model.PostAction{
+			Name: name,
+			Type: model.POST_ACTION_TYPE_BUTTON,
+			Integration: &model.PostActionIntegration{
+				URL: fmt.Sprintf("/plugins/%s/api/admin/term_suggestion", manifest.Id),
+				Context: map[string]interface{}{
+					"key":    key,
+					"action": suggestionAction,
+				},
+			},
+		}
+	}
+
+	for _, admin := range admins {
+		channel, appErr := p.API.GetDirectChannel(admin.Id, p.botUserID)
+		if appErr != nil {
+			continue
+		}
+
+		post := &model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channel.Id,
+			Message:   message,
+		}
+		model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+			Actions: []*model.PostAction{
+				action("Add to glossary", termSuggestionActionAdd),
+				action("Dismiss", termSuggestionActionDismiss),
+			},
+		}})
+
+		if _, appErr := p.API.CreatePost(post); appErr != nil {
+			p.API.LogWarn("Failed to suggest glossary term", "user_id", admin.Id, "err", appErr.Error())
+		}
+	}
+}
+
+// getTermCorrection returns the corrections of a suggested term, or nil when the suggestion was
+// answered already.
+func (p *Plugin) getTermCorrection(key string) *termCorrection {
+	if !strings.HasPrefix(key, termCorrectionKeyPrefix) {
+		return nil
+	}
+
+	var correction *termCorrection
+	if _, err := p.Helpers.KVGetJSON(key, &correction); err != nil || correction == nil || !correction.Suggested {
+		return nil
+	}
+
+	return correction
+}
+
+// handleTermSuggestion is the post action of the glossary suggestions: it opens a dialog for the
+// System Admin to confirm the term in the source language, or dismisses the suggestion.
+func (p *Plugin) handleTermSuggestion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to answer glossary suggestions", http.StatusForbidden)
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+	key, _ := request.Context["key"].(string)
+	suggestionAction, _ := request.Context["action"].(string)
+
+	respond := func(response *model.PostActionIntegrationResponse) {
+		resp, _ := json.Marshal(response)
+		w.Write(resp)
+	}
+
+	correction := p.getTermCorrection(key)
+	if correction == nil {
+		respond(&model.PostActionIntegrationResponse{EphemeralText: "This suggestion was answered already."})
+		return
+	}
+
+	switch suggestionAction {
+	case termSuggestionActionDismiss:
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			p.API.LogWarn("Failed to dismiss glossary suggestion", "err", appErr.Error())
+		}
+		respond(&model.PostActionIntegrationResponse{EphemeralText: "Suggestion dismissed."})
+	case termSuggestionActionAdd:
+		appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+			TriggerId: request.TriggerId,
+			URL:       fmt.Sprintf("/plugins/%s/api/admin/term_suggestion/submit", manifest.Id),
+			Dialog: model.Dialog{
+				CallbackId:       key,
+				Title:            "Add glossary term",
+				IntroductionText: fmt.Sprintf("Corrections replaced \"%s\" with \"%s\" in translations such as the one of:\n%s", correction.Replaced, correction.Replacement, quoteText(correction.Example)),
+				SubmitLabel:      "Add",
+				Elements: []model.DialogElement{{
+					DisplayName: fmt.Sprintf("Term in %s", languageName(correction.SourceLanguage)),
+					Name:        "source",
+					Type:        "text",
+					HelpText:    "The words of the original messages translated this way.",
+				}, {
+					DisplayName: fmt.Sprintf("Translation in %s", languageName(correction.TargetLanguage)),
+					Name:        "target",
+					Type:        "text",
+					Default:     correction.Replacement,
+				}},
+			},
+		})
+		if appErr != nil {
+			p.API.LogWarn("Failed to open glossary suggestion dialog", "err", appErr.Error())
+			respond(&model.PostActionIntegrationResponse{EphemeralText: "Failed to open the dialog."})
+			return
+		}
+		respond(&model.PostActionIntegrationResponse{})
+	default:
+		http.Error(w, "Invalid parameter: action", http.StatusBadRequest)
+	}
+}
+
+// handleTermSuggestionSubmission adds the term confirmed by the System Admin to the glossary of
+// the team where it was corrected.
+func (p *Plugin) handleTermSuggestionSubmission(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to answer glossary suggestions", http.StatusForbidden)
+		return
+	}
+
+	request := model.SubmitDialogRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid parameter: request", http.StatusBadRequest)
+		return
+	}
+
+	correction := p.getTermCorrection(request.CallbackId)
+	if correction == nil {
+		w.Write((&model.SubmitDialogResponse{Error: "This suggestion was answered already."}).ToJson())
+		return
+	}
+
+	source, _ := request.Submission["source"].(string)
+	target, _ := request.Submission["target"].(string)
+	term := glossaryTerm{
+		SourceLanguage: correction.SourceLanguage,
+		TargetLanguage: correction.TargetLanguage,
+		Source:         strings.TrimSpace(source),
+		Target:         strings.TrimSpace(target),
+	}
+	if err := term.validate(); err != nil {
+		w.Write((&model.SubmitDialogResponse{Error: err.Error()}).ToJson())
+		return
+	}
+
+	conflicts, err := p.addGlossaryTerms(newRequestID(), userID, glossaryScopeTeam, correction.TeamID, []glossaryTerm{term})
+	if err != nil {
+		w.Write((&model.SubmitDialogResponse{Error: err.Error()}).ToJson())
+		return
+	}
+
+	if appErr := p.API.KVDelete(request.CallbackId); appErr != nil {
+		p.API.LogWarn("Failed to delete answered glossary suggestion", "err", appErr.Error())
+	}
+
+	message := fmt.Sprintf("Added \"%s\" = \"%s\" to the glossary of the team.", term.Source, term.Target)
+	if len(conflicts) > 0 {
+		message += " Other glossaries translate this term differently, see /plugins/" + manifest.Id + "/api/admin/glossary_conflicts."
+	}
+	p.API.SendEphemeralPost(userID, &model.Post{
+		ChannelId: request.ChannelId,
+		Message:   message,
+	})
+
+	w.Write((&model.SubmitDialogResponse{}).ToJson())
+}
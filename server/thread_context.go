@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	threadContextKeyPrefix = "thread_ctx_"
+
+	// threadContextLength is the number of characters of the thread root given as context.
+	threadContextLength = 100
+)
+
+// threadContext is the translated excerpt of the root of a thread for a target language.
+type threadContext struct {
+	Text     string `json:"text"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+// threadExcerpt returns the first line of the message, without quote markers and cut to
+// threadContextLength characters.
+func threadExcerpt(message string) string {
+	newText, quoted := splitQuotes(message)
+	if newText == "" && len(quoted) > 0 {
+		newText = quoted[0]
+	}
+
+	line := strings.TrimSpace(strings.SplitN(newText, "\n", 2)[0])
+	if utf8.RuneCountInString(line) <= threadContextLength {
+		return line
+	}
+
+	return strings.TrimSpace(string([]rune(line)[:threadContextLength])) + "…"
+}
+
+// addThreadContext adds to the translation of a reply a translated excerpt of the root of its
+// thread, so that short replies make sense to the reader. The excerpt is cached per thread and
+// target language.
+func (p *Plugin) addThreadContext(requestID, userID, preferredProvider string, post *model.Post, translated *TranslatedMessage) {
+	if !p.getConfiguration().ThreadContextLine || post.RootId == "" {
+		return
+	}
+
+	root, appErr := p.API.GetPost(post.RootId)
+	if appErr != nil || root.DeleteAt != 0 {
+		return
+	}
+
+	excerpt := threadExcerpt(root.Message)
+	if excerpt == "" {
+		return
+	}
+
+	target := translated.TargetLanguage
+	key := threadContextKeyPrefix + root.Id + "_" + target
+
+	var cached threadContext
+	if ok, err := p.Helpers.KVGetJSON(key, &cached); err == nil && ok && cached.UpdateAt == root.UpdateAt {
+		translated.ThreadContext = cached.Text
+		return
+	}
+
+	detected, err := p.getPostLanguage(requestID, root)
+	if err != nil {
+		return
+	}
+
+	text := excerpt
+	if detected.Language != target {
+		if !p.getConfiguration().getAllowedPairs().allows(detected.Language, target) || p.blockedLanguage(excerpt, detected.Language) != "" {
+			return
+		}
+
+		var appErr *model.AppError
+		if text, appErr = p.translateText(requestID, preferredProvider, excerpt, detected.Language, target); appErr != nil {
+			p.API.LogWarn("Failed to translate thread context", "request_id", requestID, "root_id", root.Id, "err", appErr.Error())
+			return
+		}
+		p.recordUserUsage(userID, detected.Language, target, utf8.RuneCountInString(excerpt))
+	}
+
+	translated.ThreadContext = text
+	if err := p.Helpers.KVSetWithExpiryJSON(key, threadContext{Text: text, UpdateAt: root.UpdateAt}, translationTTL); err != nil {
+		p.API.LogWarn("Failed to cache thread context", "request_id", requestID, "root_id", root.Id, "err", err.Error())
+	}
+}
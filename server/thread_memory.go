@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	threadMemoryKeyPrefix = "thread_mem_"
+
+	// threadMemoryTTL is how long, in seconds, the translations of a thread are remembered after
+	// its last translated message.
+	threadMemoryTTL = 7 * 24 * 60 * 60
+
+	maxThreadMemoryEntries = 200
+
+	// providerThreadMemory is reported as the provider of a message translated entirely from
+	// the memory of its thread.
+	providerThreadMemory = "thread memory"
+)
+
+// threadMemoryKey returns the key of the memory of a thread for a language pair.
+func threadMemoryKey(rootID, sourceLang, targetLang string) string {
+	return threadMemoryKeyPrefix + rootID + "_" + languagePair(sourceLang, targetLang)
+}
+
+// translateInThread translates the message of a post. Within a thread, the translation of each
+// line is remembered and reused for the same line in later messages of the thread, so that
+// repeated terms and phrases are translated the same way throughout the conversation.
+func (p *Plugin) translateInThread(requestID, preferredProvider string, post *model.Post, sourceLang, targetLang string) (string, string, *model.AppError) {
+	if post.RootId == "" {
+		return p.translateTextWithProvider(requestID, preferredProvider, post.Message, sourceLang, targetLang, nil)
+	}
+
+	key := threadMemoryKey(post.RootId, sourceLang, targetLang)
+	memory := map[string]string{}
+	if _, err := p.Helpers.KVGetJSON(key, &memory); err != nil {
+		p.API.LogWarn("Failed to load thread memory", "request_id", requestID, "root_id", post.RootId, "err", err.Error())
+	}
+
+	lines := strings.Split(post.Message, "\n")
+	if translated, ok := recallLines(memory, lines); ok {
+		return translated, providerThreadMemory, nil
+	}
+
+	translatedText, provider, appErr := p.translateTextWithProvider(requestID, preferredProvider, post.Message, sourceLang, targetLang, p.getConversationContext(post))
+	if appErr != nil {
+		return "", "", appErr
+	}
+
+	// Lines can only be matched to their translation when the provider kept the line structure.
+	translatedLines := strings.Split(translatedText, "\n")
+	if len(translatedLines) != len(lines) {
+		return translatedText, provider, nil
+	}
+
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if remembered, ok := memory[line]; ok {
+			translatedLines[i] = remembered
+		} else if len(memory) < maxThreadMemoryEntries {
+			memory[line] = translatedLines[i]
+		}
+	}
+
+	if err := p.Helpers.KVSetWithExpiryJSON(key, memory, threadMemoryTTL); err != nil {
+		p.API.LogWarn("Failed to save thread memory", "request_id", requestID, "root_id", post.RootId, "err", err.Error())
+	}
+
+	return strings.Join(translatedLines, "\n"), provider, nil
+}
+
+// recallLines returns the translation of the lines when all of them are remembered.
+func recallLines(memory map[string]string, lines []string) (string, bool) {
+	translatedLines := make([]string, len(lines))
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		remembered, ok := memory[line]
+		if !ok {
+			return "", false
+		}
+		translatedLines[i] = remembered
+	}
+
+	return strings.Join(translatedLines, "\n"), true
+}
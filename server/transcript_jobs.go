@@ -0,0 +1,419 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/translate"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	transcriptJobKeyPrefix = "transcript_job_"
+
+	// transcriptJobMinBytes is the size of the transcripts translated with an asynchronous job,
+	// Amazon Translate translating at most 10,000 bytes per request.
+	transcriptJobMinBytes = 10000
+
+	transcriptJobPollInterval = time.Minute
+
+	// transcriptJobTimeout is how long a job may run before it is stopped, the transcript
+	// being translated cue by cue instead.
+	transcriptJobTimeout = 6 * time.Hour
+)
+
+// transcriptJob is an asynchronous Amazon Translate job translating a call transcript into a
+// language through files of the configured S3 bucket, one per cue. The cues are uploaded as
+// processed by the processing pipeline for the language, and the values the processors took
+// out of each cue are kept with the job to be put back in its translation. The job is kept
+// until its translation is posted, so that any server of the cluster, or the next instance of
+// the plugin, picks up its results.
+type transcriptJob struct {
+	JobID          string                `json:"job_id"`
+	RequestID      string                `json:"request_id"`
+	ChannelID      string                `json:"channel_id"`
+	RootID         string                `json:"root_id"`
+	Bucket         string                `json:"bucket"`
+	Prefix         string                `json:"prefix"`
+	SourceLanguage string                `json:"source_lang"`
+	TargetLanguage string                `json:"target_lang"`
+	Speakers       []string              `json:"speakers"`
+	Texts          []string              `json:"texts"`
+	Values         []map[string][]string `json:"values"`
+	StartedAt      int64                 `json:"started_at"`
+}
+
+func (j *transcriptJob) cues() []*transcriptCue {
+	cues := make([]*transcriptCue, len(j.Texts))
+	for i, text := range j.Texts {
+		cues[i] = &transcriptCue{speaker: j.Speakers[i], text: text}
+	}
+
+	return cues
+}
+
+// getTranscriptJobBucket returns the bucket and the key prefix of the files of translation
+// jobs, and false when jobs are not configured.
+func (c *configuration) getTranscriptJobBucket() (string, string, bool) {
+	bucket := strings.Trim(strings.TrimSpace(c.TranscriptJobBucket), "/")
+	if bucket == "" || strings.TrimSpace(c.TranscriptJobRoleARN) == "" {
+		return "", "", false
+	}
+
+	prefix := ""
+	if slash := strings.Index(bucket, "/"); slash >= 0 {
+		bucket, prefix = bucket[:slash], bucket[slash+1:]
+	}
+
+	return bucket, prefix, true
+}
+
+// transcriptCueObject returns the name of the file of a cue.
+func transcriptCueObject(index int) string {
+	return fmt.Sprintf("cue-%05d.txt", index)
+}
+
+func newTranscriptJobClients(configuration *configuration) (*translate.Translate, *s3.S3, error) {
+	sess := session.Must(session.NewSession())
+	creds := credentials.NewStaticCredentials(configuration.AWSAccessKeyID, configuration.AWSSecretAccessKey, "")
+	if _, err := creds.Get(); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid AWS credentials")
+	}
+
+	awsConfig := aws.NewConfig().WithCredentials(creds).WithRegion(configuration.AWSRegion)
+	return translate.New(sess, awsConfig), s3.New(sess, awsConfig), nil
+}
+
+// startTranscriptJobs starts a translation job of the transcript for each of the languages it
+// may be translated into, and returns the languages left to translate cue by cue: those the
+// checks of translations refuse, which the translation cue by cue reports, and those whose
+// job could not be started. Jobs are only started for transcripts of channels whose messages
+// may be sent to providers, and not in a blocked language.
+func (p *Plugin) startTranscriptJobs(requestID, channelID, rootID string, cues []*transcriptCue, languages []string) []string {
+	configuration := p.getConfiguration()
+	if _, _, ok := configuration.getTranscriptJobBucket(); !ok || p.isPrivateMessageExcluded(channelID) {
+		return languages
+	}
+
+	texts := make([]string, len(cues))
+	for i, cue := range cues {
+		texts[i] = cue.text
+	}
+	text := strings.Join(texts, "\n")
+
+	sourceLang, _, err := p.detectLanguageWithConfidence(requestID, text)
+	if err != nil || p.blockedLanguage(text, sourceLang) != "" {
+		return languages
+	}
+
+	var remaining []string
+	for _, language := range languages {
+		if language == sourceLang || !configuration.getAllowedPairs().allows(sourceLang, language) || !p.startTranscriptJob(requestID, channelID, rootID, sourceLang, language, cues) {
+			remaining = append(remaining, language)
+		}
+	}
+
+	return remaining
+}
+
+// startTranscriptJob uploads the cues of the transcript, processed for the target language, to
+// the bucket and starts a job translating them. It returns false, having removed what it
+// uploaded, when the job could not be started.
+func (p *Plugin) startTranscriptJob(requestID, channelID, rootID, sourceLang, targetLang string, cues []*transcriptCue) bool {
+	configuration := p.getConfiguration()
+	bucket, prefix, _ := configuration.getTranscriptJobBucket()
+
+	translateService, s3Service, err := newTranscriptJobClients(configuration)
+	if err != nil {
+		p.API.LogWarn("Failed to start transcript translation job", "request_id", requestID, "err", err.Error())
+		return false
+	}
+
+	job := &transcriptJob{
+		RequestID:      requestID,
+		ChannelID:      channelID,
+		RootID:         rootID,
+		Bucket:         bucket,
+		Prefix:         path.Join(prefix, "autotranslate", requestID, targetLang),
+		SourceLanguage: sourceLang,
+		TargetLanguage: targetLang,
+		StartedAt:      model.GetMillis(),
+	}
+
+	pipeline := configuration.getProcessingPipeline()
+	glossary := p.getChannelGlossary(channelID, sourceLang, targetLang)
+	for i, cue := range cues {
+		state := newProcessingState(sourceLang, targetLang)
+		state.glossary = glossary
+		processed := pipeline.before(cue.text, state)
+
+		job.Speakers = append(job.Speakers, cue.speaker)
+		job.Texts = append(job.Texts, cue.text)
+		job.Values = append(job.Values, state.values)
+
+		if _, err := s3Service.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(path.Join(job.Prefix, "input", transcriptCueObject(i))),
+			Body:        strings.NewReader(processed),
+			ContentType: aws.String("text/plain"),
+		}); err != nil {
+			p.API.LogWarn("Failed to upload call transcript", "request_id", requestID, "bucket", bucket, "err", err.Error())
+			p.deleteTranscriptJobFiles(s3Service, job)
+			return false
+		}
+	}
+
+	output, err := translateService.StartTextTranslationJob(&translate.StartTextTranslationJobInput{
+		ClientToken:       aws.String(requestID + "-" + targetLang),
+		JobName:           aws.String("autotranslate-" + requestID + "-" + targetLang),
+		DataAccessRoleArn: aws.String(strings.TrimSpace(configuration.TranscriptJobRoleARN)),
+		InputDataConfig: &translate.InputDataConfig{
+			S3Uri:       aws.String(fmt.Sprintf("s3://%s/%s/input/", bucket, job.Prefix)),
+			ContentType: aws.String("text/plain"),
+		},
+		OutputDataConfig: &translate.OutputDataConfig{
+			S3Uri: aws.String(fmt.Sprintf("s3://%s/%s/output/", bucket, job.Prefix)),
+		},
+		SourceLanguageCode:  aws.String(sourceLang),
+		TargetLanguageCodes: aws.StringSlice([]string{targetLang}),
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to start transcript translation job", "request_id", requestID, "language", targetLang, "err", err.Error())
+		p.deleteTranscriptJobFiles(s3Service, job)
+		return false
+	}
+	job.JobID = aws.StringValue(output.JobId)
+
+	value, err := p.atRest.sealJSON(job)
+	if err == nil {
+		if appErr := p.API.KVSet(transcriptJobKeyPrefix+job.JobID, value); appErr != nil {
+			err = appErr
+		}
+	}
+	if err != nil {
+		p.API.LogWarn("Failed to save transcript translation job", "request_id", requestID, "job_id", job.JobID, "err", err.Error())
+		translateService.StopTextTranslationJob(&translate.StopTextTranslationJobInput{JobId: output.JobId})
+		p.deleteTranscriptJobFiles(s3Service, job)
+		return false
+	}
+
+	p.API.LogInfo("Started transcript translation job", "request_id", requestID, "job_id", job.JobID, "cues", len(cues), "language", targetLang)
+	return true
+}
+
+// transcriptJobPoller periodically checks the translation jobs of transcripts, posting their
+// translations once they complete.
+type transcriptJobPoller struct {
+	plugin *Plugin
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTranscriptJobPoller(p *Plugin) *transcriptJobPoller {
+	return &transcriptJobPoller{
+		plugin: p,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (t *transcriptJobPoller) start() {
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(transcriptJobPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.plugin.safely("transcript translation jobs", t.plugin.pollTranscriptJobs)
+			}
+		}
+	}()
+}
+
+// close stops the poller, waiting for a running poll to finish.
+func (t *transcriptJobPoller) close() {
+	close(t.stop)
+	<-t.done
+}
+
+// pollTranscriptJobs checks the status of every translation job of transcripts.
+func (p *Plugin) pollTranscriptJobs() {
+	err := forEachKVKey(p.API, transcriptJobKeyPrefix, func(key string) error {
+		value, appErr := p.API.KVGet(key)
+		if appErr != nil || value == nil {
+			return nil
+		}
+
+		var job transcriptJob
+		if err := p.atRest.openJSON(value, &job); err != nil {
+			if err != errAtRestKeyUnavailable {
+				// A job encrypted with a previous key can no longer be read.
+				p.API.LogWarn("Dropping unreadable transcript translation job", "key", key, "err", err.Error())
+				p.API.KVCompareAndDelete(key, value)
+			}
+			return nil
+		}
+
+		p.pollTranscriptJob(key, value, &job)
+		return nil
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to list transcript translation jobs", "err", err.Error())
+	}
+}
+
+// pollTranscriptJob posts the translation of the job once it is done. A job that failed or ran
+// for too long is replaced with the translation of the transcript cue by cue.
+func (p *Plugin) pollTranscriptJob(key string, value []byte, job *transcriptJob) {
+	translateService, s3Service, err := newTranscriptJobClients(p.getConfiguration())
+	if err != nil {
+		p.API.LogWarn("Failed to poll transcript translation job", "request_id", job.RequestID, "job_id", job.JobID, "err", err.Error())
+		return
+	}
+
+	output, err := translateService.DescribeTextTranslationJob(&translate.DescribeTextTranslationJobInput{JobId: aws.String(job.JobID)})
+	if err != nil {
+		p.API.LogWarn("Failed to poll transcript translation job", "request_id", job.RequestID, "job_id", job.JobID, "err", err.Error())
+		return
+	}
+
+	completed := false
+	switch status := aws.StringValue(output.TextTranslationJobProperties.JobStatus); status {
+	case translate.JobStatusCompleted, translate.JobStatusCompletedWithError:
+		completed = true
+	case translate.JobStatusFailed, translate.JobStatusStopped:
+		p.API.LogWarn("Transcript translation job failed", "request_id", job.RequestID, "job_id", job.JobID, "status", status, "message", aws.StringValue(output.TextTranslationJobProperties.Message))
+	case translate.JobStatusStopRequested:
+		return
+	default:
+		if time.Since(time.Unix(0, job.StartedAt*int64(time.Millisecond))) < transcriptJobTimeout {
+			return
+		}
+		p.API.LogWarn("Stopping transcript translation job running for too long", "request_id", job.RequestID, "job_id", job.JobID)
+		translateService.StopTextTranslationJob(&translate.StopTextTranslationJobInput{JobId: aws.String(job.JobID)})
+	}
+
+	// The server deleting the job posts its translations.
+	if deleted, appErr := p.API.KVCompareAndDelete(key, value); appErr != nil || !deleted {
+		return
+	}
+	defer p.deleteTranscriptJobFiles(s3Service, job)
+
+	cues := job.cues()
+	if !completed {
+		p.translateTranscriptCues(job.RequestID, job.ChannelID, job.RootID, cues, []string{job.TargetLanguage})
+		return
+	}
+
+	translations, err := p.getTranscriptJobTranslations(s3Service, job)
+	if err != nil {
+		p.API.LogWarn("Failed to get transcript translations", "request_id", job.RequestID, "job_id", job.JobID, "err", err.Error())
+		p.translateTranscriptCues(job.RequestID, job.ChannelID, job.RootID, cues, []string{job.TargetLanguage})
+		return
+	}
+
+	// Translations are not posted to the thread of a call deleted meanwhile.
+	if p.isPostGone(job.RootID) {
+		return
+	}
+
+	pipeline := p.getConfiguration().getProcessingPipeline()
+	for i, translation := range translations {
+		if translation == "" || i >= len(job.Values) {
+			continue
+		}
+		state := newProcessingState(job.SourceLanguage, job.TargetLanguage)
+		state.values = job.Values[i]
+		translations[i] = pipeline.after(translation, state)
+	}
+
+	if p.usageTracker != nil {
+		p.usageTracker.add(transcriptSize(cues))
+	}
+	p.postTranscriptTranslation(job.RequestID, job.ChannelID, job.RootID, job.TargetLanguage, cues, translations)
+}
+
+// getTranscriptJobTranslations returns the translations of the cues the job wrote to the
+// bucket, empty for the cues it failed to translate. Amazon Translate names them after the cue,
+// prefixed with the language.
+func (p *Plugin) getTranscriptJobTranslations(s3Service *s3.S3, job *transcriptJob) ([]string, error) {
+	translations := make([]string, len(job.Texts))
+
+	var keys []string
+	err := s3Service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(path.Join(job.Prefix, "output") + "/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		name := path.Base(key)
+		var index int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(name, job.TargetLanguage+"."), "cue-%d.txt", &index); err != nil || !strings.HasPrefix(name, job.TargetLanguage+".") || index >= len(job.Texts) {
+			continue
+		}
+
+		object, err := s3Service.GetObject(&s3.GetObjectInput{Bucket: aws.String(job.Bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, err
+		}
+		text, err := ioutil.ReadAll(object.Body)
+		object.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		translations[index] = strings.TrimSpace(string(text))
+	}
+
+	return translations, nil
+}
+
+// deleteTranscriptJobFiles removes the files of the job from the bucket: the transcript and
+// its translations.
+func (p *Plugin) deleteTranscriptJobFiles(s3Service *s3.S3, job *transcriptJob) {
+	err := s3Service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(job.Prefix + "/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		if len(page.Contents) == 0 {
+			return true
+		}
+
+		objects := make([]*s3.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = &s3.ObjectIdentifier{Key: object.Key}
+		}
+		if _, err := s3Service.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(job.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		}); err != nil {
+			p.API.LogWarn("Failed to delete transcript translation files", "request_id", job.RequestID, "bucket", job.Bucket, "err", err.Error())
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to list transcript translation files", "request_id", job.RequestID, "bucket", job.Bucket, "err", err.Error())
+	}
+}
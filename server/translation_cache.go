@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	translationKeyPrefix = "trans_"
+
+	// translationTTL is how long, in seconds, the translation of a post is cached unless the
+	// System Admin set another retention period.
+	translationTTL = 7 * 24 * 60 * 60
+)
+
+// cachedTranslation is the translation of a version of a post into a language, as returned by
+// the provider before being personalized for the reader.
+type cachedTranslation struct {
+	TranslatedText string `json:"translated_text"`
+	Provider       string `json:"provider"`
+	UpdateAt       int64  `json:"update_at"`
+	CorrectedBy    string `json:"corrected_by,omitempty"`
+	CachedAt       int64  `json:"cached_at,omitempty"`
+}
+
+// getCachedTranslation returns the translation of the current version of the post, if it was
+// translated recently.
+func (p *Plugin) getCachedTranslation(post *model.Post, source, target string) *cachedTranslation {
+	cached, err := p.store.GetCachedTranslation(post.Id, source, target)
+	if err != nil || cached == nil || cached.UpdateAt != post.UpdateAt {
+		return nil
+	}
+
+	return cached
+}
+
+// cacheTranslation saves the translation of the current version of the post, so that other
+// readers of the same language are not billed for it again.
+func (p *Plugin) cacheTranslation(requestID string, post *model.Post, source, target string, translation *cachedTranslation) {
+	days := p.getConfiguration().getTranslationRetentionDays()
+	if days == 0 {
+		return
+	}
+
+	translation.CachedAt = model.GetMillis()
+	if err := p.store.SaveCachedTranslation(post.Id, source, target, translation, int64(days*secondsPerDay)); err != nil {
+		p.API.LogWarn("Failed to cache translation", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+	}
+
+	p.recordTranslationVersion(requestID, post, &translationVersion{
+		SourceLanguage: source,
+		TargetLanguage: target,
+		SourceText:     post.Message,
+		TranslatedText: translation.TranslatedText,
+		Provider:       translation.Provider,
+		CorrectedBy:    translation.CorrectedBy,
+		Shown:          translationShownToReader,
+	})
+}
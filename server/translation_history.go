@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+const (
+	// translationHistoryKeyPrefix must not start with translationKeyPrefix, whose keys the
+	// retention job reads as cached translations.
+	translationHistoryKeyPrefix = "trhist_"
+
+	// maxTranslationVersions caps the translations kept per post, the oldest being dropped.
+	maxTranslationVersions = 50
+
+	// translationShownInPost and translationShownToReader tell the translations shown in posts
+	// from those requested by readers.
+	translationShownInPost   = "post"
+	translationShownToReader = "reader"
+)
+
+// translationVersion is a translation of a version of a post, kept so that what a translation
+// said when it was read can be found after the post was edited or its translation corrected.
+type translationVersion struct {
+	UpdateAt       int64  `json:"update_at"`
+	EditAt         int64  `json:"edit_at"`
+	SourceLanguage string `json:"source_lang"`
+	TargetLanguage string `json:"target_lang"`
+	SourceText     string `json:"source_text"`
+	TranslatedText string `json:"translated_text"`
+	Provider       string `json:"provider,omitempty"`
+	CorrectedBy    string `json:"corrected_by,omitempty"`
+	Shown          string `json:"shown"`
+	RecordedAt     int64  `json:"recorded_at"`
+	// RequestID and IdempotencyKey identify the request that made the translation and the
+	// translation across the retries of that request, as found in the logs and events.
+	RequestID      string `json:"request_id,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+func translationHistoryKey(postID string) string {
+	return translationHistoryKeyPrefix + postID
+}
+
+// getTranslationHistory returns the translations kept for the post, oldest first, and the
+// stored value they were read from.
+func (p *Plugin) getTranslationHistory(postID string) ([]*translationVersion, []byte, error) {
+	value, appErr := p.API.KVGet(translationHistoryKey(postID))
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if value == nil {
+		return nil, nil, nil
+	}
+
+	var versions []*translationVersion
+	if err := p.atRest.openJSON(value, &versions); err != nil {
+		return nil, value, err
+	}
+
+	return versions, value, nil
+}
+
+// keptTranslationVersions returns the versions recorded at or after the time, in milliseconds.
+func keptTranslationVersions(versions []*translationVersion, since int64) []*translationVersion {
+	kept := make([]*translationVersion, 0, len(versions))
+	for _, version := range versions {
+		if version.RecordedAt >= since {
+			kept = append(kept, version)
+		}
+	}
+
+	return kept
+}
+
+// recordTranslationVersion adds a translation of the current version of the post to its
+// history, for as long as translations are retained.
+func (p *Plugin) recordTranslationVersion(requestID string, post *model.Post, version *translationVersion) {
+	days := p.getConfiguration().getTranslationRetentionDays()
+	if days == 0 || post.Id == "" {
+		return
+	}
+
+	now := time.Now()
+	version.UpdateAt = post.UpdateAt
+	version.EditAt = post.EditAt
+	version.RecordedAt = model.GetMillisForTime(now)
+	version.RequestID = requestID
+	version.IdempotencyKey = translationIdempotencyKey(post.Id, languagePair(version.SourceLanguage, version.TargetLanguage), post.UpdateAt)
+
+	for {
+		versions, oldValue, err := p.getTranslationHistory(post.Id)
+		if err == errAtRestKeyUnavailable {
+			return
+		}
+		if err != nil && oldValue == nil {
+			p.API.LogWarn("Failed to get translation history", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+			return
+		}
+
+		// A history encrypted with a previous key can no longer be read and starts over.
+		versions = keptTranslationVersions(versions, model.GetMillisForTime(now.AddDate(0, 0, -days)))
+		if last := len(versions) - 1; last >= 0 {
+			previous := versions[last]
+			if previous.UpdateAt == version.UpdateAt && previous.TargetLanguage == version.TargetLanguage && previous.TranslatedText == version.TranslatedText && previous.CorrectedBy == version.CorrectedBy {
+				return
+			}
+		}
+
+		versions = append(versions, version)
+		if len(versions) > maxTranslationVersions {
+			versions = versions[len(versions)-maxTranslationVersions:]
+		}
+
+		value, err := p.atRest.sealJSON(versions)
+		if err != nil {
+			p.API.LogWarn("Failed to encrypt translation history", "request_id", requestID, "post_id", post.Id, "err", err.Error())
+			return
+		}
+
+		saved, appErr := p.API.KVSetWithOptions(translationHistoryKey(post.Id), value, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        oldValue,
+			ExpireInSeconds: int64(days * secondsPerDay),
+		})
+		if appErr != nil {
+			p.API.LogWarn("Failed to save translation history", "request_id", requestID, "post_id", post.Id, "err", appErr.Error())
+			return
+		}
+		if saved {
+			return
+		}
+	}
+}
+
+// shownTranslation returns the original message of a post and the translation shown in it,
+// unless the post carries no translation or it was removed from the message.
+func shownTranslation(post *model.Post) (string, string, bool) {
+	if translation, ok := post.GetProp(propTranslation).(string); ok {
+		return post.Message, translation, true
+	}
+
+	length, ok := originalLength(post)
+	if !ok {
+		return "", "", false
+	}
+
+	// The translation follows the line of its banner.
+	bannerEnd := strings.Index(post.Message[length+2:], "\n")
+	if bannerEnd < 0 {
+		return "", "", false
+	}
+
+	return post.Message[:length], post.Message[length+2+bannerEnd+1:], true
+}
+
+// recordShownTranslation adds the translation shown in a saved post to its history.
+func (p *Plugin) recordShownTranslation(post *model.Post) {
+	pair, _ := post.GetProp(propTranslationLanguages).(string)
+	languages := strings.SplitN(pair, ":", 2)
+	if len(languages) != 2 {
+		return
+	}
+
+	original, translation, ok := shownTranslation(post)
+	if !ok {
+		return
+	}
+
+	p.recordTranslationVersion(newRequestID(), post, &translationVersion{
+		SourceLanguage: languages[0],
+		TargetLanguage: languages[1],
+		SourceText:     original,
+		TranslatedText: translation,
+		Shown:          translationShownInPost,
+	})
+}
+
+// MessageWillBeUpdated marks the translation shown in a post as outdated when its author edits
+// the original message, as it is not translated again: the translation remains the one of the
+// message before the edit, which clients can tell from the translation of an edited message.
+func (p *Plugin) MessageWillBeUpdated(c *plugin.Context, newPost, oldPost *model.Post) (updated *model.Post, rejection string) {
+	updated = newPost
+	defer p.recoverHookPanic("MessageWillBeUpdated")
+
+	if p.IsValid() != nil || p.isWatchdogTripped() {
+		return newPost, ""
+	}
+	if oldPost.GetProp(propTranslationLanguages) == nil || newPost.GetProp(propTranslationOutdated) != nil {
+		return newPost, ""
+	}
+
+	edited := false
+	if newPost.GetProp(propTranslation) != nil {
+		edited = newPost.Message != oldPost.Message
+	} else if newPost.GetProp(propTranslated) != nil {
+		oldOriginal, _, oldOK := shownTranslation(oldPost)
+		newOriginal, _, newOK := shownTranslation(newPost)
+		edited = !oldOK || !newOK || oldOriginal != newOriginal
+	}
+	if !edited {
+		return newPost, ""
+	}
+
+	newPost.AddProp(propTranslationOutdated, true)
+	return newPost, ""
+}
+
+// deleteTranslationHistoryBefore removes from the history of posts the translations recorded
+// before the time, and the histories that can no longer be read.
+func (p *Plugin) deleteTranslationHistoryBefore(before time.Time) {
+	recordedBefore := model.GetMillisForTime(before)
+
+	removed := 0
+	err := forEachKVKey(p.API, translationHistoryKeyPrefix, func(key string) error {
+		postID := strings.TrimPrefix(key, translationHistoryKeyPrefix)
+		versions, oldValue, err := p.getTranslationHistory(postID)
+		if err == errAtRestKeyUnavailable || oldValue == nil {
+			return nil
+		}
+
+		kept := keptTranslationVersions(versions, recordedBefore)
+		if err == nil && len(kept) == len(versions) {
+			return nil
+		}
+		removed += len(versions) - len(kept)
+
+		if err != nil || len(kept) == 0 {
+			if _, appErr := p.API.KVCompareAndDelete(key, oldValue); appErr != nil {
+				p.API.LogWarn("Failed to delete expired translation history", "key", key, "err", appErr.Error())
+			}
+			return nil
+		}
+
+		value, err := p.atRest.sealJSON(kept)
+		if err != nil {
+			return nil
+		}
+		if _, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{Atomic: true, OldValue: oldValue}); appErr != nil {
+			p.API.LogWarn("Failed to delete expired translation history", "key", key, "err", appErr.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to list translation histories", "err", err.Error())
+		return
+	}
+
+	if removed > 0 {
+		p.API.LogInfo("Removed expired translation history", "translations", removed)
+	}
+}
+
+// handleTranslationHistory returns the translations of a post the user can read, oldest first,
+// optionally only those into a language.
+func (p *Plugin) handleTranslationHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to read translation history", http.StatusUnauthorized)
+		return
+	}
+
+	post, appErr := p.API.GetPost(r.URL.Query().Get("post_id"))
+	if appErr != nil || !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		http.Error(w, "No post to read the translation history of", http.StatusBadRequest)
+		return
+	}
+
+	versions, _, err := p.getTranslationHistory(post.Id)
+	if err != nil {
+		http.Error(w, "Failed to read translation history", http.StatusInternalServerError)
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	filtered := make([]*translationVersion, 0, len(versions))
+	for _, version := range versions {
+		if target == "" || version.TargetLanguage == target {
+			filtered = append(filtered, version)
+		}
+	}
+
+	resp, _ := json.Marshal(filtered)
+	w.Write(resp)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	translationMemoryKeyPrefix = "tm_"
+
+	// translationMemoryTTL is how long, in seconds, a translation written by a person is reused
+	// after it was last written.
+	translationMemoryTTL = 90 * 24 * 60 * 60
+
+	// providerTranslationMemory is reported as the provider of a message translated from the
+	// translation memory.
+	providerTranslationMemory = "translation memory"
+)
+
+// isRecalledTranslation reports whether a translation came from a memory rather than from a
+// provider, and so cost nothing.
+func isRecalledTranslation(provider string) bool {
+	return provider == providerThreadMemory || provider == providerTranslationMemory || provider == providerBoilerplate
+}
+
+// translationMemoryKey returns the key of the translation of a text for a language pair. The
+// text is hashed to fit the length of keys.
+func translationMemoryKey(text, sourceLang, targetLang string) string {
+	sum := sha256.Sum256([]byte(languagePair(sourceLang, targetLang) + "\n" + strings.TrimSpace(text)))
+	return translationMemoryKeyPrefix + hex.EncodeToString(sum[:])[:40]
+}
+
+// rememberTranslation saves the translation of a text written by a person, so that the same
+// text is translated the same way from then on.
+func (p *Plugin) rememberTranslation(text, sourceLang, targetLang, translation string) error {
+	return p.Helpers.KVSetWithExpiryJSON(translationMemoryKey(text, sourceLang, targetLang), translation, translationMemoryTTL)
+}
+
+// recallTranslation returns the translation of the text saved in the translation memory, if any.
+func (p *Plugin) recallTranslation(requestID, text, sourceLang, targetLang string) (string, bool) {
+	var translation string
+	ok, err := p.Helpers.KVGetJSON(translationMemoryKey(text, sourceLang, targetLang), &translation)
+	if err != nil {
+		p.API.LogWarn("Failed to load translation memory", "request_id", requestID, "err", err.Error())
+		return "", false
+	}
+
+	return translation, ok && translation != ""
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	usageKeyPrefix  = "usage_"
+	suspensionKey   = "auto_translation_suspension"
+	usageMonthFmt   = "2006-01"
+	usageDayFmt     = "2006-01-02"
+	usageFlushEvery = 30 * time.Second
+
+	zeroRetentionKeyPrefix = "zero_retention_"
+)
+
+// monthlyUsage is the number of characters sent to providers in a month.
+type monthlyUsage struct {
+	Characters int64 `json:"characters"`
+}
+
+// autoTranslationSuspension records that auto-translation was suspended in a month because
+// usage crossed the threshold. Once an admin resumes it, it stays on for the rest of the month.
+type autoTranslationSuspension struct {
+	Month     string `json:"month"`
+	Suspended bool   `json:"suspended"`
+	ResumedBy string `json:"resumed_by,omitempty"`
+}
+
+// usageTracker counts characters in memory and periodically adds them to the monthly counter
+// in the KV store, checking the threshold at the same time.
+type usageTracker struct {
+	plugin *Plugin
+
+	lock    sync.Mutex
+	pending int64
+	// pendingZeroRetention counts the calls made to each provider in zero-retention mode.
+	pendingZeroRetention map[string]int64
+
+	// suspended caches the suspension state for the hot path.
+	suspended bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newUsageTracker(p *Plugin) *usageTracker {
+	return &usageTracker{
+		plugin: p,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (u *usageTracker) start() {
+	u.refreshSuspension()
+
+	go func() {
+		defer close(u.done)
+
+		ticker := time.NewTicker(usageFlushEvery)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-u.stop:
+				u.flush()
+				return
+			case <-ticker.C:
+				u.plugin.safely("usage flush", u.flush)
+			}
+		}
+	}()
+}
+
+// close persists the pending counts and stops the tracker.
+func (u *usageTracker) close() {
+	close(u.stop)
+	<-u.done
+}
+
+func (u *usageTracker) add(characters int) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.pending += int64(characters)
+}
+
+// addZeroRetentionCall counts a call made to the provider in zero-retention mode.
+func (u *usageTracker) addZeroRetentionCall(provider string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.pendingZeroRetention == nil {
+		u.pendingZeroRetention = map[string]int64{}
+	}
+	u.pendingZeroRetention[provider]++
+}
+
+func (u *usageTracker) isSuspended() bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return u.suspended
+}
+
+func (u *usageTracker) flush() {
+	u.lock.Lock()
+	pending := u.pending
+	u.pending = 0
+	pendingZeroRetention := u.pendingZeroRetention
+	u.pendingZeroRetention = nil
+	u.lock.Unlock()
+
+	u.flushZeroRetention(pendingZeroRetention)
+
+	month := time.Now().UTC().Format(usageMonthFmt)
+	if pending > 0 {
+		total, err := u.plugin.store.IncrementUsage(month, pending)
+		if err != nil {
+			u.plugin.API.LogError("Failed to persist usage", "err", err.Error())
+			u.add(int(pending))
+			return
+		}
+
+		threshold := u.plugin.getConfiguration().getMonthlyCharacterThreshold()
+		if threshold > 0 && total >= threshold {
+			u.plugin.suspendAutoTranslation(month, total, threshold)
+		}
+	}
+
+	u.refreshSuspension()
+}
+
+// flushZeroRetention adds the calls made in zero-retention mode to the counters of the day,
+// keeping those that failed to be saved for the next flush.
+func (u *usageTracker) flushZeroRetention(pending map[string]int64) {
+	day := time.Now().UTC().Format(usageDayFmt)
+	for provider, calls := range pending {
+		if err := u.plugin.store.AddZeroRetentionCalls(day, provider, calls); err != nil {
+			u.plugin.API.LogError("Failed to persist zero-retention calls", "provider", provider, "err", err.Error())
+			u.lock.Lock()
+			if u.pendingZeroRetention == nil {
+				u.pendingZeroRetention = map[string]int64{}
+			}
+			u.pendingZeroRetention[provider] += calls
+			u.lock.Unlock()
+		}
+	}
+}
+
+// refreshSuspension reloads the suspension state, which may have been changed by another node.
+func (u *usageTracker) refreshSuspension() {
+	suspension := u.plugin.getSuspension()
+	suspended := suspension != nil && suspension.Suspended && suspension.Month == time.Now().UTC().Format(usageMonthFmt)
+
+	u.lock.Lock()
+	u.suspended = suspended
+	u.lock.Unlock()
+}
+
+// getMonthlyCharacterThreshold returns the monthly usage above which auto-translation is
+// suspended, or 0 when there is no threshold.
+func (c *configuration) getMonthlyCharacterThreshold() int64 {
+	threshold, err := strconv.ParseInt(strings.TrimSpace(c.MonthlyCharacterThreshold), 10, 64)
+	if err != nil || threshold < 0 {
+		return 0
+	}
+
+	return threshold
+}
+
+func (p *Plugin) getSuspension() *autoTranslationSuspension {
+	var suspension *autoTranslationSuspension
+	if _, err := p.Helpers.KVGetJSON(suspensionKey, &suspension); err != nil {
+		p.API.LogWarn("Failed to get auto-translation suspension", "err", err.Error())
+		return nil
+	}
+
+	return suspension
+}
+
+// isAutoTranslationSuspended reports whether only on-demand translations are allowed.
+func (p *Plugin) isAutoTranslationSuspended() bool {
+	return p.usageTracker != nil && p.usageTracker.isSuspended()
+}
+
+// suspendAutoTranslation switches to on-demand-only mode for the month, unless it was already
+// decided for this month, and asks the system admins whether to resume.
+func (p *Plugin) suspendAutoTranslation(month string, total, threshold int64) {
+	suspension := &autoTranslationSuspension{Month: month, Suspended: true}
+
+	var oldValue interface{}
+	if old := p.getSuspension(); old != nil {
+		if old.Month == month {
+			return
+		}
+		oldValue = old
+	}
+
+	saved, err := p.Helpers.KVCompareAndSetJSON(suspensionKey, oldValue, suspension)
+	if err != nil || !saved {
+		return
+	}
+
+	p.API.LogWarn("Auto-translation suspended after crossing the monthly threshold", "characters", total, "threshold", threshold)
+	p.notifyAdminsOfSuspension(total, threshold)
+}
+
+func (p *Plugin) notifyAdminsOfSuspension(total, threshold int64) {
+	admins, appErr := p.API.GetUsers(&model.UserGetOptions{Role: model.SYSTEM_ADMIN_ROLE_ID, Page: 0, PerPage: 100})
+	if appErr != nil {
+		p.API.LogError("Failed to get system admins", "err", appErr.Error())
+		return
+	}
+
+	message := fmt.Sprintf("Auto-translation was switched to on-demand only: %d characters were translated this month, over the threshold of %d. Users can still translate posts from the post menu.", total, threshold)
+
+	for _, admin := range admins {
+		channel, appErr := p.API.GetDirectChannel(admin.Id, p.botUserID)
+		if appErr != nil {
+			continue
+		}
+
+		post := &model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channel.Id,
+			Message:   message,
+		}
+		model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+			Actions: []*model.PostAction{{
+				Name: "Re-enable auto-translation",
+				Type: model.POST_ACTION_TYPE_BUTTON,
+				Integration: &model.PostActionIntegration{
+					URL: fmt.Sprintf("/plugins/%s/api/admin/resume", manifest.Id),
+				},
+			}},
+		}})
+
+		if _, appErr := p.API.CreatePost(post); appErr != nil {
+			p.API.LogWarn("Failed to notify system admin", "user_id", admin.Id, "err", appErr.Error())
+		}
+	}
+}
+
+// resumeAutoTranslation is the post action re-enabling auto-translation for the rest of the
+// month.
+func (p *Plugin) resumeAutoTranslation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to resume auto-translation", http.StatusForbidden)
+		return
+	}
+
+	suspension := &autoTranslationSuspension{
+		Month:     time.Now().UTC().Format(usageMonthFmt),
+		ResumedBy: userID,
+	}
+	if err := p.Helpers.KVSetJSON(suspensionKey, suspension); err != nil {
+		http.Error(w, "Failed to resume auto-translation", http.StatusInternalServerError)
+		return
+	}
+
+	if p.usageTracker != nil {
+		p.usageTracker.refreshSuspension()
+	}
+
+	resp, _ := json.Marshal(&model.PostActionIntegrationResponse{
+		EphemeralText: "Auto-translation was re-enabled for the rest of the month.",
+	})
+	w.Write(resp)
+}
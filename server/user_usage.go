@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	userUsageKeyPrefix = "user_usage_"
+
+	// apiErrorQuotaExceeded reports that the user used up their monthly character quota.
+	apiErrorQuotaExceeded = "quota_exceeded"
+
+	maxUsageReportPairs = 5
+)
+
+// userUsage is the number of characters translated for a user in a month, in total and by
+// language pair.
+type userUsage struct {
+	Characters int64            `json:"characters"`
+	Pairs      map[string]int64 `json:"pairs"`
+}
+
+// pairUsage is the number of characters translated for a language pair.
+type pairUsage struct {
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+	Characters     int64  `json:"characters"`
+}
+
+// usageReport tells users how much they translated this month. Remaining is -1 when there is no
+// quota.
+type usageReport struct {
+	Month      string       `json:"month"`
+	Characters int64        `json:"characters"`
+	Quota      int64        `json:"quota"`
+	Remaining  int64        `json:"remaining"`
+	TopPairs   []*pairUsage `json:"top_pairs"`
+}
+
+// getUserMonthlyCharacterQuota returns the number of characters each user can have translated
+// in a month, or 0 when there is no quota.
+func (c *configuration) getUserMonthlyCharacterQuota() int64 {
+	quota, err := strconv.ParseInt(strings.TrimSpace(c.UserMonthlyCharacterQuota), 10, 64)
+	if err != nil || quota < 0 {
+		return 0
+	}
+
+	return quota
+}
+
+func (p *Plugin) getUserUsage(userID, month string) *userUsage {
+	usage, err := p.store.GetUserUsage(userID, month)
+	if err != nil {
+		p.API.LogWarn("Failed to get user usage", "user_id", userID, "err", err.Error())
+		return &userUsage{}
+	}
+
+	return usage
+}
+
+// isOverUserQuota reports whether the user used up their quota of the current month.
+func (p *Plugin) isOverUserQuota(userID string) bool {
+	quota := p.getConfiguration().getUserMonthlyCharacterQuota()
+	if quota == 0 {
+		return false
+	}
+
+	return p.getUserUsage(userID, time.Now().UTC().Format(usageMonthFmt)).Characters >= quota
+}
+
+// recordUserUsage atomically adds the characters translated for the user to their usage of the
+// current month. Failures are logged only, the translation is already done.
+func (p *Plugin) recordUserUsage(userID, sourceLang, targetLang string, characters int) {
+	month := time.Now().UTC().Format(usageMonthFmt)
+	if err := p.store.AddUserUsage(userID, month, languagePair(sourceLang, targetLang), int64(characters)); err != nil {
+		p.API.LogWarn("Failed to save user usage", "user_id", userID, "err", err.Error())
+	}
+}
+
+// getUsageReport returns the usage of the user in the current month.
+func (p *Plugin) getUsageReport(userID string) *usageReport {
+	month := time.Now().UTC().Format(usageMonthFmt)
+	usage := p.getUserUsage(userID, month)
+	quota := p.getConfiguration().getUserMonthlyCharacterQuota()
+
+	report := &usageReport{
+		Month:      month,
+		Characters: usage.Characters,
+		Quota:      quota,
+		Remaining:  -1,
+		TopPairs:   []*pairUsage{},
+	}
+	if quota > 0 {
+		report.Remaining = quota - usage.Characters
+		if report.Remaining < 0 {
+			report.Remaining = 0
+		}
+	}
+
+	for pair, characters := range usage.Pairs {
+		languages := strings.SplitN(pair, ":", 2)
+		if len(languages) != 2 {
+			continue
+		}
+		report.TopPairs = append(report.TopPairs, &pairUsage{SourceLanguage: languages[0], TargetLanguage: languages[1], Characters: characters})
+	}
+	sort.Slice(report.TopPairs, func(i, j int) bool {
+		return report.TopPairs[i].Characters > report.TopPairs[j].Characters
+	})
+	if len(report.TopPairs) > maxUsageReportPairs {
+		report.TopPairs = report.TopPairs[:maxUsageReportPairs]
+	}
+
+	return report
+}
+
+// getMyUsage returns the usage of the current month of the user.
+func (p *Plugin) getMyUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized to get usage", http.StatusUnauthorized)
+		return
+	}
+
+	resp, _ := json.Marshal(p.getUsageReport(userID))
+	w.Write(resp)
+}
+
+// quotaExceededError is returned for translations of users over their quota.
+func quotaExceededError() *APIErrorResponse {
+	return &APIErrorResponse{ID: apiErrorQuotaExceeded, Message: "You used up your monthly translation quota, see /autotranslate usage", StatusCode: http.StatusTooManyRequests}
+}
+
+// renderUsageReport formats the usage report for a command response.
+func renderUsageReport(report *usageReport) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Your translations this month (%s):\n * Characters translated: `%d`\n", report.Month, report.Characters)
+	if report.Quota > 0 {
+		fmt.Fprintf(&text, " * Remaining quota: `%d` of `%d`\n", report.Remaining, report.Quota)
+	} else {
+		text.WriteString(" * Remaining quota: `unlimited`\n")
+	}
+	for _, pair := range report.TopPairs {
+		fmt.Fprintf(&text, " * %s → %s: `%d`\n", languageName(pair.SourceLanguage), languageName(pair.TargetLanguage), pair.Characters)
+	}
+
+	return text.String()
+}
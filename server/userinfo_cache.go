@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+)
+
+// userInfoCacheTTL bounds how long a server of a cluster keeps user info changed on another
+// server. The plugin API this plugin is built against cannot publish cluster events, so the
+// servers cannot tell each other about changes.
+const userInfoCacheTTL = 30 * time.Second
+
+// cachedUserInfo is an entry of the user info cache. A nil info records that the user has none.
+type cachedUserInfo struct {
+	info     *UserInfo
+	loadedAt time.Time
+}
+
+// getCachedUserInfo returns the user info of the user, or nil when the user has none. The
+// returned info is shared and must not be modified; use getUserInfo to change it.
+func (p *Plugin) getCachedUserInfo(userID string) *UserInfo {
+	if cached, ok := p.userInfoCache.Load(userID); ok {
+		if entry := cached.(*cachedUserInfo); time.Since(entry.loadedAt) < userInfoCacheTTL {
+			return entry.info
+		}
+	}
+
+	userInfo, err := p.store.GetUserInfo(userID)
+	if err != nil {
+		// Do not remember a failed read.
+		return nil
+	}
+
+	p.userInfoCache.Store(userID, &cachedUserInfo{info: userInfo, loadedAt: time.Now()})
+
+	return userInfo
+}
+
+// cacheUserInfo replaces the cached info of the user with a copy of the saved info.
+func (p *Plugin) cacheUserInfo(userInfo *UserInfo) {
+	info := *userInfo
+	p.userInfoCache.Store(userInfo.UserID, &cachedUserInfo{info: &info, loadedAt: time.Now()})
+}
+
+// invalidateUserInfoCache forgets the cached info of every user.
+func (p *Plugin) invalidateUserInfoCache() {
+	p.userInfoCache.Range(func(key, _ interface{}) bool {
+		p.userInfoCache.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	watchdogKey = "hook_watchdog"
+
+	// maxHookCrashes is the number of crashes of the posting hooks within hookCrashWindow after
+	// which the watchdog turns auto-translation off.
+	maxHookCrashes  = 5
+	hookCrashWindow = 10 * time.Minute
+
+	// watchdogRefreshInterval is how often the state of the watchdog, which may have been changed
+	// by another node, is reloaded.
+	watchdogRefreshInterval = time.Minute
+)
+
+// watchdogTrip records that auto-translation was turned off because the posting hooks kept
+// crashing, until an admin turns it back on.
+type watchdogTrip struct {
+	Tripped   bool   `json:"tripped"`
+	Hook      string `json:"hook,omitempty"`
+	Panic     string `json:"panic,omitempty"`
+	TrippedAt int64  `json:"tripped_at,omitempty"`
+	ResumedBy string `json:"resumed_by,omitempty"`
+}
+
+// hookWatchdog counts the recent crashes of the posting hooks, and caches whether it turned
+// auto-translation off for the hot path.
+type hookWatchdog struct {
+	lock      sync.Mutex
+	crashes   []time.Time
+	tripped   bool
+	checkedAt time.Time
+}
+
+// recordCrash adds a crash and reports whether there were too many of them recently.
+func (w *hookWatchdog) recordCrash(now time.Time) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	recent := w.crashes[:0]
+	for _, crash := range w.crashes {
+		if now.Sub(crash) < hookCrashWindow {
+			recent = append(recent, crash)
+		}
+	}
+	w.crashes = append(recent, now)
+
+	return len(w.crashes) >= maxHookCrashes
+}
+
+func (w *hookWatchdog) setTripped(tripped bool, now time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.tripped = tripped
+	w.checkedAt = now
+	if !tripped {
+		w.crashes = nil
+	}
+}
+
+// recoverPanic keeps a panic of the calling goroutine from crashing the plugin. It must be
+// deferred directly. The fallback, when given, is run with the recovered value, for instance to
+// answer a request the panic left unanswered.
+func (p *Plugin) recoverPanic(where string, fallback func(recovered interface{})) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	p.API.LogError("Recovered from panic", "where", where, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+	if fallback != nil {
+		fallback(recovered)
+	}
+}
+
+// safely runs the function, recovering from its panics. Background workers run their work
+// through it so that a bug in one job does not stop them.
+func (p *Plugin) safely(where string, fn func()) {
+	defer p.recoverPanic(where, nil)
+
+	fn()
+}
+
+// recoverHookPanic is deferred by the posting hooks: besides recovering, it counts the crash and
+// turns auto-translation off when the hook keeps crashing, so that a bug of the plugin cannot
+// take message posting down.
+func (p *Plugin) recoverHookPanic(hook string) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	p.API.LogError("Recovered from panic", "where", hook, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+	if p.hookWatchdog.recordCrash(time.Now()) {
+		p.tripWatchdog(hook, recovered)
+	}
+}
+
+// isWatchdogTripped reports whether the watchdog turned auto-translation off.
+func (p *Plugin) isWatchdogTripped() bool {
+	w := &p.hookWatchdog
+	w.lock.Lock()
+	tripped, stale := w.tripped, time.Since(w.checkedAt) >= watchdogRefreshInterval
+	w.lock.Unlock()
+
+	if stale {
+		trip := p.getWatchdogTrip()
+		tripped = trip != nil && trip.Tripped
+		w.setTripped(tripped, time.Now())
+	}
+
+	return tripped
+}
+
+func (p *Plugin) getWatchdogTrip() *watchdogTrip {
+	var trip *watchdogTrip
+	if _, err := p.Helpers.KVGetJSON(watchdogKey, &trip); err != nil {
+		p.API.LogWarn("Failed to get hook watchdog state", "err", err.Error())
+		return nil
+	}
+
+	return trip
+}
+
+// tripWatchdog turns auto-translation off on every node and alerts the System Admins, unless
+// another crash did it already.
+func (p *Plugin) tripWatchdog(hook string, recovered interface{}) {
+	p.hookWatchdog.setTripped(true, time.Now())
+
+	var oldValue interface{}
+	if old := p.getWatchdogTrip(); old != nil {
+		if old.Tripped {
+			return
+		}
+		oldValue = old
+	}
+
+	trip := &watchdogTrip{
+		Tripped:   true,
+		Hook:      hook,
+		Panic:     fmt.Sprint(recovered),
+		TrippedAt: model.GetMillis(),
+	}
+	saved, err := p.Helpers.KVCompareAndSetJSON(watchdogKey, oldValue, trip)
+	if err != nil || !saved {
+		return
+	}
+
+	p.API.LogError("Auto-translation turned off after repeated crashes", "hook", hook, "crashes", maxHookCrashes, "window", hookCrashWindow.String())
+	p.notifyAdminsOfWatchdogTrip(trip)
+}
+
+func (p *Plugin) notifyAdminsOfWatchdogTrip(trip *watchdogTrip) {
+	admins, appErr := p.API.GetUsers(&model.UserGetOptions{Role: model.SYSTEM_ADMIN_ROLE_ID, Page: 0, PerPage: 100})
+	if appErr != nil {
+		p.API.LogError("Failed to get system admins", "err", appErr.Error())
+		return
+	}
+
+	message := fmt.Sprintf("Auto-translation was turned off: the plugin crashed %d times within %s in `%s`, last with `%s`. Messages are posted untranslated and users can still translate posts from the post menu. See the server logs for the details.",
+		maxHookCrashes, hookCrashWindow, trip.Hook, trip.Panic)
+
+	for _, admin := range admins {
+		channel, appErr := p.API.GetDirectChannel(admin.Id, p.botUserID)
+		if appErr != nil {
+			continue
+		}
+
+		post := &model.Post{
+			UserId:    p.botUserID,
+			ChannelId: channel.Id,
+			Message:   message,
+		}
+		model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+			Actions: []*model.PostAction{{
+				Name: "Re-enable auto-translation",
+				Type: model.POST_ACTION_TYPE_BUTTON,
+				Integration: &model.PostActionIntegration{
+					URL: fmt.Sprintf("/plugins/%s/api/admin/watchdog_resume", manifest.Id),
+				},
+			}},
+		}})
+
+		if _, appErr := p.API.CreatePost(post); appErr != nil {
+			p.API.LogWarn("Failed to notify system admin", "user_id", admin.Id, "err", appErr.Error())
+		}
+	}
+}
+
+// resumeAfterWatchdog is the post action turning auto-translation back on after the watchdog
+// turned it off.
+func (p *Plugin) resumeAfterWatchdog(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		http.Error(w, "Not authorized to resume auto-translation", http.StatusForbidden)
+		return
+	}
+
+	if err := p.Helpers.KVSetJSON(watchdogKey, &watchdogTrip{ResumedBy: userID}); err != nil {
+		http.Error(w, "Failed to resume auto-translation", http.StatusInternalServerError)
+		return
+	}
+	p.hookWatchdog.setTripped(false, time.Now())
+
+	resp, _ := json.Marshal(&model.PostActionIntegrationResponse{
+		EphemeralText: "Auto-translation was re-enabled. It is turned off again if the plugin keeps crashing.",
+	})
+	w.Write(resp)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	wsEventInfoChange = "info_change"
+	// wsEventInfoRefresh tells the listed users to fetch their info again, when it was changed
+	// for many members of a team or channel at once.
+	wsEventInfoRefresh = "info_refresh"
+
+	// wsBatchInterval is how long events are held back so bursts aimed at the same user or
+	// channel go out as a single WebSocket message.
+	wsBatchInterval = 250 * time.Millisecond
+	wsBatchSuffix   = "_batch"
+)
+
+// wsCoalescedEvents lists events for which only the latest payload per target matters, along
+// with the field of the payload naming what the payload is about.
+var wsCoalescedEvents = map[string]string{
+	wsEventInfoChange:         "user_id",
+	wsEventTranslationPartial: "post_id",
+}
+
+type wsEventKey struct {
+	event     string
+	userID    string
+	channelID string
+	teamID    string
+}
+
+func (k wsEventKey) broadcast() *model.WebsocketBroadcast {
+	return &model.WebsocketBroadcast{UserId: k.userID, ChannelId: k.channelID, TeamId: k.teamID}
+}
+
+// wsBatcher buffers WebSocket events per event name and broadcast target. A single pending
+// event is published unchanged, while several are sent as one "<event>_batch" event carrying
+// the JSON encoded payloads in its "items" field.
+type wsBatcher struct {
+	plugin *Plugin
+
+	lock    sync.Mutex
+	pending map[wsEventKey][]map[string]interface{}
+	order   []wsEventKey
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWSBatcher(p *Plugin) *wsBatcher {
+	return &wsBatcher{
+		plugin:  p,
+		pending: map[wsEventKey][]map[string]interface{}{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (b *wsBatcher) start() {
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(wsBatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stop:
+				b.flush()
+				return
+			case <-ticker.C:
+				b.plugin.safely("WebSocket batch", b.flush)
+			}
+		}
+	}()
+}
+
+// close flushes the pending events and stops the batcher. Events added afterwards are
+// published right away.
+func (b *wsBatcher) close() {
+	b.lock.Lock()
+	b.closed = true
+	b.lock.Unlock()
+
+	close(b.stop)
+	<-b.done
+}
+
+func (b *wsBatcher) add(key wsEventKey, payload map[string]interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		b.plugin.API.PublishWebSocketEvent(key.event, payload, key.broadcast())
+		return
+	}
+
+	items, ok := b.pending[key]
+	if !ok {
+		b.order = append(b.order, key)
+	}
+
+	if field, ok := wsCoalescedEvents[key.event]; ok {
+		for i, item := range items {
+			if item[field] == payload[field] {
+				items[i] = payload
+				return
+			}
+		}
+	}
+
+	b.pending[key] = append(items, payload)
+}
+
+func (b *wsBatcher) flush() {
+	b.lock.Lock()
+	pending, order := b.pending, b.order
+	b.pending = map[wsEventKey][]map[string]interface{}{}
+	b.order = nil
+	b.lock.Unlock()
+
+	for _, key := range order {
+		broadcast := key.broadcast()
+
+		items := pending[key]
+		if len(items) == 1 {
+			b.plugin.API.PublishWebSocketEvent(key.event, items[0], broadcast)
+			continue
+		}
+
+		encoded, err := json.Marshal(items)
+		if err != nil {
+			b.plugin.API.LogError("Failed to encode WebSocket batch", "event", key.event, "err", err.Error())
+			continue
+		}
+
+		b.plugin.API.PublishWebSocketEvent(key.event+wsBatchSuffix, map[string]interface{}{
+			"count": len(items),
+			"items": string(encoded),
+		}, broadcast)
+	}
+}
+
+// publishToUser queues a WebSocket event for a single user.
+func (p *Plugin) publishToUser(event, userID string, payload map[string]interface{}) {
+	p.publish(wsEventKey{event: event, userID: userID}, payload)
+}
+
+// publishToChannel queues a WebSocket event for every member of a channel, which is what
+// channel-wide features should use instead of publishing once per member.
+func (p *Plugin) publishToChannel(event, channelID string, payload map[string]interface{}) {
+	p.publish(wsEventKey{event: event, channelID: channelID}, payload)
+}
+
+// publishToTeam queues a WebSocket event for every member of a team.
+func (p *Plugin) publishToTeam(event, teamID string, payload map[string]interface{}) {
+	p.publish(wsEventKey{event: event, teamID: teamID}, payload)
+}
+
+func (p *Plugin) publish(key wsEventKey, payload map[string]interface{}) {
+	if p.wsBatcher == nil {
+		p.API.PublishWebSocketEvent(key.event, payload, key.broadcast())
+		return
+	}
+
+	p.wsBatcher.add(key, payload)
+}
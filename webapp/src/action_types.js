@@ -2,5 +2,6 @@ import PluginId from './plugin_id';
 
 // Namespace your actions to avoid collisions.
 export const INFO_CHANGE = PluginId + '_info_change';
+export const SAVE_DETECTION = PluginId + '_save_detection';
 export const SAVE_TRANSLATED_POST = PluginId + '_save_translated_post';
 export const SAVE_TRANSLATION = PluginId + '_save_translation';
@@ -2,6 +2,7 @@ import {getPost} from 'mattermost-redux/selectors/entities/posts';
 import {getCurrentUserId} from 'mattermost-redux/selectors/entities/users';
 
 import {
+    getDetections,
     getTranslatedPosts,
     getTranslations,
     getUserInfo,
@@ -9,16 +10,32 @@ import {
 
 import {
     INFO_CHANGE,
+    SAVE_DETECTION,
     SAVE_TRANSLATED_POST,
     SAVE_TRANSLATION,
 } from './action_types';
 
 import Client from './clients';
 
+// userInfoETag matches the ETag the server sends for the user info.
+const userInfoETag = (userInfo) => {
+    if (!userInfo || !userInfo.update_at) {
+        return '';
+    }
+
+    return `"${userInfo.user_id}-${userInfo.update_at}"`;
+};
+
 export const getInfo = () => {
-    return async (dispatch) => {
+    return async (dispatch, getState) => {
         try {
-            const data = await Client.getInfo();
+            const current = getUserInfo(getState());
+            const data = await Client.getInfo(userInfoETag(current));
+            if (current && (!data || !data.user_id)) {
+                // Not modified since the last fetch.
+                return {data: current};
+            }
+
             dispatch({type: INFO_CHANGE, data});
 
             return {data};
@@ -28,7 +45,33 @@ export const getInfo = () => {
     };
 };
 
-export const getTranslatedMessage = (postId) => {
+// pendingDetections holds the posts whose language is being detected, so that each is requested
+// once.
+const pendingDetections = new Set();
+
+export const detectPostLanguage = (postId) => {
+    return async (dispatch, getState) => {
+        const post = getPost(getState(), postId);
+        const detection = getDetections(getState())[postId];
+        if (!post || (detection && detection.update_at === post.update_at) || pendingDetections.has(postId)) {
+            return {data: detection};
+        }
+
+        pendingDetections.add(postId);
+        try {
+            const data = await Client.getDetect(postId);
+            dispatch({type: SAVE_DETECTION, data});
+
+            return {data};
+        } catch (error) {
+            return {error};
+        } finally {
+            pendingDetections.delete(postId);
+        }
+    };
+};
+
+export const getTranslatedMessage = (postId, retried = false) => {
     return async (dispatch, getState) => {
         const state = getState();
 
@@ -69,6 +112,20 @@ export const getTranslatedMessage = (postId) => {
             const text = errorText.replace(/[\n\t\r]/g, ' ');
             const errorData = {errorMessage: text, show: true, post_id: postId};
 
+            // Translation errors are sent as JSON, with an ID telling them apart.
+            try {
+                const apiError = JSON.parse(errorText);
+                errorData.errorMessage = apiError.message;
+                errorData.errorId = apiError.id;
+
+                // Throttled translations are retried once, when the provider accepts requests again.
+                if (apiError.retry_after && !retried) {
+                    setTimeout(() => dispatch(getTranslatedMessage(postId, true)), apiError.retry_after * 1000);
+                }
+            } catch (e) {
+                // Other errors are plain text.
+            }
+
             dispatch(saveTranslatedPost(errorData));
             return {error: true};
         }
@@ -80,6 +137,17 @@ export const getTranslatedMessage = (postId) => {
     };
 };
 
+export const requestDMTranslation = (postId) => {
+    return async () => {
+        try {
+            const data = await Client.postDMTranslation(postId);
+            return {data};
+        } catch (error) {
+            return {error};
+        }
+    };
+};
+
 export const saveTranslatedPost = (data) => {
     return (dispatch) => {
         dispatch({type: SAVE_TRANSLATED_POST, data});
@@ -109,3 +177,104 @@ export const websocketInfoChange = (message) => {
         dispatch({type: INFO_CHANGE, data: message.data});
     };
 };
+
+// websocketInfoRefresh fetches the info of the current user again when the server changed it
+// along with the info of other members of a team or channel.
+export const websocketInfoRefresh = (message) => {
+    return (dispatch, getState) => {
+        const userIds = message.data.user_ids.split(',');
+        if (!userIds.includes(getCurrentUserId(getState()))) {
+            return;
+        }
+
+        dispatch(getInfo());
+    };
+};
+
+// websocketTranslationPartial shows the translation of a long post as the server produces it,
+// unless the complete translation already arrived.
+export const websocketTranslationPartial = (message) => {
+    return (dispatch, getState) => {
+        const {
+            post_id: postId,
+            target_lang: target,
+            translated_text: text,
+        } = message.data;
+
+        const current = getTranslatedPosts(getState())[postId];
+        if (current && current.id && current.target_lang === target) {
+            return;
+        }
+
+        dispatch(saveTranslatedPost({post_id: postId, target_lang: target, translated_text: text, show: true, partial: true}));
+    };
+};
+
+// websocketTranslationComplete shows the translation of a post queued for asynchronous
+// translation once the server is done with it.
+export const websocketTranslationComplete = (message) => {
+    return (dispatch) => {
+        const translation = {...message.data};
+
+        // WebSocket payloads only carry plain values, so the previews are sent as JSON.
+        if (translation.permalink_previews) {
+            translation.permalink_previews = JSON.parse(translation.permalink_previews);
+        }
+
+        dispatch(saveTranslatedPost({...translation, show: true}));
+        dispatch(saveTranslation(translation));
+    };
+};
+
+// websocketTranslationFailed shows why a post queued for asynchronous translation could not be
+// translated, unless a translation of the post to the same language is already shown.
+export const websocketTranslationFailed = (message) => {
+    return (dispatch, getState) => {
+        const {
+            post_id: postId,
+            target_lang: target,
+            message: errorMessage,
+        } = message.data;
+
+        const current = getTranslatedPosts(getState())[postId];
+        if (current && current.id && current.target_lang === target) {
+            return;
+        }
+
+        dispatch(saveTranslatedPost({post_id: postId, target_lang: target, errorMessage, show: true}));
+    };
+};
+
+export const websocketReactionAdded = (message) => {
+    return async (dispatch, getState) => {
+        const reaction = JSON.parse(message.data.reaction);
+        if (reaction.user_id !== getCurrentUserId(getState())) {
+            return {data: null};
+        }
+
+        try {
+            const data = await Client.postReaction(reaction.post_id, reaction.emoji_name);
+            return {data};
+        } catch (error) {
+            return {error};
+        }
+    };
+};
+
+const FLAGGED_POST_PREFIX = 'flagged_post--';
+
+export const requestSavedDigest = () => {
+    return async (dispatch, getState) => {
+        const preferences = getState().entities.preferences.myPreferences;
+        const postIds = Object.keys(preferences).
+            filter((key) => key.startsWith(FLAGGED_POST_PREFIX)).
+            map((key) => key.substring(FLAGGED_POST_PREFIX.length));
+
+        try {
+            const data = await Client.postSavedDigest(postIds);
+            return {data};
+        } catch (error) {
+            return {error};
+        }
+    };
+};
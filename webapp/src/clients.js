@@ -14,14 +14,39 @@ class ClientClass {
         return this.doGet(this.url + '/go' + buildQueryString({post_id: postId, source, target}));
     }
 
-    getInfo = async () => {
-        return this.doGet(`${this.url}/get_info`);
+    getDetect = async (postId) => {
+        return this.doGet(this.url + '/detect' + buildQueryString({post_id: postId}));
+    }
+
+    getInfo = async (etag) => {
+        const headers = {};
+        if (etag) {
+            headers['If-None-Match'] = etag;
+        }
+
+        return this.doGet(`${this.url}/get_info`, headers);
+    }
+
+    getPrivacy = async () => {
+        return this.doGet(`${this.url}/privacy`);
     }
 
     postInfo = async (info) => {
         return this.doPost(`${this.url}/set_info`, info);
     }
 
+    postSavedDigest = async (postIds) => {
+        return this.doPost(`${this.url}/saved_digest`, {post_ids: postIds});
+    }
+
+    postDMTranslation = async (postId) => {
+        return this.doPost(`${this.url}/dm_translation`, {post_id: postId});
+    }
+
+    postReaction = async (postId, emojiName) => {
+        return this.doPost(`${this.url}/reaction`, {post_id: postId, emoji_name: emojiName});
+    }
+
     doGet = async (url, headers = {}) => {
         headers['X-Requested-With'] = 'XMLHttpRequest';
 
@@ -0,0 +1,12 @@
+import ErrorBoundary from './error_boundary';
+import MenuItem from './menu_item';
+
+const DMTranslationMenuItem = () => {
+    return (
+        <ErrorBoundary>
+            <MenuItem text='Send me the translation'/>
+        </ErrorBoundary>
+    );
+};
+
+export default DMTranslationMenuItem;
@@ -1,7 +1,7 @@
 import React from 'react';
 import PropTypes from 'prop-types';
 
-const MenuItem = ({activated}) => {
+const MenuItem = ({activated, text}) => {
     if (!activated) {
         return null;
     }
@@ -14,13 +14,18 @@ const MenuItem = ({activated}) => {
             <span className='MenuItem__icon'>
                 <i className='icon fa fa-language'/>
             </span>
-            <span>{'Translate'}</span>
+            <span>{text}</span>
         </button>
     );
 };
 
 MenuItem.propTypes = {
     activated: PropTypes.bool,
+    text: PropTypes.string,
+};
+
+MenuItem.defaultProps = {
+    text: 'Translate',
 };
 
 export default MenuItem;
@@ -14,3 +14,13 @@ test('should render Translate menu when activated', async () => {
     render(<MenuItem activated={true}/>);
     expect(screen.getByText(/Translate/i)).toBeInTheDocument();
 });
+
+test('should render the given text', async () => {
+    render(
+        <MenuItem
+            activated={true}
+            text='Send me the translation'
+        />,
+    );
+    expect(screen.getByText('Send me the translation')).toBeInTheDocument();
+});
@@ -1,6 +1,8 @@
 import {connect} from 'react-redux';
 import {bindActionCreators} from 'redux';
 
+import {getPost} from 'mattermost-redux/selectors/entities/posts';
+
 import {getUserInfo, getTranslatedPosts} from 'selectors';
 import {hideTranslatedMessage} from 'actions';
 
@@ -10,9 +12,20 @@ const mapStateToProps = (state, ownProps) => {
     const userInfo = getUserInfo(state);
     const activated = userInfo && userInfo.activated ? userInfo.activated : false;
 
+    // Posts of users in the props-toggle display mode carry their translation, which is the one
+    // of the message before it was edited when it is outdated.
+    const post = getPost(state, ownProps.postId);
+    const props = post && post.props ? post.props : {};
+    const postTranslation = props.autotranslate_translation ? {
+        banner: props.autotranslate_banner,
+        text: props.autotranslate_translation,
+        outdated: Boolean(props.autotranslate_translation_outdated),
+    } : null;
+
     return {
         activated,
         translation: getTranslatedPosts(state)[ownProps.postId],
+        postTranslation,
     };
 };
 
@@ -5,6 +5,7 @@ export default class TranslatedMessage extends React.PureComponent {
     static propTypes = {
         activated: PropTypes.bool.isRequired,
         translation: PropTypes.object,
+        postTranslation: PropTypes.object,
         hideTranslatedMessage: PropTypes.func.isRequired,
         onHeightChange: PropTypes.func,
     }
@@ -13,6 +14,10 @@ export default class TranslatedMessage extends React.PureComponent {
         activated: false,
     }
 
+    state = {
+        expanded: false,
+    }
+
     componentDidUpdate(prevProps) {
         if (this.props.translation &&
             prevProps.translation &&
@@ -27,6 +32,38 @@ export default class TranslatedMessage extends React.PureComponent {
         this.props.onHeightChange(1);
     }
 
+    handleToggleTranslation = () => {
+        this.setState((state) => ({expanded: !state.expanded}));
+        if (this.props.onHeightChange) {
+            this.props.onHeightChange(1);
+        }
+    }
+
+    renderPostTranslation() {
+        const {postTranslation} = this.props;
+
+        if (!this.state.expanded) {
+            return (
+                <p>
+                    <i className='icon fa fa-language'/>
+                    <a onClick={this.handleToggleTranslation}>{'  Show translation'}</a>
+                </p>
+            );
+        }
+
+        return (
+            <p>
+                <i className='icon fa fa-language'/>
+                <span>{`  ${postTranslation.banner}\n`}</span>
+                <span>{`${postTranslation.text}  `}</span>
+                {postTranslation.outdated &&
+                    <span style={{opacity: 0.7}}>{'(translation of the message before it was edited)  '}</span>
+                }
+                <a onClick={this.handleToggleTranslation}>{'(hide)'}</a>
+            </p>
+        );
+    }
+
     renderMessage(message) {
         return (
             <React.Fragment>
@@ -40,10 +77,10 @@ export default class TranslatedMessage extends React.PureComponent {
     }
 
     render() {
-        const {translation, activated} = this.props;
+        const {translation, activated, postTranslation} = this.props;
 
         if (!activated || !translation || !translation.show) {
-            return null;
+            return postTranslation ? this.renderPostTranslation() : null;
         }
 
         if (translation.errorMessage) {
@@ -55,7 +92,24 @@ export default class TranslatedMessage extends React.PureComponent {
         return this.renderMessage(
             <React.Fragment>
                 <span>{'  See translation:\n'}</span>
-                <span>{`${translation.translated_text}  `}</span>
+                {translation.thread_context &&
+                    <span style={{display: 'block', opacity: 0.7}}>{`↳ ${translation.thread_context}`}</span>
+                }
+                <span>{`${translation.translated_text}${translation.partial ? '…' : ''}  `}</span>
+                {translation.romanized_text &&
+                    <span style={{opacity: 0.7}}>{`(${translation.romanized_text})  `}</span>
+                }
+                {translation.corrected_by &&
+                    <span style={{opacity: 0.7}}>{`(corrected by ${translation.corrected_by})  `}</span>
+                }
+                {translation.permalink_previews && translation.permalink_previews.map((preview) => (
+                    <span
+                        key={preview.post_id}
+                        style={{display: 'block', opacity: 0.7}}
+                    >
+                        {`> ${preview.translated_text}`}
+                    </span>
+                ))}
             </React.Fragment>,
         );
     }
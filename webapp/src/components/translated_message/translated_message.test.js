@@ -78,3 +78,28 @@ test('should render translated message', async () => {
     expect(onHeightChange).toHaveBeenCalledTimes(1);
     expect(onHeightChange).toHaveBeenCalledWith(1);
 });
+
+test('should toggle the translation carried by the post', async () => {
+    const hideTranslatedMessage = jest.fn();
+    const onHeightChange = jest.fn();
+    const postTranslation = {
+        banner: '(Translated: Japanese → English)',
+        text: 'Good morning',
+    };
+
+    render(
+        <TranslatedMessage
+            postTranslation={postTranslation}
+            hideTranslatedMessage={hideTranslatedMessage}
+            onHeightChange={onHeightChange}
+        />,
+    );
+    expect(screen.queryByText(/Good morning/)).toBeNull();
+
+    fireEvent.click(screen.getByText(/Show translation/i));
+    expect(screen.getByText(/Good morning/)).toBeInTheDocument();
+    expect(onHeightChange).toHaveBeenCalledWith(1);
+
+    fireEvent.click(screen.getByText(/hide/i));
+    expect(screen.queryByText(/Good morning/)).toBeNull();
+});
@@ -3,17 +3,39 @@ import React from 'react';
 import {getPost} from 'mattermost-redux/selectors/entities/posts';
 
 import PostMessageAttachment from './components/post_message_attachment';
+import DMTranslationMenuItem from './components/dm_translation_menu_item';
 import TranslateMenuItem from './components/translate_menu_item';
 
 import PluginId from './plugin_id';
 
 import {
+    detectPostLanguage,
     getTranslatedMessage,
     getInfo,
+    requestDMTranslation,
+    requestSavedDigest,
     websocketInfoChange,
+    websocketInfoRefresh,
+    websocketReactionAdded,
+    websocketTranslationComplete,
+    websocketTranslationFailed,
+    websocketTranslationPartial,
 } from './actions';
 import reducer from './reducer';
-import {getUserInfo} from './selectors';
+import {getDetections, getUserInfo} from './selectors';
+
+// registerPluginEventHandler registers the handler of a WebSocket event of the plugin. The server
+// sends bursts of events as a single "<event>_batch" event carrying their JSON encoded payloads in
+// its "items" field, so the handler is also called for each of them.
+const registerPluginEventHandler = (registry, event, handler) => {
+    registry.registerWebSocketEventHandler('custom_' + PluginId + '_' + event, handler);
+    registry.registerWebSocketEventHandler(
+        'custom_' + PluginId + '_' + event + '_batch',
+        (message) => {
+            JSON.parse(message.data.items).forEach((data) => handler({...message, data}));
+        },
+    );
+};
 
 export default class AWSTranslatePlugin {
     // eslint-disable-next-line no-unused-vars
@@ -27,6 +49,28 @@ export default class AWSTranslatePlugin {
         registry.registerPostDropdownMenuAction(
             <TranslateMenuItem/>,
             (postId) => store.dispatch(getTranslatedMessage(postId)),
+            (postId) => {
+                const state = store.getState();
+                const post = getPost(state, postId);
+                const userInfo = getUserInfo(state);
+                if (!post || post.type !== '' || !userInfo || !userInfo.activated) {
+                    return false;
+                }
+
+                // Hide the action for posts already written in the language of the user.
+                const detection = getDetections(state)[postId];
+                if (!detection || detection.update_at !== post.update_at) {
+                    store.dispatch(detectPostLanguage(postId));
+                    return true;
+                }
+
+                return detection.language !== userInfo.target_language;
+            },
+        );
+
+        registry.registerPostDropdownMenuAction(
+            <DMTranslationMenuItem/>,
+            (postId) => store.dispatch(requestDMTranslation(postId)),
             (postId) => {
                 const state = store.getState();
                 const post = getPost(state, postId);
@@ -35,13 +79,63 @@ export default class AWSTranslatePlugin {
             },
         );
 
-        registry.registerWebSocketEventHandler(
-            'custom_' + PluginId + '_info_change',
+        registerPluginEventHandler(
+            registry,
+            'info_change',
             (message) => {
                 store.dispatch(websocketInfoChange(message));
             },
         );
 
+        registerPluginEventHandler(
+            registry,
+            'info_refresh',
+            (message) => {
+                store.dispatch(websocketInfoRefresh(message));
+            },
+        );
+
+        registerPluginEventHandler(
+            registry,
+            'translation_partial',
+            (message) => {
+                store.dispatch(websocketTranslationPartial(message));
+            },
+        );
+
+        registerPluginEventHandler(
+            registry,
+            'translation_complete',
+            (message) => {
+                store.dispatch(websocketTranslationComplete(message));
+            },
+        );
+
+        registerPluginEventHandler(
+            registry,
+            'translation_failed',
+            (message) => {
+                store.dispatch(websocketTranslationFailed(message));
+            },
+        );
+
+        registry.registerWebSocketEventHandler(
+            'reaction_added',
+            (message) => {
+                store.dispatch(websocketReactionAdded(message));
+            },
+        );
+
+        // The server cannot list saved posts, so hand them over when the digest is requested.
+        registry.registerSlashCommandWillBePostedHook((message, args) => {
+            if (message.trim() === '/autotranslate saved') {
+                store.dispatch(requestSavedDigest());
+                return {};
+            }
+
+            return {message, args};
+        });
+
         // Fetch the current status whenever we recover an internet connection.
         registry.registerReconnectHandler(() => {
             store.dispatch(getInfo());
@@ -2,6 +2,7 @@ import {combineReducers} from 'redux';
 
 import {
     INFO_CHANGE,
+    SAVE_DETECTION,
     SAVE_TRANSLATED_POST,
     SAVE_TRANSLATION,
 } from './action_types';
@@ -42,7 +43,21 @@ const translations = (state = {}, action) => {
     }
 };
 
+const detections = (state = {}, action) => {
+    switch (action.type) {
+    case SAVE_DETECTION: {
+        const nextState = {};
+        nextState[action.data.post_id] = action.data;
+
+        return {...state, ...nextState};
+    }
+    default:
+        return state;
+    }
+};
+
 export default combineReducers({
+    detections,
     translatedPosts,
     translations,
     userInfo,